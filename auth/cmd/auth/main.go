@@ -12,6 +12,7 @@ import (
 	"github.com/eac0de/xandy/auth/internal/grpcserver"
 	"github.com/eac0de/xandy/auth/internal/services"
 	"github.com/eac0de/xandy/auth/internal/storage"
+	"github.com/eac0de/xandy/shared/pkg/emailsender"
 
 	"github.com/gin-gonic/gin"
 )
@@ -66,17 +67,17 @@ func main() {
 	}
 	defer authStorage.Close()
 
-	var smsSender smssender.ISMSSender
+	var emailSender emailsender.IEmailSender
 	if cfg.IsDev {
-		smsSender = smssender.NewMock()
+		emailSender = emailsender.NewMock()
 	} else {
-		smsSender = smssender.New(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword)
+		emailSender = emailsender.New(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword)
 	}
 
 	sessionService := services.NewSessionService(cfg.JWTSecretKey, cfg.JWTAccessExp, cfg.JWTRefreshExp, authStorage)
-	authService := services.NewAuthService(authStorage, smsSender)
+	authService := services.NewAuthService(authStorage, emailSender)
 
-	gprcAuthServer := grpcserver.NewAuthGRPCServer(cfg.GPRCServerAddress, sessionService)
+	gprcAuthServer := grpcserver.NewAuthGRPCServer(cfg.GPRCServerAddress, sessionService, authService)
 	go gprcAuthServer.Run()
 
 	r := setupRouter(sessionService, authService)
@@ -53,3 +53,6 @@ require (
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20241015192408-796eee8c2d53 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+// shared лежит в этом же репозитории, сервис собирается вместе с его текущим кодом
+replace github.com/eac0de/xandy/shared => ../shared
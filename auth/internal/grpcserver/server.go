@@ -4,12 +4,17 @@ import (
 	"context"
 	"log"
 	"net"
+	"net/http"
 
 	"github.com/eac0de/xandy/auth/internal/services"
 	pb "github.com/eac0de/xandy/auth/proto"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
 
+	"github.com/google/uuid"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
 )
 
 type gprcAuthServer struct {
@@ -17,13 +22,15 @@ type gprcAuthServer struct {
 
 	Addr           string
 	sessionService *services.SessionService
+	authService    *services.AuthService
 }
 
-func NewAuthGRPCServer(addr string, sessionService *services.SessionService) *gprcAuthServer {
+func NewAuthGRPCServer(addr string, sessionService *services.SessionService, authService *services.AuthService) *gprcAuthServer {
 	return &gprcAuthServer{
 
 		Addr:           addr,
 		sessionService: sessionService,
+		authService:    authService,
 	}
 }
 
@@ -35,6 +42,39 @@ func (s *gprcAuthServer) AuthUser(ctx context.Context, req *pb.AuthUserRequest)
 	return &pb.AuthUserResponse{UserId: claims.UserID.String()}, nil
 }
 
+func (s *gprcAuthServer) GetUserByEmail(ctx context.Context, req *pb.GetUserByEmailRequest) (*pb.UserResponse, error) {
+	user, err := s.authService.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.UserResponse{UserId: user.ID.String(), Email: user.Email}, nil
+}
+
+func (s *gprcAuthServer) GetUserByID(ctx context.Context, req *pb.GetUserByIDRequest) (*pb.UserResponse, error) {
+	userID, err := uuid.Parse(req.UserId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid user id")
+	}
+	user, err := s.authService.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.UserResponse{UserId: user.ID.String(), Email: user.Email}, nil
+}
+
+// grpcError переводит код ответа httperror в код gRPC, чтобы клиент мог отличить отсутствие пользователя от сбоя
+func grpcError(err error) error {
+	msg, statusCode := httperror.GetMessageAndStatusCode(err)
+	switch statusCode {
+	case http.StatusNotFound:
+		return status.Error(codes.NotFound, msg)
+	case http.StatusBadRequest:
+		return status.Error(codes.InvalidArgument, msg)
+	default:
+		return status.Error(codes.Internal, msg)
+	}
+}
+
 func (s *gprcAuthServer) Run() {
 	listen, err := net.Listen("tcp", s.Addr)
 	if err != nil {
@@ -6,11 +6,12 @@ import (
 	"math/rand"
 	"net/http"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/eac0de/xandy/auth/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/emailsender"
 	"github.com/eac0de/xandy/shared/pkg/httperror"
-	"github.com/eac0de/xandy/shared/pkg/smssender"
 
 	"github.com/google/uuid"
 )
@@ -25,14 +26,17 @@ type AuthStore interface {
 
 	InsertUser(ctx context.Context, user *models.User) error
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error)
+
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
 type AuthService struct {
 	AuthStore   AuthStore
-	emailSender smssender.ISMSSender
+	emailSender emailsender.IEmailSender
 }
 
-func NewAuthService(authStore AuthStore, emailSender smssender.ISMSSender) *AuthService {
+func NewAuthService(authStore AuthStore, emailSender emailsender.IEmailSender) *AuthService {
 	return &AuthService{
 		AuthStore:   authStore,
 		emailSender: emailSender,
@@ -104,23 +108,32 @@ func (as *AuthService) VerifyEmailCode(
 			http.StatusPreconditionFailed,
 		)
 	}
+	var user *models.User
 	var isNewUser bool
-	user, err := as.AuthStore.GetUserByEmail(ctx, emailCode.Email)
-	if err != nil {
-		_, statusCode := httperror.GetMessageAndStatusCode(err)
-		if statusCode != http.StatusNotFound {
-			return nil, false, err
-		}
-		user, err = as.CreateUser(
-			ctx,
-			emailCode.Email,
-		)
+	// Пользователь создаётся и код удаляется в одной транзакции
+	err = as.AuthStore.WithTx(ctx, func(ctx context.Context) error {
+		// При конфликте транзакция повторяется, пользователь мог появиться с прошлой попытки
+		isNewUser = false
+		user, err = as.AuthStore.GetUserByEmail(ctx, emailCode.Email)
 		if err != nil {
-			return nil, false, err
+			_, statusCode := httperror.GetMessageAndStatusCode(err)
+			if statusCode != http.StatusNotFound {
+				return err
+			}
+			user, err = as.CreateUser(
+				ctx,
+				emailCode.Email,
+			)
+			if err != nil {
+				return err
+			}
+			isNewUser = true
 		}
-		isNewUser = true
+		return as.AuthStore.DeleteEmailCode(ctx, emailCode.ID)
+	})
+	if err != nil {
+		return nil, false, err
 	}
-	as.AuthStore.DeleteEmailCode(ctx, emailCode.ID)
 	return user, isNewUser, nil
 }
 
@@ -140,3 +153,16 @@ func (as *AuthService) CreateUser(ctx context.Context, email string) (*models.Us
 	}
 	return user, nil
 }
+
+// GetUserByEmail ищет пользователя для других сервисов, например чтобы поделиться с ним записью
+func (as *AuthService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !emailRegexp.MatchString(email) {
+		return nil, httperror.New(nil, "Email is not valid", http.StatusBadRequest)
+	}
+	return as.AuthStore.GetUserByEmail(ctx, email)
+}
+
+func (as *AuthService) GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	return as.AuthStore.GetUserByID(ctx, userID)
+}
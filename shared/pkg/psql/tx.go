@@ -0,0 +1,148 @@
+package psql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type txKey struct{}
+
+// Транзакция, начатая WithTx, и действия, отложенные до её фиксации
+type txState struct {
+	tx          pgx.Tx
+	afterCommit []func()
+}
+
+func txFromContext(ctx context.Context) *txState {
+	state, _ := ctx.Value(txKey{}).(*txState)
+	return state
+}
+
+// Сколько раз WithTx выполняет транзакцию, которую сервер отменил из-за конфликта
+const maxTxAttempts = 3
+
+// WithTx выполняет fn в транзакции. Exec, Query и QueryRow с контекстом, который получает fn,
+// выполняются в этой транзакции, поэтому методы хранилищ участвуют в ней без изменений.
+// Если fn вернула ошибку, транзакция откатывается. Вызов внутри другой транзакции
+// открывает точку сохранения: ошибка fn откатывает только сделанное в ней.
+func (storage *PSQLStorage) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return storage.WithTxOptions(ctx, pgx.TxOptions{}, fn)
+}
+
+// WithTxOptions как WithTx, но с уровнем изоляции и режимом доступа из opts.
+// При ошибке сериализации или взаимной блокировке транзакция повторяется целиком,
+// поэтому fn может выполниться несколько раз. Во вложенном вызове opts не действуют.
+func (storage *PSQLStorage) WithTxOptions(ctx context.Context, opts pgx.TxOptions, fn func(ctx context.Context) error) error {
+	if parent := txFromContext(ctx); parent != nil {
+		return withSavepoint(ctx, parent, fn)
+	}
+	var err error
+	for attempt := 0; attempt < maxTxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(time.Duration(attempt*attempt) * 10 * time.Millisecond):
+			}
+		}
+		err = storage.runTx(ctx, opts, fn)
+		if !isRetryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (storage *PSQLStorage) runTx(ctx context.Context, opts pgx.TxOptions, fn func(ctx context.Context) error) error {
+	tx, err := storage.Pool.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	state := &txState{tx: tx}
+	if err := fn(context.WithValue(ctx, txKey{}, state)); err != nil {
+		tx.Rollback(context.WithoutCancel(ctx))
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	for _, fn := range state.afterCommit {
+		fn()
+	}
+	return nil
+}
+
+func withSavepoint(ctx context.Context, parent *txState, fn func(ctx context.Context) error) error {
+	savepoint, err := parent.tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	state := &txState{tx: savepoint}
+	if err := fn(context.WithValue(ctx, txKey{}, state)); err != nil {
+		savepoint.Rollback(context.WithoutCancel(ctx))
+		return err
+	}
+	if err := savepoint.Commit(ctx); err != nil {
+		return err
+	}
+	// Отложенные действия выполнятся, только если зафиксируется и внешняя транзакция
+	parent.afterCommit = append(parent.afterCommit, state.afterCommit...)
+	return nil
+}
+
+// isRetryable сообщает, что сервер отменил транзакцию из-за конфликта с другой
+// и её можно повторить: serialization_failure или deadlock_detected
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == "40001" || pgErr.Code == "40P01"
+}
+
+// InTx сообщает, что ctx относится к транзакции WithTx
+func InTx(ctx context.Context) bool {
+	return txFromContext(ctx) != nil
+}
+
+// WithoutTx возвращает ctx, запросы с которым выполняются вне транзакции ctx.
+// Нужен отложенным через AfterCommit действиям: к их запуску транзакция уже завершена
+func WithoutTx(ctx context.Context) context.Context {
+	return context.WithValue(ctx, txKey{}, (*txState)(nil))
+}
+
+// AfterCommit откладывает fn до фиксации транзакции ctx, при откате fn не выполняется.
+// Так делают то, что откатом не отменить, например удаляют файлы. Без транзакции fn выполняется сразу.
+func AfterCommit(ctx context.Context, fn func()) {
+	state := txFromContext(ctx)
+	if state == nil {
+		fn()
+		return
+	}
+	state.afterCommit = append(state.afterCommit, fn)
+}
+
+func (storage *PSQLStorage) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	if state := txFromContext(ctx); state != nil {
+		return state.tx.Exec(ctx, sql, arguments...)
+	}
+	return storage.Pool.Exec(ctx, sql, arguments...)
+}
+
+func (storage *PSQLStorage) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if state := txFromContext(ctx); state != nil {
+		return state.tx.Query(ctx, sql, args...)
+	}
+	return storage.Pool.Query(ctx, sql, args...)
+}
+
+func (storage *PSQLStorage) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if state := txFromContext(ctx); state != nil {
+		return state.tx.QueryRow(ctx, sql, args...)
+	}
+	return storage.Pool.QueryRow(ctx, sql, args...)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/eac0de/xandy/internal/services"
+)
+
+// Утилита загружает экспорт стороннего менеджера паролей в xandy и печатает отчёт по каждой записи.
+//
+//	xandy-import -token <access token> -format bitwarden_json -file export.json -dry-run
+func main() {
+	server := flag.String("server", "http://localhost:8081", "xandy server address")
+	token := flag.String("token", os.Getenv("XANDY_TOKEN"), "access token (default $XANDY_TOKEN)")
+	format := flag.String("format", "", "export format: bitwarden_json, keepass_xml, keepass_kdbx, 1pux, chrome_csv, firefox_csv")
+	path := flag.String("file", "", "path to the export file")
+	password := flag.String("password", os.Getenv("XANDY_IMPORT_PASSWORD"), "KeePass master password (default $XANDY_IMPORT_PASSWORD)")
+	dryRun := flag.Bool("dry-run", false, "only show what would be imported")
+	flag.Parse()
+
+	if *token == "" || *format == "" || *path == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	report, err := upload(*server, *token, *format, *path, *password, *dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	printReport(report)
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func upload(server, token, format, path, password string, dryRun bool) (*services.ImportReport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("format", format)
+	writer.WriteField("dry_run", strconv.FormatBool(dryRun))
+	if password != "" {
+		writer.WriteField("password", password)
+	}
+	fileWriter, err := writer.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(fileWriter, file); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(server, "/")+"/api/xandy/import/", body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		var errorResponse struct {
+			Detail string `json:"detail"`
+		}
+		json.NewDecoder(resp.Body).Decode(&errorResponse)
+		return nil, fmt.Errorf("import failed (%d): %s", resp.StatusCode, errorResponse.Detail)
+	}
+	var report services.ImportReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func printReport(report *services.ImportReport) {
+	for _, item := range report.Items {
+		line := fmt.Sprintf("%4d  %-10s %-9s %s", item.Index, item.Status, item.Kind, item.Name)
+		if item.Error != "" {
+			line += " - " + item.Error
+		}
+		fmt.Println(line)
+	}
+	if report.DryRun {
+		fmt.Printf("\nDry run: %d total, %d ready, %d duplicates, %d errors\n", report.Total, report.Ready, report.Duplicates, report.Failed)
+		return
+	}
+	fmt.Printf("\n%d total, %d created, %d duplicates, %d errors\n", report.Total, report.Created, report.Duplicates, report.Failed)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/eac0de/xandy/internal/config"
+	"github.com/eac0de/xandy/internal/importers"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/internal/services"
+	"github.com/eac0de/xandy/internal/storage"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+// runImport импортирует экспорт стороннего менеджера паролей пользователю:
+// ./xandy import -user <id> -format bitwarden_json [-dry-run] <файл или - для stdin>.
+// Пароль зашифрованного экспорта берётся из XANDY_IMPORT_PASSWORD, чтобы не попасть в список процессов.
+// Отчёт в JSON выводится в stdout, код выхода 1 означает, что часть записей не импортирована.
+func runImport(ctx context.Context, cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	userIDString := flags.String("user", "", "id of the user who receives the records")
+	format := flags.String("format", "", "export format: bitwarden_json, keepass_xml, keepass_kdbx, 1pux, chrome_csv, firefox_csv")
+	dryRun := flags.Bool("dry-run", false, "only report what would be imported")
+	flags.Parse(args)
+
+	userID, err := uuid.Parse(*userIDString)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid -user:", err)
+		return 2
+	}
+	if *format == "" || flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: xandy import -user <id> -format <format> [-dry-run] <file>")
+		return 2
+	}
+	var data []byte
+	if path := flags.Arg(0); path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	xandyStorage, err := storage.NewxandyStorage(
+		ctx,
+		cfg.PSQLHost,
+		cfg.PSQLPort,
+		cfg.PSQLUsername,
+		cfg.PSQLPassword,
+		cfg.PSQLDBName,
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer xandyStorage.Close()
+	if err := xandyStorage.Migrate(ctx, "./migrations", false); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	blobs, err := newBlobStore(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	quotaService := services.NewQuotaService(xandyStorage, services.Quotas{
+		MaxFileSize:       cfg.MaxFileSize,
+		MaxStorage:        cfg.UserStorageQuota,
+		MaxRecordsPerKind: cfg.MaxRecordsPerKind,
+	})
+	importService := services.NewImportService(
+		xandyStorage,
+		services.NewFileContentStore(blobs, xandyStorage),
+		quotaService,
+		services.NewAuditService(xandyStorage),
+	)
+
+	// В журнале аудита импорт из командной строки отличается от импорта через API
+	ctx = services.WithAuditActor(ctx, models.AuditActor{UserAgent: "xandy import"})
+	report, err := importService.Import(ctx, userID, importers.Format(*format), data, os.Getenv("XANDY_IMPORT_PASSWORD"), *dryRun)
+	if err != nil {
+		msg, _ := httperror.GetMessageAndStatusCode(err)
+		fmt.Fprintln(os.Stderr, msg)
+		return 2
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -2,15 +2,21 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
 	"github.com/eac0de/xandy/internal/api/handlers"
+	"github.com/eac0de/xandy/internal/authclient"
+	"github.com/eac0de/xandy/internal/blobstore"
 	"github.com/eac0de/xandy/internal/config"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/internal/scanner"
 	"github.com/eac0de/xandy/internal/services"
 	"github.com/eac0de/xandy/internal/storage"
+	"github.com/eac0de/xandy/shared/pkg/emailsender"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 
@@ -20,47 +26,211 @@ import (
 func setupRouter(
 	authServiceConn *grpc.ClientConn,
 	userDataService *services.UserDataService,
+	batchService *services.BatchService,
+	importService *services.ImportService,
+	vaultService *services.VaultService,
+	uploadService *services.UploadService,
+	fileArchiveService *services.FileArchiveService,
+	quotaService *services.QuotaService,
+	shareService *services.ShareService,
+	organizationService *services.OrganizationService,
+	shareLinkService *services.ShareLinkService,
+	emergencyAccessService *services.EmergencyAccessService,
+	reminderService *services.ReminderService,
+	webhookService *services.WebhookService,
+	auditService *services.AuditService,
+	idempotencyService *services.IdempotencyService,
+	maxFileSize int64,
 ) *gin.Engine {
 	router := gin.Default()
 	rootGroup := router.Group("api/xandy/")
-	authenticatedGroup := rootGroup.Group("/", outmiddlewares.NewAuthMiddleware(authServiceConn))
+	auditActor := handlers.AuditActor()
+	authenticatedGroup := rootGroup.Group("/", outmiddlewares.NewAuthMiddleware(authServiceConn), auditActor)
 
 	userDataHandlers := handlers.NewUserDataHandlers(userDataService)
+	batchHandlers := handlers.NewBatchHandlers(batchService)
+	importHandlers := handlers.NewImportHandlers(importService)
+	vaultHandlers := handlers.NewVaultHandlers(vaultService)
+	uploadHandlers := handlers.NewUploadHandlers(uploadService)
+	attachmentHandlers := handlers.NewAttachmentHandlers(userDataService)
+	fileArchiveHandlers := handlers.NewFileArchiveHandlers(fileArchiveService)
+	usageHandlers := handlers.NewUsageHandlers(quotaService)
+	shareHandlers := handlers.NewShareHandlers(shareService)
+	organizationHandlers := handlers.NewOrganizationHandlers(organizationService)
+	shareLinkHandlers := handlers.NewShareLinkHandlers(shareLinkService)
+	emergencyAccessHandlers := handlers.NewEmergencyAccessHandlers(emergencyAccessService)
+	reminderHandlers := handlers.NewReminderHandlers(reminderService)
+	webhookHandlers := handlers.NewWebhookHandlers(webhookService)
+	auditHandlers := handlers.NewAuditHandlers(auditService)
+	maxUploadSize := handlers.MaxUploadSize(maxFileSize)
+	idempotent := handlers.Idempotency(idempotencyService, maxFileSize)
 
 	authenticatedGroup.GET("/auth_info/", userDataHandlers.GetUserAuthInfoList)
 	authenticatedGroup.GET("/auth_info/:id/", userDataHandlers.GetUserAuthInfo)
 	authenticatedGroup.DELETE("/auth_info/:id/", userDataHandlers.DeleteUserAuthInfo)
 	authenticatedGroup.PUT("/auth_info/:id/", userDataHandlers.UpdateUserAuthInfo)
-	authenticatedGroup.POST("/auth_info/", userDataHandlers.InsertUserAuthInfo)
+	authenticatedGroup.POST("/auth_info/", idempotent, userDataHandlers.InsertUserAuthInfo)
 
 	authenticatedGroup.GET("/text_data/", userDataHandlers.GetUserTextDataList)
 	authenticatedGroup.GET("/text_data/:id/", userDataHandlers.GetUserTextData)
 	authenticatedGroup.DELETE("/text_data/:id/", userDataHandlers.DeleteUserTextData)
 	authenticatedGroup.PUT("/text_data/:id/", userDataHandlers.UpdateUserTextData)
-	authenticatedGroup.POST("/text_data/", userDataHandlers.InsertUserTextData)
+	authenticatedGroup.POST("/text_data/", idempotent, userDataHandlers.InsertUserTextData)
 
 	authenticatedGroup.GET("/file_data/", userDataHandlers.GetUserFileDataList)
 	authenticatedGroup.GET("/file_data/:id/", userDataHandlers.GetUserFileData)
 	authenticatedGroup.GET("/file_data/:id/download/", userDataHandlers.DownloadUserFile)
 	authenticatedGroup.DELETE("/file_data/:id/", userDataHandlers.DeleteUserFileData)
 	authenticatedGroup.PUT("/file_data/:id/", userDataHandlers.UpdateUserFileData)
-	authenticatedGroup.POST("/file_data/", userDataHandlers.InsertUserFileData)
+	authenticatedGroup.PUT("/file_data/:id/content/", maxUploadSize, userDataHandlers.ReplaceUserFileContent)
+	authenticatedGroup.POST("/file_data/", maxUploadSize, idempotent, userDataHandlers.InsertUserFileData)
+	authenticatedGroup.POST("/file_data/archive/", fileArchiveHandlers.Download)
+
+	authenticatedGroup.POST("/uploads/", idempotent, uploadHandlers.CreateUpload)
+	authenticatedGroup.HEAD("/uploads/:id/", uploadHandlers.GetUpload)
+	authenticatedGroup.GET("/uploads/:id/", uploadHandlers.GetUpload)
+	authenticatedGroup.PATCH("/uploads/:id/", uploadHandlers.PatchUpload)
+	authenticatedGroup.DELETE("/uploads/:id/", uploadHandlers.CancelUpload)
 
 	authenticatedGroup.GET("bank_cards/", userDataHandlers.GetUserBankCardList)
 	authenticatedGroup.GET("bank_cards/:id/", userDataHandlers.GetUserBankCard)
 	authenticatedGroup.DELETE("bank_cards/:id/", userDataHandlers.DeleteUserBankCard)
 	authenticatedGroup.PUT("bank_cards/:id/", userDataHandlers.UpdateUserBankCard)
-	authenticatedGroup.POST("bank_cards/", userDataHandlers.InsertUserBankCard)
+	authenticatedGroup.POST("bank_cards/", idempotent, userDataHandlers.InsertUserBankCard)
+
+	// Маршруты, общие для записей всех видов
+	recordRoutes := map[string]models.DataKind{
+		"/auth_info/":  models.KindAuthInfo,
+		"/text_data/":  models.KindTextData,
+		"/file_data/":  models.KindFileData,
+		"/bank_cards/": models.KindBankCard,
+	}
+	for path, kind := range recordRoutes {
+		authenticatedGroup.PATCH(path+":id/", userDataHandlers.PatchRecord(kind))
+		authenticatedGroup.POST(path+":id/attachments/", maxUploadSize, idempotent, attachmentHandlers.InsertAttachment(kind))
+		authenticatedGroup.GET(path+":id/attachments/:attachment_id/download/", attachmentHandlers.DownloadAttachment(kind))
+		authenticatedGroup.DELETE(path+":id/attachments/:attachment_id/", attachmentHandlers.DeleteAttachment(kind))
+		authenticatedGroup.POST(path+":id/shares/", idempotent, shareHandlers.ShareRecord(kind))
+		authenticatedGroup.GET(path+":id/shares/", shareHandlers.GetRecordShares(kind))
+		authenticatedGroup.DELETE(path+":id/shares/:share_id/", shareHandlers.RevokeShare(kind))
+		authenticatedGroup.PUT(path+":id/collection/", organizationHandlers.MoveRecord(kind))
+		authenticatedGroup.PUT(path+":id/expiration/", userDataHandlers.SetExpiration(kind))
+		authenticatedGroup.DELETE(path+":id/expiration/", userDataHandlers.RemoveExpiration(kind))
+	}
+
+	shareLinkRoutes := map[string]models.DataKind{
+		"/auth_info/": models.KindAuthInfo,
+		"/text_data/": models.KindTextData,
+	}
+	for path, kind := range shareLinkRoutes {
+		authenticatedGroup.POST(path+":id/links/", idempotent, shareLinkHandlers.CreateLink(kind))
+		authenticatedGroup.GET(path+":id/links/", shareLinkHandlers.GetLinks(kind))
+		authenticatedGroup.DELETE(path+":id/links/:link_id/", shareLinkHandlers.RevokeLink(kind))
+	}
+	rootGroup.GET("/public/links/:link_id/", shareLinkHandlers.GetPublicLink)
+	rootGroup.POST("/public/links/:link_id/", auditActor, shareLinkHandlers.OpenLink)
+
+	authenticatedGroup.GET("/expiring/", userDataHandlers.GetExpiring)
+
+	authenticatedGroup.POST("/batch/", idempotent, batchHandlers.Run)
+
+	authenticatedGroup.GET("/shared/", shareHandlers.GetSharedWithMe)
+	authenticatedGroup.GET("/shared/:share_id/", shareHandlers.GetSharedRecord)
+	authenticatedGroup.PUT("/shared/:share_id/", shareHandlers.UpdateSharedRecord)
+	authenticatedGroup.DELETE("/shared/:share_id/", shareHandlers.LeaveShare)
+	authenticatedGroup.GET("/shared/:share_id/download/", shareHandlers.DownloadSharedFile)
+	authenticatedGroup.GET("/shared/:share_id/attachments/:attachment_id/download/", shareHandlers.DownloadSharedFile)
+
+	authenticatedGroup.GET("/organizations/", organizationHandlers.GetOrganizations)
+	authenticatedGroup.POST("/organizations/", idempotent, organizationHandlers.CreateOrganization)
+	authenticatedGroup.GET("/organizations/:org_id/", organizationHandlers.GetOrganization)
+	authenticatedGroup.PUT("/organizations/:org_id/", organizationHandlers.UpdateOrganization)
+	authenticatedGroup.DELETE("/organizations/:org_id/", organizationHandlers.DeleteOrganization)
+	authenticatedGroup.GET("/organizations/:org_id/members/", organizationHandlers.GetMembers)
+	authenticatedGroup.POST("/organizations/:org_id/members/", idempotent, organizationHandlers.AddMember)
+	authenticatedGroup.PUT("/organizations/:org_id/members/:user_id/", organizationHandlers.UpdateMember)
+	authenticatedGroup.DELETE("/organizations/:org_id/members/:user_id/", organizationHandlers.RemoveMember)
+	authenticatedGroup.GET("/organizations/:org_id/collections/", organizationHandlers.GetCollections)
+	authenticatedGroup.POST("/organizations/:org_id/collections/", idempotent, organizationHandlers.CreateCollection)
+	authenticatedGroup.PUT("/organizations/:org_id/collections/:collection_id/", organizationHandlers.UpdateCollection)
+	authenticatedGroup.DELETE("/organizations/:org_id/collections/:collection_id/", organizationHandlers.DeleteCollection)
+	authenticatedGroup.GET("/organizations/:org_id/collections/:collection_id/grants/", organizationHandlers.GetCollectionGrants)
+	authenticatedGroup.PUT("/organizations/:org_id/collections/:collection_id/grants/:user_id/", organizationHandlers.GrantCollection)
+	authenticatedGroup.DELETE("/organizations/:org_id/collections/:collection_id/grants/:user_id/", organizationHandlers.RevokeCollection)
+	authenticatedGroup.GET("/organizations/:org_id/audit/export/", organizationHandlers.ExportAudit)
+
+	authenticatedGroup.GET("/emergency/contacts/", emergencyAccessHandlers.GetContacts)
+	authenticatedGroup.POST("/emergency/contacts/", idempotent, emergencyAccessHandlers.AddContact)
+	authenticatedGroup.DELETE("/emergency/contacts/:access_id/", emergencyAccessHandlers.RemoveContact)
+	authenticatedGroup.POST("/emergency/contacts/:access_id/reject/", emergencyAccessHandlers.RejectRequest)
+	authenticatedGroup.GET("/emergency/granted/", emergencyAccessHandlers.GetGrantedToMe)
+	authenticatedGroup.DELETE("/emergency/granted/:access_id/", emergencyAccessHandlers.LeaveAccess)
+	authenticatedGroup.POST("/emergency/granted/:access_id/request/", emergencyAccessHandlers.RequestAccess)
+	authenticatedGroup.GET("/emergency/granted/:access_id/vault/", emergencyAccessHandlers.GetVault)
+	authenticatedGroup.GET("/emergency/granted/:access_id/file_data/:id/download/", emergencyAccessHandlers.DownloadFile)
+	authenticatedGroup.POST("/emergency/granted/:access_id/takeover/", emergencyAccessHandlers.TakeOver)
+
+	authenticatedGroup.GET("/reminders/preferences/", reminderHandlers.GetPreferences)
+	authenticatedGroup.PUT("/reminders/preferences/", reminderHandlers.UpdatePreferences)
+
+	authenticatedGroup.GET("/webhooks/", webhookHandlers.GetWebhooks)
+	authenticatedGroup.POST("/webhooks/", idempotent, webhookHandlers.CreateWebhook)
+	authenticatedGroup.PUT("/webhooks/:webhook_id/", webhookHandlers.UpdateWebhook)
+	authenticatedGroup.DELETE("/webhooks/:webhook_id/", webhookHandlers.DeleteWebhook)
+	authenticatedGroup.GET("/webhooks/:webhook_id/deliveries/", webhookHandlers.GetDeliveries)
+	authenticatedGroup.POST("/webhooks/:webhook_id/deliveries/:delivery_id/replay/", webhookHandlers.ReplayDelivery)
+
+	authenticatedGroup.GET("/audit/", auditHandlers.GetEvents)
+
+	authenticatedGroup.POST("/import/", maxUploadSize, idempotent, importHandlers.Import)
+
+	authenticatedGroup.POST("/vault/export/", vaultHandlers.Export)
+	authenticatedGroup.POST("/vault/restore/", vaultHandlers.Restore)
+
+	authenticatedGroup.GET("/usage/", usageHandlers.GetUsage)
 
 	return router
 }
 
+func newBlobStore(cfg *config.Config) (blobstore.BlobStore, error) {
+	switch cfg.BlobStore {
+	case "local":
+		return blobstore.NewLocalStore(cfg.BlobLocalDir), nil
+	case "s3":
+		return blobstore.NewS3Store(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3PathStyle)
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", cfg.BlobStore)
+	}
+}
+
+func newScanner(cfg *config.Config) (scanner.Scanner, error) {
+	switch cfg.Scanner {
+	case "none":
+		return nil, nil
+	case "clamd":
+		return scanner.NewClamdScanner(cfg.ClamdAddress, cfg.ScanTimeout), nil
+	case "fake":
+		return scanner.NewFakeScanner(), nil
+	default:
+		return nil, fmt.Errorf("unknown scanner %q", cfg.Scanner)
+	}
+}
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	cfg := config.MustLoad()
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "scrub":
+			os.Exit(runScrub(ctx, cfg, os.Args[2:]))
+		case "import":
+			os.Exit(runImport(ctx, cfg, os.Args[2:]))
+		}
+	}
+
 	if !cfg.IsDev {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -82,12 +252,60 @@ func main() {
 	}
 	defer xandyStorage.Close()
 
-	userDataService := services.NewUserDataService(xandyStorage)
+	blobs, err := newBlobStore(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	fileContentStore := services.NewFileContentStore(blobs, xandyStorage)
+
+	quotaService := services.NewQuotaService(xandyStorage, services.Quotas{
+		MaxFileSize:       cfg.MaxFileSize,
+		MaxStorage:        cfg.UserStorageQuota,
+		MaxRecordsPerKind: cfg.MaxRecordsPerKind,
+	})
+
+	auditService := services.NewAuditService(xandyStorage)
+	userDataService := services.NewUserDataService(xandyStorage, fileContentStore, quotaService, auditService)
+	go userDataService.RunExpirationSweep(ctx, cfg.ExpirationSweepInterval)
+	batchService := services.NewBatchService(xandyStorage, userDataService)
+	importService := services.NewImportService(xandyStorage, fileContentStore, quotaService, auditService)
+	vaultService := services.NewVaultService(xandyStorage, fileContentStore, quotaService, auditService)
+	uploadService := services.NewUploadService(xandyStorage, xandyStorage, fileContentStore, quotaService, auditService, cfg.UploadStagingDir, cfg.UploadExpiration)
+	fileArchiveService := services.NewFileArchiveService(xandyStorage, fileContentStore, cfg.ArchiveMaxSize, auditService)
+	go uploadService.RunCleanup(ctx, cfg.UploadCleanupInterval)
+
+	contentScanner, err := newScanner(cfg)
+	if err != nil {
+		panic(err)
+	}
+	scanService := services.NewScanService(xandyStorage, fileContentStore, contentScanner)
+	go scanService.Run(ctx, cfg.ScanInterval)
+
 	authServiceConn, err := grpc.NewClient(cfg.AuthGRPCServerAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		panic(err)
 	}
-	r := setupRouter(authServiceConn, userDataService)
+	userDirectory := authclient.NewClient(authServiceConn)
+	shareService := services.NewShareService(xandyStorage, userDirectory, userDataService)
+	organizationService := services.NewOrganizationService(xandyStorage, userDirectory, userDataService)
+	shareLinkService := services.NewShareLinkService(xandyStorage, userDataService)
+	go shareLinkService.RunCleanup(ctx, cfg.ShareLinkCleanupInterval)
+
+	var emailSender emailsender.IEmailSender
+	if cfg.IsDev {
+		emailSender = emailsender.NewMock()
+	} else {
+		emailSender = emailsender.New(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword)
+	}
+	emergencyAccessService := services.NewEmergencyAccessService(xandyStorage, userDirectory, userDataService, emailSender)
+	reminderService := services.NewReminderService(xandyStorage, userDirectory, emailSender)
+	go reminderService.RunReminders(ctx, cfg.ReminderInterval)
+	webhookService := services.NewWebhookService(xandyStorage, services.NewWebhookClient(cfg.WebhookTimeout))
+	go webhookService.Run(ctx, cfg.WebhookInterval)
+	idempotencyService := services.NewIdempotencyService(xandyStorage, cfg.IdempotencyKeyTTL)
+	go idempotencyService.RunCleanup(ctx, cfg.IdempotencyKeyCleanupInterval)
+	r := setupRouter(authServiceConn, userDataService, batchService, importService, vaultService, uploadService, fileArchiveService, quotaService, shareService, organizationService, shareLinkService, emergencyAccessService, reminderService, webhookService, auditService, idempotencyService, cfg.MaxFileSize)
 	go r.Run(cfg.ServerAddress)
 
 	sigChan := make(chan os.Signal, 1)
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/eac0de/xandy/internal/config"
+	"github.com/eac0de/xandy/internal/services"
+	"github.com/eac0de/xandy/internal/storage"
+)
+
+// runScrub проверяет целостность файлов: ./xandy scrub [-verify] [-repair] [-quarantine] [-grace 1h].
+// Отчёт в JSON выводится в stdout, код выхода 1 означает, что остались неисправленные проблемы.
+func runScrub(ctx context.Context, cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("scrub", flag.ExitOnError)
+	verify := flags.Bool("verify", false, "read all content and check SHA-256")
+	repair := flags.Bool("repair", false, "fix reference counts and file sizes, delete unreferenced content")
+	quarantine := flags.Bool("quarantine", false, "move unreferenced and corrupted content to quarantine/ instead of deleting")
+	grace := flags.Duration("grace", time.Hour, "skip content and references changed more recently, they may belong to uploads in progress")
+	flags.Parse(args)
+
+	xandyStorage, err := storage.NewxandyStorage(
+		ctx,
+		cfg.PSQLHost,
+		cfg.PSQLPort,
+		cfg.PSQLUsername,
+		cfg.PSQLPassword,
+		cfg.PSQLDBName,
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer xandyStorage.Close()
+	if err := xandyStorage.Migrate(ctx, "./migrations", false); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	blobs, err := newBlobStore(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	report, err := services.NewScrubber(xandyStorage, blobs).Run(ctx, services.ScrubOptions{
+		Verify:      *verify,
+		Repair:      *repair,
+		Quarantine:  *quarantine,
+		GracePeriod: *grace,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	for _, issue := range report.Issues {
+		if issue.Action == "" {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IAttachmentService interface {
+	InsertAttachment(ctx context.Context, userID uuid.UUID, parentKind models.DataKind, parentID uuid.UUID, name string, fileName string, metadata map[string]interface{}, content io.Reader) (*models.UserFileData, error)
+	GetAttachmentContent(ctx context.Context, userID uuid.UUID, parentKind models.DataKind, parentID uuid.UUID, attachmentID uuid.UUID) (*models.UserFileData, io.ReadSeekCloser, error)
+	DeleteAttachment(ctx context.Context, userID uuid.UUID, parentKind models.DataKind, parentID uuid.UUID, attachmentID uuid.UUID) error
+}
+
+// AttachmentHandlers обслуживают файлы, прикреплённые к записям.
+// Вид родительской записи задаётся при регистрации маршрута.
+type AttachmentHandlers struct {
+	attachmentService IAttachmentService
+}
+
+func NewAttachmentHandlers(attachmentService IAttachmentService) *AttachmentHandlers {
+	return &AttachmentHandlers{
+		attachmentService: attachmentService,
+	}
+}
+
+func (ah *AttachmentHandlers) InsertAttachment(parentKind models.DataKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid data id"})
+			return
+		}
+		userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+		upload, ok := readUploadedFile(c)
+		if !ok {
+			return
+		}
+		defer upload.Content.Close()
+		userFileData, err := ah.attachmentService.InsertAttachment(
+			c.Request.Context(),
+			userID,
+			parentKind,
+			parentID,
+			upload.Name,
+			upload.FileName,
+			upload.Metadata,
+			upload.Content,
+		)
+		if err != nil {
+			msg, statusCode := httperror.GetMessageAndStatusCode(err)
+			c.JSON(statusCode, gin.H{"detail": msg})
+			return
+		}
+		c.JSON(http.StatusCreated, userFileData)
+	}
+}
+
+func (ah *AttachmentHandlers) DownloadAttachment(parentKind models.DataKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parentID, attachmentID, ok := attachmentParams(c)
+		if !ok {
+			return
+		}
+		userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+		userFileData, content, err := ah.attachmentService.GetAttachmentContent(c.Request.Context(), userID, parentKind, parentID, attachmentID)
+		if err != nil {
+			msg, statusCode := httperror.GetMessageAndStatusCode(err)
+			c.JSON(statusCode, gin.H{"detail": msg})
+			return
+		}
+		defer content.Close()
+		serveUserFile(c, userFileData, content)
+	}
+}
+
+func (ah *AttachmentHandlers) DeleteAttachment(parentKind models.DataKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parentID, attachmentID, ok := attachmentParams(c)
+		if !ok {
+			return
+		}
+		userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+		err := ah.attachmentService.DeleteAttachment(c.Request.Context(), userID, parentKind, parentID, attachmentID)
+		if err != nil {
+			msg, statusCode := httperror.GetMessageAndStatusCode(err)
+			c.JSON(statusCode, gin.H{"detail": msg})
+			return
+		}
+		c.String(http.StatusNoContent, "")
+	}
+}
+
+func attachmentParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	parentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid data id"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	attachmentID, err := uuid.Parse(c.Param("attachment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid attachment id"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return parentID, attachmentID, true
+}
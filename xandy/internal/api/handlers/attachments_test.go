@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockIAttachmentService struct {
+	mock.Mock
+}
+
+func (m *MockIAttachmentService) InsertAttachment(ctx context.Context, userID uuid.UUID, parentKind models.DataKind, parentID uuid.UUID, name string, fileName string, metadata map[string]interface{}, content io.Reader) (*models.UserFileData, error) {
+	args := m.Called(ctx, userID, parentKind, parentID, name, fileName, metadata, content)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.UserFileData), args.Error(1)
+}
+
+func (m *MockIAttachmentService) GetAttachmentContent(ctx context.Context, userID uuid.UUID, parentKind models.DataKind, parentID uuid.UUID, attachmentID uuid.UUID) (*models.UserFileData, io.ReadSeekCloser, error) {
+	args := m.Called(ctx, userID, parentKind, parentID, attachmentID)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(*models.UserFileData), args.Get(1).(io.ReadSeekCloser), args.Error(2)
+}
+
+func (m *MockIAttachmentService) DeleteAttachment(ctx context.Context, userID uuid.UUID, parentKind models.DataKind, parentID uuid.UUID, attachmentID uuid.UUID) error {
+	args := m.Called(ctx, userID, parentKind, parentID, attachmentID)
+	return args.Error(0)
+}
+
+func TestAttachments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIAttachmentService)
+	handlers := NewAttachmentHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.POST("/auth_info/:id/attachments/", handlers.InsertAttachment(models.KindAuthInfo))
+	authenticatedGroup.GET("/auth_info/:id/attachments/:attachment_id/download/", handlers.DownloadAttachment(models.KindAuthInfo))
+	authenticatedGroup.DELETE("/auth_info/:id/attachments/:attachment_id/", handlers.DeleteAttachment(models.KindAuthInfo))
+
+	parentID := uuid.New()
+
+	t.Run("Insert", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		writer.WriteField("name", "Коды восстановления")
+		fileWriter, _ := writer.CreateFormFile("file", "recovery-codes.pdf")
+		fileWriter.Write([]byte("%PDF-1.4"))
+		writer.Close()
+
+		attachment := &models.UserFileData{BaseUserData: models.BaseUserData{ID: uuid.New()}, ParentKind: models.KindAuthInfo, ParentID: &parentID}
+		mockService.On("InsertAttachment", mock.Anything, userID, models.KindAuthInfo, parentID, "Коды восстановления", "recovery-codes.pdf", map[string]interface{}(nil), mock.Anything).Return(attachment, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/auth_info/"+parentID.String()+"/attachments/", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"parent_kind":"auth_info"`)
+		assert.Contains(t, rec.Body.String(), `"parent_id":"`+parentID.String()+`"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("InsertParentNotFound", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		fileWriter, _ := writer.CreateFormFile("file", "scan.png")
+		fileWriter.Write([]byte("png"))
+		writer.Close()
+
+		missingID := uuid.New()
+		mockService.On("InsertAttachment", mock.Anything, userID, models.KindAuthInfo, missingID, "", "scan.png", map[string]interface{}(nil), mock.Anything).Return(nil, httperror.New(nil, "UserAuthInfo not found", http.StatusNotFound)).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/auth_info/"+missingID.String()+"/attachments/", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Download", func(t *testing.T) {
+		attachmentID := uuid.New()
+		attachment := &models.UserFileData{BaseUserData: models.BaseUserData{ID: attachmentID, Name: "recovery-codes", UpdatedAt: time.Now()}, Ext: ".txt", MimeType: "text/plain; charset=utf-8"}
+		mockService.On("GetAttachmentContent", mock.Anything, userID, models.KindAuthInfo, parentID, attachmentID).Return(attachment, fileContent("1111 2222"), nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/auth_info/"+parentID.String()+"/attachments/"+attachmentID.String()+"/download/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "1111 2222", rec.Body.String())
+		assert.Equal(t, "attachment; filename=recovery-codes.txt", rec.Header().Get("Content-Disposition"))
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("InvalidAttachmentID", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodDelete, "/auth_info/"+parentID.String()+"/attachments/invalid-id/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"detail":"Invalid attachment id"}`, rec.Body.String())
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		attachmentID := uuid.New()
+		mockService.On("DeleteAttachment", mock.Anything, userID, models.KindAuthInfo, parentID, attachmentID).Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodDelete, "/auth_info/"+parentID.String()+"/attachments/"+attachmentID.String()+"/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+}
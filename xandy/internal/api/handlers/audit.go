@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/internal/services"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IAuditService interface {
+	GetEvents(ctx context.Context, userID uuid.UUID, filter models.AuditFilter, offset int) ([]models.AuditEvent, error)
+}
+
+// AuditActor сохраняет в контексте запроса пользователя, сессию, IP и User-Agent для журнала аудита.
+// Подключается после проверки токена: сессия берётся из уже проверенного токена
+func AuditActor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor := models.AuditActor{
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		}
+		if userID, ok := c.Get(gin.AuthUserKey); ok {
+			userID := userID.(uuid.UUID)
+			actor.UserID = &userID
+			actor.SessionID = tokenSessionID(c.GetHeader("Authorization"))
+		}
+		c.Request = c.Request.WithContext(services.WithAuditActor(c.Request.Context(), actor))
+		c.Next()
+	}
+}
+
+// tokenSessionID достаёт идентификатор сессии из полезной нагрузки JWT без проверки подписи
+func tokenSessionID(authorizationHeader string) *uuid.UUID {
+	token, _ := strings.CutPrefix(authorizationHeader, "Bearer ")
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	var claims struct {
+		SessionID uuid.UUID `json:"SessionID"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.SessionID == uuid.Nil {
+		return nil
+	}
+	return &claims.SessionID
+}
+
+type AuditHandlers struct {
+	auditService IAuditService
+}
+
+func NewAuditHandlers(auditService IAuditService) *AuditHandlers {
+	return &AuditHandlers{
+		auditService: auditService,
+	}
+}
+
+func (ah *AuditHandlers) GetEvents(c *gin.Context) {
+	var offset int64
+	offsetString := c.Query("offset")
+	if offsetString != "" {
+		offset, _ = strconv.ParseInt(offsetString, 10, 64)
+	}
+	filter, ok := auditFilterQuery(c)
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	auditEvents, err := ah.auditService.GetEvents(c.Request.Context(), userID, filter, int(offset))
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, auditEvents)
+}
+
+// auditFilterQuery читает фильтр событий из query параметров, при ошибке отвечает 400
+func auditFilterQuery(c *gin.Context) (models.AuditFilter, bool) {
+	filter := models.AuditFilter{
+		Action:   models.AuditAction(c.Query("action")),
+		DataKind: models.DataKind(c.Query("data_kind")),
+	}
+	uuidParams := map[string]**uuid.UUID{"data_id": &filter.DataID, "actor_id": &filter.ActorID}
+	for param, field := range uuidParams {
+		if value := c.Query(param); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid " + param})
+				return filter, false
+			}
+			*field = &id
+		}
+	}
+	timeParams := map[string]**time.Time{"from": &filter.From, "to": &filter.To}
+	for param, field := range timeParams {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid " + param + ", expected RFC 3339 time"})
+				return filter, false
+			}
+			*field = &t
+		}
+	}
+	return filter, true
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockIAuditService struct {
+	mock.Mock
+}
+
+func (m *MockIAuditService) GetEvents(ctx context.Context, userID uuid.UUID, filter models.AuditFilter, offset int) ([]models.AuditEvent, error) {
+	args := m.Called(ctx, userID, filter, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.AuditEvent), args.Error(1)
+}
+
+func TestAudit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIAuditService)
+	handlers := NewAuditHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.GET("/audit/", handlers.GetEvents)
+
+	t.Run("GetEventsWithFilter", func(t *testing.T) {
+		dataID := uuid.New()
+		from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		filter := models.AuditFilter{Action: models.AuditActionRead, DataKind: models.KindAuthInfo, DataID: &dataID, From: &from}
+		auditEvent := models.AuditEvent{ID: uuid.New(), Action: models.AuditActionRead, DataKind: models.KindAuthInfo, DataID: &dataID}
+		mockService.On("GetEvents", mock.Anything, userID, filter, 50).Return([]models.AuditEvent{auditEvent}, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/audit/?action=read&data_kind=auth_info&data_id="+dataID.String()+"&from=2025-01-01T00:00:00Z&offset=50", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"action":"read"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("GetEventsInvalidTime", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/audit/?to=yesterday", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"detail":"Invalid to, expected RFC 3339 time"}`, rec.Body.String())
+	})
+}
+
+func TestAuditActor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := uuid.New()
+	sessionID := uuid.New()
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"UserID":"` + userID.String() + `","SessionID":"` + sessionID.String() + `"}`))
+
+	var actor models.AuditActor
+	router := gin.New()
+	handler := func(c *gin.Context) {
+		actor = services.AuditActorFromContext(c.Request.Context())
+		c.Status(http.StatusNoContent)
+	}
+	router.GET("/private/", outmiddlewares.NewAuthMiddlewareForTest(userID), AuditActor(), handler)
+	router.GET("/public/", AuditActor(), handler)
+
+	t.Run("Authenticated", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/private/", nil)
+		req.Header.Set("Authorization", "Bearer header."+payload+".signature")
+		req.Header.Set("User-Agent", "xandy-cli/1.0")
+		req.RemoteAddr = "203.0.113.7:5000"
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Equal(t, &userID, actor.UserID)
+		assert.Equal(t, &sessionID, actor.SessionID)
+		assert.Equal(t, "203.0.113.7", actor.IP)
+		assert.Equal(t, "xandy-cli/1.0", actor.UserAgent)
+	})
+
+	t.Run("PublicIgnoresToken", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/public/", nil)
+		req.Header.Set("Authorization", "Bearer header."+payload+".signature")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Nil(t, actor.UserID)
+		assert.Nil(t, actor.SessionID)
+	})
+}
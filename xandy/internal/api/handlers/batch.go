@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/eac0de/xandy/internal/services"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IBatchService interface {
+	Run(ctx context.Context, userID uuid.UUID, mode services.BatchMode, operations []services.BatchOperation) (*services.BatchReport, error)
+}
+
+type BatchHandlers struct {
+	batchService IBatchService
+}
+
+func NewBatchHandlers(batchService IBatchService) *BatchHandlers {
+	return &BatchHandlers{
+		batchService: batchService,
+	}
+}
+
+// Run выполняет пакет операций, по умолчанию в режиме atomic
+func (bh *BatchHandlers) Run(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	var requestData struct {
+		Mode       services.BatchMode        `json:"mode"`
+		Operations []services.BatchOperation `json:"operations"`
+	}
+	if err := c.BindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	if requestData.Mode == "" {
+		requestData.Mode = services.BatchModeAtomic
+	}
+	report, err := bh.batchService.Run(c.Request.Context(), userID, requestData.Mode, requestData.Operations)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
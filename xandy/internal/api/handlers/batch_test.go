@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/internal/services"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockIBatchService struct {
+	mock.Mock
+}
+
+func (m *MockIBatchService) Run(ctx context.Context, userID uuid.UUID, mode services.BatchMode, operations []services.BatchOperation) (*services.BatchReport, error) {
+	args := m.Called(ctx, userID, mode, operations)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*services.BatchReport), args.Error(1)
+}
+
+func TestBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIBatchService)
+	handlers := NewBatchHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.POST("/batch/", handlers.Run)
+
+	dataID := uuid.New()
+
+	t.Run("DefaultsToAtomic", func(t *testing.T) {
+		operations := []services.BatchOperation{
+			{Op: services.BatchOpCreate, Kind: models.KindAuthInfo, RecordUpdate: services.RecordUpdate{Name: "mail", Login: "me", Password: "secret"}},
+			{Op: services.BatchOpDelete, Kind: models.KindBankCard, ID: &dataID},
+		}
+		report := &services.BatchReport{Mode: services.BatchModeAtomic, Succeeded: 2, Items: []services.BatchItemResult{
+			{Index: 0, Op: services.BatchOpCreate, Kind: models.KindAuthInfo, Status: http.StatusCreated},
+			{Index: 1, Op: services.BatchOpDelete, Kind: models.KindBankCard, Status: http.StatusNoContent, ID: &dataID},
+		}}
+		mockService.On("Run", mock.Anything, userID, services.BatchModeAtomic, operations).Return(report, nil).Once()
+
+		body := `{"operations":[
+			{"op":"create","kind":"auth_info","name":"mail","login":"me","password":"secret"},
+			{"op":"delete","kind":"bank_card","id":"` + dataID.String() + `"}
+		]}`
+		req, _ := http.NewRequest(http.MethodPost, "/batch/", bytes.NewReader([]byte(body)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"succeeded":2`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("AtomicFailure", func(t *testing.T) {
+		mockService.On("Run", mock.Anything, userID, services.BatchModeAtomic, mock.Anything).
+			Return(nil, httperror.New(nil, "Operation 0: UserBankCard not found", http.StatusNotFound)).Once()
+
+		body := `{"mode":"atomic","operations":[{"op":"delete","kind":"bank_card","id":"` + dataID.String() + `"}]}`
+		req, _ := http.NewRequest(http.MethodPost, "/batch/", bytes.NewReader([]byte(body)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Operation 0")
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("BestEffort", func(t *testing.T) {
+		report := &services.BatchReport{Mode: services.BatchModeBestEffort, Failed: 1, Items: []services.BatchItemResult{
+			{Index: 0, Op: services.BatchOpDelete, Kind: models.KindBankCard, Status: http.StatusNotFound, Error: "UserBankCard not found"},
+		}}
+		mockService.On("Run", mock.Anything, userID, services.BatchModeBestEffort, mock.Anything).Return(report, nil).Once()
+
+		body := `{"mode":"best_effort","operations":[{"op":"delete","kind":"bank_card","id":"` + dataID.String() + `"}]}`
+		req, _ := http.NewRequest(http.MethodPost, "/batch/", bytes.NewReader([]byte(body)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"error":"UserBankCard not found"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("InvalidBody", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/batch/", bytes.NewReader([]byte(`{"operations":{}}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
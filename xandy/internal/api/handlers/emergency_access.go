@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IEmergencyAccessService interface {
+	AddContact(ctx context.Context, grantorID uuid.UUID, email string, accessType models.EmergencyAccessType, waitDays int) (*models.EmergencyAccess, error)
+	GetContacts(ctx context.Context, grantorID uuid.UUID) ([]models.EmergencyAccess, error)
+	RejectRequest(ctx context.Context, grantorID uuid.UUID, accessID uuid.UUID) error
+	RemoveContact(ctx context.Context, grantorID uuid.UUID, accessID uuid.UUID) error
+
+	GetGrantedToMe(ctx context.Context, granteeID uuid.UUID) ([]models.EmergencyAccess, error)
+	RequestAccess(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID) (*models.EmergencyAccess, error)
+	LeaveAccess(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID) error
+	GetVault(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID) (*models.EmergencyVault, error)
+	GetFileContent(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID, fileID uuid.UUID) (*models.UserFileData, io.ReadSeekCloser, error)
+	TakeOver(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID) (int, error)
+}
+
+// EmergencyAccessHandlers обслуживают экстренный доступ. Владелец управляет доверенными
+// контактами через /emergency/contacts/, контакт работает с доступом через /emergency/granted/.
+type EmergencyAccessHandlers struct {
+	emergencyAccessService IEmergencyAccessService
+}
+
+func NewEmergencyAccessHandlers(emergencyAccessService IEmergencyAccessService) *EmergencyAccessHandlers {
+	return &EmergencyAccessHandlers{
+		emergencyAccessService: emergencyAccessService,
+	}
+}
+
+func (eh *EmergencyAccessHandlers) AddContact(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	var requestData struct {
+		Email      *string                    `json:"email"`
+		AccessType models.EmergencyAccessType `json:"access_type"`
+		WaitDays   int                        `json:"wait_days"`
+	}
+	if err := c.BindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	if requestData.Email == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "email is required"})
+		return
+	}
+	if requestData.AccessType == "" {
+		requestData.AccessType = models.EmergencyAccessView
+	}
+	if requestData.WaitDays == 0 {
+		requestData.WaitDays = 7
+	}
+	emergencyAccess, err := eh.emergencyAccessService.AddContact(c.Request.Context(), userID, *requestData.Email, requestData.AccessType, requestData.WaitDays)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusCreated, emergencyAccess)
+}
+
+func (eh *EmergencyAccessHandlers) GetContacts(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	emergencyAccessList, err := eh.emergencyAccessService.GetContacts(c.Request.Context(), userID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, emergencyAccessList)
+}
+
+func (eh *EmergencyAccessHandlers) RejectRequest(c *gin.Context) {
+	accessID, ok := uuidParam(c, "access_id", "Invalid emergency access id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	err := eh.emergencyAccessService.RejectRequest(c.Request.Context(), userID, accessID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.String(http.StatusNoContent, "")
+}
+
+func (eh *EmergencyAccessHandlers) RemoveContact(c *gin.Context) {
+	accessID, ok := uuidParam(c, "access_id", "Invalid emergency access id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	err := eh.emergencyAccessService.RemoveContact(c.Request.Context(), userID, accessID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.String(http.StatusNoContent, "")
+}
+
+func (eh *EmergencyAccessHandlers) GetGrantedToMe(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	emergencyAccessList, err := eh.emergencyAccessService.GetGrantedToMe(c.Request.Context(), userID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, emergencyAccessList)
+}
+
+func (eh *EmergencyAccessHandlers) RequestAccess(c *gin.Context) {
+	accessID, ok := uuidParam(c, "access_id", "Invalid emergency access id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	emergencyAccess, err := eh.emergencyAccessService.RequestAccess(c.Request.Context(), userID, accessID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, emergencyAccess)
+}
+
+func (eh *EmergencyAccessHandlers) LeaveAccess(c *gin.Context) {
+	accessID, ok := uuidParam(c, "access_id", "Invalid emergency access id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	err := eh.emergencyAccessService.LeaveAccess(c.Request.Context(), userID, accessID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.String(http.StatusNoContent, "")
+}
+
+func (eh *EmergencyAccessHandlers) GetVault(c *gin.Context) {
+	accessID, ok := uuidParam(c, "access_id", "Invalid emergency access id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	vault, err := eh.emergencyAccessService.GetVault(c.Request.Context(), userID, accessID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, vault)
+}
+
+func (eh *EmergencyAccessHandlers) DownloadFile(c *gin.Context) {
+	accessID, ok := uuidParam(c, "access_id", "Invalid emergency access id")
+	if !ok {
+		return
+	}
+	fileID, ok := uuidParam(c, "id", "Invalid data id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	userFileData, content, err := eh.emergencyAccessService.GetFileContent(c.Request.Context(), userID, accessID, fileID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	defer content.Close()
+	serveUserFile(c, userFileData, content)
+}
+
+func (eh *EmergencyAccessHandlers) TakeOver(c *gin.Context) {
+	accessID, ok := uuidParam(c, "access_id", "Invalid emergency access id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	moved, err := eh.emergencyAccessService.TakeOver(c.Request.Context(), userID, accessID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"moved": moved})
+}
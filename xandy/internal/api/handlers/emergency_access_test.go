@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockIEmergencyAccessService struct {
+	mock.Mock
+}
+
+func (m *MockIEmergencyAccessService) AddContact(ctx context.Context, grantorID uuid.UUID, email string, accessType models.EmergencyAccessType, waitDays int) (*models.EmergencyAccess, error) {
+	args := m.Called(ctx, grantorID, email, accessType, waitDays)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.EmergencyAccess), args.Error(1)
+}
+
+func (m *MockIEmergencyAccessService) GetContacts(ctx context.Context, grantorID uuid.UUID) ([]models.EmergencyAccess, error) {
+	args := m.Called(ctx, grantorID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.EmergencyAccess), args.Error(1)
+}
+
+func (m *MockIEmergencyAccessService) RejectRequest(ctx context.Context, grantorID uuid.UUID, accessID uuid.UUID) error {
+	args := m.Called(ctx, grantorID, accessID)
+	return args.Error(0)
+}
+
+func (m *MockIEmergencyAccessService) RemoveContact(ctx context.Context, grantorID uuid.UUID, accessID uuid.UUID) error {
+	args := m.Called(ctx, grantorID, accessID)
+	return args.Error(0)
+}
+
+func (m *MockIEmergencyAccessService) GetGrantedToMe(ctx context.Context, granteeID uuid.UUID) ([]models.EmergencyAccess, error) {
+	args := m.Called(ctx, granteeID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.EmergencyAccess), args.Error(1)
+}
+
+func (m *MockIEmergencyAccessService) RequestAccess(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID) (*models.EmergencyAccess, error) {
+	args := m.Called(ctx, granteeID, accessID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.EmergencyAccess), args.Error(1)
+}
+
+func (m *MockIEmergencyAccessService) LeaveAccess(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID) error {
+	args := m.Called(ctx, granteeID, accessID)
+	return args.Error(0)
+}
+
+func (m *MockIEmergencyAccessService) GetVault(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID) (*models.EmergencyVault, error) {
+	args := m.Called(ctx, granteeID, accessID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.EmergencyVault), args.Error(1)
+}
+
+func (m *MockIEmergencyAccessService) GetFileContent(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID, fileID uuid.UUID) (*models.UserFileData, io.ReadSeekCloser, error) {
+	args := m.Called(ctx, granteeID, accessID, fileID)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(*models.UserFileData), args.Get(1).(io.ReadSeekCloser), args.Error(2)
+}
+
+func (m *MockIEmergencyAccessService) TakeOver(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID) (int, error) {
+	args := m.Called(ctx, granteeID, accessID)
+	return args.Int(0), args.Error(1)
+}
+
+func TestEmergencyAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIEmergencyAccessService)
+	handlers := NewEmergencyAccessHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.GET("/emergency/contacts/", handlers.GetContacts)
+	authenticatedGroup.POST("/emergency/contacts/", handlers.AddContact)
+	authenticatedGroup.DELETE("/emergency/contacts/:access_id/", handlers.RemoveContact)
+	authenticatedGroup.POST("/emergency/contacts/:access_id/reject/", handlers.RejectRequest)
+	authenticatedGroup.GET("/emergency/granted/", handlers.GetGrantedToMe)
+	authenticatedGroup.DELETE("/emergency/granted/:access_id/", handlers.LeaveAccess)
+	authenticatedGroup.POST("/emergency/granted/:access_id/request/", handlers.RequestAccess)
+	authenticatedGroup.GET("/emergency/granted/:access_id/vault/", handlers.GetVault)
+	authenticatedGroup.GET("/emergency/granted/:access_id/file_data/:id/download/", handlers.DownloadFile)
+	authenticatedGroup.POST("/emergency/granted/:access_id/takeover/", handlers.TakeOver)
+
+	accessID := uuid.New()
+
+	t.Run("AddContactWithDefaults", func(t *testing.T) {
+		emergencyAccess := &models.EmergencyAccess{ID: accessID, GrantorID: userID, GranteeEmail: "contact@example.com", AccessType: models.EmergencyAccessView, WaitDays: 7, Status: models.EmergencyAccessIdle}
+		mockService.On("AddContact", mock.Anything, userID, "contact@example.com", models.EmergencyAccessView, 7).Return(emergencyAccess, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/emergency/contacts/", bytes.NewReader([]byte(`{"email":"contact@example.com"}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"idle"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("AddContactWithoutEmail", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/emergency/contacts/", bytes.NewReader([]byte(`{"wait_days":3}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "email is required")
+	})
+
+	t.Run("GetContacts", func(t *testing.T) {
+		mockService.On("GetContacts", mock.Anything, userID).Return([]models.EmergencyAccess{}, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/emergency/contacts/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "[]", rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		mockService.On("RejectRequest", mock.Anything, userID, accessID).Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/emergency/contacts/"+accessID.String()+"/reject/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("RemoveContactInvalidID", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodDelete, "/emergency/contacts/bad/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("RequestOwnerNotNotified", func(t *testing.T) {
+		mockService.On("RequestAccess", mock.Anything, userID, accessID).
+			Return(nil, httperror.New(nil, "Failed to notify the owner, try again later", http.StatusBadGateway)).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/emergency/granted/"+accessID.String()+"/request/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadGateway, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Request", func(t *testing.T) {
+		requestedAt := time.Now()
+		emergencyAccess := &models.EmergencyAccess{ID: accessID, GranteeID: userID, Status: models.EmergencyAccessRequested, RequestedAt: &requestedAt}
+		mockService.On("RequestAccess", mock.Anything, userID, accessID).Return(emergencyAccess, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/emergency/granted/"+accessID.String()+"/request/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"requested"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("VaultNotGrantedYet", func(t *testing.T) {
+		mockService.On("GetVault", mock.Anything, userID, accessID).
+			Return(nil, httperror.New(nil, "Emergency access is not granted yet", http.StatusForbidden)).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/emergency/granted/"+accessID.String()+"/vault/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("DownloadFile", func(t *testing.T) {
+		fileID := uuid.New()
+		userFileData := &models.UserFileData{Ext: ".txt", MimeType: "text/plain"}
+		userFileData.Name = "scan"
+		content := fileContent("scan content")
+		mockService.On("GetFileContent", mock.Anything, userID, accessID, fileID).Return(userFileData, content, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/emergency/granted/"+accessID.String()+"/file_data/"+fileID.String()+"/download/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "scan content", rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("TakeOver", func(t *testing.T) {
+		mockService.On("TakeOver", mock.Anything, userID, accessID).Return(5, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/emergency/granted/"+accessID.String()+"/takeover/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"moved":5}`, rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Leave", func(t *testing.T) {
+		mockService.On("LeaveAccess", mock.Anything, userID, accessID).Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodDelete, "/emergency/granted/"+accessID.String()+"/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Окно списка записей, срок жизни которых скоро истечёт, по умолчанию
+const defaultExpiringWindow = 7 * 24 * time.Hour
+
+// SetExpiration задаёт срок жизни записи: момент expires_at или expires_in секунд от текущего времени
+func (ah *UserDataHandlers) SetExpiration(dataKind models.DataKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dataID, ok := uuidParam(c, "id", "Invalid data id")
+		if !ok {
+			return
+		}
+		userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+		var requestData struct {
+			ExpiresAt *time.Time `json:"expires_at"`
+			ExpiresIn *int64     `json:"expires_in"`
+		}
+		if err := c.BindJSON(&requestData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+			return
+		}
+		if (requestData.ExpiresAt == nil) == (requestData.ExpiresIn == nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "Either expires_at or expires_in is required"})
+			return
+		}
+		expiresAt := requestData.ExpiresAt
+		if requestData.ExpiresIn != nil {
+			t := time.Now().Add(time.Duration(*requestData.ExpiresIn) * time.Second)
+			expiresAt = &t
+		}
+		record, err := ah.userDataService.SetExpiration(c.Request.Context(), userID, dataKind, dataID, expiresAt)
+		if err != nil {
+			msg, statusCode := httperror.GetMessageAndStatusCode(err)
+			c.JSON(statusCode, gin.H{"detail": msg})
+			return
+		}
+		c.JSON(http.StatusOK, models.ExpiringRecord{
+			DataKind:     dataKind,
+			ID:           record.ID,
+			Name:         record.Name,
+			CollectionID: record.CollectionID,
+			ExpiresAt:    *record.ExpiresAt,
+		})
+	}
+}
+
+// RemoveExpiration снимает срок жизни, запись снова хранится бессрочно
+func (ah *UserDataHandlers) RemoveExpiration(dataKind models.DataKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dataID, ok := uuidParam(c, "id", "Invalid data id")
+		if !ok {
+			return
+		}
+		userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+		_, err := ah.userDataService.SetExpiration(c.Request.Context(), userID, dataKind, dataID, nil)
+		if err != nil {
+			msg, statusCode := httperror.GetMessageAndStatusCode(err)
+			c.JSON(statusCode, gin.H{"detail": msg})
+			return
+		}
+		c.String(http.StatusNoContent, "")
+	}
+}
+
+// GetExpiring возвращает записи, срок жизни которых истекает в ближайшие within (например 24h), по умолчанию 7 дней
+func (ah *UserDataHandlers) GetExpiring(c *gin.Context) {
+	within := defaultExpiringWindow
+	if withinString := c.Query("within"); withinString != "" {
+		var err error
+		within, err = time.ParseDuration(withinString)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid within, expected a duration such as 24h"})
+			return
+		}
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	expiringRecords, err := ah.userDataService.GetExpiring(c.Request.Context(), userID, within)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, expiringRecords)
+}
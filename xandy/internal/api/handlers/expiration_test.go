@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExpiration(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIUserDataService)
+	handlers := NewUserDataHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.PUT("/text_data/:id/expiration/", handlers.SetExpiration(models.KindTextData))
+	authenticatedGroup.DELETE("/text_data/:id/expiration/", handlers.RemoveExpiration(models.KindTextData))
+	authenticatedGroup.GET("/expiring/", handlers.GetExpiring)
+
+	dataID := uuid.New()
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("SetExpiresAt", func(t *testing.T) {
+		record := &models.BaseUserData{ID: dataID, UserID: userID, Name: "note", ExpiresAt: &expiresAt}
+		mockService.On("SetExpiration", mock.Anything, userID, models.KindTextData, dataID, mock.MatchedBy(func(at *time.Time) bool {
+			return at != nil && at.Equal(expiresAt)
+		})).Return(record, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPut, "/text_data/"+dataID.String()+"/expiration/", bytes.NewReader([]byte(`{"expires_at":"2030-01-02T03:04:05Z"}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"expires_at":"2030-01-02T03:04:05Z"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("SetExpiresIn", func(t *testing.T) {
+		record := &models.BaseUserData{ID: dataID, UserID: userID, Name: "note", ExpiresAt: &expiresAt}
+		mockService.On("SetExpiration", mock.Anything, userID, models.KindTextData, dataID, mock.MatchedBy(func(at *time.Time) bool {
+			return at != nil && time.Until(*at) > 59*time.Minute && time.Until(*at) <= time.Hour
+		})).Return(record, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPut, "/text_data/"+dataID.String()+"/expiration/", bytes.NewReader([]byte(`{"expires_in":3600}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("SetWithoutMoment", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPut, "/text_data/"+dataID.String()+"/expiration/", bytes.NewReader([]byte(`{}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Either expires_at or expires_in is required")
+	})
+
+	t.Run("SetInPast", func(t *testing.T) {
+		mockService.On("SetExpiration", mock.Anything, userID, models.KindTextData, dataID, mock.Anything).
+			Return(nil, httperror.New(nil, "expires_at must be in the future", http.StatusUnprocessableEntity)).Once()
+
+		req, _ := http.NewRequest(http.MethodPut, "/text_data/"+dataID.String()+"/expiration/", bytes.NewReader([]byte(`{"expires_at":"2000-01-01T00:00:00Z"}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		mockService.On("SetExpiration", mock.Anything, userID, models.KindTextData, dataID, (*time.Time)(nil)).
+			Return(&models.BaseUserData{ID: dataID, UserID: userID}, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodDelete, "/text_data/"+dataID.String()+"/expiration/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("GetExpiringDefaultWindow", func(t *testing.T) {
+		expiringRecords := []models.ExpiringRecord{{DataKind: models.KindTextData, ID: dataID, Name: "note", ExpiresAt: expiresAt}}
+		mockService.On("GetExpiring", mock.Anything, userID, 7*24*time.Hour).Return(expiringRecords, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/expiring/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), dataID.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("GetExpiringInvalidWindow", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/expiring/?within=week", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
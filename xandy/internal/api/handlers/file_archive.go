@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/internal/services"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IFileArchiveService interface {
+	Export(ctx context.Context, userID uuid.UUID, ids []uuid.UUID, filter models.FileDataFilter, format services.ArchiveFormat, w io.Writer) error
+}
+
+type FileArchiveHandlers struct {
+	fileArchiveService IFileArchiveService
+}
+
+func NewFileArchiveHandlers(fileArchiveService IFileArchiveService) *FileArchiveHandlers {
+	return &FileArchiveHandlers{
+		fileArchiveService: fileArchiveService,
+	}
+}
+
+var archiveContentTypes = map[services.ArchiveFormat]string{
+	services.ArchiveFormatZip:   "application/zip",
+	services.ArchiveFormatTarGz: "application/gzip",
+}
+
+// Download отдаёт архив с файлами из списка ids или, если он пуст, с файлами под фильтр
+func (fah *FileArchiveHandlers) Download(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	var requestData struct {
+		IDs    []uuid.UUID `json:"ids"`
+		Format string      `json:"format"`
+		Filter struct {
+			MimeType         string `json:"mime_type"`
+			MinSize          *int64 `json:"min_size"`
+			MaxSize          *int64 `json:"max_size"`
+			OriginalFileName string `json:"original_file_name"`
+		} `json:"filter"`
+	}
+	if err := c.BindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	format := services.ArchiveFormat(requestData.Format)
+	if format == "" {
+		format = services.ArchiveFormatZip
+	}
+	filter := models.FileDataFilter{
+		MimeType:         requestData.Filter.MimeType,
+		MinSize:          requestData.Filter.MinSize,
+		MaxSize:          requestData.Filter.MaxSize,
+		OriginalFileName: requestData.Filter.OriginalFileName,
+	}
+	w := &attachmentWriter{c: c, fileName: "files." + string(format), contentType: archiveContentTypes[format]}
+	err := fah.fileArchiveService.Export(c.Request.Context(), userID, requestData.IDs, filter, format, w)
+	if err != nil {
+		if c.Writer.Written() {
+			// Архив уже частично отправлен, клиент получит оборванный поток
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/internal/services"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockIFileArchiveService struct {
+	mock.Mock
+}
+
+func (m *MockIFileArchiveService) Export(ctx context.Context, userID uuid.UUID, ids []uuid.UUID, filter models.FileDataFilter, format services.ArchiveFormat, w io.Writer) error {
+	args := m.Called(ctx, userID, ids, filter, format, w)
+	if content := args.String(1); content != "" {
+		w.Write([]byte(content))
+	}
+	return args.Error(0)
+}
+
+func TestDownloadFileArchive(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIFileArchiveService)
+	handlers := NewFileArchiveHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.POST("/file_data/archive/", handlers.Download)
+
+	t.Run("ZipByIDs", func(t *testing.T) {
+		fileID := uuid.New()
+		mockService.On("Export", mock.Anything, userID, []uuid.UUID{fileID}, models.FileDataFilter{}, services.ArchiveFormatZip, mock.Anything).Return(nil, "PK").Once()
+		req, _ := http.NewRequest(http.MethodPost, "/file_data/archive/", bytes.NewBufferString(`{"ids": ["`+fileID.String()+`"]}`))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="files.zip"`, rec.Header().Get("Content-Disposition"))
+		assert.Equal(t, "PK", rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("TarGzByFilter", func(t *testing.T) {
+		minSize := int64(100)
+		filter := models.FileDataFilter{MimeType: "image/", MinSize: &minSize}
+		mockService.On("Export", mock.Anything, userID, []uuid.UUID(nil), filter, services.ArchiveFormatTarGz, mock.Anything).Return(nil, "gz").Once()
+		req, _ := http.NewRequest(http.MethodPost, "/file_data/archive/", bytes.NewBufferString(`{"format": "tar.gz", "filter": {"mime_type": "image/", "min_size": 100}}`))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/gzip", rec.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="files.tar.gz"`, rec.Header().Get("Content-Disposition"))
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		mockService.On("Export", mock.Anything, userID, []uuid.UUID(nil), models.FileDataFilter{}, services.ArchiveFormatZip, mock.Anything).Return(httperror.New(nil, "Archive exceeds the size limit of 10 bytes", http.StatusRequestEntityTooLarge), "").Once()
+		req, _ := http.NewRequest(http.MethodPost, "/file_data/archive/", bytes.NewBufferString(`{}`))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.JSONEq(t, `{"detail":"Archive exceeds the size limit of 10 bytes"}`, rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("InvalidJSON", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/file_data/archive/", bytes.NewBufferString(`{"ids": ["not-a-uuid"]}`))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Тело запроса больше этого размера на время запроса сохраняется во временный файл
+const idempotencyMemoryLimit = 1 << 20
+
+type IIdempotencyService interface {
+	Begin(ctx context.Context, userID uuid.UUID, key string, requestHash string) (*models.IdempotencyKey, error)
+	Complete(ctx context.Context, userID uuid.UUID, key string, requestHash string, statusCode int, contentType string, body []byte) error
+	Release(ctx context.Context, userID uuid.UUID, key string, requestHash string) error
+}
+
+// Idempotency выполняет запрос с заголовком Idempotency-Key один раз: повтор с тем же ключом
+// и тем же телом получает сохранённый ответ с заголовком Idempotent-Replayed.
+// Тело читается целиком до обработчика, поэтому его размер ограничен так же, как в MaxUploadSize
+func Idempotency(idempotencyService IIdempotencyService, maxFileSize int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+		if maxFileSize > 0 {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxFileSize+multipartOverhead)
+		}
+		hash := sha256.New()
+		io.WriteString(hash, c.Request.Method+" "+c.Request.URL.Path+"\n")
+		body, err := spoolBody(c.Request.Body, requestHashWriter(hash, c.GetHeader("Content-Type")))
+		if err != nil {
+			formFileError(c, err)
+			c.Abort()
+			return
+		}
+		defer body.Close()
+		c.Request.Body = body
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		stored, err := idempotencyService.Begin(c.Request.Context(), userID, key, requestHash)
+		if err != nil {
+			msg, statusCode := httperror.GetMessageAndStatusCode(err)
+			c.AbortWithStatusJSON(statusCode, gin.H{"detail": msg})
+			return
+		}
+		if stored != nil {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(stored.StatusCode, stored.ContentType, stored.Body)
+			c.Abort()
+			return
+		}
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		defer func() {
+			// После паники обработчика ключ остался бы занятым до истечения срока
+			if r := recover(); r != nil {
+				if err := idempotencyService.Release(context.WithoutCancel(c.Request.Context()), userID, key, requestHash); err != nil {
+					log.Printf("release idempotency key: %s\n", err)
+				}
+				panic(r)
+			}
+		}()
+		c.Next()
+		err = idempotencyService.Complete(
+			context.WithoutCancel(c.Request.Context()),
+			userID,
+			key,
+			requestHash,
+			recorder.Status(),
+			recorder.Header().Get("Content-Type"),
+			recorder.body.Bytes(),
+		)
+		if err != nil {
+			log.Printf("complete idempotency key: %s\n", err)
+		}
+	}
+}
+
+// responseRecorder запоминает тело ответа, чтобы сохранить его для повторов
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+// requestHashWriter возвращает writer для хэша тела. Граница multipart формы случайна
+// и при повторе запроса может быть другой, поэтому она в хэш не попадает
+func requestHashWriter(hash io.Writer, contentType string) io.Writer {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return hash
+	}
+	return &replacingWriter{w: hash, old: []byte(params["boundary"]), new: []byte("boundary")}
+}
+
+// replacingWriter заменяет old на new в потоке, в том числе на стыке вызовов Write.
+// Остаток потока записывается в Close
+type replacingWriter struct {
+	w       io.Writer
+	old     []byte
+	new     []byte
+	pending []byte
+}
+
+func (r *replacingWriter) Write(data []byte) (int, error) {
+	buf := append(r.pending, data...)
+	for {
+		i := bytes.Index(buf, r.old)
+		if i < 0 {
+			break
+		}
+		if _, err := r.w.Write(buf[:i]); err != nil {
+			return 0, err
+		}
+		if _, err := r.w.Write(r.new); err != nil {
+			return 0, err
+		}
+		buf = buf[i+len(r.old):]
+	}
+	// Начало old может оказаться в конце буфера, его проверит следующий вызов
+	keep := min(len(buf), len(r.old)-1)
+	if _, err := r.w.Write(buf[:len(buf)-keep]); err != nil {
+		return 0, err
+	}
+	r.pending = append([]byte(nil), buf[len(buf)-keep:]...)
+	return len(data), nil
+}
+
+func (r *replacingWriter) Close() error {
+	_, err := r.w.Write(r.pending)
+	r.pending = nil
+	return err
+}
+
+// spoolBody читает тело запроса целиком, одновременно передавая его в w, и возвращает его копию.
+// Большое тело сохраняется во временный файл, который удаляется при закрытии копии
+func spoolBody(body io.Reader, w io.Writer) (io.ReadCloser, error) {
+	if closer, ok := w.(io.Closer); ok {
+		defer closer.Close()
+	}
+	var buf bytes.Buffer
+	_, err := io.CopyN(io.MultiWriter(&buf, w), body, idempotencyMemoryLimit+1)
+	if err == io.EOF {
+		return io.NopCloser(&buf), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp("", "xandy-request-*")
+	if err != nil {
+		return nil, err
+	}
+	spooled := &tempFileBody{file}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		spooled.Close()
+		return nil, err
+	}
+	if _, err := io.Copy(io.MultiWriter(file, w), body); err != nil {
+		spooled.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		spooled.Close()
+		return nil, err
+	}
+	return spooled, nil
+}
+
+type tempFileBody struct {
+	*os.File
+}
+
+func (f *tempFileBody) Close() error {
+	f.File.Close()
+	return os.Remove(f.Name())
+}
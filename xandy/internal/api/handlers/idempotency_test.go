@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockIIdempotencyService struct {
+	mock.Mock
+}
+
+func (m *MockIIdempotencyService) Begin(ctx context.Context, userID uuid.UUID, key string, requestHash string) (*models.IdempotencyKey, error) {
+	args := m.Called(ctx, userID, key, requestHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.IdempotencyKey), args.Error(1)
+}
+
+func (m *MockIIdempotencyService) Complete(ctx context.Context, userID uuid.UUID, key string, requestHash string, statusCode int, contentType string, body []byte) error {
+	args := m.Called(ctx, userID, key, requestHash, statusCode, contentType, body)
+	return args.Error(0)
+}
+
+func (m *MockIIdempotencyService) Release(ctx context.Context, userID uuid.UUID, key string, requestHash string) error {
+	args := m.Called(ctx, userID, key, requestHash)
+	return args.Error(0)
+}
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIIdempotencyService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	calls := 0
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.POST("/text_data/", Idempotency(mockService, 0), func(c *gin.Context) {
+		calls++
+		var requestData struct {
+			Name string `json:"name"`
+		}
+		if err := c.BindJSON(&requestData); err != nil {
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"name": requestData.Name})
+	})
+	authenticatedGroup.POST("/file_data/", Idempotency(mockService, 0), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	authenticatedGroup.POST("/bank_cards/", Idempotency(mockService, 16), func(c *gin.Context) {
+		panic("handler failed")
+	})
+
+	post := func(path, key, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var requestHash string
+
+	t.Run("WithoutKey", func(t *testing.T) {
+		rec := post("/text_data/", "", `{"name":"note"}`)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("FirstRequest", func(t *testing.T) {
+		mockService.On("Begin", mock.Anything, userID, "key-1", mock.AnythingOfType("string")).
+			Run(func(args mock.Arguments) { requestHash = args.String(3) }).
+			Return(nil, nil).Once()
+		mockService.On("Complete", mock.Anything, userID, "key-1", mock.AnythingOfType("string"), http.StatusCreated, "application/json; charset=utf-8", []byte(`{"name":"note"}`)).
+			Return(nil).Once()
+
+		rec := post("/text_data/", "key-1", `{"name":"note"}`)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, `{"name":"note"}`, rec.Body.String())
+		assert.Equal(t, 2, calls)
+		assert.Len(t, requestHash, 64)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		stored := &models.IdempotencyKey{StatusCode: http.StatusCreated, ContentType: "application/json; charset=utf-8", Body: []byte(`{"name":"note"}`)}
+		mockService.On("Begin", mock.Anything, userID, "key-1", requestHash).Return(stored, nil).Once()
+
+		rec := post("/text_data/", "key-1", `{"name":"note"}`)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, `{"name":"note"}`, rec.Body.String())
+		assert.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, 2, calls)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("HashCoversPathAndBody", func(t *testing.T) {
+		mockService.On("Begin", mock.Anything, userID, "key-1", mock.MatchedBy(func(hash string) bool { return hash != requestHash })).
+			Return(nil, httperror.New(nil, "Idempotency-Key was already used with a different request", http.StatusUnprocessableEntity)).Twice()
+
+		rec := post("/text_data/", "key-1", `{"name":"other"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		rec = post("/file_data/", "key-1", `{"name":"note"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Equal(t, 2, calls)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("PanicReleasesKey", func(t *testing.T) {
+		mockService.On("Begin", mock.Anything, userID, "key-2", mock.AnythingOfType("string")).Return(nil, nil).Once()
+		mockService.On("Release", mock.Anything, userID, "key-2", mock.AnythingOfType("string")).Return(nil).Once()
+
+		rec := post("/bank_cards/", "key-2", `{"number":"4111"}`)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("BodyTooLarge", func(t *testing.T) {
+		rec := post("/bank_cards/", "key-3", strings.Repeat("a", multipartOverhead+17))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		mockService.AssertNotCalled(t, "Begin", mock.Anything, userID, "key-3", mock.Anything)
+	})
+
+	t.Run("MultipartBoundaryIgnored", func(t *testing.T) {
+		var hashes []string
+		mockService.On("Begin", mock.Anything, userID, "upload", mock.AnythingOfType("string")).
+			Run(func(args mock.Arguments) { hashes = append(hashes, args.String(3)) }).
+			Return(nil, nil).Twice()
+		mockService.On("Complete", mock.Anything, userID, "upload", mock.Anything, http.StatusNoContent, mock.Anything, mock.Anything).
+			Return(nil).Twice()
+
+		for _, boundary := range []string{"first-boundary", "second-boundary-which-is-longer"} {
+			var body bytes.Buffer
+			writer := multipart.NewWriter(&body)
+			require.NoError(t, writer.SetBoundary(boundary))
+			part, err := writer.CreateFormFile("file", "notes.txt")
+			require.NoError(t, err)
+			part.Write([]byte(strings.Repeat("content ", 1<<18)))
+			require.NoError(t, writer.Close())
+
+			req, _ := http.NewRequest(http.MethodPost, "/file_data/", &body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			req.Header.Set("Idempotency-Key", "upload")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+		}
+		require.Len(t, hashes, 2)
+		assert.Equal(t, hashes[0], hashes[1])
+		mockService.AssertExpectations(t)
+	})
+}
+
+func TestReplacingWriter(t *testing.T) {
+	input := "xxABCxxAB" + "CxABABCx"
+	for chunk := 1; chunk <= len(input); chunk++ {
+		var out bytes.Buffer
+		w := &replacingWriter{w: &out, old: []byte("ABC"), new: []byte("-")}
+		for i := 0; i < len(input); i += chunk {
+			_, err := w.Write([]byte(input[i:min(i+chunk, len(input))]))
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+		assert.Equal(t, "xx-xx-xAB-x", out.String(), "chunk %d", chunk)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/eac0de/xandy/internal/importers"
+	"github.com/eac0de/xandy/internal/services"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IImportService interface {
+	Import(ctx context.Context, userID uuid.UUID, format importers.Format, data []byte, password string, dryRun bool) (*services.ImportReport, error)
+}
+
+type ImportHandlers struct {
+	importService IImportService
+}
+
+func NewImportHandlers(
+	importService IImportService,
+) *ImportHandlers {
+	return &ImportHandlers{
+		importService: importService,
+	}
+}
+
+func (ih *ImportHandlers) Import(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	// Форму разбираем явно, иначе превышение размера PostForm вернёт как пустое поле
+	if _, err := c.MultipartForm(); err != nil {
+		formFileError(c, err)
+		return
+	}
+	format := c.PostForm("format")
+	if format == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "format is required"})
+		return
+	}
+	var dryRun bool
+	if dryRunString := c.PostForm("dry_run"); dryRunString != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(dryRunString)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid dry_run value"})
+			return
+		}
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		formFileError(c, err)
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": err.Error()})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": err.Error()})
+		return
+	}
+	report, err := ih.importService.Import(
+		c.Request.Context(),
+		userID,
+		importers.Format(format),
+		data,
+		c.PostForm("password"),
+		dryRun,
+	)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	if dryRun {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+	c.JSON(http.StatusCreated, report)
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/importers"
+	"github.com/eac0de/xandy/internal/services"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockIImportService struct {
+	mock.Mock
+}
+
+func (m *MockIImportService) Import(ctx context.Context, userID uuid.UUID, format importers.Format, data []byte, password string, dryRun bool) (*services.ImportReport, error) {
+	args := m.Called(ctx, userID, format, data, password, dryRun)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*services.ImportReport), args.Error(1)
+}
+
+func newImportRequest(t *testing.T, fields map[string]string, withFile bool) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for key, value := range fields {
+		writer.WriteField(key, value)
+	}
+	if withFile {
+		fileWriter, err := writer.CreateFormFile("file", "export.csv")
+		if err != nil {
+			t.Fatalf("Failed to create form file: %v", err)
+		}
+		fileWriter.Write([]byte("name,url,username,password\n"))
+	}
+	writer.Close()
+	req, _ := http.NewRequest(http.MethodPost, "/import/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestImport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIImportService)
+	handlers := NewImportHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.POST("/import/", MaxUploadSize(1024), handlers.Import)
+
+	t.Run("Success", func(t *testing.T) {
+		req := newImportRequest(t, map[string]string{"format": "chrome_csv"}, true)
+		rec := httptest.NewRecorder()
+		mockService.On("Import", mock.Anything, userID, importers.FormatChromeCSV, mock.Anything, "", false).Return(&services.ImportReport{}, nil).Once()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("DryRun", func(t *testing.T) {
+		req := newImportRequest(t, map[string]string{"format": "keepass_kdbx", "password": "master", "dry_run": "true"}, true)
+		rec := httptest.NewRecorder()
+		mockService.On("Import", mock.Anything, userID, importers.FormatKeePassKDBX, mock.Anything, "master", true).Return(&services.ImportReport{DryRun: true}, nil).Once()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("MissingFormat", func(t *testing.T) {
+		req := newImportRequest(t, map[string]string{}, true)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"detail":"format is required"}`, rec.Body.String())
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		writer.WriteField("format", "chrome_csv")
+		fileWriter, _ := writer.CreateFormFile("file", "export.csv")
+		fileWriter.Write(bytes.Repeat([]byte("a"), 2*multipartOverhead))
+		writer.Close()
+		req, _ := http.NewRequest(http.MethodPost, "/import/", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+
+	t.Run("MissingFile", func(t *testing.T) {
+		req := newImportRequest(t, map[string]string{"format": "chrome_csv"}, false)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Service Error", func(t *testing.T) {
+		req := newImportRequest(t, map[string]string{"format": "lastpass"}, true)
+		rec := httptest.NewRecorder()
+		mockService.On("Import", mock.Anything, userID, importers.Format("lastpass"), mock.Anything, "", false).Return(nil, httperror.New(nil, "Unsupported import format: lastpass", http.StatusBadRequest)).Once()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"detail":"Unsupported import format: lastpass"}`, rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+}
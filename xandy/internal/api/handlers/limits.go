@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Запас на заголовки частей и текстовые поля multipart формы
+const multipartOverhead = 1 << 20
+
+// MaxUploadSize ограничивает тело запроса с файлом. Без ограничения gin сначала
+// сохраняет файл во временный файл целиком, и размер проверяется только после этого.
+// Точный размер файла и квота пользователя проверяются сервисом при чтении содержимого.
+func MaxUploadSize(maxFileSize int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxFileSize > 0 {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxFileSize+multipartOverhead)
+		}
+		c.Next()
+	}
+}
+
+// formFileError отвечает на ошибку чтения файла из multipart формы
+func formFileError(c *gin.Context, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"detail": fmt.Sprintf("File exceeds the maximum size of %d bytes", maxBytesErr.Limit-multipartOverhead)})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+}
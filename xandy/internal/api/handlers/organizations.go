@@ -0,0 +1,440 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IOrganizationService interface {
+	CreateOrganization(ctx context.Context, userID uuid.UUID, name string) (*models.Organization, error)
+	GetOrganizations(ctx context.Context, userID uuid.UUID) ([]models.Organization, error)
+	GetOrganization(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID) (*models.Organization, error)
+	UpdateOrganization(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, name string) (*models.Organization, error)
+	DeleteOrganization(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID) error
+
+	GetMembers(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID) ([]models.OrganizationMember, error)
+	AddMember(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, email string, role models.OrganizationRole) (*models.OrganizationMember, error)
+	UpdateMember(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, memberID uuid.UUID, role models.OrganizationRole) (*models.OrganizationMember, error)
+	RemoveMember(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, memberID uuid.UUID) error
+
+	GetCollections(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID) ([]models.Collection, error)
+	CreateCollection(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, name string) (*models.Collection, error)
+	UpdateCollection(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, collectionID uuid.UUID, name string) (*models.Collection, error)
+	DeleteCollection(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, collectionID uuid.UUID) error
+
+	GetCollectionGrants(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, collectionID uuid.UUID) ([]models.CollectionGrant, error)
+	GrantCollection(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, collectionID uuid.UUID, memberID uuid.UUID, permission models.CollectionPermission) (*models.CollectionGrant, error)
+	RevokeCollection(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, collectionID uuid.UUID, memberID uuid.UUID) error
+
+	MoveRecord(ctx context.Context, userID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID, collectionID uuid.UUID) error
+
+	ExportAudit(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, filter models.AuditFilter, w io.Writer) error
+}
+
+// OrganizationHandlers обслуживают организации, их участников, коллекции и доступы к коллекциям.
+// Записи коллекций читаются и меняются через обычные маршруты записей.
+type OrganizationHandlers struct {
+	organizationService IOrganizationService
+}
+
+func NewOrganizationHandlers(organizationService IOrganizationService) *OrganizationHandlers {
+	return &OrganizationHandlers{
+		organizationService: organizationService,
+	}
+}
+
+func (oh *OrganizationHandlers) CreateOrganization(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	var requestData struct {
+		Name string `json:"name"`
+	}
+	if err := c.BindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	organization, err := oh.organizationService.CreateOrganization(c.Request.Context(), userID, requestData.Name)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusCreated, organization)
+}
+
+func (oh *OrganizationHandlers) GetOrganizations(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	organizations, err := oh.organizationService.GetOrganizations(c.Request.Context(), userID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, organizations)
+}
+
+func (oh *OrganizationHandlers) GetOrganization(c *gin.Context) {
+	organizationID, ok := uuidParam(c, "org_id", "Invalid organization id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	organization, err := oh.organizationService.GetOrganization(c.Request.Context(), userID, organizationID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, organization)
+}
+
+func (oh *OrganizationHandlers) UpdateOrganization(c *gin.Context) {
+	organizationID, ok := uuidParam(c, "org_id", "Invalid organization id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	var requestData struct {
+		Name string `json:"name"`
+	}
+	if err := c.BindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	organization, err := oh.organizationService.UpdateOrganization(c.Request.Context(), userID, organizationID, requestData.Name)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, organization)
+}
+
+func (oh *OrganizationHandlers) DeleteOrganization(c *gin.Context) {
+	organizationID, ok := uuidParam(c, "org_id", "Invalid organization id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	if err := oh.organizationService.DeleteOrganization(c.Request.Context(), userID, organizationID); err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.String(http.StatusNoContent, "")
+}
+
+func (oh *OrganizationHandlers) GetMembers(c *gin.Context) {
+	organizationID, ok := uuidParam(c, "org_id", "Invalid organization id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	members, err := oh.organizationService.GetMembers(c.Request.Context(), userID, organizationID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+func (oh *OrganizationHandlers) AddMember(c *gin.Context) {
+	organizationID, ok := uuidParam(c, "org_id", "Invalid organization id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	var requestData struct {
+		Email *string                 `json:"email"`
+		Role  models.OrganizationRole `json:"role"`
+	}
+	if err := c.BindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	if requestData.Email == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "email is required"})
+		return
+	}
+	if requestData.Role == "" {
+		requestData.Role = models.OrganizationRoleMember
+	}
+	member, err := oh.organizationService.AddMember(c.Request.Context(), userID, organizationID, *requestData.Email, requestData.Role)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusCreated, member)
+}
+
+func (oh *OrganizationHandlers) UpdateMember(c *gin.Context) {
+	organizationID, ok := uuidParam(c, "org_id", "Invalid organization id")
+	if !ok {
+		return
+	}
+	memberID, ok := uuidParam(c, "user_id", "Invalid user id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	var requestData struct {
+		Role models.OrganizationRole `json:"role"`
+	}
+	if err := c.BindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	member, err := oh.organizationService.UpdateMember(c.Request.Context(), userID, organizationID, memberID, requestData.Role)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, member)
+}
+
+func (oh *OrganizationHandlers) RemoveMember(c *gin.Context) {
+	organizationID, ok := uuidParam(c, "org_id", "Invalid organization id")
+	if !ok {
+		return
+	}
+	memberID, ok := uuidParam(c, "user_id", "Invalid user id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	if err := oh.organizationService.RemoveMember(c.Request.Context(), userID, organizationID, memberID); err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.String(http.StatusNoContent, "")
+}
+
+func (oh *OrganizationHandlers) GetCollections(c *gin.Context) {
+	organizationID, ok := uuidParam(c, "org_id", "Invalid organization id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	collections, err := oh.organizationService.GetCollections(c.Request.Context(), userID, organizationID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, collections)
+}
+
+func (oh *OrganizationHandlers) CreateCollection(c *gin.Context) {
+	organizationID, ok := uuidParam(c, "org_id", "Invalid organization id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	var requestData struct {
+		Name string `json:"name"`
+	}
+	if err := c.BindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	collection, err := oh.organizationService.CreateCollection(c.Request.Context(), userID, organizationID, requestData.Name)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusCreated, collection)
+}
+
+func (oh *OrganizationHandlers) UpdateCollection(c *gin.Context) {
+	organizationID, ok := uuidParam(c, "org_id", "Invalid organization id")
+	if !ok {
+		return
+	}
+	collectionID, ok := uuidParam(c, "collection_id", "Invalid collection id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	var requestData struct {
+		Name string `json:"name"`
+	}
+	if err := c.BindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	collection, err := oh.organizationService.UpdateCollection(c.Request.Context(), userID, organizationID, collectionID, requestData.Name)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, collection)
+}
+
+func (oh *OrganizationHandlers) DeleteCollection(c *gin.Context) {
+	organizationID, ok := uuidParam(c, "org_id", "Invalid organization id")
+	if !ok {
+		return
+	}
+	collectionID, ok := uuidParam(c, "collection_id", "Invalid collection id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	if err := oh.organizationService.DeleteCollection(c.Request.Context(), userID, organizationID, collectionID); err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.String(http.StatusNoContent, "")
+}
+
+func (oh *OrganizationHandlers) GetCollectionGrants(c *gin.Context) {
+	organizationID, ok := uuidParam(c, "org_id", "Invalid organization id")
+	if !ok {
+		return
+	}
+	collectionID, ok := uuidParam(c, "collection_id", "Invalid collection id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	grants, err := oh.organizationService.GetCollectionGrants(c.Request.Context(), userID, organizationID, collectionID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, grants)
+}
+
+func (oh *OrganizationHandlers) GrantCollection(c *gin.Context) {
+	organizationID, ok := uuidParam(c, "org_id", "Invalid organization id")
+	if !ok {
+		return
+	}
+	collectionID, ok := uuidParam(c, "collection_id", "Invalid collection id")
+	if !ok {
+		return
+	}
+	memberID, ok := uuidParam(c, "user_id", "Invalid user id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	var requestData struct {
+		Permission models.CollectionPermission `json:"permission"`
+	}
+	if err := c.BindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	if requestData.Permission == "" {
+		requestData.Permission = models.CollectionPermissionRead
+	}
+	grant, err := oh.organizationService.GrantCollection(c.Request.Context(), userID, organizationID, collectionID, memberID, requestData.Permission)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, grant)
+}
+
+func (oh *OrganizationHandlers) RevokeCollection(c *gin.Context) {
+	organizationID, ok := uuidParam(c, "org_id", "Invalid organization id")
+	if !ok {
+		return
+	}
+	collectionID, ok := uuidParam(c, "collection_id", "Invalid collection id")
+	if !ok {
+		return
+	}
+	memberID, ok := uuidParam(c, "user_id", "Invalid user id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	if err := oh.organizationService.RevokeCollection(c.Request.Context(), userID, organizationID, collectionID, memberID); err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.String(http.StatusNoContent, "")
+}
+
+// MoveRecord переносит запись в коллекцию организации
+func (oh *OrganizationHandlers) MoveRecord(dataKind models.DataKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dataID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid data id"})
+			return
+		}
+		userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+		var requestData struct {
+			CollectionID *uuid.UUID `json:"collection_id"`
+		}
+		if err := c.BindJSON(&requestData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+			return
+		}
+		if requestData.CollectionID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "collection_id is required"})
+			return
+		}
+		err = oh.organizationService.MoveRecord(c.Request.Context(), userID, dataKind, dataID, *requestData.CollectionID)
+		if err != nil {
+			msg, statusCode := httperror.GetMessageAndStatusCode(err)
+			c.JSON(statusCode, gin.H{"detail": msg})
+			return
+		}
+		c.String(http.StatusNoContent, "")
+	}
+}
+
+// ExportAudit отдаёт журнал аудита организации в формате NDJSON, по событию в строке
+func (oh *OrganizationHandlers) ExportAudit(c *gin.Context) {
+	organizationID, ok := uuidParam(c, "org_id", "Invalid organization id")
+	if !ok {
+		return
+	}
+	filter, ok := auditFilterQuery(c)
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	w := &attachmentWriter{c: c, fileName: fmt.Sprintf("audit-%s.ndjson", organizationID), contentType: "application/x-ndjson"}
+	err := oh.organizationService.ExportAudit(c.Request.Context(), userID, organizationID, filter, w)
+	if err != nil {
+		if c.Writer.Written() {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+}
+
+func uuidParam(c *gin.Context, name string, detail string) (uuid.UUID, bool) {
+	value, err := uuid.Parse(c.Param(name))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": detail})
+		return uuid.Nil, false
+	}
+	return value, true
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockIOrganizationService struct {
+	mock.Mock
+}
+
+func (m *MockIOrganizationService) CreateOrganization(ctx context.Context, userID uuid.UUID, name string) (*models.Organization, error) {
+	args := m.Called(ctx, userID, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Organization), args.Error(1)
+}
+
+func (m *MockIOrganizationService) GetOrganizations(ctx context.Context, userID uuid.UUID) ([]models.Organization, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Organization), args.Error(1)
+}
+
+func (m *MockIOrganizationService) GetOrganization(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID) (*models.Organization, error) {
+	args := m.Called(ctx, userID, organizationID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Organization), args.Error(1)
+}
+
+func (m *MockIOrganizationService) UpdateOrganization(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, name string) (*models.Organization, error) {
+	args := m.Called(ctx, userID, organizationID, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Organization), args.Error(1)
+}
+
+func (m *MockIOrganizationService) DeleteOrganization(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID) error {
+	args := m.Called(ctx, userID, organizationID)
+	return args.Error(0)
+}
+
+func (m *MockIOrganizationService) GetMembers(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID) ([]models.OrganizationMember, error) {
+	args := m.Called(ctx, userID, organizationID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.OrganizationMember), args.Error(1)
+}
+
+func (m *MockIOrganizationService) AddMember(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, email string, role models.OrganizationRole) (*models.OrganizationMember, error) {
+	args := m.Called(ctx, userID, organizationID, email, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.OrganizationMember), args.Error(1)
+}
+
+func (m *MockIOrganizationService) UpdateMember(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, memberID uuid.UUID, role models.OrganizationRole) (*models.OrganizationMember, error) {
+	args := m.Called(ctx, userID, organizationID, memberID, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.OrganizationMember), args.Error(1)
+}
+
+func (m *MockIOrganizationService) RemoveMember(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, memberID uuid.UUID) error {
+	args := m.Called(ctx, userID, organizationID, memberID)
+	return args.Error(0)
+}
+
+func (m *MockIOrganizationService) GetCollections(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID) ([]models.Collection, error) {
+	args := m.Called(ctx, userID, organizationID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Collection), args.Error(1)
+}
+
+func (m *MockIOrganizationService) CreateCollection(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, name string) (*models.Collection, error) {
+	args := m.Called(ctx, userID, organizationID, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Collection), args.Error(1)
+}
+
+func (m *MockIOrganizationService) UpdateCollection(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, collectionID uuid.UUID, name string) (*models.Collection, error) {
+	args := m.Called(ctx, userID, organizationID, collectionID, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Collection), args.Error(1)
+}
+
+func (m *MockIOrganizationService) DeleteCollection(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, collectionID uuid.UUID) error {
+	args := m.Called(ctx, userID, organizationID, collectionID)
+	return args.Error(0)
+}
+
+func (m *MockIOrganizationService) GetCollectionGrants(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, collectionID uuid.UUID) ([]models.CollectionGrant, error) {
+	args := m.Called(ctx, userID, organizationID, collectionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.CollectionGrant), args.Error(1)
+}
+
+func (m *MockIOrganizationService) GrantCollection(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, collectionID uuid.UUID, memberID uuid.UUID, permission models.CollectionPermission) (*models.CollectionGrant, error) {
+	args := m.Called(ctx, userID, organizationID, collectionID, memberID, permission)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.CollectionGrant), args.Error(1)
+}
+
+func (m *MockIOrganizationService) RevokeCollection(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, collectionID uuid.UUID, memberID uuid.UUID) error {
+	args := m.Called(ctx, userID, organizationID, collectionID, memberID)
+	return args.Error(0)
+}
+
+func (m *MockIOrganizationService) MoveRecord(ctx context.Context, userID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID, collectionID uuid.UUID) error {
+	args := m.Called(ctx, userID, dataKind, dataID, collectionID)
+	return args.Error(0)
+}
+
+func (m *MockIOrganizationService) ExportAudit(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, filter models.AuditFilter, w io.Writer) error {
+	args := m.Called(ctx, userID, organizationID, filter, w)
+	return args.Error(0)
+}
+
+func TestOrganizations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIOrganizationService)
+	handlers := NewOrganizationHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.POST("/organizations/", handlers.CreateOrganization)
+	authenticatedGroup.GET("/organizations/:org_id/", handlers.GetOrganization)
+	authenticatedGroup.POST("/organizations/:org_id/members/", handlers.AddMember)
+	authenticatedGroup.PUT("/organizations/:org_id/members/:user_id/", handlers.UpdateMember)
+	authenticatedGroup.DELETE("/organizations/:org_id/members/:user_id/", handlers.RemoveMember)
+	authenticatedGroup.POST("/organizations/:org_id/collections/", handlers.CreateCollection)
+	authenticatedGroup.DELETE("/organizations/:org_id/collections/:collection_id/", handlers.DeleteCollection)
+	authenticatedGroup.PUT("/organizations/:org_id/collections/:collection_id/grants/:user_id/", handlers.GrantCollection)
+	authenticatedGroup.PUT("/text_data/:id/collection/", handlers.MoveRecord(models.KindTextData))
+	authenticatedGroup.GET("/organizations/:org_id/audit/export/", handlers.ExportAudit)
+
+	organizationID := uuid.New()
+	collectionID := uuid.New()
+	memberID := uuid.New()
+	orgPath := "/organizations/" + organizationID.String()
+
+	t.Run("CreateOrganization", func(t *testing.T) {
+		organization := &models.Organization{ID: organizationID, Name: "Team", Role: models.OrganizationRoleOwner}
+		mockService.On("CreateOrganization", mock.Anything, userID, "Team").Return(organization, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/organizations/", bytes.NewReader([]byte(`{"name":"Team"}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"role":"owner"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("GetOrganizationNotMember", func(t *testing.T) {
+		mockService.On("GetOrganization", mock.Anything, userID, organizationID).Return(nil, httperror.New(nil, "Organization not found", http.StatusNotFound)).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, orgPath+"/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.JSONEq(t, `{"detail":"Organization not found"}`, rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("InvalidOrganizationID", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/organizations/invalid/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"detail":"Invalid organization id"}`, rec.Body.String())
+	})
+
+	t.Run("AddMemberDefaultRole", func(t *testing.T) {
+		member := &models.OrganizationMember{OrganizationID: organizationID, UserID: memberID, Email: "colleague@example.com", Role: models.OrganizationRoleMember}
+		mockService.On("AddMember", mock.Anything, userID, organizationID, "colleague@example.com", models.OrganizationRoleMember).Return(member, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, orgPath+"/members/", bytes.NewReader([]byte(`{"email":"colleague@example.com"}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"role":"member"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("AddMemberWithoutEmail", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, orgPath+"/members/", bytes.NewReader([]byte(`{"role":"admin"}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"detail":"email is required"}`, rec.Body.String())
+	})
+
+	t.Run("UpdateMemberForbidden", func(t *testing.T) {
+		mockService.On("UpdateMember", mock.Anything, userID, organizationID, memberID, models.OrganizationRoleOwner).Return(nil, httperror.New(nil, "Only owners can manage owners", http.StatusForbidden)).Once()
+
+		req, _ := http.NewRequest(http.MethodPut, orgPath+"/members/"+memberID.String()+"/", bytes.NewReader([]byte(`{"role":"owner"}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.JSONEq(t, `{"detail":"Only owners can manage owners"}`, rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("RemoveMember", func(t *testing.T) {
+		mockService.On("RemoveMember", mock.Anything, userID, organizationID, memberID).Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodDelete, orgPath+"/members/"+memberID.String()+"/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("DeleteCollectionNotEmpty", func(t *testing.T) {
+		mockService.On("DeleteCollection", mock.Anything, userID, organizationID, collectionID).Return(httperror.New(nil, "Collection is not empty", http.StatusConflict)).Once()
+
+		req, _ := http.NewRequest(http.MethodDelete, orgPath+"/collections/"+collectionID.String()+"/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("GrantCollectionDefaultPermission", func(t *testing.T) {
+		grant := &models.CollectionGrant{CollectionID: collectionID, UserID: memberID, Email: "colleague@example.com", Permission: models.CollectionPermissionRead}
+		mockService.On("GrantCollection", mock.Anything, userID, organizationID, collectionID, memberID, models.CollectionPermissionRead).Return(grant, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPut, orgPath+"/collections/"+collectionID.String()+"/grants/"+memberID.String()+"/", bytes.NewReader([]byte(`{}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"permission":"read"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("MoveRecord", func(t *testing.T) {
+		dataID := uuid.New()
+		mockService.On("MoveRecord", mock.Anything, userID, models.KindTextData, dataID, collectionID).Return(nil).Once()
+
+		body := []byte(`{"collection_id":"` + collectionID.String() + `"}`)
+		req, _ := http.NewRequest(http.MethodPut, "/text_data/"+dataID.String()+"/collection/", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("MoveRecordWithoutCollection", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPut, "/text_data/"+uuid.New().String()+"/collection/", bytes.NewReader([]byte(`{}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"detail":"collection_id is required"}`, rec.Body.String())
+	})
+
+	t.Run("ExportAudit", func(t *testing.T) {
+		filter := models.AuditFilter{Action: models.AuditActionRead}
+		mockService.On("ExportAudit", mock.Anything, userID, organizationID, filter, mock.Anything).
+			Run(func(args mock.Arguments) {
+				io.WriteString(args.Get(4).(io.Writer), `{"action":"read"}`+"\n")
+			}).
+			Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, orgPath+"/audit/export/?action=read", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+		assert.Equal(t, `{"action":"read"}`+"\n", rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("ExportAuditNotAdmin", func(t *testing.T) {
+		mockService.On("ExportAudit", mock.Anything, userID, organizationID, models.AuditFilter{}, mock.Anything).
+			Return(httperror.New(nil, "Not enough rights in the organization", http.StatusForbidden)).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, orgPath+"/audit/export/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+}
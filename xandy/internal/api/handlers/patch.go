@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Content-Type тела частичного обновления по RFC 7396, application/json тоже принимается
+const mergePatchContentType = "application/merge-patch+json"
+
+// PatchRecord меняет только переданные поля записи, значения metadata объединяются по ключам,
+// а null удаляет ключ
+func (ah *UserDataHandlers) PatchRecord(dataKind models.DataKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dataID, ok := uuidParam(c, "id", "Invalid data id")
+		if !ok {
+			return
+		}
+		if contentType := c.ContentType(); contentType != mergePatchContentType && contentType != gin.MIMEJSON {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"detail": "Content-Type must be " + mergePatchContentType})
+			return
+		}
+		userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+		var patch map[string]interface{}
+		if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil || patch == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "Merge patch must be a JSON object"})
+			return
+		}
+		record, err := ah.userDataService.PatchRecord(c.Request.Context(), userID, dataKind, dataID, patch)
+		if err != nil {
+			msg, statusCode := httperror.GetMessageAndStatusCode(err)
+			c.JSON(statusCode, gin.H{"detail": msg})
+			return
+		}
+		c.JSON(http.StatusOK, record)
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPatchRecord(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIUserDataService)
+	handlers := NewUserDataHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.PATCH("/bank_cards/:id/", handlers.PatchRecord(models.KindBankCard))
+
+	dataID := uuid.New()
+
+	t.Run("Success", func(t *testing.T) {
+		patch := map[string]interface{}{
+			"name":     "Travel card",
+			"metadata": map[string]interface{}{"bank": nil, "limit": float64(100)},
+		}
+		card := &models.UserBankCard{BaseUserData: models.BaseUserData{ID: dataID, Name: "Travel card"}}
+		mockService.On("PatchRecord", mock.Anything, userID, models.KindBankCard, dataID, patch).Return(card, nil).Once()
+
+		body := `{"name":"Travel card","metadata":{"bank":null,"limit":100}}`
+		req, _ := http.NewRequest(http.MethodPatch, "/bank_cards/"+dataID.String()+"/", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"name":"Travel card"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("ServiceError", func(t *testing.T) {
+		mockService.On("PatchRecord", mock.Anything, userID, models.KindBankCard, dataID, mock.Anything).
+			Return(nil, httperror.New(nil, "Field id can not be patched", http.StatusBadRequest)).Once()
+
+		req, _ := http.NewRequest(http.MethodPatch, "/bank_cards/"+dataID.String()+"/", bytes.NewReader([]byte(`{"id":"x"}`)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Field id can not be patched")
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("NotAnObject", func(t *testing.T) {
+		for _, body := range []string{`null`, `["name"]`, `{"name":`} {
+			req, _ := http.NewRequest(http.MethodPatch, "/bank_cards/"+dataID.String()+"/", bytes.NewReader([]byte(body)))
+			req.Header.Set("Content-Type", "application/merge-patch+json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		}
+	})
+
+	t.Run("UnsupportedMediaType", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPatch, "/bank_cards/"+dataID.String()+"/", bytes.NewReader([]byte(`{"name":"x"}`)))
+		req.Header.Set("Content-Type", "text/plain")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+}
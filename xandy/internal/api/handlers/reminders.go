@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IReminderService interface {
+	GetPreferences(ctx context.Context, userID uuid.UUID) (*models.ReminderPreferences, error)
+	UpdatePreferences(ctx context.Context, userID uuid.UUID, cardExpiry *bool, credentialRotation *bool) (*models.ReminderPreferences, error)
+}
+
+type ReminderHandlers struct {
+	reminderService IReminderService
+}
+
+func NewReminderHandlers(reminderService IReminderService) *ReminderHandlers {
+	return &ReminderHandlers{
+		reminderService: reminderService,
+	}
+}
+
+func (rh *ReminderHandlers) GetPreferences(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	preferences, err := rh.reminderService.GetPreferences(c.Request.Context(), userID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, preferences)
+}
+
+// UpdatePreferences меняет только переданные настройки
+func (rh *ReminderHandlers) UpdatePreferences(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	var requestData struct {
+		CardExpiry         *bool `json:"card_expiry"`
+		CredentialRotation *bool `json:"credential_rotation"`
+	}
+	if err := c.BindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	preferences, err := rh.reminderService.UpdatePreferences(c.Request.Context(), userID, requestData.CardExpiry, requestData.CredentialRotation)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, preferences)
+}
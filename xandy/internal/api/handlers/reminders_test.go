@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockIReminderService struct {
+	mock.Mock
+}
+
+func (m *MockIReminderService) GetPreferences(ctx context.Context, userID uuid.UUID) (*models.ReminderPreferences, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ReminderPreferences), args.Error(1)
+}
+
+func (m *MockIReminderService) UpdatePreferences(ctx context.Context, userID uuid.UUID, cardExpiry *bool, credentialRotation *bool) (*models.ReminderPreferences, error) {
+	args := m.Called(ctx, userID, cardExpiry, credentialRotation)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ReminderPreferences), args.Error(1)
+}
+
+func TestReminders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIReminderService)
+	handlers := NewReminderHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.GET("/reminders/preferences/", handlers.GetPreferences)
+	authenticatedGroup.PUT("/reminders/preferences/", handlers.UpdatePreferences)
+
+	t.Run("GetPreferences", func(t *testing.T) {
+		preferences := models.NewReminderPreferences(userID)
+		mockService.On("GetPreferences", mock.Anything, userID).Return(&preferences, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/reminders/preferences/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"card_expiry":true`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("UpdatePreferences", func(t *testing.T) {
+		preferences := models.NewReminderPreferences(userID)
+		preferences.CardExpiry = false
+		mockService.On("UpdatePreferences", mock.Anything, userID, mock.MatchedBy(func(cardExpiry *bool) bool {
+			return cardExpiry != nil && !*cardExpiry
+		}), (*bool)(nil)).Return(&preferences, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPut, "/reminders/preferences/", bytes.NewReader([]byte(`{"card_expiry":false}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"card_expiry":false`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("UpdatePreferencesInvalidBody", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPut, "/reminders/preferences/", bytes.NewReader([]byte(`{"card_expiry":"no"}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
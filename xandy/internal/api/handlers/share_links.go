@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Путь публичного маршрута ссылки, из него собирается URL для создателя
+const publicLinksPath = "/api/xandy/public/links/"
+
+type IShareLinkService interface {
+	CreateLink(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID, ttl time.Duration, maxViews int, passphrase string) (*models.ShareLink, string, error)
+	GetLinks(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID) ([]models.ShareLink, error)
+	RevokeLink(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID, linkID uuid.UUID) error
+
+	GetPublicLink(ctx context.Context, linkID uuid.UUID) (*models.PublicShareLink, error)
+	OpenLink(ctx context.Context, linkID uuid.UUID, passphrase string) (*models.PublicShareLink, error)
+}
+
+// ShareLinkHandlers обслуживают одноразовые ссылки. Владелец управляет ими через маршруты записи,
+// а открывается ссылка без авторизации через /public/links/.
+type ShareLinkHandlers struct {
+	shareLinkService IShareLinkService
+}
+
+func NewShareLinkHandlers(shareLinkService IShareLinkService) *ShareLinkHandlers {
+	return &ShareLinkHandlers{
+		shareLinkService: shareLinkService,
+	}
+}
+
+// Созданная ссылка. Secret отдаётся только здесь и передаётся получателю во фрагменте URL.
+type createdShareLink struct {
+	models.ShareLink
+	Secret string `json:"secret"`
+	URL    string `json:"url"`
+}
+
+func (slh *ShareLinkHandlers) CreateLink(dataKind models.DataKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dataID, ok := uuidParam(c, "id", "Invalid data id")
+		if !ok {
+			return
+		}
+		userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+		var requestData struct {
+			// Срок жизни ссылки в секундах, по умолчанию сутки
+			ExpiresIn  int64  `json:"expires_in"`
+			MaxViews   int    `json:"max_views"`
+			Passphrase string `json:"passphrase"`
+		}
+		if err := c.BindJSON(&requestData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+			return
+		}
+		if requestData.ExpiresIn == 0 {
+			requestData.ExpiresIn = int64((24 * time.Hour).Seconds())
+		}
+		if requestData.MaxViews == 0 {
+			requestData.MaxViews = 1
+		}
+		shareLink, secret, err := slh.shareLinkService.CreateLink(
+			c.Request.Context(),
+			userID,
+			dataKind,
+			dataID,
+			time.Duration(requestData.ExpiresIn)*time.Second,
+			requestData.MaxViews,
+			requestData.Passphrase,
+		)
+		if err != nil {
+			msg, statusCode := httperror.GetMessageAndStatusCode(err)
+			c.JSON(statusCode, gin.H{"detail": msg})
+			return
+		}
+		c.JSON(http.StatusCreated, createdShareLink{
+			ShareLink: *shareLink,
+			Secret:    secret,
+			URL:       publicLinksPath + shareLink.ID.String() + "/#" + secret,
+		})
+	}
+}
+
+func (slh *ShareLinkHandlers) GetLinks(dataKind models.DataKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dataID, ok := uuidParam(c, "id", "Invalid data id")
+		if !ok {
+			return
+		}
+		userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+		shareLinks, err := slh.shareLinkService.GetLinks(c.Request.Context(), userID, dataKind, dataID)
+		if err != nil {
+			msg, statusCode := httperror.GetMessageAndStatusCode(err)
+			c.JSON(statusCode, gin.H{"detail": msg})
+			return
+		}
+		c.JSON(http.StatusOK, shareLinks)
+	}
+}
+
+func (slh *ShareLinkHandlers) RevokeLink(dataKind models.DataKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dataID, ok := uuidParam(c, "id", "Invalid data id")
+		if !ok {
+			return
+		}
+		linkID, ok := uuidParam(c, "link_id", "Invalid link id")
+		if !ok {
+			return
+		}
+		userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+		err := slh.shareLinkService.RevokeLink(c.Request.Context(), userID, dataKind, dataID, linkID)
+		if err != nil {
+			msg, statusCode := httperror.GetMessageAndStatusCode(err)
+			c.JSON(statusCode, gin.H{"detail": msg})
+			return
+		}
+		c.String(http.StatusNoContent, "")
+	}
+}
+
+// GetPublicLink отдаёт сведения о ссылке, чтобы клиент понял, нужно ли спрашивать фразу-пароль
+func (slh *ShareLinkHandlers) GetPublicLink(c *gin.Context) {
+	linkID, ok := uuidParam(c, "link_id", "Invalid link id")
+	if !ok {
+		return
+	}
+	publicLink, err := slh.shareLinkService.GetPublicLink(c.Request.Context(), linkID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, publicLink)
+}
+
+// OpenLink расходует просмотр. Это POST, чтобы предпросмотр ссылок в мессенджерах её не сжигал.
+func (slh *ShareLinkHandlers) OpenLink(c *gin.Context) {
+	linkID, ok := uuidParam(c, "link_id", "Invalid link id")
+	if !ok {
+		return
+	}
+	var requestData struct {
+		Passphrase string `json:"passphrase"`
+	}
+	// Тело необязательно, если у ссылки нет фразы-пароля
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&requestData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+			return
+		}
+	}
+	publicLink, err := slh.shareLinkService.OpenLink(c.Request.Context(), linkID, requestData.Passphrase)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, publicLink)
+}
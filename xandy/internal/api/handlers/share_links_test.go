@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockIShareLinkService struct {
+	mock.Mock
+}
+
+func (m *MockIShareLinkService) CreateLink(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID, ttl time.Duration, maxViews int, passphrase string) (*models.ShareLink, string, error) {
+	args := m.Called(ctx, ownerID, dataKind, dataID, ttl, maxViews, passphrase)
+	if args.Get(0) == nil {
+		return nil, "", args.Error(2)
+	}
+	return args.Get(0).(*models.ShareLink), args.String(1), args.Error(2)
+}
+
+func (m *MockIShareLinkService) GetLinks(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID) ([]models.ShareLink, error) {
+	args := m.Called(ctx, ownerID, dataKind, dataID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.ShareLink), args.Error(1)
+}
+
+func (m *MockIShareLinkService) RevokeLink(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID, linkID uuid.UUID) error {
+	args := m.Called(ctx, ownerID, dataKind, dataID, linkID)
+	return args.Error(0)
+}
+
+func (m *MockIShareLinkService) GetPublicLink(ctx context.Context, linkID uuid.UUID) (*models.PublicShareLink, error) {
+	args := m.Called(ctx, linkID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PublicShareLink), args.Error(1)
+}
+
+func (m *MockIShareLinkService) OpenLink(ctx context.Context, linkID uuid.UUID, passphrase string) (*models.PublicShareLink, error) {
+	args := m.Called(ctx, linkID, passphrase)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PublicShareLink), args.Error(1)
+}
+
+func TestShareLinks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIShareLinkService)
+	handlers := NewShareLinkHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.POST("/text_data/:id/links/", handlers.CreateLink(models.KindTextData))
+	authenticatedGroup.GET("/text_data/:id/links/", handlers.GetLinks(models.KindTextData))
+	authenticatedGroup.DELETE("/text_data/:id/links/:link_id/", handlers.RevokeLink(models.KindTextData))
+	router.GET("/public/links/:link_id/", handlers.GetPublicLink)
+	router.POST("/public/links/:link_id/", handlers.OpenLink)
+
+	dataID := uuid.New()
+	linkID := uuid.New()
+
+	t.Run("CreateWithDefaults", func(t *testing.T) {
+		shareLink := &models.ShareLink{ID: linkID, OwnerID: userID, DataKind: models.KindTextData, DataID: dataID, Content: []byte("sealed"), MaxViews: 1}
+		mockService.On("CreateLink", mock.Anything, userID, models.KindTextData, dataID, 24*time.Hour, 1, "").Return(shareLink, "c2VjcmV0", nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/text_data/"+dataID.String()+"/links/", bytes.NewReader([]byte(`{}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"secret":"c2VjcmV0"`)
+		assert.Contains(t, rec.Body.String(), `"url":"/api/xandy/public/links/`+linkID.String()+`/#c2VjcmV0"`)
+		assert.NotContains(t, rec.Body.String(), `"content"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("CreateInvalidLifetime", func(t *testing.T) {
+		mockService.On("CreateLink", mock.Anything, userID, models.KindTextData, dataID, 10*time.Second, 3, "pass").
+			Return(nil, "", httperror.New(nil, "Link lifetime must be from 1 minute to 30 days", http.StatusUnprocessableEntity)).Once()
+
+		body := []byte(`{"expires_in":10,"max_views":3,"passphrase":"pass"}`)
+		req, _ := http.NewRequest(http.MethodPost, "/text_data/"+dataID.String()+"/links/", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("GetLinks", func(t *testing.T) {
+		mockService.On("GetLinks", mock.Anything, userID, models.KindTextData, dataID).Return([]models.ShareLink{{ID: linkID, MaxViews: 2, Views: 1}}, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/text_data/"+dataID.String()+"/links/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"views":1`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		mockService.On("RevokeLink", mock.Anything, userID, models.KindTextData, dataID, linkID).Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodDelete, "/text_data/"+dataID.String()+"/links/"+linkID.String()+"/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("GetPublicLink", func(t *testing.T) {
+		publicLink := &models.PublicShareLink{DataKind: models.KindTextData, HasPassphrase: true, ViewsLeft: 1}
+		mockService.On("GetPublicLink", mock.Anything, linkID).Return(publicLink, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/public/links/"+linkID.String()+"/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"has_passphrase":true`)
+		assert.NotContains(t, rec.Body.String(), `"content"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("OpenWithoutBody", func(t *testing.T) {
+		publicLink := &models.PublicShareLink{DataKind: models.KindTextData, Content: []byte("sealed")}
+		mockService.On("OpenLink", mock.Anything, linkID, "").Return(publicLink, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/public/links/"+linkID.String()+"/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"content":"c2VhbGVk"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("OpenWrongPassphrase", func(t *testing.T) {
+		mockService.On("OpenLink", mock.Anything, linkID, "wrong").Return(nil, httperror.New(nil, "Wrong passphrase", http.StatusForbidden)).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/public/links/"+linkID.String()+"/", bytes.NewReader([]byte(`{"passphrase":"wrong"}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("OpenInvalidID", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/public/links/bad/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/internal/services"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IShareService interface {
+	ShareRecord(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID, email string, permission models.SharePermission, encryptedKey string) (*models.Share, error)
+	GetRecordShares(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID) ([]models.Share, error)
+	RevokeShare(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID, shareID uuid.UUID) error
+
+	GetSharedWithMe(ctx context.Context, granteeID uuid.UUID, offset int) ([]models.Share, error)
+	GetSharedRecord(ctx context.Context, granteeID uuid.UUID, shareID uuid.UUID) (*models.SharedRecord, error)
+	UpdateSharedRecord(ctx context.Context, granteeID uuid.UUID, shareID uuid.UUID, update services.RecordUpdate) (*models.SharedRecord, error)
+	GetSharedFileContent(ctx context.Context, granteeID uuid.UUID, shareID uuid.UUID, attachmentID *uuid.UUID) (*models.UserFileData, io.ReadSeekCloser, error)
+	LeaveShare(ctx context.Context, granteeID uuid.UUID, shareID uuid.UUID) error
+}
+
+// ShareHandlers обслуживают доступ к записям для других пользователей.
+// Владелец управляет доступом через маршруты записи, получатель работает с записью через /shared/.
+type ShareHandlers struct {
+	shareService IShareService
+}
+
+func NewShareHandlers(shareService IShareService) *ShareHandlers {
+	return &ShareHandlers{
+		shareService: shareService,
+	}
+}
+
+func (sh *ShareHandlers) ShareRecord(dataKind models.DataKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dataID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid data id"})
+			return
+		}
+		userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+		var requestData struct {
+			Email        *string                `json:"email"`
+			Permission   models.SharePermission `json:"permission"`
+			EncryptedKey string                 `json:"encrypted_key"`
+		}
+		if err := c.BindJSON(&requestData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+			return
+		}
+		if requestData.Email == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "email is required"})
+			return
+		}
+		if requestData.Permission == "" {
+			requestData.Permission = models.SharePermissionRead
+		}
+		share, err := sh.shareService.ShareRecord(c.Request.Context(), userID, dataKind, dataID, *requestData.Email, requestData.Permission, requestData.EncryptedKey)
+		if err != nil {
+			msg, statusCode := httperror.GetMessageAndStatusCode(err)
+			c.JSON(statusCode, gin.H{"detail": msg})
+			return
+		}
+		c.JSON(http.StatusCreated, share)
+	}
+}
+
+func (sh *ShareHandlers) GetRecordShares(dataKind models.DataKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dataID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid data id"})
+			return
+		}
+		userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+		shares, err := sh.shareService.GetRecordShares(c.Request.Context(), userID, dataKind, dataID)
+		if err != nil {
+			msg, statusCode := httperror.GetMessageAndStatusCode(err)
+			c.JSON(statusCode, gin.H{"detail": msg})
+			return
+		}
+		c.JSON(http.StatusOK, shares)
+	}
+}
+
+func (sh *ShareHandlers) RevokeShare(dataKind models.DataKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dataID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid data id"})
+			return
+		}
+		shareID, ok := shareParam(c)
+		if !ok {
+			return
+		}
+		userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+		err = sh.shareService.RevokeShare(c.Request.Context(), userID, dataKind, dataID, shareID)
+		if err != nil {
+			msg, statusCode := httperror.GetMessageAndStatusCode(err)
+			c.JSON(statusCode, gin.H{"detail": msg})
+			return
+		}
+		c.String(http.StatusNoContent, "")
+	}
+}
+
+func (sh *ShareHandlers) GetSharedWithMe(c *gin.Context) {
+	var offset int64
+	offsetString := c.Query("offset")
+	if offsetString != "" {
+		offset, _ = strconv.ParseInt(offsetString, 10, 64)
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	shares, err := sh.shareService.GetSharedWithMe(c.Request.Context(), userID, int(offset))
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, shares)
+}
+
+func (sh *ShareHandlers) GetSharedRecord(c *gin.Context) {
+	shareID, ok := shareParam(c)
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	sharedRecord, err := sh.shareService.GetSharedRecord(c.Request.Context(), userID, shareID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, sharedRecord)
+}
+
+func (sh *ShareHandlers) UpdateSharedRecord(c *gin.Context) {
+	shareID, ok := shareParam(c)
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	var update services.RecordUpdate
+	if err := c.BindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	sharedRecord, err := sh.shareService.UpdateSharedRecord(c.Request.Context(), userID, shareID, update)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, sharedRecord)
+}
+
+func (sh *ShareHandlers) DownloadSharedFile(c *gin.Context) {
+	shareID, ok := shareParam(c)
+	if !ok {
+		return
+	}
+	var attachmentID *uuid.UUID
+	if c.Param("attachment_id") != "" {
+		id, err := uuid.Parse(c.Param("attachment_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid attachment id"})
+			return
+		}
+		attachmentID = &id
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	userFileData, content, err := sh.shareService.GetSharedFileContent(c.Request.Context(), userID, shareID, attachmentID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	defer content.Close()
+	serveUserFile(c, userFileData, content)
+}
+
+func (sh *ShareHandlers) LeaveShare(c *gin.Context) {
+	shareID, ok := shareParam(c)
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	err := sh.shareService.LeaveShare(c.Request.Context(), userID, shareID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.String(http.StatusNoContent, "")
+}
+
+func shareParam(c *gin.Context) (uuid.UUID, bool) {
+	shareID, err := uuid.Parse(c.Param("share_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid share id"})
+		return uuid.Nil, false
+	}
+	return shareID, true
+}
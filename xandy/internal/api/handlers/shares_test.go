@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/internal/services"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockIShareService struct {
+	mock.Mock
+}
+
+func (m *MockIShareService) ShareRecord(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID, email string, permission models.SharePermission, encryptedKey string) (*models.Share, error) {
+	args := m.Called(ctx, ownerID, dataKind, dataID, email, permission, encryptedKey)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Share), args.Error(1)
+}
+
+func (m *MockIShareService) GetRecordShares(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID) ([]models.Share, error) {
+	args := m.Called(ctx, ownerID, dataKind, dataID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Share), args.Error(1)
+}
+
+func (m *MockIShareService) RevokeShare(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID, shareID uuid.UUID) error {
+	args := m.Called(ctx, ownerID, dataKind, dataID, shareID)
+	return args.Error(0)
+}
+
+func (m *MockIShareService) GetSharedWithMe(ctx context.Context, granteeID uuid.UUID, offset int) ([]models.Share, error) {
+	args := m.Called(ctx, granteeID, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Share), args.Error(1)
+}
+
+func (m *MockIShareService) GetSharedRecord(ctx context.Context, granteeID uuid.UUID, shareID uuid.UUID) (*models.SharedRecord, error) {
+	args := m.Called(ctx, granteeID, shareID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.SharedRecord), args.Error(1)
+}
+
+func (m *MockIShareService) UpdateSharedRecord(ctx context.Context, granteeID uuid.UUID, shareID uuid.UUID, update services.RecordUpdate) (*models.SharedRecord, error) {
+	args := m.Called(ctx, granteeID, shareID, update)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.SharedRecord), args.Error(1)
+}
+
+func (m *MockIShareService) GetSharedFileContent(ctx context.Context, granteeID uuid.UUID, shareID uuid.UUID, attachmentID *uuid.UUID) (*models.UserFileData, io.ReadSeekCloser, error) {
+	args := m.Called(ctx, granteeID, shareID, attachmentID)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(*models.UserFileData), args.Get(1).(io.ReadSeekCloser), args.Error(2)
+}
+
+func (m *MockIShareService) LeaveShare(ctx context.Context, granteeID uuid.UUID, shareID uuid.UUID) error {
+	args := m.Called(ctx, granteeID, shareID)
+	return args.Error(0)
+}
+
+func TestShares(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIShareService)
+	handlers := NewShareHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.POST("/text_data/:id/shares/", handlers.ShareRecord(models.KindTextData))
+	authenticatedGroup.GET("/text_data/:id/shares/", handlers.GetRecordShares(models.KindTextData))
+	authenticatedGroup.DELETE("/text_data/:id/shares/:share_id/", handlers.RevokeShare(models.KindTextData))
+	authenticatedGroup.GET("/shared/", handlers.GetSharedWithMe)
+	authenticatedGroup.GET("/shared/:share_id/", handlers.GetSharedRecord)
+	authenticatedGroup.PUT("/shared/:share_id/", handlers.UpdateSharedRecord)
+	authenticatedGroup.DELETE("/shared/:share_id/", handlers.LeaveShare)
+	authenticatedGroup.GET("/shared/:share_id/download/", handlers.DownloadSharedFile)
+	authenticatedGroup.GET("/shared/:share_id/attachments/:attachment_id/download/", handlers.DownloadSharedFile)
+
+	dataID := uuid.New()
+	shareID := uuid.New()
+
+	t.Run("Share", func(t *testing.T) {
+		share := &models.Share{ID: shareID, OwnerID: userID, GranteeEmail: "friend@example.com", DataKind: models.KindTextData, DataID: dataID, Permission: models.SharePermissionRead, EncryptedKey: "d3JhcHBlZA=="}
+		mockService.On("ShareRecord", mock.Anything, userID, models.KindTextData, dataID, "friend@example.com", models.SharePermissionRead, "d3JhcHBlZA==").Return(share, nil).Once()
+
+		body := []byte(`{"email":"friend@example.com","encrypted_key":"d3JhcHBlZA=="}`)
+		req, _ := http.NewRequest(http.MethodPost, "/text_data/"+dataID.String()+"/shares/", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"permission":"read"`)
+		assert.Contains(t, rec.Body.String(), `"encrypted_key":"d3JhcHBlZA=="`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("ShareUnknownUser", func(t *testing.T) {
+		mockService.On("ShareRecord", mock.Anything, userID, models.KindTextData, dataID, "nobody@example.com", models.SharePermissionWrite, "").Return(nil, httperror.New(nil, "User not found", http.StatusNotFound)).Once()
+
+		body := []byte(`{"email":"nobody@example.com","permission":"write"}`)
+		req, _ := http.NewRequest(http.MethodPost, "/text_data/"+dataID.String()+"/shares/", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.JSONEq(t, `{"detail":"User not found"}`, rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("ShareWithoutEmail", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/text_data/"+dataID.String()+"/shares/", bytes.NewReader([]byte(`{"permission":"read"}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"detail":"email is required"}`, rec.Body.String())
+	})
+
+	t.Run("GetRecordShares", func(t *testing.T) {
+		mockService.On("GetRecordShares", mock.Anything, userID, models.KindTextData, dataID).Return([]models.Share{{ID: shareID}}, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/text_data/"+dataID.String()+"/shares/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), shareID.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		mockService.On("RevokeShare", mock.Anything, userID, models.KindTextData, dataID, shareID).Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodDelete, "/text_data/"+dataID.String()+"/shares/"+shareID.String()+"/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("SharedWithMe", func(t *testing.T) {
+		mockService.On("GetSharedWithMe", mock.Anything, userID, 20).Return([]models.Share{}, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/shared/?offset=20", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "[]", rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("GetSharedRecord", func(t *testing.T) {
+		sharedRecord := &models.SharedRecord{
+			Share: models.Share{ID: shareID, DataKind: models.KindTextData},
+			Data:  &models.UserTextData{Data: "shared note"},
+		}
+		mockService.On("GetSharedRecord", mock.Anything, userID, shareID).Return(sharedRecord, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/shared/"+shareID.String()+"/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"data":"shared note"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("UpdateReadOnly", func(t *testing.T) {
+		update := services.RecordUpdate{Name: "note", Data: "changed"}
+		mockService.On("UpdateSharedRecord", mock.Anything, userID, shareID, update).Return(nil, httperror.New(nil, "Record is shared read-only", http.StatusForbidden)).Once()
+
+		req, _ := http.NewRequest(http.MethodPut, "/shared/"+shareID.String()+"/", bytes.NewReader([]byte(`{"name":"note","data":"changed"}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("DownloadAttachment", func(t *testing.T) {
+		attachmentID := uuid.New()
+		attachment := &models.UserFileData{BaseUserData: models.BaseUserData{ID: attachmentID, Name: "scan", UpdatedAt: time.Now()}, Ext: ".txt", MimeType: "text/plain; charset=utf-8"}
+		mockService.On("GetSharedFileContent", mock.Anything, userID, shareID, &attachmentID).Return(attachment, fileContent("scan"), nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/shared/"+shareID.String()+"/attachments/"+attachmentID.String()+"/download/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "scan", rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Leave", func(t *testing.T) {
+		mockService.On("LeaveShare", mock.Anything, userID, shareID).Return(nil).Once()
+
+		req, _ := http.NewRequest(http.MethodDelete, "/shared/"+shareID.String()+"/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("InvalidShareID", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/shared/invalid-id/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"detail":"Invalid share id"}`, rec.Body.String())
+	})
+}
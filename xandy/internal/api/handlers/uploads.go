@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Content-Type тела PATCH запроса, как в протоколе tus
+const uploadChunkContentType = "application/offset+octet-stream"
+
+type IUploadService interface {
+	CreateUpload(ctx context.Context, userID uuid.UUID, fileName string, size int64, checksum string) (*models.FileUpload, error)
+	GetUpload(ctx context.Context, userID uuid.UUID, uploadID uuid.UUID) (*models.FileUpload, error)
+	AppendChunk(ctx context.Context, userID uuid.UUID, uploadID uuid.UUID, offset int64, chunk io.Reader) (*models.FileUpload, *models.UserFileData, error)
+	CancelUpload(ctx context.Context, userID uuid.UUID, uploadID uuid.UUID) error
+}
+
+type UploadHandlers struct {
+	uploadService IUploadService
+}
+
+func NewUploadHandlers(
+	uploadService IUploadService,
+) *UploadHandlers {
+	return &UploadHandlers{
+		uploadService: uploadService,
+	}
+}
+
+func setUploadHeaders(c *gin.Context, fileUpload *models.FileUpload) {
+	c.Header("Upload-Offset", strconv.FormatInt(fileUpload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(fileUpload.Size, 10))
+	c.Header("Upload-Expires", fileUpload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "no-store")
+}
+
+func (uh *UploadHandlers) CreateUpload(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	var requestData struct {
+		FileName *string `json:"file_name"`
+		Size     *int64  `json:"size"`
+		Checksum *string `json:"checksum"`
+	}
+	if err := c.BindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	if requestData.FileName == nil || requestData.Size == nil || requestData.Checksum == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "file_name, size and checksum are required"})
+		return
+	}
+	fileUpload, err := uh.uploadService.CreateUpload(c.Request.Context(), userID, *requestData.FileName, *requestData.Size, *requestData.Checksum)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	setUploadHeaders(c, fileUpload)
+	c.Header("Location", c.Request.URL.Path+fileUpload.ID.String()+"/")
+	c.JSON(http.StatusCreated, fileUpload)
+}
+
+// GetUpload отдаёт текущее смещение загрузки, для HEAD запроса только в заголовках
+func (uh *UploadHandlers) GetUpload(c *gin.Context) {
+	uploadID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid upload id"})
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	fileUpload, err := uh.uploadService.GetUpload(c.Request.Context(), userID, uploadID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	if time.Now().After(fileUpload.ExpiresAt) {
+		c.JSON(http.StatusGone, gin.H{"detail": "Upload has expired"})
+		return
+	}
+	setUploadHeaders(c, fileUpload)
+	if c.Request.Method == http.MethodHead {
+		c.Status(http.StatusOK)
+		return
+	}
+	c.JSON(http.StatusOK, fileUpload)
+}
+
+func (uh *UploadHandlers) PatchUpload(c *gin.Context) {
+	uploadID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid upload id"})
+		return
+	}
+	if c.ContentType() != uploadChunkContentType {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"detail": "Content-Type must be " + uploadChunkContentType})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid Upload-Offset header"})
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	fileUpload, userFileData, err := uh.uploadService.AppendChunk(c.Request.Context(), userID, uploadID, offset, c.Request.Body)
+	if fileUpload != nil {
+		setUploadHeaders(c, fileUpload)
+	}
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	if userFileData != nil {
+		c.JSON(http.StatusCreated, userFileData)
+		return
+	}
+	c.String(http.StatusNoContent, "")
+}
+
+func (uh *UploadHandlers) CancelUpload(c *gin.Context) {
+	uploadID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid upload id"})
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	err = uh.uploadService.CancelUpload(c.Request.Context(), userID, uploadID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.String(http.StatusNoContent, "")
+}
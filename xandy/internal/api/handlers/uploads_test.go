@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockIUploadService struct {
+	mock.Mock
+}
+
+func (m *MockIUploadService) CreateUpload(ctx context.Context, userID uuid.UUID, fileName string, size int64, checksum string) (*models.FileUpload, error) {
+	args := m.Called(ctx, userID, fileName, size, checksum)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.FileUpload), args.Error(1)
+}
+
+func (m *MockIUploadService) GetUpload(ctx context.Context, userID uuid.UUID, uploadID uuid.UUID) (*models.FileUpload, error) {
+	args := m.Called(ctx, userID, uploadID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.FileUpload), args.Error(1)
+}
+
+func (m *MockIUploadService) AppendChunk(ctx context.Context, userID uuid.UUID, uploadID uuid.UUID, offset int64, chunk io.Reader) (*models.FileUpload, *models.UserFileData, error) {
+	args := m.Called(ctx, userID, uploadID, offset, chunk)
+	var fileUpload *models.FileUpload
+	if args.Get(0) != nil {
+		fileUpload = args.Get(0).(*models.FileUpload)
+	}
+	var userFileData *models.UserFileData
+	if args.Get(1) != nil {
+		userFileData = args.Get(1).(*models.UserFileData)
+	}
+	return fileUpload, userFileData, args.Error(2)
+}
+
+func (m *MockIUploadService) CancelUpload(ctx context.Context, userID uuid.UUID, uploadID uuid.UUID) error {
+	args := m.Called(ctx, userID, uploadID)
+	return args.Error(0)
+}
+
+func newChunkRequest(uploadID uuid.UUID, offset string, chunk []byte) *http.Request {
+	req, _ := http.NewRequest(http.MethodPatch, "/uploads/"+uploadID.String()+"/", bytes.NewReader(chunk))
+	req.Header.Set("Content-Type", uploadChunkContentType)
+	req.Header.Set("Upload-Offset", offset)
+	return req
+}
+
+func TestCreateUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIUploadService)
+	handlers := NewUploadHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.POST("/uploads/", handlers.CreateUpload)
+
+	checksum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	t.Run("Success", func(t *testing.T) {
+		fileUpload := &models.FileUpload{ID: uuid.New(), FileName: "video.mp4", Size: 5, Checksum: checksum, ExpiresAt: time.Now().Add(time.Hour)}
+		req, _ := http.NewRequest(http.MethodPost, "/uploads/", bytes.NewBufferString(`{"file_name": "video.mp4", "size": 5, "checksum": "`+checksum+`"}`))
+		rec := httptest.NewRecorder()
+		mockService.On("CreateUpload", mock.Anything, userID, "video.mp4", int64(5), checksum).Return(fileUpload, nil).Once()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "/uploads/"+fileUpload.ID.String()+"/", rec.Header().Get("Location"))
+		assert.Equal(t, "0", rec.Header().Get("Upload-Offset"))
+		assert.Equal(t, "5", rec.Header().Get("Upload-Length"))
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("MissingFields", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/uploads/", bytes.NewBufferString(`{"file_name": "video.mp4"}`))
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"detail":"file_name, size and checksum are required"}`, rec.Body.String())
+	})
+}
+
+func TestGetUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIUploadService)
+	handlers := NewUploadHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.HEAD("/uploads/:id/", handlers.GetUpload)
+
+	t.Run("Success", func(t *testing.T) {
+		fileUpload := &models.FileUpload{ID: uuid.New(), Size: 100, Offset: 40, ExpiresAt: time.Now().Add(time.Hour)}
+		req, _ := http.NewRequest(http.MethodHead, "/uploads/"+fileUpload.ID.String()+"/", nil)
+		rec := httptest.NewRecorder()
+		mockService.On("GetUpload", mock.Anything, userID, fileUpload.ID).Return(fileUpload, nil).Once()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "40", rec.Header().Get("Upload-Offset"))
+		assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		fileUpload := &models.FileUpload{ID: uuid.New(), Size: 100, ExpiresAt: time.Now().Add(-time.Hour)}
+		req, _ := http.NewRequest(http.MethodHead, "/uploads/"+fileUpload.ID.String()+"/", nil)
+		rec := httptest.NewRecorder()
+		mockService.On("GetUpload", mock.Anything, userID, fileUpload.ID).Return(fileUpload, nil).Once()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusGone, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+}
+
+func TestPatchUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIUploadService)
+	handlers := NewUploadHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.PATCH("/uploads/:id/", handlers.PatchUpload)
+
+	t.Run("Partial", func(t *testing.T) {
+		fileUpload := &models.FileUpload{ID: uuid.New(), Size: 10, Offset: 5, ExpiresAt: time.Now().Add(time.Hour)}
+		rec := httptest.NewRecorder()
+		mockService.On("AppendChunk", mock.Anything, userID, fileUpload.ID, int64(0), mock.Anything).Return(fileUpload, nil, nil).Once()
+
+		router.ServeHTTP(rec, newChunkRequest(fileUpload.ID, "0", []byte("hello")))
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "5", rec.Header().Get("Upload-Offset"))
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Complete", func(t *testing.T) {
+		fileUpload := &models.FileUpload{ID: uuid.New(), Size: 10, Offset: 10, ExpiresAt: time.Now().Add(time.Hour)}
+		userFileData := &models.UserFileData{BaseUserData: models.BaseUserData{ID: uuid.New(), Name: "video"}, Ext: ".mp4"}
+		rec := httptest.NewRecorder()
+		mockService.On("AppendChunk", mock.Anything, userID, fileUpload.ID, int64(5), mock.Anything).Return(fileUpload, userFileData, nil).Once()
+
+		router.ServeHTTP(rec, newChunkRequest(fileUpload.ID, "5", []byte("world")))
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), userFileData.ID.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("OffsetConflict", func(t *testing.T) {
+		fileUpload := &models.FileUpload{ID: uuid.New(), Size: 10, Offset: 5, ExpiresAt: time.Now().Add(time.Hour)}
+		rec := httptest.NewRecorder()
+		mockService.On("AppendChunk", mock.Anything, userID, fileUpload.ID, int64(0), mock.Anything).Return(fileUpload, nil, httperror.New(nil, "Upload-Offset does not match the current offset", http.StatusConflict)).Once()
+
+		router.ServeHTTP(rec, newChunkRequest(fileUpload.ID, "0", []byte("hello")))
+
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Equal(t, "5", rec.Header().Get("Upload-Offset"))
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("InvalidContentType", func(t *testing.T) {
+		req := newChunkRequest(uuid.New(), "0", []byte("hello"))
+		req.Header.Set("Content-Type", "application/octet-stream")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+
+	t.Run("InvalidOffset", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, newChunkRequest(uuid.New(), "abc", []byte("hello")))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"detail":"Invalid Upload-Offset header"}`, rec.Body.String())
+	})
+}
+
+func TestCancelUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIUploadService)
+	handlers := NewUploadHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.DELETE("/uploads/:id/", handlers.CancelUpload)
+
+	t.Run("Success", func(t *testing.T) {
+		uploadID := uuid.New()
+		req, _ := http.NewRequest(http.MethodDelete, "/uploads/"+uploadID.String()+"/", nil)
+		rec := httptest.NewRecorder()
+		mockService.On("CancelUpload", mock.Anything, userID, uploadID).Return(nil).Once()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/eac0de/xandy/internal/services"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IUsageService interface {
+	GetUsage(ctx context.Context, userID uuid.UUID) (*services.UsageReport, error)
+}
+
+type UsageHandlers struct {
+	usageService IUsageService
+}
+
+func NewUsageHandlers(usageService IUsageService) *UsageHandlers {
+	return &UsageHandlers{
+		usageService: usageService,
+	}
+}
+
+// GetUsage отдаёт занятое место и количество записей вместе с ограничениями, limit равен null, если ограничения нет
+func (uh *UsageHandlers) GetUsage(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	usage, err := uh.usageService.GetUsage(c.Request.Context(), userID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/internal/services"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockIUsageService struct {
+	mock.Mock
+}
+
+func (m *MockIUsageService) GetUsage(ctx context.Context, userID uuid.UUID) (*services.UsageReport, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*services.UsageReport), args.Error(1)
+}
+
+func TestGetUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIUsageService)
+	handlers := NewUsageHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.GET("/usage/", handlers.GetUsage)
+
+	t.Run("Success", func(t *testing.T) {
+		storageLimit := int64(1000)
+		report := &services.UsageReport{
+			Storage: services.UsageLimit{Used: 250, Limit: &storageLimit},
+			Records: map[models.DataKind]services.UsageLimit{models.KindAuthInfo: {Used: 3}},
+		}
+		mockService.On("GetUsage", mock.Anything, userID).Return(report, nil).Once()
+		req, _ := http.NewRequest(http.MethodGet, "/usage/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"storage":{"used":250,"limit":1000},"max_file_size":null,"records":{"auth_info":{"used":3,"limit":null}}}`, rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		mockService.On("GetUsage", mock.Anything, userID).Return(nil, httperror.New(nil, "Internal Server Error", http.StatusInternalServerError)).Once()
+		req, _ := http.NewRequest(http.MethodGet, "/usage/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+}
+
+func TestMaxUploadSize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIUserDataService)
+	handlers := NewUserDataHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.POST("/file_data/", MaxUploadSize(10), handlers.InsertUserFileData)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fileWriter, _ := writer.CreateFormFile("file", "big.bin")
+	fileWriter.Write(bytes.Repeat([]byte("x"), multipartOverhead+11))
+	writer.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, "/file_data/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.JSONEq(t, `{"detail":"File exceeds the maximum size of 10 bytes"}`, rec.Body.String())
+	mockService.AssertNotCalled(t, "InsertUserFileData")
+}
@@ -2,11 +2,16 @@ package handlers
 
 import (
 	"context"
-	"fmt"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/eac0de/xandy/internal/models"
 	"github.com/eac0de/xandy/shared/pkg/httperror"
@@ -17,22 +22,26 @@ import (
 
 type IUserDataService interface {
 	InsertUserTextData(ctx context.Context, userID uuid.UUID, name string, text string, metadata map[string]interface{}) (*models.UserTextData, error)
-	InsertUserFileData(ctx context.Context, userID uuid.UUID, name string, pathToFile string, ext string) (*models.UserFileData, error)
+	InsertUserFileData(ctx context.Context, userID uuid.UUID, name string, fileName string, metadata map[string]interface{}, content io.Reader) (*models.UserFileData, error)
 	InsertUserAuthInfo(ctx context.Context, userID uuid.UUID, name, login, password string, metadata map[string]interface{}) (*models.UserAuthInfo, error)
 	InsertUserBankCard(ctx context.Context, userID uuid.UUID, name, number, cardHolder, expireDate, csc string, metadata map[string]interface{}) (*models.UserBankCard, error)
 
 	UpdateUserTextData(ctx context.Context, userID uuid.UUID, ID uuid.UUID, name, text string, metadata map[string]interface{}) (*models.UserTextData, error)
 	UpdateUserFileData(ctx context.Context, userID uuid.UUID, ID uuid.UUID, name string, metadata map[string]interface{}) (*models.UserFileData, error)
+	ReplaceUserFileContent(ctx context.Context, userID uuid.UUID, ID uuid.UUID, content io.Reader) (*models.UserFileData, error)
 	UpdateUserAuthInfo(ctx context.Context, userID uuid.UUID, ID uuid.UUID, name, login, password string, metadata map[string]interface{}) (*models.UserAuthInfo, error)
 	UpdateUserBankCard(ctx context.Context, userID uuid.UUID, ID uuid.UUID, name, number, cardHolder, expireDate, csc string, metadata map[string]interface{}) (*models.UserBankCard, error)
+	PatchRecord(ctx context.Context, userID uuid.UUID, dataKind models.DataKind, ID uuid.UUID, patch map[string]interface{}) (interface{}, error)
 
 	GetUserTextData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserTextData, error)
 	GetUserFileData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserFileData, error)
 	GetUserAuthInfo(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserAuthInfo, error)
 	GetUserBankCard(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserBankCard, error)
 
+	GetUserFileContent(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserFileData, io.ReadSeekCloser, error)
+
 	GetUserTextDataList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserTextData, error)
-	GetUserFileDataList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserFileData, error)
+	GetUserFileDataList(ctx context.Context, userID uuid.UUID, filter models.FileDataFilter, offset int) ([]models.UserFileData, error)
 	GetUserAuthInfoList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserAuthInfo, error)
 	GetUserBankCardList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserBankCard, error)
 
@@ -40,6 +49,9 @@ type IUserDataService interface {
 	DeleteUserFileData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) error
 	DeleteUserAuthInfo(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) error
 	DeleteUserBankCard(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) error
+
+	SetExpiration(ctx context.Context, userID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID, expiresAt *time.Time) (*models.BaseUserData, error)
+	GetExpiring(ctx context.Context, userID uuid.UUID, within time.Duration) ([]models.ExpiringRecord, error)
 }
 
 type UserDataHandlers struct {
@@ -274,48 +286,56 @@ func (ah *UserDataHandlers) UpdateUserTextData(c *gin.Context) {
 	c.JSON(http.StatusOK, userTextData)
 }
 
-func (ah *UserDataHandlers) InsertUserFileData(c *gin.Context) {
-	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
-	file, err := c.FormFile("file")
+// uploadedFile - файл из multipart формы: file, необязательные name и metadata (JSON объект)
+type uploadedFile struct {
+	FileName string
+	Name     string
+	Metadata map[string]interface{}
+	Content  multipart.File
+}
+
+// readUploadedFile отвечает 400 сам и возвращает false, если форма некорректна.
+// Content нужно закрыть после использования.
+func readUploadedFile(c *gin.Context) (*uploadedFile, bool) {
+	fileHeader, err := c.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
-		return
-	}
-	dir := fmt.Sprintf("../user_files/%s", userID.String())
-	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"detail": err.Error()})
-		return
+		formFileError(c, err)
+		return nil, false
 	}
-	ext := filepath.Ext(file.Filename)
-	name := file.Filename[:len(file.Filename)-len(filepath.Ext(file.Filename))]
-	clearName := name
-	pathToFile := fmt.Sprintf("%s/%s%s", dir, name, ext)
-
-	count := 0
-	for {
-		_, err := os.Stat(pathToFile)
-		if err != nil {
-			if os.IsNotExist(err) {
-				break
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"detail": err.Error()})
-				return
-			}
+	var metadata map[string]interface{}
+	if metadataString := c.PostForm("metadata"); metadataString != "" {
+		if err := json.Unmarshal([]byte(metadataString), &metadata); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "metadata must be a JSON object"})
+			return nil, false
 		}
-		count++
-		name = fmt.Sprintf("%s(%d)", clearName, count)
-		pathToFile = fmt.Sprintf("%s/%s%s", dir, name, ext)
 	}
-	if err := c.SaveUploadedFile(file, pathToFile); err != nil {
+	file, err := fileHeader.Open()
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"detail": err.Error()})
+		return nil, false
+	}
+	return &uploadedFile{
+		FileName: fileHeader.Filename,
+		Name:     c.PostForm("name"),
+		Metadata: metadata,
+		Content:  file,
+	}, true
+}
+
+func (ah *UserDataHandlers) InsertUserFileData(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	upload, ok := readUploadedFile(c)
+	if !ok {
 		return
 	}
+	defer upload.Content.Close()
 	userFileData, err := ah.userDataService.InsertUserFileData(
 		c.Request.Context(),
 		userID,
-		name,
-		pathToFile,
-		ext,
+		upload.Name,
+		upload.FileName,
+		upload.Metadata,
+		upload.Content,
 	)
 	if err != nil {
 		msg, statusCode := httperror.GetMessageAndStatusCode(err)
@@ -347,8 +367,21 @@ func (ah *UserDataHandlers) GetUserFileDataList(c *gin.Context) {
 	if offsetString != "" {
 		offset, _ = strconv.ParseInt(offsetString, 10, 64)
 	}
+	filter := models.FileDataFilter{
+		MimeType:         c.Query("mime_type"),
+		OriginalFileName: c.Query("original_file_name"),
+	}
+	var ok bool
+	if filter.MinSize, ok = sizeQuery(c, "min_size"); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid min_size"})
+		return
+	}
+	if filter.MaxSize, ok = sizeQuery(c, "max_size"); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid max_size"})
+		return
+	}
 	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
-	userFileDataList, err := ah.userDataService.GetUserFileDataList(c.Request.Context(), userID, int(offset))
+	userFileDataList, err := ah.userDataService.GetUserFileDataList(c.Request.Context(), userID, filter, int(offset))
 	if err != nil {
 		msg, statusCode := httperror.GetMessageAndStatusCode(err)
 		c.JSON(statusCode, gin.H{"detail": msg})
@@ -357,6 +390,19 @@ func (ah *UserDataHandlers) GetUserFileDataList(c *gin.Context) {
 	c.JSON(http.StatusOK, userFileDataList)
 }
 
+// sizeQuery читает необязательный размер в байтах из query параметра
+func sizeQuery(c *gin.Context, param string) (*int64, bool) {
+	sizeString := c.Query(param)
+	if sizeString == "" {
+		return nil, true
+	}
+	size, err := strconv.ParseInt(sizeString, 10, 64)
+	if err != nil || size < 0 {
+		return nil, false
+	}
+	return &size, true
+}
+
 func (ah *UserDataHandlers) DownloadUserFile(c *gin.Context) {
 	dataID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
@@ -364,13 +410,32 @@ func (ah *UserDataHandlers) DownloadUserFile(c *gin.Context) {
 		return
 	}
 	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
-	userFileData, err := ah.userDataService.GetUserFileData(c.Request.Context(), dataID, userID)
+	userFileData, content, err := ah.userDataService.GetUserFileContent(c.Request.Context(), dataID, userID)
 	if err != nil {
 		msg, statusCode := httperror.GetMessageAndStatusCode(err)
 		c.JSON(statusCode, gin.H{"detail": msg})
 		return
 	}
-	c.FileAttachment(userFileData.PathToFile, userFileData.Name+userFileData.Ext)
+	defer content.Close()
+	serveUserFile(c, userFileData, content)
+}
+
+// serveUserFile отдаёт содержимое файла с заголовками для скачивания
+func serveUserFile(c *gin.Context, userFileData *models.UserFileData, content io.ReadSeeker) {
+	fileName := userFileData.Name + userFileData.Ext
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	contentType := userFileData.MimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	// ETag и Digest есть только у файлов, для которых при загрузке посчитан SHA-256
+	if digest, err := hex.DecodeString(userFileData.SHA256); err == nil && len(digest) == sha256.Size {
+		c.Header("ETag", `"`+userFileData.SHA256+`"`)
+		c.Header("Digest", "sha-256="+base64.StdEncoding.EncodeToString(digest))
+	}
+	// ServeContent обрабатывает Range, If-Range, If-None-Match и If-Modified-Since
+	http.ServeContent(c.Writer, c.Request, fileName, userFileData.UpdatedAt, content)
 }
 
 func (ah *UserDataHandlers) DeleteUserFileData(c *gin.Context) {
@@ -424,6 +489,34 @@ func (ah *UserDataHandlers) UpdateUserFileData(c *gin.Context) {
 	c.JSON(http.StatusOK, userFileData)
 }
 
+// ReplaceUserFileContent принимает новое содержимое файла в поле file, как и при создании
+func (ah *UserDataHandlers) ReplaceUserFileContent(c *gin.Context) {
+	dataID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "Invalid data id"})
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		formFileError(c, err)
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": err.Error()})
+		return
+	}
+	defer file.Close()
+	userFileData, err := ah.userDataService.ReplaceUserFileContent(c.Request.Context(), userID, dataID, file)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, userFileData)
+}
+
 func (ah *UserDataHandlers) InsertUserBankCard(c *gin.Context) {
 	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
 	var requestData struct {
@@ -3,14 +3,19 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
 	"github.com/eac0de/xandy/internal/models"
@@ -34,8 +39,8 @@ func (m *MockIUserDataService) InsertUserTextData(ctx context.Context, userID uu
 	return args.Get(0).(*models.UserTextData), args.Error(1)
 }
 
-func (m *MockIUserDataService) InsertUserFileData(ctx context.Context, userID uuid.UUID, name string, pathToFile string, ext string) (*models.UserFileData, error) {
-	args := m.Called(ctx, userID, name, pathToFile)
+func (m *MockIUserDataService) InsertUserFileData(ctx context.Context, userID uuid.UUID, name string, fileName string, metadata map[string]interface{}, content io.Reader) (*models.UserFileData, error) {
+	args := m.Called(ctx, userID, name, fileName, metadata, content)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -74,6 +79,14 @@ func (m *MockIUserDataService) UpdateUserFileData(ctx context.Context, userID uu
 	return args.Get(0).(*models.UserFileData), args.Error(1)
 }
 
+func (m *MockIUserDataService) ReplaceUserFileContent(ctx context.Context, userID uuid.UUID, ID uuid.UUID, content io.Reader) (*models.UserFileData, error) {
+	args := m.Called(ctx, userID, ID, content)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.UserFileData), args.Error(1)
+}
+
 func (m *MockIUserDataService) UpdateUserAuthInfo(ctx context.Context, userID uuid.UUID, ID uuid.UUID, name, login, password string, metadata map[string]interface{}) (*models.UserAuthInfo, error) {
 	args := m.Called(ctx, userID, ID, name, login, password, metadata)
 	if args.Get(0) == nil {
@@ -106,6 +119,22 @@ func (m *MockIUserDataService) GetUserFileData(ctx context.Context, dataID uuid.
 	return args.Get(0).(*models.UserFileData), args.Error(1)
 }
 
+func (m *MockIUserDataService) GetUserFileContent(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserFileData, io.ReadSeekCloser, error) {
+	args := m.Called(ctx, dataID, userID)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(*models.UserFileData), args.Get(1).(io.ReadSeekCloser), args.Error(2)
+}
+
+// fileContent возвращает содержимое файла так, как его отдаёт сервис
+func fileContent(s string) io.ReadSeekCloser {
+	return struct {
+		io.ReadSeeker
+		io.Closer
+	}{strings.NewReader(s), io.NopCloser(nil)}
+}
+
 func (m *MockIUserDataService) GetUserAuthInfo(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserAuthInfo, error) {
 	args := m.Called(ctx, dataID, userID)
 	if args.Get(0) == nil {
@@ -130,8 +159,8 @@ func (m *MockIUserDataService) GetUserTextDataList(ctx context.Context, userID u
 	return args.Get(0).([]models.UserTextData), args.Error(1)
 }
 
-func (m *MockIUserDataService) GetUserFileDataList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserFileData, error) {
-	args := m.Called(ctx, userID, offset)
+func (m *MockIUserDataService) GetUserFileDataList(ctx context.Context, userID uuid.UUID, filter models.FileDataFilter, offset int) ([]models.UserFileData, error) {
+	args := m.Called(ctx, userID, filter, offset)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -174,6 +203,27 @@ func (m *MockIUserDataService) DeleteUserBankCard(ctx context.Context, dataID uu
 	return args.Error(0)
 }
 
+func (m *MockIUserDataService) PatchRecord(ctx context.Context, userID uuid.UUID, dataKind models.DataKind, ID uuid.UUID, patch map[string]interface{}) (interface{}, error) {
+	args := m.Called(ctx, userID, dataKind, ID, patch)
+	return args.Get(0), args.Error(1)
+}
+
+func (m *MockIUserDataService) SetExpiration(ctx context.Context, userID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID, expiresAt *time.Time) (*models.BaseUserData, error) {
+	args := m.Called(ctx, userID, dataKind, dataID, expiresAt)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.BaseUserData), args.Error(1)
+}
+
+func (m *MockIUserDataService) GetExpiring(ctx context.Context, userID uuid.UUID, within time.Duration) ([]models.ExpiringRecord, error) {
+	args := m.Called(ctx, userID, within)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.ExpiringRecord), args.Error(1)
+}
+
 func TestInsertUserAuthInfo(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mockService := new(MockIUserDataService)
@@ -801,12 +851,52 @@ func TestInsertUserFileData(t *testing.T) {
 		req, _ := http.NewRequest(http.MethodPost, "/user_file_data/", body)
 		req.Header.Set("Content-Type", writer.FormDataContentType())
 		rec := httptest.NewRecorder()
-		mockService.On("InsertUserFileData", mock.Anything, userID, mock.Anything, mock.Anything).Return(&models.UserFileData{}, nil).Once()
+		mockService.On("InsertUserFileData", mock.Anything, userID, "", "testFile.txt", map[string]interface{}(nil), mock.Anything).Return(&models.UserFileData{}, nil).Once()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("NameAndMetadata", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		writer.WriteField("name", "Отчёт")
+		writer.WriteField("metadata", `{"project":"xandy"}`)
+		fileWriter, err := writer.CreateFormFile("file", "testFile.txt")
+		if err != nil {
+			t.Fatalf("Failed to create form file: %v", err)
+		}
+		fileWriter.Write([]byte("This is a test file"))
+		writer.Close()
+
+		req, _ := http.NewRequest(http.MethodPost, "/user_file_data/", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		mockService.On("InsertUserFileData", mock.Anything, userID, "Отчёт", "testFile.txt", map[string]interface{}{"project": "xandy"}, mock.Anything).Return(&models.UserFileData{}, nil).Once()
 		router.ServeHTTP(rec, req)
 		assert.Equal(t, http.StatusCreated, rec.Code)
 		mockService.AssertExpectations(t)
 	})
 
+	t.Run("InvalidMetadata", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		writer.WriteField("metadata", `["not", "an", "object"]`)
+		fileWriter, err := writer.CreateFormFile("file", "testFile.txt")
+		if err != nil {
+			t.Fatalf("Failed to create form file: %v", err)
+		}
+		fileWriter.Write([]byte("This is a test file"))
+		writer.Close()
+
+		req, _ := http.NewRequest(http.MethodPost, "/user_file_data/", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"detail":"metadata must be a JSON object"}`, rec.Body.String())
+	})
+
 	t.Run("BadRequestMissingFile", func(t *testing.T) {
 		// Тестируем случай без файла
 		body := &bytes.Buffer{}
@@ -844,7 +934,7 @@ func TestInsertUserFileData(t *testing.T) {
 		rec := httptest.NewRecorder()
 
 		// Мокируем ошибку сохранения файла
-		mockService.On("InsertUserFileData", mock.Anything, userID, mock.Anything, mock.Anything).Return(nil, fmt.Errorf("failed to save file")).Once()
+		mockService.On("InsertUserFileData", mock.Anything, userID, "", "testFile.txt", map[string]interface{}(nil), mock.Anything).Return(nil, fmt.Errorf("failed to save file")).Once()
 
 		// Проверка на ошибку
 		router.ServeHTTP(rec, req)
@@ -873,7 +963,7 @@ func TestInsertUserFileData(t *testing.T) {
 		rec := httptest.NewRecorder()
 
 		// Мокируем ошибку при создании директории
-		mockService.On("InsertUserFileData", mock.Anything, userID, mock.Anything, mock.Anything).Return(nil, fmt.Errorf("failed to create directory")).Once()
+		mockService.On("InsertUserFileData", mock.Anything, userID, "", "testFile.txt", map[string]interface{}(nil), mock.Anything).Return(nil, fmt.Errorf("failed to create directory")).Once()
 
 		// Проверка на ошибку
 		router.ServeHTTP(rec, req)
@@ -1090,23 +1180,109 @@ func TestUpdateUserFileData(t *testing.T) {
 	})
 }
 
-func TestDownloadUserFile(t *testing.T) {
+func TestGetUserFileDataList(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIUserDataService)
+	handlers := NewUserDataHandlers(mockService)
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.GET("/user_file_data/", handlers.GetUserFileDataList)
+
+	t.Run("Filters", func(t *testing.T) {
+		minSize, maxSize := int64(10), int64(2048)
+		filter := models.FileDataFilter{MimeType: "image/", MinSize: &minSize, MaxSize: &maxSize, OriginalFileName: "scan"}
+		mockService.On("GetUserFileDataList", mock.Anything, userID, filter, 20).Return([]models.UserFileData{{Size: 100, MimeType: "image/png", OriginalFileName: "scan.png"}}, nil).Once()
+		req, _ := http.NewRequest(http.MethodGet, "/user_file_data/?offset=20&mime_type=image/&min_size=10&max_size=2048&original_file_name=scan", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var response []map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, "scan.png", response[0]["original_file_name"])
+		assert.Equal(t, float64(100), response[0]["size"])
+		assert.Equal(t, "image/png", response[0]["mime_type"])
+		mockService.AssertExpectations(t)
+	})
+	t.Run("InvalidSize", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/user_file_data/?max_size=big", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"detail":"Invalid max_size"}`, rec.Body.String())
+	})
+}
+
+func TestReplaceUserFileContent(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mockService := new(MockIUserDataService)
 	handlers := NewUserDataHandlers(mockService)
 	router := gin.Default()
 	userID := uuid.New()
-	tempFile, err := os.CreateTemp("", "testfile-*.txt")
-	if err != nil {
-		t.Fatal(err)
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.PUT("/user_file_data/:id/content/", handlers.ReplaceUserFileContent)
+
+	newRequest := func(dataID string, withFile bool) *http.Request {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		if withFile {
+			fileWriter, err := writer.CreateFormFile("file", "new.txt")
+			if err != nil {
+				t.Fatalf("Failed to create form file: %v", err)
+			}
+			fileWriter.Write([]byte("new content"))
+		}
+		writer.Close()
+		req, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("/user_file_data/%s/content/", dataID), body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return req
 	}
-	defer os.Remove(tempFile.Name())
+
+	t.Run("Invalid DataID", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, newRequest("invalid-id", true))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"detail":"Invalid data id"}`, rec.Body.String())
+	})
+	t.Run("MissingFile", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, newRequest(uuid.New().String(), false))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"detail":"http: no such file"}`, rec.Body.String())
+	})
+	t.Run("Success", func(t *testing.T) {
+		dataID := uuid.New()
+		fileData := &models.UserFileData{BaseUserData: models.BaseUserData{ID: dataID, UserID: userID, Name: "report"}, Ext: ".txt", Size: 11}
+		mockService.On("ReplaceUserFileContent", mock.Anything, userID, dataID, mock.MatchedBy(func(content io.Reader) bool {
+			data, _ := io.ReadAll(content)
+			return string(data) == "new content"
+		})).Return(fileData, nil).Once()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, newRequest(dataID.String(), true))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var response models.UserFileData
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, dataID, response.ID)
+		assert.Equal(t, int64(11), response.Size)
+		mockService.AssertExpectations(t)
+	})
+	t.Run("Conflict", func(t *testing.T) {
+		dataID := uuid.New()
+		mockService.On("ReplaceUserFileContent", mock.Anything, userID, dataID, mock.Anything).Return(nil, httperror.New(nil, "UserFileData was changed or deleted concurrently", http.StatusConflict)).Once()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, newRequest(dataID.String(), true))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+}
+
+func TestDownloadUserFile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIUserDataService)
+	handlers := NewUserDataHandlers(mockService)
+	router := gin.Default()
+	userID := uuid.New()
 	testFileContent := "This is a test file"
-	_, err = tempFile.WriteString(testFileContent)
-	if err != nil {
-		t.Fatal(err)
-	}
-	tempFile.Close()
 
 	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
 	authenticatedGroup.GET("/user_file_data/:id/download/", handlers.DownloadUserFile)
@@ -1126,7 +1302,7 @@ func TestDownloadUserFile(t *testing.T) {
 
 		rec := httptest.NewRecorder()
 
-		mockService.On("GetUserFileData", mock.Anything, dataID, userID).Return(&models.UserFileData{}, httperror.New(nil, "not found", http.StatusNotFound)).Once()
+		mockService.On("GetUserFileContent", mock.Anything, dataID, userID).Return(nil, nil, httperror.New(nil, "not found", http.StatusNotFound)).Once()
 
 		router.ServeHTTP(rec, req)
 
@@ -1139,7 +1315,7 @@ func TestDownloadUserFile(t *testing.T) {
 
 		rec := httptest.NewRecorder()
 
-		mockService.On("GetUserFileData", mock.Anything, dataID, userID).Return(&models.UserFileData{PathToFile: tempFile.Name()}, nil).Once()
+		mockService.On("GetUserFileContent", mock.Anything, dataID, userID).Return(&models.UserFileData{}, fileContent(testFileContent), nil).Once()
 
 		router.ServeHTTP(rec, req)
 
@@ -1147,6 +1323,69 @@ func TestDownloadUserFile(t *testing.T) {
 		assert.Equal(t, http.StatusOK, rec.Code)
 		mockService.AssertExpectations(t)
 	})
+	sum := sha256.Sum256([]byte(testFileContent))
+	checksum := hex.EncodeToString(sum[:])
+	fileData := &models.UserFileData{
+		BaseUserData: models.BaseUserData{Name: "testfile", UpdatedAt: time.Now()},
+		Ext:          ".txt",
+		SHA256:       checksum,
+		MimeType:     "text/plain; charset=utf-8",
+	}
+	t.Run("Headers", func(t *testing.T) {
+		dataID := uuid.New()
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/user_file_data/%s/download/", dataID.String()), nil)
+		rec := httptest.NewRecorder()
+		mockService.On("GetUserFileContent", mock.Anything, dataID, userID).Return(fileData, fileContent(testFileContent), nil).Once()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+		assert.Equal(t, `"`+checksum+`"`, rec.Header().Get("ETag"))
+		assert.Equal(t, "sha-256="+base64.StdEncoding.EncodeToString(sum[:]), rec.Header().Get("Digest"))
+		assert.Equal(t, `attachment; filename=testfile.txt`, rec.Header().Get("Content-Disposition"))
+		mockService.AssertExpectations(t)
+	})
+	t.Run("Range", func(t *testing.T) {
+		dataID := uuid.New()
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/user_file_data/%s/download/", dataID.String()), nil)
+		req.Header.Set("Range", "bytes=5-")
+		rec := httptest.NewRecorder()
+		mockService.On("GetUserFileContent", mock.Anything, dataID, userID).Return(fileData, fileContent(testFileContent), nil).Once()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Equal(t, testFileContent[5:], rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+	t.Run("IfRangeMismatch", func(t *testing.T) {
+		dataID := uuid.New()
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/user_file_data/%s/download/", dataID.String()), nil)
+		req.Header.Set("Range", "bytes=5-")
+		req.Header.Set("If-Range", `"outdated"`)
+		rec := httptest.NewRecorder()
+		mockService.On("GetUserFileContent", mock.Anything, dataID, userID).Return(fileData, fileContent(testFileContent), nil).Once()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, testFileContent, rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+	t.Run("NotModified", func(t *testing.T) {
+		dataID := uuid.New()
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/user_file_data/%s/download/", dataID.String()), nil)
+		req.Header.Set("If-None-Match", `"`+checksum+`"`)
+		rec := httptest.NewRecorder()
+		mockService.On("GetUserFileContent", mock.Anything, dataID, userID).Return(fileData, fileContent(testFileContent), nil).Once()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Empty(t, rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
 }
 
 func TestInsertUserBankCard(t *testing.T) {
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/eac0de/xandy/internal/services"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IVaultService interface {
+	Export(ctx context.Context, userID uuid.UUID, passphrase string, w io.Writer) error
+	Restore(ctx context.Context, userID uuid.UUID, passphrase string, r io.Reader, mode services.RestoreMode) (*services.RestoreReport, error)
+}
+
+type VaultHandlers struct {
+	vaultService IVaultService
+}
+
+func NewVaultHandlers(
+	vaultService IVaultService,
+) *VaultHandlers {
+	return &VaultHandlers{
+		vaultService: vaultService,
+	}
+}
+
+// attachmentWriter выставляет заголовки вложения при первой записи,
+// до неё ошибку ещё можно вернуть обычным JSON ответом
+type attachmentWriter struct {
+	c           *gin.Context
+	fileName    string
+	contentType string
+}
+
+func (w *attachmentWriter) Write(p []byte) (int, error) {
+	if !w.c.Writer.Written() {
+		contentType := w.contentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		w.c.Header("Content-Type", contentType)
+		w.c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, w.fileName))
+		w.c.Status(http.StatusOK)
+	}
+	return w.c.Writer.Write(p)
+}
+
+func (vh *VaultHandlers) Export(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	var requestData struct {
+		Passphrase *string `json:"passphrase"`
+	}
+	if err := c.BindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	if requestData.Passphrase == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "passphrase is required"})
+		return
+	}
+	w := &attachmentWriter{c: c, fileName: fmt.Sprintf("xandy-%s.xvault", time.Now().Format("2006-01-02"))}
+	err := vh.vaultService.Export(c.Request.Context(), userID, *requestData.Passphrase, w)
+	if err != nil {
+		if c.Writer.Written() {
+			// Архив уже частично отправлен, клиент получит оборванный поток и не сможет его расшифровать
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+}
+
+func (vh *VaultHandlers) Restore(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	passphrase := c.PostForm("passphrase")
+	if passphrase == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "passphrase is required"})
+		return
+	}
+	mode := services.RestoreMode(c.DefaultPostForm("mode", string(services.RestoreModeMerge)))
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": err.Error()})
+		return
+	}
+	defer file.Close()
+	report, err := vh.vaultService.Restore(c.Request.Context(), userID, passphrase, file, mode)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/services"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockIVaultService struct {
+	mock.Mock
+}
+
+func (m *MockIVaultService) Export(ctx context.Context, userID uuid.UUID, passphrase string, w io.Writer) error {
+	args := m.Called(ctx, userID, passphrase, w)
+	return args.Error(0)
+}
+
+func (m *MockIVaultService) Restore(ctx context.Context, userID uuid.UUID, passphrase string, r io.Reader, mode services.RestoreMode) (*services.RestoreReport, error) {
+	args := m.Called(ctx, userID, passphrase, r, mode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*services.RestoreReport), args.Error(1)
+}
+
+func newRestoreRequest(t *testing.T, fields map[string]string, withFile bool) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for key, value := range fields {
+		writer.WriteField(key, value)
+	}
+	if withFile {
+		fileWriter, err := writer.CreateFormFile("file", "backup.xvault")
+		if err != nil {
+			t.Fatalf("Failed to create form file: %v", err)
+		}
+		fileWriter.Write([]byte("XNDYVLT1"))
+	}
+	writer.Close()
+	req, _ := http.NewRequest(http.MethodPost, "/vault/restore/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestExportVault(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIVaultService)
+	handlers := NewVaultHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.POST("/vault/export/", handlers.Export)
+
+	t.Run("Success", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/vault/export/", bytes.NewBufferString(`{"passphrase": "correct horse"}`))
+		rec := httptest.NewRecorder()
+		mockService.On("Export", mock.Anything, userID, "correct horse", mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(3).(io.Writer).Write([]byte("encrypted"))
+		}).Return(nil).Once()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Header().Get("Content-Disposition"), "attachment")
+		assert.Equal(t, "encrypted", rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("MissingPassphrase", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/vault/export/", bytes.NewBufferString(`{}`))
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"detail":"passphrase is required"}`, rec.Body.String())
+	})
+
+	t.Run("Service Error", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/vault/export/", bytes.NewBufferString(`{"passphrase": "short"}`))
+		rec := httptest.NewRecorder()
+		mockService.On("Export", mock.Anything, userID, "short", mock.Anything).Return(httperror.New(nil, "Passphrase must be at least 8 characters", http.StatusUnprocessableEntity)).Once()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.JSONEq(t, `{"detail":"Passphrase must be at least 8 characters"}`, rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+}
+
+func TestRestoreVault(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIVaultService)
+	handlers := NewVaultHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.POST("/vault/restore/", handlers.Restore)
+
+	t.Run("Success", func(t *testing.T) {
+		req := newRestoreRequest(t, map[string]string{"passphrase": "correct horse", "mode": "replace"}, true)
+		rec := httptest.NewRecorder()
+		mockService.On("Restore", mock.Anything, userID, "correct horse", mock.Anything, services.RestoreModeReplace).Return(&services.RestoreReport{Mode: services.RestoreModeReplace}, nil).Once()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("DefaultMode", func(t *testing.T) {
+		req := newRestoreRequest(t, map[string]string{"passphrase": "correct horse"}, true)
+		rec := httptest.NewRecorder()
+		mockService.On("Restore", mock.Anything, userID, "correct horse", mock.Anything, services.RestoreModeMerge).Return(&services.RestoreReport{Mode: services.RestoreModeMerge}, nil).Once()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("MissingFile", func(t *testing.T) {
+		req := newRestoreRequest(t, map[string]string{"passphrase": "correct horse"}, false)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Service Error", func(t *testing.T) {
+		req := newRestoreRequest(t, map[string]string{"passphrase": "wrong horse"}, true)
+		rec := httptest.NewRecorder()
+		mockService.On("Restore", mock.Anything, userID, "wrong horse", mock.Anything, services.RestoreModeMerge).Return(nil, httperror.New(nil, "Wrong passphrase or corrupted vault archive", http.StatusUnprocessableEntity)).Once()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.JSONEq(t, `{"detail":"Wrong passphrase or corrupted vault archive"}`, rec.Body.String())
+		mockService.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IWebhookService interface {
+	CreateWebhook(ctx context.Context, userID uuid.UUID, url string, events []models.WebhookEvent) (*models.Webhook, error)
+	GetWebhooks(ctx context.Context, userID uuid.UUID) ([]models.Webhook, error)
+	UpdateWebhook(ctx context.Context, userID uuid.UUID, webhookID uuid.UUID, url *string, events []models.WebhookEvent, active *bool) (*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, userID uuid.UUID, webhookID uuid.UUID) error
+	GetDeliveries(ctx context.Context, userID uuid.UUID, webhookID uuid.UUID, offset int) ([]models.WebhookDelivery, error)
+	ReplayDelivery(ctx context.Context, userID uuid.UUID, webhookID uuid.UUID, deliveryID uuid.UUID) (*models.WebhookDelivery, error)
+}
+
+type WebhookHandlers struct {
+	webhookService IWebhookService
+}
+
+func NewWebhookHandlers(webhookService IWebhookService) *WebhookHandlers {
+	return &WebhookHandlers{
+		webhookService: webhookService,
+	}
+}
+
+// CreateWebhook регистрирует вебхук. Ключ подписи возвращается только в этом ответе
+func (wh *WebhookHandlers) CreateWebhook(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	var requestData struct {
+		URL    *string               `json:"url"`
+		Events []models.WebhookEvent `json:"events"`
+	}
+	if err := c.BindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	if requestData.URL == nil || requestData.Events == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "url and events are required"})
+		return
+	}
+	webhook, err := wh.webhookService.CreateWebhook(c.Request.Context(), userID, *requestData.URL, requestData.Events)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusCreated, webhook)
+}
+
+func (wh *WebhookHandlers) GetWebhooks(c *gin.Context) {
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	webhooks, err := wh.webhookService.GetWebhooks(c.Request.Context(), userID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, webhooks)
+}
+
+func (wh *WebhookHandlers) UpdateWebhook(c *gin.Context) {
+	webhookID, ok := uuidParam(c, "webhook_id", "Invalid webhook id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	var requestData struct {
+		URL    *string               `json:"url"`
+		Events []models.WebhookEvent `json:"events"`
+		Active *bool                 `json:"active"`
+	}
+	if err := c.BindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	}
+	webhook, err := wh.webhookService.UpdateWebhook(c.Request.Context(), userID, webhookID, requestData.URL, requestData.Events, requestData.Active)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, webhook)
+}
+
+func (wh *WebhookHandlers) DeleteWebhook(c *gin.Context) {
+	webhookID, ok := uuidParam(c, "webhook_id", "Invalid webhook id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	err := wh.webhookService.DeleteWebhook(c.Request.Context(), userID, webhookID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.String(http.StatusNoContent, "")
+}
+
+func (wh *WebhookHandlers) GetDeliveries(c *gin.Context) {
+	webhookID, ok := uuidParam(c, "webhook_id", "Invalid webhook id")
+	if !ok {
+		return
+	}
+	var offset int64
+	offsetString := c.Query("offset")
+	if offsetString != "" {
+		offset, _ = strconv.ParseInt(offsetString, 10, 64)
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	deliveries, err := wh.webhookService.GetDeliveries(c.Request.Context(), userID, webhookID, int(offset))
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// ReplayDelivery ставит событие из журнала в очередь на повторную доставку
+func (wh *WebhookHandlers) ReplayDelivery(c *gin.Context) {
+	webhookID, ok := uuidParam(c, "webhook_id", "Invalid webhook id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := uuidParam(c, "delivery_id", "Invalid delivery id")
+	if !ok {
+		return
+	}
+	userID := c.MustGet(gin.AuthUserKey).(uuid.UUID)
+	delivery, err := wh.webhookService.ReplayDelivery(c.Request.Context(), userID, webhookID, deliveryID)
+	if err != nil {
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		c.JSON(statusCode, gin.H{"detail": msg})
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
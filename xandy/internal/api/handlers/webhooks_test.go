@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eac0de/xandy/auth/pkg/outmiddlewares"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockIWebhookService struct {
+	mock.Mock
+}
+
+func (m *MockIWebhookService) CreateWebhook(ctx context.Context, userID uuid.UUID, url string, events []models.WebhookEvent) (*models.Webhook, error) {
+	args := m.Called(ctx, userID, url, events)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Webhook), args.Error(1)
+}
+
+func (m *MockIWebhookService) GetWebhooks(ctx context.Context, userID uuid.UUID) ([]models.Webhook, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Webhook), args.Error(1)
+}
+
+func (m *MockIWebhookService) UpdateWebhook(ctx context.Context, userID uuid.UUID, webhookID uuid.UUID, url *string, events []models.WebhookEvent, active *bool) (*models.Webhook, error) {
+	args := m.Called(ctx, userID, webhookID, url, events, active)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Webhook), args.Error(1)
+}
+
+func (m *MockIWebhookService) DeleteWebhook(ctx context.Context, userID uuid.UUID, webhookID uuid.UUID) error {
+	args := m.Called(ctx, userID, webhookID)
+	return args.Error(0)
+}
+
+func (m *MockIWebhookService) GetDeliveries(ctx context.Context, userID uuid.UUID, webhookID uuid.UUID, offset int) ([]models.WebhookDelivery, error) {
+	args := m.Called(ctx, userID, webhookID, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockIWebhookService) ReplayDelivery(ctx context.Context, userID uuid.UUID, webhookID uuid.UUID, deliveryID uuid.UUID) (*models.WebhookDelivery, error) {
+	args := m.Called(ctx, userID, webhookID, deliveryID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WebhookDelivery), args.Error(1)
+}
+
+func TestWebhooks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockIWebhookService)
+	handlers := NewWebhookHandlers(mockService)
+
+	router := gin.Default()
+	userID := uuid.New()
+	authenticatedGroup := router.Group("/", outmiddlewares.NewAuthMiddlewareForTest(userID))
+	authenticatedGroup.GET("/webhooks/", handlers.GetWebhooks)
+	authenticatedGroup.POST("/webhooks/", handlers.CreateWebhook)
+	authenticatedGroup.PUT("/webhooks/:webhook_id/", handlers.UpdateWebhook)
+	authenticatedGroup.DELETE("/webhooks/:webhook_id/", handlers.DeleteWebhook)
+	authenticatedGroup.GET("/webhooks/:webhook_id/deliveries/", handlers.GetDeliveries)
+	authenticatedGroup.POST("/webhooks/:webhook_id/deliveries/:delivery_id/replay/", handlers.ReplayDelivery)
+
+	webhookID := uuid.New()
+
+	t.Run("Create", func(t *testing.T) {
+		events := []models.WebhookEvent{models.WebhookEventCreated, models.WebhookEventShared}
+		webhook := &models.Webhook{ID: webhookID, URL: "https://example.com/hook", Events: events, Secret: "secret", Active: true}
+		mockService.On("CreateWebhook", mock.Anything, userID, "https://example.com/hook", events).Return(webhook, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/webhooks/", bytes.NewReader([]byte(`{"url":"https://example.com/hook","events":["created","shared"]}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"secret":"secret"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("CreateWithoutEvents", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/webhooks/", bytes.NewReader([]byte(`{"url":"https://example.com/hook"}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "url and events are required")
+	})
+
+	t.Run("List", func(t *testing.T) {
+		mockService.On("GetWebhooks", mock.Anything, userID).Return([]models.Webhook{{ID: webhookID, URL: "https://example.com/hook"}}, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/webhooks/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "secret")
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Deactivate", func(t *testing.T) {
+		webhook := &models.Webhook{ID: webhookID, URL: "https://example.com/hook", Active: false}
+		mockService.On("UpdateWebhook", mock.Anything, userID, webhookID, (*string)(nil), []models.WebhookEvent(nil), mock.MatchedBy(func(active *bool) bool {
+			return active != nil && !*active
+		})).Return(webhook, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPut, "/webhooks/"+webhookID.String()+"/", bytes.NewReader([]byte(`{"active":false}`)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"active":false`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("DeleteNotFound", func(t *testing.T) {
+		mockService.On("DeleteWebhook", mock.Anything, userID, webhookID).Return(httperror.New(nil, "Webhook not found", http.StatusNotFound)).Once()
+
+		req, _ := http.NewRequest(http.MethodDelete, "/webhooks/"+webhookID.String()+"/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Deliveries", func(t *testing.T) {
+		deliveries := []models.WebhookDelivery{{ID: uuid.New(), WebhookID: webhookID, Status: models.WebhookDeliveryFailed, Payload: []byte(`{}`)}}
+		mockService.On("GetDeliveries", mock.Anything, userID, webhookID, 20).Return(deliveries, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodGet, "/webhooks/"+webhookID.String()+"/deliveries/?offset=20", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"failed"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		deliveryID := uuid.New()
+		replayed := &models.WebhookDelivery{ID: uuid.New(), WebhookID: webhookID, Status: models.WebhookDeliveryPending, Payload: []byte(`{}`)}
+		mockService.On("ReplayDelivery", mock.Anything, userID, webhookID, deliveryID).Return(replayed, nil).Once()
+
+		req, _ := http.NewRequest(http.MethodPost, "/webhooks/"+webhookID.String()+"/deliveries/"+deliveryID.String()+"/replay/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"pending"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("ReplayInvalidID", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/webhooks/"+webhookID.String()+"/deliveries/bad/replay/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,71 @@
+package authclient
+
+import (
+	"context"
+	"net/http"
+
+	pb "github.com/eac0de/xandy/auth/proto"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// User - пользователь сервиса авторизации
+type User struct {
+	ID    uuid.UUID
+	Email string
+}
+
+// Client ищет пользователей в сервисе авторизации по gRPC
+type Client struct {
+	client pb.AuthClient
+}
+
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{
+		client: pb.NewAuthClient(conn),
+	}
+}
+
+func (c *Client) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	resp, err := c.client.GetUserByEmail(ctx, &pb.GetUserByEmailRequest{Email: email})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return newUser(resp)
+}
+
+func (c *Client) GetUserByID(ctx context.Context, userID uuid.UUID) (*User, error) {
+	resp, err := c.client.GetUserByID(ctx, &pb.GetUserByIDRequest{UserId: userID.String()})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return newUser(resp)
+}
+
+func newUser(resp *pb.UserResponse) (*User, error) {
+	userID, err := uuid.Parse(resp.UserId)
+	if err != nil {
+		return nil, err
+	}
+	return &User{ID: userID, Email: resp.Email}, nil
+}
+
+// convertError переводит ошибку gRPC в httperror, недоступность сервиса авторизации - 502
+func convertError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.NotFound:
+		return httperror.New(err, "User not found", http.StatusNotFound)
+	case codes.InvalidArgument:
+		return httperror.New(err, st.Message(), http.StatusBadRequest)
+	default:
+		return httperror.New(err, "Auth service is unavailable", http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,72 @@
+package authclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	pb "github.com/eac0de/xandy/auth/proto"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type fakeAuthServer struct {
+	pb.UnimplementedAuthServer
+	users map[string]string
+}
+
+func (s *fakeAuthServer) GetUserByEmail(ctx context.Context, req *pb.GetUserByEmailRequest) (*pb.UserResponse, error) {
+	userID, ok := s.users[req.Email]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "User not found")
+	}
+	return &pb.UserResponse{UserId: userID, Email: req.Email}, nil
+}
+
+func newTestClient(t *testing.T, server pb.AuthServer) *Client {
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	pb.RegisterAuthServer(grpcServer, server)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return NewClient(conn)
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	client := newTestClient(t, &fakeAuthServer{users: map[string]string{"friend@example.com": userID.String()}})
+
+	user, err := client.GetUserByEmail(ctx, "friend@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, &User{ID: userID, Email: "friend@example.com"}, user)
+
+	_, err = client.GetUserByEmail(ctx, "nobody@example.com")
+	require.Error(t, err)
+	msg, statusCode := httperror.GetMessageAndStatusCode(err)
+	assert.Equal(t, http.StatusNotFound, statusCode)
+	assert.Equal(t, "User not found", msg)
+
+	// Метод, который сервер не реализует, считается недоступностью сервиса
+	_, err = client.GetUserByID(ctx, userID)
+	require.Error(t, err)
+	_, statusCode = httperror.GetMessageAndStatusCode(err)
+	assert.Equal(t, http.StatusBadGateway, statusCode)
+}
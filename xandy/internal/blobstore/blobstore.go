@@ -0,0 +1,97 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+type Info struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// BlobStore хранит содержимое файлов пользователей.
+// Ключ - путь вида <userID>/<name>, разделитель всегда "/".
+type BlobStore interface {
+	// Put сохраняет содержимое целиком, size равен -1, если размер заранее неизвестен
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get открывает содержимое начиная с offset, length меньше нуля означает до конца
+	Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Delete не возвращает ошибку, если содержимого уже нет
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (Info, error)
+	// List вызывает fn для каждого сохранённого ключа, начинающегося с prefix, порядок не гарантируется
+	List(ctx context.Context, prefix string, fn func(key string, info Info) error) error
+}
+
+// ReadSeeker позволяет отдавать содержимое через http.ServeContent:
+// Seek только запоминает позицию, а Read открывает Get с нужного смещения
+type ReadSeeker struct {
+	ctx    context.Context
+	store  BlobStore
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func NewReadSeeker(ctx context.Context, store BlobStore, key string, size int64) *ReadSeeker {
+	return &ReadSeeker{
+		ctx:   ctx,
+		store: store,
+		key:   key,
+		size:  size,
+	}
+}
+
+func (rs *ReadSeeker) Read(p []byte) (int, error) {
+	if rs.offset >= rs.size {
+		return 0, io.EOF
+	}
+	if rs.body == nil {
+		body, err := rs.store.Get(rs.ctx, rs.key, rs.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		rs.body = body
+	}
+	n, err := rs.body.Read(p)
+	rs.offset += int64(n)
+	return n, err
+}
+
+func (rs *ReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = rs.offset + offset
+	case io.SeekEnd:
+		abs = rs.size + offset
+	default:
+		return 0, errors.New("blobstore: invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("blobstore: negative position")
+	}
+	if abs != rs.offset && rs.body != nil {
+		rs.body.Close()
+		rs.body = nil
+	}
+	rs.offset = abs
+	return abs, nil
+}
+
+func (rs *ReadSeeker) Close() error {
+	if rs.body == nil {
+		return nil
+	}
+	err := rs.body.Close()
+	rs.body = nil
+	return err
+}
@@ -0,0 +1,161 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore хранит содержимое в каталоге на диске
+type LocalStore struct {
+	root string
+}
+
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{
+		root: root,
+	}
+}
+
+func (ls *LocalStore) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != key || strings.HasPrefix(key, "/") {
+		return "", fmt.Errorf("blobstore: invalid key %q", key)
+	}
+	return filepath.Join(ls.root, filepath.FromSlash(key)), nil
+}
+
+func (ls *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	blobPath, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(blobPath), os.ModePerm); err != nil {
+		return err
+	}
+	// Пишем во временный файл рядом, чтобы читатели не увидели недописанное содержимое
+	file, err := os.CreateTemp(filepath.Dir(blobPath), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), blobPath)
+}
+
+type limitedFile struct {
+	io.Reader
+	file *os.File
+}
+
+func (lf *limitedFile) Close() error {
+	return lf.file.Close()
+}
+
+func (ls *LocalStore) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	blobPath, err := ls.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(blobPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return &limitedFile{Reader: io.LimitReader(file, length), file: file}, nil
+}
+
+func (ls *LocalStore) Delete(ctx context.Context, key string) error {
+	blobPath, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(blobPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (ls *LocalStore) Stat(ctx context.Context, key string) (Info, error) {
+	blobPath, err := ls.path(key)
+	if err != nil {
+		return Info{}, err
+	}
+	info, err := os.Stat(blobPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, err
+	}
+	return Info{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// List пропускает файлы и каталоги, имена которых начинаются с точки:
+// это недописанные временные файлы и служебные каталоги рядом с хранилищем
+func (ls *LocalStore) List(ctx context.Context, prefix string, fn func(key string, info Info) error) error {
+	// Обходится только каталог, в котором могут лежать ключи с префиксом
+	walkRoot := filepath.Join(ls.root, filepath.FromSlash(path.Dir(prefix+"x")))
+	return filepath.WalkDir(walkRoot, func(blobPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Каталог хранилища ещё не создан или файл удалили во время обхода
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if blobPath == walkRoot {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		key, err := filepath.Rel(ls.root, blobPath)
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(filepath.ToSlash(key), prefix) {
+			return nil
+		}
+		return fn(filepath.ToSlash(key), Info{Size: info.Size(), ModTime: info.ModTime()})
+	})
+}
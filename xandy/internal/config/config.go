@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/caarlos0/env"
 )
@@ -23,6 +24,59 @@ type Config struct {
 
 	// AuthService
 	AuthGRPCServerAddress string `env:"AUTH_GRPC_SERVER_ADDRESS" envDefault:"0.0.0.0:9090"`
+
+	// Почта для уведомлений, в режиме разработки письма выводятся в консоль
+	SMTPHost     string `env:"SMTP_HOST"`
+	SMTPPort     string `env:"SMTP_PORT"`
+	SMTPUsername string `env:"SMTP_USERNAME"`
+	SMTPPassword string `env:"SMTP_PASSWORD"`
+
+	// BlobStore: local или s3
+	BlobStore    string `env:"BLOB_STORE" envDefault:"local"`
+	BlobLocalDir string `env:"BLOB_LOCAL_DIR" envDefault:"../user_files"`
+	S3Endpoint   string `env:"S3_ENDPOINT" envDefault:"http://localhost:9000"`
+	S3Region     string `env:"S3_REGION" envDefault:"us-east-1"`
+	S3Bucket     string `env:"S3_BUCKET" envDefault:"xandy"`
+	S3AccessKey  string `env:"S3_ACCESS_KEY"`
+	S3SecretKey  string `env:"S3_SECRET_KEY"`
+	S3PathStyle  bool   `env:"S3_PATH_STYLE" envDefault:"true"`
+
+	// Максимальный суммарный размер файлов в архиве для скачивания, 1 GiB
+	ArchiveMaxSize int64 `env:"ARCHIVE_MAX_SIZE" envDefault:"1073741824"`
+
+	// Квоты пользователя, 0 - без ограничения
+	MaxFileSize       int64 `env:"MAX_FILE_SIZE" envDefault:"104857600"`       // 100 MiB
+	UserStorageQuota  int64 `env:"USER_STORAGE_QUOTA" envDefault:"5368709120"` // 5 GiB
+	MaxRecordsPerKind int64 `env:"MAX_RECORDS_PER_KIND" envDefault:"10000"`
+
+	// Проверка загруженных файлов на вирусы: none, clamd или fake.
+	// С none файлы доступны сразу и помечаются непроверенными.
+	Scanner      string        `env:"SCANNER" envDefault:"none"`
+	ClamdAddress string        `env:"CLAMD_ADDRESS" envDefault:"localhost:3310"`
+	ScanTimeout  time.Duration `env:"SCAN_TIMEOUT" envDefault:"5m"`
+	ScanInterval time.Duration `env:"SCAN_INTERVAL" envDefault:"2s"`
+
+	// Uploads
+	UploadStagingDir      string        `env:"UPLOAD_STAGING_DIR" envDefault:"../user_files/.uploads"`
+	UploadExpiration      time.Duration `env:"UPLOAD_EXPIRATION" envDefault:"24h"`
+	UploadCleanupInterval time.Duration `env:"UPLOAD_CLEANUP_INTERVAL" envDefault:"1h"`
+
+	// Удаление истёкших и использованных одноразовых ссылок
+	ShareLinkCleanupInterval time.Duration `env:"SHARE_LINK_CLEANUP_INTERVAL" envDefault:"1h"`
+
+	// Удаление записей с истёкшим сроком жизни
+	ExpirationSweepInterval time.Duration `env:"EXPIRATION_SWEEP_INTERVAL" envDefault:"1m"`
+
+	// Рассылка напоминаний о картах и паролях
+	ReminderInterval time.Duration `env:"REMINDER_INTERVAL" envDefault:"1h"`
+
+	// Доставка событий на вебхуки
+	WebhookInterval time.Duration `env:"WEBHOOK_INTERVAL" envDefault:"5s"`
+	WebhookTimeout  time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"10s"`
+
+	// Сколько хранится ответ на запрос с заголовком Idempotency-Key
+	IdempotencyKeyTTL             time.Duration `env:"IDEMPOTENCY_KEY_TTL" envDefault:"24h"`
+	IdempotencyKeyCleanupInterval time.Duration `env:"IDEMPOTENCY_KEY_CLEANUP_INTERVAL" envDefault:"1h"`
 }
 
 func MustLoad() *Config {
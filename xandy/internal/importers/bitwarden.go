@@ -0,0 +1,144 @@
+package importers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+)
+
+const (
+	bitwardenTypeLogin      = 1
+	bitwardenTypeSecureNote = 2
+	bitwardenTypeCard       = 3
+	bitwardenTypeIdentity   = 4
+)
+
+type bitwardenExport struct {
+	Encrypted bool `json:"encrypted"`
+	Folders   []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Items []bitwardenItem `json:"items"`
+}
+
+type bitwardenItem struct {
+	Type     int     `json:"type"`
+	Name     string  `json:"name"`
+	Notes    *string `json:"notes"`
+	FolderID *string `json:"folderId"`
+	Favorite bool    `json:"favorite"`
+	Fields   []struct {
+		Name  string  `json:"name"`
+		Value *string `json:"value"`
+	} `json:"fields"`
+	Login *struct {
+		Username *string `json:"username"`
+		Password *string `json:"password"`
+		Totp     *string `json:"totp"`
+		URIs     []struct {
+			URI *string `json:"uri"`
+		} `json:"uris"`
+	} `json:"login"`
+	Card *struct {
+		CardholderName *string `json:"cardholderName"`
+		Brand          *string `json:"brand"`
+		Number         *string `json:"number"`
+		ExpMonth       *string `json:"expMonth"`
+		ExpYear        *string `json:"expYear"`
+		Code           *string `json:"code"`
+	} `json:"card"`
+	Identity map[string]*string `json:"identity"`
+}
+
+func parseBitwarden(data []byte) ([]Item, error) {
+	var export bitwardenExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, invalidExport(err, "Bitwarden")
+	}
+	if export.Encrypted {
+		return nil, httperror.New(nil, "Encrypted Bitwarden exports are not supported, export the vault as unencrypted JSON", http.StatusBadRequest)
+	}
+	folders := make(map[string]string, len(export.Folders))
+	for _, folder := range export.Folders {
+		folders[folder.ID] = folder.Name
+	}
+
+	items := make([]Item, 0, len(export.Items))
+	for _, bwItem := range export.Items {
+		metadata := models.Metadata{"source": string(FormatBitwardenJSON)}
+		if bwItem.FolderID != nil {
+			setIfNotEmpty(metadata, "folder", folders[*bwItem.FolderID])
+		}
+		for _, field := range bwItem.Fields {
+			if field.Value != nil {
+				setIfNotEmpty(metadata, field.Name, *field.Value)
+			}
+		}
+		notes := deref(bwItem.Notes)
+
+		switch bwItem.Type {
+		case bitwardenTypeLogin:
+			if bwItem.Login == nil {
+				items = append(items, Item{Kind: models.KindAuthInfo, Name: bwItem.Name, Err: fmt.Errorf("login data is missing")})
+				continue
+			}
+			setIfNotEmpty(metadata, "notes", notes)
+			setIfNotEmpty(metadata, "totp", deref(bwItem.Login.Totp))
+			if len(bwItem.Login.URIs) > 0 {
+				setIfNotEmpty(metadata, "url", deref(bwItem.Login.URIs[0].URI))
+			}
+			items = append(items, newLoginItem(bwItem.Name, deref(bwItem.Login.Username), deref(bwItem.Login.Password), metadata))
+		case bitwardenTypeSecureNote:
+			items = append(items, newNoteItem(bwItem.Name, notes, metadata))
+		case bitwardenTypeCard:
+			if bwItem.Card == nil {
+				items = append(items, Item{Kind: models.KindBankCard, Name: bwItem.Name, Err: fmt.Errorf("card data is missing")})
+				continue
+			}
+			setIfNotEmpty(metadata, "notes", notes)
+			setIfNotEmpty(metadata, "brand", deref(bwItem.Card.Brand))
+			items = append(items, Item{
+				Kind:       models.KindBankCard,
+				Name:       bwItem.Name,
+				Number:     cleanCardNumber(deref(bwItem.Card.Number)),
+				CardHolder: deref(bwItem.Card.CardholderName),
+				ExpireDate: formatExpireDate(deref(bwItem.Card.ExpMonth), deref(bwItem.Card.ExpYear)),
+				CSC:        deref(bwItem.Card.Code),
+				Metadata:   metadata,
+			})
+		case bitwardenTypeIdentity:
+			// Для личных данных отдельного вида нет, сохраняем их как текст
+			keys := make([]string, 0, len(bwItem.Identity))
+			for key, value := range bwItem.Identity {
+				if value != nil && *value != "" {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			lines := make([]string, 0, len(keys)+1)
+			for _, key := range keys {
+				lines = append(lines, fmt.Sprintf("%s: %s", key, *bwItem.Identity[key]))
+			}
+			if notes != "" {
+				lines = append(lines, notes)
+			}
+			items = append(items, newNoteItem(bwItem.Name, strings.Join(lines, "\n"), metadata))
+		default:
+			items = append(items, Item{Name: bwItem.Name, Err: fmt.Errorf("unknown Bitwarden item type %d", bwItem.Type)})
+		}
+	}
+	return items, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,63 @@
+package importers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/eac0de/xandy/internal/models"
+)
+
+// parseBrowserCSV разбирает экспорт паролей Chrome (name,url,username,password,note)
+// и Firefox (url,username,password,httpRealm,formActionOrigin,guid,...).
+// Колонки ищутся по заголовку, поэтому оба формата обрабатываются одинаково.
+func parseBrowserCSV(data []byte) ([]Item, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, invalidExport(err, "CSV")
+	}
+	if len(records) == 0 {
+		return nil, invalidExport(fmt.Errorf("file is empty"), "CSV")
+	}
+	columns := make(map[string]int, len(records[0]))
+	for i, column := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	if _, ok := columns["password"]; !ok {
+		return nil, invalidExport(fmt.Errorf("password column is missing"), "CSV")
+	}
+	get := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+
+	items := make([]Item, 0, len(records)-1)
+	for _, record := range records[1:] {
+		rawURL := get(record, "url")
+		name := get(record, "name")
+		if name == "" {
+			name = hostFromURL(rawURL)
+		}
+		metadata := models.Metadata{"source": "browser_csv"}
+		setIfNotEmpty(metadata, "url", rawURL)
+		setIfNotEmpty(metadata, "notes", get(record, "note"))
+		setIfNotEmpty(metadata, "http_realm", get(record, "httprealm"))
+		items = append(items, newLoginItem(name, get(record, "username"), get(record, "password"), metadata))
+	}
+	return items, nil
+}
+
+func hostFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Host
+}
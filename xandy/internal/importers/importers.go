@@ -0,0 +1,130 @@
+package importers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+)
+
+// Поддерживаемые форматы импорта
+type Format string
+
+const (
+	FormatBitwardenJSON Format = "bitwarden_json"
+	FormatKeePassXML    Format = "keepass_xml"
+	FormatKeePassKDBX   Format = "keepass_kdbx"
+	FormatOnePassword   Format = "1pux"
+	FormatChromeCSV     Format = "chrome_csv"
+	FormatFirefoxCSV    Format = "firefox_csv"
+)
+
+// Запись, прочитанная из экспорта стороннего менеджера паролей.
+// Заполняются только поля, относящиеся к Kind.
+type Item struct {
+	Kind     models.DataKind
+	Name     string
+	Metadata models.Metadata
+
+	// auth_info
+	Login    string
+	Password string
+
+	// text_data
+	Text string
+
+	// bank_card
+	Number     string
+	CardHolder string
+	ExpireDate string
+	CSC        string
+
+	// file_data
+	FileName string
+	FileData []byte
+
+	// Ошибка разбора конкретной записи, сама запись при этом не импортируется
+	Err error
+}
+
+// Parse разбирает экспорт в заданном формате.
+// password используется только для зашифрованных баз KeePass.
+func Parse(format Format, data []byte, password string) ([]Item, error) {
+	switch format {
+	case FormatBitwardenJSON:
+		return parseBitwarden(data)
+	case FormatKeePassXML:
+		return parseKeePassXML(data, nil, nil)
+	case FormatKeePassKDBX:
+		return parseKDBX(data, password)
+	case FormatOnePassword:
+		return parseOnePassword(data)
+	case FormatChromeCSV, FormatFirefoxCSV:
+		return parseBrowserCSV(data)
+	default:
+		return nil, httperror.New(nil, fmt.Sprintf("Unsupported import format: %s", format), http.StatusBadRequest)
+	}
+}
+
+func invalidExport(err error, format string) error {
+	return httperror.New(err, fmt.Sprintf("Invalid %s export: %s", format, err.Error()), http.StatusBadRequest)
+}
+
+func newLoginItem(name, login, password string, metadata models.Metadata) Item {
+	return Item{
+		Kind:     models.KindAuthInfo,
+		Name:     name,
+		Login:    login,
+		Password: password,
+		Metadata: metadata,
+	}
+}
+
+func newNoteItem(name, text string, metadata models.Metadata) Item {
+	return Item{
+		Kind:     models.KindTextData,
+		Name:     name,
+		Text:     text,
+		Metadata: metadata,
+	}
+}
+
+func newFileItem(fileName string, data []byte, metadata models.Metadata) Item {
+	return Item{
+		Kind:     models.KindFileData,
+		Name:     fileName,
+		FileName: fileName,
+		FileData: data,
+		Metadata: metadata,
+	}
+}
+
+// formatExpireDate приводит месяц и год к формату MM/YY
+func formatExpireDate(month, year string) string {
+	month = strings.TrimSpace(month)
+	year = strings.TrimSpace(year)
+	if month == "" || year == "" {
+		return ""
+	}
+	if len(month) == 1 {
+		month = "0" + month
+	}
+	if len(year) > 2 {
+		year = year[len(year)-2:]
+	}
+	return month + "/" + year
+}
+
+// cleanCardNumber убирает пробелы и дефисы из номера карты
+func cleanCardNumber(number string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(number)
+}
+
+// setIfNotEmpty добавляет значение в метаданные, только если оно не пустое
+func setIfNotEmpty(metadata models.Metadata, key string, value string) {
+	if value != "" {
+		metadata[key] = value
+	}
+}
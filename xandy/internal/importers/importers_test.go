@@ -0,0 +1,201 @@
+package importers
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBitwarden(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		export := `{
+			"encrypted": false,
+			"folders": [{"id": "f1", "name": "Work"}],
+			"items": [
+				{"type": 1, "name": "GitHub", "folderId": "f1", "notes": "main account",
+				 "login": {"username": "octocat", "password": "secret", "uris": [{"uri": "https://github.com"}]}},
+				{"type": 2, "name": "Wifi", "notes": "password: 12345678"},
+				{"type": 3, "name": "Visa", "card": {"cardholderName": "IVAN IVANOV", "brand": "Visa",
+				 "number": "4111 1111 1111 1111", "expMonth": "1", "expYear": "2027", "code": "123"}},
+				{"type": 9, "name": "Unknown"}
+			]
+		}`
+		items, err := Parse(FormatBitwardenJSON, []byte(export), "")
+		require.NoError(t, err)
+		require.Len(t, items, 4)
+
+		assert.Equal(t, models.KindAuthInfo, items[0].Kind)
+		assert.Equal(t, "octocat", items[0].Login)
+		assert.Equal(t, "secret", items[0].Password)
+		assert.Equal(t, "Work", items[0].Metadata["folder"])
+		assert.Equal(t, "https://github.com", items[0].Metadata["url"])
+
+		assert.Equal(t, models.KindTextData, items[1].Kind)
+		assert.Equal(t, "password: 12345678", items[1].Text)
+
+		assert.Equal(t, models.KindBankCard, items[2].Kind)
+		assert.Equal(t, "4111111111111111", items[2].Number)
+		assert.Equal(t, "01/27", items[2].ExpireDate)
+		assert.Equal(t, "123", items[2].CSC)
+
+		assert.Error(t, items[3].Err)
+	})
+
+	t.Run("Encrypted", func(t *testing.T) {
+		_, err := Parse(FormatBitwardenJSON, []byte(`{"encrypted": true, "items": []}`), "")
+		_, statusCode := httperror.GetMessageAndStatusCode(err)
+		assert.Equal(t, 400, statusCode)
+	})
+}
+
+func TestParseBrowserCSV(t *testing.T) {
+	t.Run("Chrome", func(t *testing.T) {
+		export := "name,url,username,password,note\nexample.com,https://example.com/login,user,pass,hello\n"
+		items, err := Parse(FormatChromeCSV, []byte(export), "")
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, "example.com", items[0].Name)
+		assert.Equal(t, "user", items[0].Login)
+		assert.Equal(t, "pass", items[0].Password)
+		assert.Equal(t, "hello", items[0].Metadata["notes"])
+	})
+
+	t.Run("Firefox", func(t *testing.T) {
+		export := `"url","username","password","httpRealm","formActionOrigin","guid","timeCreated","timeLastUsed","timePasswordChanged"
+"https://mail.example.org","user@example.org","pass","","https://mail.example.org","{1}","1","1","1"
+`
+		items, err := Parse(FormatFirefoxCSV, []byte(export), "")
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, "mail.example.org", items[0].Name)
+		assert.Equal(t, "user@example.org", items[0].Login)
+	})
+
+	t.Run("MissingPasswordColumn", func(t *testing.T) {
+		_, err := Parse(FormatChromeCSV, []byte("name,url\nexample,https://example.com\n"), "")
+		assert.Error(t, err)
+	})
+}
+
+func TestParseKeePassXML(t *testing.T) {
+	export := `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<KeePassFile>
+	<Meta>
+		<RecycleBinUUID>cmVjeWNsZQ==</RecycleBinUUID>
+		<Binaries>
+			<Binary ID="0" Compressed="False">aGVsbG8=</Binary>
+		</Binaries>
+	</Meta>
+	<Root>
+		<Group>
+			<UUID>cm9vdA==</UUID>
+			<Name>Database</Name>
+			<Entry>
+				<String><Key>Title</Key><Value>Mail</Value></String>
+				<String><Key>UserName</Key><Value>ivan</Value></String>
+				<String><Key>Password</Key><Value Protected="True">qwerty</Value></String>
+				<String><Key>URL</Key><Value>https://mail.example.com</Value></String>
+				<String><Key>Recovery</Key><Value>code</Value></String>
+				<Binary><Key>codes.txt</Key><Value Ref="0" /></Binary>
+				<History>
+					<Entry>
+						<String><Key>Title</Key><Value>Old mail</Value></String>
+					</Entry>
+				</History>
+			</Entry>
+			<Group>
+				<UUID>bm90ZXM=</UUID>
+				<Name>Notes</Name>
+				<Entry>
+					<String><Key>Title</Key><Value>Door code</Value></String>
+					<String><Key>Notes</Key><Value>1234</Value></String>
+				</Entry>
+			</Group>
+			<Group>
+				<UUID>cmVjeWNsZQ==</UUID>
+				<Name>Recycle Bin</Name>
+				<Entry>
+					<String><Key>Title</Key><Value>Deleted</Value></String>
+				</Entry>
+			</Group>
+		</Group>
+	</Root>
+</KeePassFile>`
+	items, err := Parse(FormatKeePassXML, []byte(export), "")
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+
+	assert.Equal(t, models.KindAuthInfo, items[0].Kind)
+	assert.Equal(t, "Mail", items[0].Name)
+	assert.Equal(t, "qwerty", items[0].Password)
+	assert.Equal(t, "code", items[0].Metadata["Recovery"])
+
+	assert.Equal(t, models.KindFileData, items[1].Kind)
+	assert.Equal(t, "codes.txt", items[1].FileName)
+	assert.Equal(t, []byte("hello"), items[1].FileData)
+	assert.Equal(t, "Mail", items[1].Metadata["attachment_of"])
+
+	assert.Equal(t, models.KindTextData, items[2].Kind)
+	assert.Equal(t, "1234", items[2].Text)
+	assert.Equal(t, "Notes", items[2].Metadata["folder"])
+}
+
+func TestParseKDBXInvalid(t *testing.T) {
+	_, err := Parse(FormatKeePassKDBX, []byte("not a database"), "password")
+	_, statusCode := httperror.GetMessageAndStatusCode(err)
+	assert.Equal(t, 400, statusCode)
+}
+
+func TestParseOnePassword(t *testing.T) {
+	exportData := `{"accounts": [{"vaults": [{"attrs": {"name": "Private"}, "items": [
+		{"uuid": "1", "state": "active", "categoryUuid": "001",
+		 "overview": {"title": "Bank", "url": "https://bank.example.com"},
+		 "details": {"loginFields": [{"designation": "username", "value": "client"}, {"designation": "password", "value": "pwd"}]}},
+		{"uuid": "2", "state": "active", "categoryUuid": "002", "overview": {"title": "Mastercard"},
+		 "details": {"sections": [{"fields": [
+			{"id": "cardholder", "title": "cardholder name", "value": {"string": "IVAN IVANOV"}},
+			{"id": "ccnum", "title": "number", "value": {"creditCardNumber": "5555555555554444"}},
+			{"id": "cvv", "title": "verification number", "value": {"concealed": "321"}},
+			{"id": "expiry", "title": "expiry date", "value": {"monthYear": 202612}}
+		 ]}]}},
+		{"uuid": "3", "state": "active", "categoryUuid": "006", "overview": {"title": "Passport scan"},
+		 "details": {"documentAttributes": {"fileName": "passport.pdf", "documentId": "doc1"}}},
+		{"uuid": "4", "state": "trashed", "categoryUuid": "003", "overview": {"title": "Old note"}, "details": {"notesPlain": "x"}}
+	]}]}]}`
+	buf := &bytes.Buffer{}
+	archive := zip.NewWriter(buf)
+	w, err := archive.Create("export.data")
+	require.NoError(t, err)
+	w.Write([]byte(exportData))
+	w, err = archive.Create("files/doc1__passport.pdf")
+	require.NoError(t, err)
+	w.Write([]byte("%PDF"))
+	require.NoError(t, archive.Close())
+
+	items, err := Parse(FormatOnePassword, buf.Bytes(), "")
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+
+	assert.Equal(t, models.KindAuthInfo, items[0].Kind)
+	assert.Equal(t, "client", items[0].Login)
+	assert.Equal(t, "pwd", items[0].Password)
+
+	assert.Equal(t, models.KindBankCard, items[1].Kind)
+	assert.Equal(t, "5555555555554444", items[1].Number)
+	assert.Equal(t, "12/26", items[1].ExpireDate)
+	assert.Equal(t, "321", items[1].CSC)
+
+	assert.Equal(t, models.KindFileData, items[2].Kind)
+	assert.Equal(t, []byte("%PDF"), items[2].FileData)
+}
+
+func TestParseUnsupportedFormat(t *testing.T) {
+	_, err := Parse(Format("lastpass"), nil, "")
+	_, statusCode := httperror.GetMessageAndStatusCode(err)
+	assert.Equal(t, 400, statusCode)
+}
@@ -0,0 +1,267 @@
+package importers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+)
+
+// Тестовые базы собираются так же, как их пишет KeePass, с минимальной стоимостью KDF
+const kdbxTestXML = `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<KeePassFile>
+	<Root>
+		<Group>
+			<Name>Database</Name>
+			<Entry>
+				<String><Key>Title</Key><Value>Mail</Value></String>
+				<String><Key>UserName</Key><Value>ivan</Value></String>
+				<String><Key>Password</Key><Value Protected="True">%s</Value></String>
+				%s
+			</Entry>
+		</Group>
+	</Root>
+</KeePassFile>`
+
+func randomBytes(t *testing.T, size int) []byte {
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+	return data
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	buf := &bytes.Buffer{}
+	writer := gzip.NewWriter(buf)
+	_, err := writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func encryptAESCBC(t *testing.T, key, iv, data []byte) []byte {
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	padded := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	encrypted := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, padded)
+	return encrypted
+}
+
+// protectValue шифрует защищённое значение потоком, общим для всего документа
+func protectValue(t *testing.T, streamID uint32, streamKey []byte, value string) string {
+	stream, err := newProtectedStream(streamID, streamKey)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(stream([]byte(value)))
+}
+
+func kdbxCompositeKey(password string) []byte {
+	passwordHash := sha256.Sum256([]byte(password))
+	compositeKey := sha256.Sum256(passwordHash[:])
+	return compositeKey[:]
+}
+
+func writeKDBXSignature(buf *bytes.Buffer, minorVersion, majorVersion uint16) {
+	binary.Write(buf, binary.LittleEndian, []uint32{kdbxSignature1, kdbxSignature2})
+	binary.Write(buf, binary.LittleEndian, []uint16{minorVersion, majorVersion})
+}
+
+func writeKDBX3Field(buf *bytes.Buffer, fieldID uint8, value []byte) {
+	buf.WriteByte(fieldID)
+	binary.Write(buf, binary.LittleEndian, uint16(len(value)))
+	buf.Write(value)
+}
+
+func writeKDBX4Field(buf *bytes.Buffer, fieldID uint8, value []byte) {
+	buf.WriteByte(fieldID)
+	binary.Write(buf, binary.LittleEndian, uint32(len(value)))
+	buf.Write(value)
+}
+
+func buildKDBX3(t *testing.T, password string, rounds uint64) []byte {
+	masterSeed := randomBytes(t, 32)
+	transformSeed := randomBytes(t, 32)
+	iv := randomBytes(t, 16)
+	streamKey := randomBytes(t, 32)
+	streamStartBytes := randomBytes(t, 32)
+
+	header := &bytes.Buffer{}
+	writeKDBXSignature(header, 1, 3)
+	writeKDBX3Field(header, kdbxHeaderCipherID, kdbxCipherAES256[:])
+	writeKDBX3Field(header, kdbxHeaderCompressionFlags, binary.LittleEndian.AppendUint32(nil, 1))
+	writeKDBX3Field(header, kdbxHeaderMasterSeed, masterSeed)
+	writeKDBX3Field(header, kdbxHeaderTransformSeed, transformSeed)
+	writeKDBX3Field(header, kdbxHeaderTransformRounds, binary.LittleEndian.AppendUint64(nil, rounds))
+	writeKDBX3Field(header, kdbxHeaderEncryptionIV, iv)
+	writeKDBX3Field(header, kdbxHeaderProtectedStreamKey, streamKey)
+	writeKDBX3Field(header, kdbxHeaderStreamStartBytes, streamStartBytes)
+	writeKDBX3Field(header, kdbxHeaderInnerRandomStreamID, binary.LittleEndian.AppendUint32(nil, kdbxRandomStreamSalsa20))
+	writeKDBX3Field(header, kdbxHeaderEnd, []byte("\r\n\r\n"))
+
+	xml := fmt.Sprintf(kdbxTestXML, protectValue(t, kdbxRandomStreamSalsa20, streamKey, "qwerty"), "")
+	content := gzipBytes(t, []byte(xml))
+	payload := &bytes.Buffer{}
+	payload.Write(streamStartBytes)
+	contentHash := sha256.Sum256(content)
+	binary.Write(payload, binary.LittleEndian, uint32(0))
+	payload.Write(contentHash[:])
+	binary.Write(payload, binary.LittleEndian, uint32(len(content)))
+	payload.Write(content)
+	binary.Write(payload, binary.LittleEndian, uint32(1))
+	payload.Write(make([]byte, sha256.Size))
+	binary.Write(payload, binary.LittleEndian, uint32(0))
+
+	block, err := aes.NewCipher(transformSeed)
+	require.NoError(t, err)
+	transformedKey := kdbxCompositeKey(password)
+	for i := uint64(0); i < rounds; i++ {
+		block.Encrypt(transformedKey[:16], transformedKey[:16])
+		block.Encrypt(transformedKey[16:], transformedKey[16:])
+	}
+	transformedHash := sha256.Sum256(transformedKey)
+	masterKey := sha256.Sum256(append(append([]byte{}, masterSeed...), transformedHash[:]...))
+
+	return append(header.Bytes(), encryptAESCBC(t, masterKey[:], iv, payload.Bytes())...)
+}
+
+func writeVariant(buf *bytes.Buffer, valueType uint8, key string, value []byte) {
+	buf.WriteByte(valueType)
+	binary.Write(buf, binary.LittleEndian, uint32(len(key)))
+	buf.WriteString(key)
+	binary.Write(buf, binary.LittleEndian, uint32(len(value)))
+	buf.Write(value)
+}
+
+func buildKDBX4(t *testing.T, password string, iterations, memory uint64) []byte {
+	masterSeed := randomBytes(t, 32)
+	salt := randomBytes(t, 32)
+	iv := randomBytes(t, 16)
+	streamKey := randomBytes(t, 64)
+
+	kdfParameters := &bytes.Buffer{}
+	binary.Write(kdfParameters, binary.LittleEndian, uint16(0x0100))
+	writeVariant(kdfParameters, 0x42, "$UUID", kdbxKdfArgon2id[:])
+	writeVariant(kdfParameters, 0x42, "S", salt)
+	writeVariant(kdfParameters, 0x05, "I", binary.LittleEndian.AppendUint64(nil, iterations))
+	writeVariant(kdfParameters, 0x05, "M", binary.LittleEndian.AppendUint64(nil, memory))
+	writeVariant(kdfParameters, 0x04, "P", binary.LittleEndian.AppendUint32(nil, 1))
+	writeVariant(kdfParameters, 0x04, "V", binary.LittleEndian.AppendUint32(nil, argon2.Version))
+	kdfParameters.WriteByte(0)
+
+	header := &bytes.Buffer{}
+	writeKDBXSignature(header, 0, 4)
+	writeKDBX4Field(header, kdbxHeaderCipherID, kdbxCipherAES256[:])
+	writeKDBX4Field(header, kdbxHeaderCompressionFlags, binary.LittleEndian.AppendUint32(nil, 1))
+	writeKDBX4Field(header, kdbxHeaderMasterSeed, masterSeed)
+	writeKDBX4Field(header, kdbxHeaderEncryptionIV, iv)
+	writeKDBX4Field(header, kdbxHeaderKdfParameters, kdfParameters.Bytes())
+	writeKDBX4Field(header, kdbxHeaderEnd, []byte("\r\n\r\n"))
+	headerBytes := header.Bytes()
+
+	inner := &bytes.Buffer{}
+	writeKDBX4Field(inner, kdbxInnerHeaderRandomStreamID, binary.LittleEndian.AppendUint32(nil, kdbxRandomStreamChaCha20))
+	writeKDBX4Field(inner, kdbxInnerHeaderRandomStreamKey, streamKey)
+	writeKDBX4Field(inner, kdbxInnerHeaderBinary, append([]byte{0}, "hello"...))
+	writeKDBX4Field(inner, kdbxInnerHeaderEnd, nil)
+	binaryRef := `<Binary><Key>codes.txt</Key><Value Ref="0" /></Binary>`
+	inner.WriteString(fmt.Sprintf(kdbxTestXML, protectValue(t, kdbxRandomStreamChaCha20, streamKey, "qwerty"), binaryRef))
+
+	transformedKey := argon2.IDKey(kdbxCompositeKey(password), salt, uint32(iterations), uint32(memory/1024), 1, 32)
+	keyMaterial := append(append([]byte{}, masterSeed...), transformedKey...)
+	cipherKey := sha256.Sum256(keyMaterial)
+	hmacBaseKey := sha512.Sum512(append(keyMaterial, 0x01))
+	encrypted := encryptAESCBC(t, cipherKey[:], iv, gzipBytes(t, inner.Bytes()))
+
+	file := &bytes.Buffer{}
+	file.Write(headerBytes)
+	headerHash := sha256.Sum256(headerBytes)
+	file.Write(headerHash[:])
+	file.Write(kdbxHMAC(hmacBaseKey[:], ^uint64(0), headerBytes))
+	for index, block := range [][]byte{encrypted, nil} {
+		signed := binary.LittleEndian.AppendUint64(nil, uint64(index))
+		signed = binary.LittleEndian.AppendUint32(signed, uint32(len(block)))
+		file.Write(kdbxHMAC(hmacBaseKey[:], uint64(index), append(signed, block...)))
+		binary.Write(file, binary.LittleEndian, uint32(len(block)))
+		file.Write(block)
+	}
+	return file.Bytes()
+}
+
+func TestParseKDBX3(t *testing.T) {
+	data := buildKDBX3(t, "master", 100)
+
+	t.Run("Success", func(t *testing.T) {
+		items, err := Parse(FormatKeePassKDBX, data, "master")
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, models.KindAuthInfo, items[0].Kind)
+		assert.Equal(t, "Mail", items[0].Name)
+		assert.Equal(t, "ivan", items[0].Login)
+		assert.Equal(t, "qwerty", items[0].Password)
+	})
+
+	t.Run("WrongPassword", func(t *testing.T) {
+		_, err := Parse(FormatKeePassKDBX, data, "wrong")
+		_, statusCode := httperror.GetMessageAndStatusCode(err)
+		assert.Equal(t, 422, statusCode)
+	})
+
+	t.Run("TooManyRounds", func(t *testing.T) {
+		// KDF до проверки не доходит, поэтому подменяем только поле заголовка
+		roundsField := append([]byte{kdbxHeaderTransformRounds, 8, 0}, binary.LittleEndian.AppendUint64(nil, 100)...)
+		tampered := bytes.Replace(data, roundsField, append(roundsField[:3:3], binary.LittleEndian.AppendUint64(nil, kdbxMaxAESRounds+1)...), 1)
+		_, err := Parse(FormatKeePassKDBX, tampered, "master")
+		assert.ErrorContains(t, err, "too many AES-KDF rounds")
+		_, statusCode := httperror.GetMessageAndStatusCode(err)
+		assert.Equal(t, 400, statusCode)
+	})
+}
+
+func TestParseKDBX4(t *testing.T) {
+	data := buildKDBX4(t, "master", 2, 1024*1024)
+
+	t.Run("Success", func(t *testing.T) {
+		items, err := Parse(FormatKeePassKDBX, data, "master")
+		require.NoError(t, err)
+		require.Len(t, items, 2)
+		assert.Equal(t, models.KindAuthInfo, items[0].Kind)
+		assert.Equal(t, "qwerty", items[0].Password)
+		assert.Equal(t, models.KindFileData, items[1].Kind)
+		assert.Equal(t, "codes.txt", items[1].FileName)
+		assert.Equal(t, []byte("hello"), items[1].FileData)
+	})
+
+	t.Run("WrongPassword", func(t *testing.T) {
+		_, err := Parse(FormatKeePassKDBX, data, "wrong")
+		_, statusCode := httperror.GetMessageAndStatusCode(err)
+		assert.Equal(t, 422, statusCode)
+	})
+
+	t.Run("ExcessiveArgon2Memory", func(t *testing.T) {
+		memoryField := append([]byte{'M', 8, 0, 0, 0}, binary.LittleEndian.AppendUint64(nil, 1024*1024)...)
+		tampered := bytes.Replace(data, memoryField, append(memoryField[:5:5], binary.LittleEndian.AppendUint64(nil, 2*kdbxMaxArgon2Memory)...), 1)
+		// Контрольная сумма заголовка проверяется до KDF, её пересчитываем
+		headerEnd := []byte{kdbxHeaderEnd, 4, 0, 0, 0, '\r', '\n', '\r', '\n'}
+		headerSize := bytes.Index(tampered, headerEnd) + len(headerEnd)
+		headerHash := sha256.Sum256(tampered[:headerSize])
+		copy(tampered[headerSize:], headerHash[:])
+		_, err := Parse(FormatKeePassKDBX, tampered, "master")
+		assert.ErrorContains(t, err, "unsupported Argon2 parameters")
+		_, statusCode := httperror.GetMessageAndStatusCode(err)
+		assert.Equal(t, 400, statusCode)
+	})
+}
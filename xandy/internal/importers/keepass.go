@@ -0,0 +1,196 @@
+package importers
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/eac0de/xandy/internal/models"
+)
+
+// Стандартные поля записи KeePass, остальные строки попадают в метаданные
+var keepassStandardFields = map[string]bool{
+	"Title":    true,
+	"UserName": true,
+	"Password": true,
+	"URL":      true,
+	"Notes":    true,
+}
+
+// xmlNode - узел XML-дерева с сохранением порядка дочерних элементов.
+// Порядок важен: защищённые значения KDBX расшифровываются потоком в порядке документа.
+type xmlNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",chardata"`
+	Nodes   []xmlNode  `xml:",any"`
+}
+
+func (n *xmlNode) child(name string) *xmlNode {
+	for i := range n.Nodes {
+		if n.Nodes[i].XMLName.Local == name {
+			return &n.Nodes[i]
+		}
+	}
+	return nil
+}
+
+func (n *xmlNode) childText(name string) string {
+	if c := n.child(name); c != nil {
+		return c.Content
+	}
+	return ""
+}
+
+func (n *xmlNode) attr(name string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// unprotect проходит дерево в порядке документа и расшифровывает значения с Protected="True"
+func (n *xmlNode) unprotect(stream func([]byte) []byte) error {
+	if strings.EqualFold(n.attr("Protected"), "true") {
+		raw, err := base64.StdEncoding.DecodeString(n.Content)
+		if err != nil {
+			return err
+		}
+		n.Content = string(stream(raw))
+	}
+	for i := range n.Nodes {
+		if err := n.Nodes[i].unprotect(stream); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseKeePassXML разбирает XML-экспорт KeePass.
+// Для KDBX передаются поток расшифровки защищённых значений и вложения из внутреннего заголовка.
+func parseKeePassXML(data []byte, stream func([]byte) []byte, binaries [][]byte) ([]Item, error) {
+	var root xmlNode
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, invalidExport(err, "KeePass")
+	}
+	if root.XMLName.Local != "KeePassFile" {
+		return nil, invalidExport(fmt.Errorf("KeePassFile element is missing"), "KeePass")
+	}
+	if stream != nil {
+		if err := root.unprotect(stream); err != nil {
+			return nil, invalidExport(err, "KeePass")
+		}
+	}
+
+	meta := root.child("Meta")
+	binaryByRef := make(map[string][]byte)
+	for i, binary := range binaries {
+		binaryByRef[fmt.Sprint(i)] = binary
+	}
+	var recycleBinUUID string
+	if meta != nil {
+		recycleBinUUID = meta.childText("RecycleBinUUID")
+		if metaBinaries := meta.child("Binaries"); metaBinaries != nil {
+			for _, binary := range metaBinaries.Nodes {
+				content, err := decodeKeePassBinary(&binary)
+				if err != nil {
+					return nil, invalidExport(err, "KeePass")
+				}
+				binaryByRef[binary.attr("ID")] = content
+			}
+		}
+	}
+
+	rootGroup := root.child("Root")
+	if rootGroup == nil {
+		return nil, invalidExport(fmt.Errorf("Root element is missing"), "KeePass")
+	}
+	var items []Item
+	for i := range rootGroup.Nodes {
+		if rootGroup.Nodes[i].XMLName.Local == "Group" {
+			items = appendKeePassGroup(items, &rootGroup.Nodes[i], nil, recycleBinUUID, binaryByRef)
+		}
+	}
+	return items, nil
+}
+
+func appendKeePassGroup(items []Item, group *xmlNode, path []string, recycleBinUUID string, binaries map[string][]byte) []Item {
+	if recycleBinUUID != "" && group.childText("UUID") == recycleBinUUID {
+		return items
+	}
+	// Корневую группу в путь не включаем, это название самой базы
+	if path != nil {
+		path = append(append([]string{}, path...), group.childText("Name"))
+	} else {
+		path = []string{}
+	}
+	for i := range group.Nodes {
+		node := &group.Nodes[i]
+		switch node.XMLName.Local {
+		case "Entry":
+			items = appendKeePassEntry(items, node, strings.Join(path, "/"), binaries)
+		case "Group":
+			items = appendKeePassGroup(items, node, path, recycleBinUUID, binaries)
+		}
+	}
+	return items
+}
+
+func appendKeePassEntry(items []Item, entry *xmlNode, folder string, binaries map[string][]byte) []Item {
+	fields := make(map[string]string)
+	metadata := models.Metadata{"source": "keepass"}
+	setIfNotEmpty(metadata, "folder", folder)
+	for _, node := range entry.Nodes {
+		if node.XMLName.Local != "String" {
+			continue
+		}
+		key, value := node.childText("Key"), node.childText("Value")
+		fields[key] = value
+		if !keepassStandardFields[key] {
+			setIfNotEmpty(metadata, key, value)
+		}
+	}
+	name := fields["Title"]
+	setIfNotEmpty(metadata, "url", fields["URL"])
+
+	if fields["UserName"] == "" && fields["Password"] == "" {
+		items = append(items, newNoteItem(name, fields["Notes"], metadata))
+	} else {
+		setIfNotEmpty(metadata, "notes", fields["Notes"])
+		items = append(items, newLoginItem(name, fields["UserName"], fields["Password"], metadata))
+	}
+
+	for _, node := range entry.Nodes {
+		if node.XMLName.Local != "Binary" {
+			continue
+		}
+		fileName := node.childText("Key")
+		fileMetadata := models.Metadata{"source": "keepass", "attachment_of": name}
+		setIfNotEmpty(fileMetadata, "folder", folder)
+		var ref string
+		if value := node.child("Value"); value != nil {
+			ref = value.attr("Ref")
+		}
+		content, ok := binaries[ref]
+		if !ok {
+			items = append(items, Item{Kind: models.KindFileData, Name: fileName, Err: fmt.Errorf("attachment %q references missing binary %q", fileName, ref)})
+			continue
+		}
+		items = append(items, newFileItem(fileName, content, fileMetadata))
+	}
+	return items
+}
+
+func decodeKeePassBinary(binary *xmlNode) ([]byte, error) {
+	content, err := base64.StdEncoding.DecodeString(strings.TrimSpace(binary.Content))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(binary.attr("Compressed"), "true") {
+		return content, nil
+	}
+	return gunzip(content)
+}
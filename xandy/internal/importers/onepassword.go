@@ -0,0 +1,207 @@
+package importers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/eac0de/xandy/internal/models"
+)
+
+const (
+	onePasswordCategoryLogin      = "001"
+	onePasswordCategoryCreditCard = "002"
+	onePasswordCategorySecureNote = "003"
+	onePasswordCategoryPassword   = "005"
+	onePasswordCategoryDocument   = "006"
+)
+
+type onePasswordExport struct {
+	Accounts []struct {
+		Vaults []struct {
+			Attrs struct {
+				Name string `json:"name"`
+			} `json:"attrs"`
+			Items []onePasswordItem `json:"items"`
+		} `json:"vaults"`
+	} `json:"accounts"`
+}
+
+type onePasswordItem struct {
+	UUID         string `json:"uuid"`
+	State        string `json:"state"`
+	CategoryUUID string `json:"categoryUuid"`
+	Overview     struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+	} `json:"overview"`
+	Details struct {
+		LoginFields []struct {
+			Designation string `json:"designation"`
+			Value       string `json:"value"`
+		} `json:"loginFields"`
+		NotesPlain string `json:"notesPlain"`
+		Password   string `json:"password"`
+		Sections   []struct {
+			Fields []struct {
+				Title string                     `json:"title"`
+				ID    string                     `json:"id"`
+				Value map[string]json.RawMessage `json:"value"`
+			} `json:"fields"`
+		} `json:"sections"`
+		DocumentAttributes *struct {
+			FileName   string `json:"fileName"`
+			DocumentID string `json:"documentId"`
+		} `json:"documentAttributes"`
+	} `json:"details"`
+}
+
+// fields возвращает значения полей всех секций по их id в строковом виде
+func (item *onePasswordItem) fields() map[string]string {
+	fields := make(map[string]string)
+	for _, section := range item.Details.Sections {
+		for _, field := range section.Fields {
+			for _, raw := range field.Value {
+				var value interface{}
+				if err := json.Unmarshal(raw, &value); err != nil {
+					continue
+				}
+				switch v := value.(type) {
+				case string:
+					fields[field.ID] = v
+				case float64:
+					fields[field.ID] = fmt.Sprintf("%.0f", v)
+				}
+			}
+		}
+	}
+	return fields
+}
+
+// parseOnePassword разбирает архив 1PUX: данные лежат в export.data, вложения - в files/
+func parseOnePassword(data []byte) ([]Item, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, invalidExport(err, "1Password")
+	}
+	files := make(map[string]*zip.File)
+	var exportFile *zip.File
+	for _, file := range archive.File {
+		if file.Name == "export.data" {
+			exportFile = file
+		} else if strings.HasPrefix(file.Name, "files/") {
+			files[strings.TrimPrefix(file.Name, "files/")] = file
+		}
+	}
+	if exportFile == nil {
+		return nil, invalidExport(fmt.Errorf("export.data is missing"), "1Password")
+	}
+	exportData, err := readZipFile(exportFile)
+	if err != nil {
+		return nil, invalidExport(err, "1Password")
+	}
+	var export onePasswordExport
+	if err := json.Unmarshal(exportData, &export); err != nil {
+		return nil, invalidExport(err, "1Password")
+	}
+
+	var items []Item
+	for _, account := range export.Accounts {
+		for _, vault := range account.Vaults {
+			for _, opItem := range vault.Items {
+				if opItem.State == "trashed" {
+					continue
+				}
+				items = append(items, convertOnePasswordItem(&opItem, vault.Attrs.Name, files))
+			}
+		}
+	}
+	return items, nil
+}
+
+func convertOnePasswordItem(opItem *onePasswordItem, vaultName string, files map[string]*zip.File) Item {
+	name := opItem.Overview.Title
+	metadata := models.Metadata{"source": string(FormatOnePassword)}
+	setIfNotEmpty(metadata, "folder", vaultName)
+	fields := opItem.fields()
+
+	switch opItem.CategoryUUID {
+	case onePasswordCategoryLogin, onePasswordCategoryPassword:
+		var login, password string
+		for _, field := range opItem.Details.LoginFields {
+			switch field.Designation {
+			case "username":
+				login = field.Value
+			case "password":
+				password = field.Value
+			}
+		}
+		if password == "" {
+			password = opItem.Details.Password
+		}
+		setIfNotEmpty(metadata, "url", opItem.Overview.URL)
+		setIfNotEmpty(metadata, "notes", opItem.Details.NotesPlain)
+		return newLoginItem(name, login, password, metadata)
+	case onePasswordCategorySecureNote:
+		return newNoteItem(name, opItem.Details.NotesPlain, metadata)
+	case onePasswordCategoryCreditCard:
+		// expiry хранится как число YYYYMM
+		var expireDate string
+		if expiry := fields["expiry"]; len(expiry) == 6 {
+			expireDate = formatExpireDate(expiry[4:], expiry[:4])
+		}
+		setIfNotEmpty(metadata, "notes", opItem.Details.NotesPlain)
+		setIfNotEmpty(metadata, "brand", fields["type"])
+		setIfNotEmpty(metadata, "bank", fields["bank"])
+		return Item{
+			Kind:       models.KindBankCard,
+			Name:       name,
+			Number:     cleanCardNumber(fields["ccnum"]),
+			CardHolder: fields["cardholder"],
+			ExpireDate: expireDate,
+			CSC:        fields["cvv"],
+			Metadata:   metadata,
+		}
+	case onePasswordCategoryDocument:
+		document := opItem.Details.DocumentAttributes
+		if document == nil {
+			return Item{Kind: models.KindFileData, Name: name, Err: fmt.Errorf("document attributes are missing")}
+		}
+		file, ok := files[document.DocumentID+"__"+document.FileName]
+		if !ok {
+			return Item{Kind: models.KindFileData, Name: name, Err: fmt.Errorf("document file %q is missing from the archive", document.FileName)}
+		}
+		content, err := readZipFile(file)
+		if err != nil {
+			return Item{Kind: models.KindFileData, Name: name, Err: err}
+		}
+		setIfNotEmpty(metadata, "notes", opItem.Details.NotesPlain)
+		return newFileItem(document.FileName, content, metadata)
+	default:
+		// Остальные категории (документы личности, банковские счета и т.д.) сохраняем как текст
+		lines := make([]string, 0, len(fields)+1)
+		for _, section := range opItem.Details.Sections {
+			for _, field := range section.Fields {
+				if value := fields[field.ID]; value != "" {
+					lines = append(lines, fmt.Sprintf("%s: %s", field.Title, value))
+				}
+			}
+		}
+		if opItem.Details.NotesPlain != "" {
+			lines = append(lines, opItem.Details.NotesPlain)
+		}
+		return newNoteItem(name, strings.Join(lines, "\n"), metadata)
+	}
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
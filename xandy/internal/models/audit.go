@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditAction string
+
+const (
+	// Чтение секретных полей: пароля, номера карты, текста
+	AuditActionRead     AuditAction = "read"
+	AuditActionCreate   AuditAction = "create"
+	AuditActionUpdate   AuditAction = "update"
+	AuditActionDelete   AuditAction = "delete"
+	AuditActionDownload AuditAction = "download"
+	AuditActionMove     AuditAction = "move"
+
+	AuditActionShare      AuditAction = "share"
+	AuditActionUnshare    AuditAction = "unshare"
+	AuditActionLinkCreate AuditAction = "link_create"
+	AuditActionLinkRevoke AuditAction = "link_revoke"
+	AuditActionLinkOpen   AuditAction = "link_open"
+
+	AuditActionImport   AuditAction = "import"
+	AuditActionExport   AuditAction = "export"
+	AuditActionRestore  AuditAction = "restore"
+	AuditActionTakeover AuditAction = "takeover"
+)
+
+// Кто выполняет запрос. Заполняется для каждого запроса, UserID пуст у публичных маршрутов
+type AuditActor struct {
+	UserID    *uuid.UUID
+	SessionID *uuid.UUID
+	IP        string
+	UserAgent string
+}
+
+// Событие журнала аудита. Журнал только пополняется, изменить или удалить событие нельзя
+type AuditEvent struct {
+	ID         uuid.UUID `db:"id" json:"id"`
+	OccurredAt time.Time `db:"occurred_at" json:"occurred_at"`
+	// Пустой, если действие выполнено без авторизации или фоновой задачей
+	ActorID   *uuid.UUID  `db:"actor_id" json:"actor_id"`
+	SessionID *uuid.UUID  `db:"session_id" json:"session_id"`
+	IP        string      `db:"ip" json:"ip"`
+	UserAgent string      `db:"user_agent" json:"user_agent"`
+	Action    AuditAction `db:"action" json:"action"`
+	// Владелец затронутых записей, для записей коллекции - автор
+	OwnerID        *uuid.UUID `db:"owner_id" json:"owner_id"`
+	DataKind       DataKind   `db:"data_kind" json:"data_kind,omitempty"`
+	DataID         *uuid.UUID `db:"data_id" json:"data_id"`
+	CollectionID   *uuid.UUID `db:"collection_id" json:"collection_id,omitempty"`
+	OrganizationID *uuid.UUID `db:"organization_id" json:"organization_id,omitempty"`
+	Details        Metadata   `db:"details" json:"details,omitempty"`
+}
+
+func NewAuditEvent(actor AuditActor, action AuditAction) AuditEvent {
+	return AuditEvent{
+		ID:         uuid.New(),
+		OccurredAt: time.Now(),
+		ActorID:    actor.UserID,
+		SessionID:  actor.SessionID,
+		IP:         actor.IP,
+		UserAgent:  actor.UserAgent,
+		Action:     action,
+	}
+}
+
+// Условия выборки событий, пустые поля не ограничивают выборку
+type AuditFilter struct {
+	Action   AuditAction
+	DataKind DataKind
+	DataID   *uuid.UUID
+	ActorID  *uuid.UUID
+	From     *time.Time
+	To       *time.Time
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Что получает доверенный контакт после ожидания
+type EmergencyAccessType string
+
+const (
+	// Чтение личных записей владельца
+	EmergencyAccessView EmergencyAccessType = "view"
+	// Перенос личных записей владельца к доверенному контакту
+	EmergencyAccessTakeover EmergencyAccessType = "takeover"
+)
+
+type EmergencyAccessStatus string
+
+const (
+	// Контакт назначен, доступ не запрошен
+	EmergencyAccessIdle EmergencyAccessStatus = "idle"
+	// Контакт запросил доступ, владелец может отклонить запрос до конца ожидания
+	EmergencyAccessRequested EmergencyAccessStatus = "requested"
+)
+
+// Экстренный доступ доверенного контакта к записям владельца
+type EmergencyAccess struct {
+	ID        uuid.UUID `db:"id" json:"id"`
+	GrantorID uuid.UUID `db:"grantor_id" json:"grantor_id"`
+	// Адреса почты владельца и контакта на момент назначения
+	GrantorEmail string                `db:"grantor_email" json:"grantor_email"`
+	GranteeID    uuid.UUID             `db:"grantee_id" json:"grantee_id"`
+	GranteeEmail string                `db:"grantee_email" json:"grantee_email"`
+	AccessType   EmergencyAccessType   `db:"access_type" json:"access_type" validate:"oneof=view takeover"`
+	WaitDays     int                   `db:"wait_days" json:"wait_days" validate:"min=1,max=90"`
+	Status       EmergencyAccessStatus `db:"status" json:"status"`
+	RequestedAt  *time.Time            `db:"requested_at" json:"requested_at"`
+	CreatedAt    time.Time             `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time             `db:"updated_at" json:"updated_at"`
+}
+
+func NewEmergencyAccess(grantorID uuid.UUID, grantorEmail string, granteeID uuid.UUID, granteeEmail string, accessType EmergencyAccessType, waitDays int) (EmergencyAccess, error) {
+	now := time.Now()
+	emergencyAccess := EmergencyAccess{
+		ID:           uuid.New(),
+		GrantorID:    grantorID,
+		GrantorEmail: grantorEmail,
+		GranteeID:    granteeID,
+		GranteeEmail: granteeEmail,
+		AccessType:   accessType,
+		WaitDays:     waitDays,
+		Status:       EmergencyAccessIdle,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	return emergencyAccess, Validate(emergencyAccess)
+}
+
+// GrantedAt возвращает время, с которого контакт получает доступ, или nil, если доступ не запрошен
+func (a EmergencyAccess) GrantedAt() *time.Time {
+	if a.Status != EmergencyAccessRequested || a.RequestedAt == nil {
+		return nil
+	}
+	grantedAt := a.RequestedAt.AddDate(0, 0, a.WaitDays)
+	return &grantedAt
+}
+
+func (a EmergencyAccess) Granted(now time.Time) bool {
+	grantedAt := a.GrantedAt()
+	return grantedAt != nil && !now.Before(*grantedAt)
+}
+
+// Личные записи владельца, которые видит доверенный контакт
+type EmergencyVault struct {
+	AuthInfo  []UserAuthInfo `json:"auth_info"`
+	TextData  []UserTextData `json:"text_data"`
+	BankCards []UserBankCard `json:"bank_cards"`
+	FileData  []UserFileData `json:"file_data"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Ссылки записей UserFileData на содержимое в BlobStore
+type FileBlob struct {
+	Key       string    `db:"key"`
+	RefCount  int64     `db:"ref_count"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Незавершённая загрузка файла по частям
+type FileUpload struct {
+	ID          uuid.UUID `db:"id" json:"id"`
+	UserID      uuid.UUID `db:"user_id" json:"-"`
+	FileName    string    `db:"file_name" json:"file_name" validate:"required,max=255"`
+	Size        int64     `db:"size" json:"size" validate:"gte=0"`
+	Offset      int64     `db:"upload_offset" json:"offset"`
+	Checksum    string    `db:"checksum" json:"checksum" validate:"required,hexadecimal,len=64"`
+	StagingPath string    `db:"staging_path" json:"-"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+	ExpiresAt   time.Time `db:"expires_at" json:"expires_at"`
+}
+
+func NewFileUpload(userID uuid.UUID, fileName string, size int64, checksum string, expiration time.Duration) (FileUpload, error) {
+	now := time.Now()
+	fileUpload := FileUpload{
+		ID:        uuid.New(),
+		UserID:    userID,
+		FileName:  fileName,
+		Size:      size,
+		Checksum:  checksum,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(expiration),
+	}
+	return fileUpload, Validate(fileUpload)
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Ключ идемпотентности из заголовка Idempotency-Key и ответ на первый запрос с ним.
+// Повтор запроса с тем же ключом получает сохранённый ответ вместо повторного выполнения
+type IdempotencyKey struct {
+	UserID uuid.UUID `db:"user_id"`
+	Key    string    `db:"idempotency_key"`
+	// SHA-256 метода, пути и тела запроса в hex
+	RequestHash string `db:"request_hash"`
+	// 0, пока первый запрос выполняется
+	StatusCode  int       `db:"status_code"`
+	ContentType string    `db:"content_type"`
+	Body        []byte    `db:"body"`
+	CreatedAt   time.Time `db:"created_at"`
+	ExpiresAt   time.Time `db:"expires_at"`
+}
+
+// Completed сообщает, что ответ на первый запрос уже сохранён
+func (k IdempotencyKey) Completed() bool {
+	return k.StatusCode != 0
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Роль участника организации
+type OrganizationRole string
+
+const (
+	// Управляет организацией, участниками и всеми коллекциями
+	OrganizationRoleOwner OrganizationRole = "owner"
+	// Управляет участниками, кроме владельцев, и всеми коллекциями
+	OrganizationRoleAdmin OrganizationRole = "admin"
+	// Работает с коллекциями, к которым ему выдан доступ
+	OrganizationRoleMember OrganizationRole = "member"
+	// Только читает коллекции, к которым ему выдан доступ
+	OrganizationRoleReadOnly OrganizationRole = "read_only"
+)
+
+// Права участника на коллекцию, выданные владельцем или администратором
+type CollectionPermission string
+
+const (
+	CollectionPermissionRead  CollectionPermission = "read"
+	CollectionPermissionWrite CollectionPermission = "write"
+)
+
+type Organization struct {
+	ID        uuid.UUID `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name" validate:"required,max=255"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+	// Роль текущего пользователя, заполняется при чтении организации участником
+	Role OrganizationRole `db:"-" json:"role,omitempty"`
+}
+
+func NewOrganization(name string) (Organization, error) {
+	now := time.Now()
+	organization := Organization{
+		ID:        uuid.New(),
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return organization, Validate(organization)
+}
+
+type OrganizationMember struct {
+	OrganizationID uuid.UUID `db:"organization_id" json:"organization_id"`
+	UserID         uuid.UUID `db:"user_id" json:"user_id"`
+	// Адрес почты участника на момент добавления в организацию
+	Email     string           `db:"email" json:"email"`
+	Role      OrganizationRole `db:"role" json:"role" validate:"oneof=owner admin member read_only"`
+	CreatedAt time.Time        `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time        `db:"updated_at" json:"updated_at"`
+}
+
+func NewOrganizationMember(organizationID uuid.UUID, userID uuid.UUID, email string, role OrganizationRole) (OrganizationMember, error) {
+	now := time.Now()
+	member := OrganizationMember{
+		OrganizationID: organizationID,
+		UserID:         userID,
+		Email:          email,
+		Role:           role,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	return member, Validate(member)
+}
+
+// Коллекция записей, которые принадлежат организации, а не отдельному пользователю
+type Collection struct {
+	ID             uuid.UUID `db:"id" json:"id"`
+	OrganizationID uuid.UUID `db:"organization_id" json:"organization_id"`
+	Name           string    `db:"name" json:"name" validate:"required,max=255"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+}
+
+func NewCollection(organizationID uuid.UUID, name string) (Collection, error) {
+	now := time.Now()
+	collection := Collection{
+		ID:             uuid.New(),
+		OrganizationID: organizationID,
+		Name:           name,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	return collection, Validate(collection)
+}
+
+// Доступ участника организации к коллекции
+type CollectionGrant struct {
+	CollectionID   uuid.UUID            `db:"collection_id" json:"collection_id"`
+	OrganizationID uuid.UUID            `db:"organization_id" json:"-"`
+	UserID         uuid.UUID            `db:"user_id" json:"user_id"`
+	Email          string               `db:"email" json:"email"`
+	Permission     CollectionPermission `db:"permission" json:"permission" validate:"oneof=read write"`
+	CreatedAt      time.Time            `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time            `db:"updated_at" json:"updated_at"`
+}
+
+func NewCollectionGrant(collection *Collection, member *OrganizationMember, permission CollectionPermission) (CollectionGrant, error) {
+	now := time.Now()
+	grant := CollectionGrant{
+		CollectionID:   collection.ID,
+		OrganizationID: collection.OrganizationID,
+		UserID:         member.UserID,
+		Email:          member.Email,
+		Permission:     permission,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	return grant, Validate(grant)
+}
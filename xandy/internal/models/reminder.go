@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ReminderKind string
+
+const (
+	// Срок действия банковской карты истекает в следующем месяце
+	ReminderCardExpiry ReminderKind = "card_expiry"
+	// Пароль не менялся дольше, чем указано в метаданных учётной записи
+	ReminderCredentialRotation ReminderKind = "credential_rotation"
+)
+
+// Ключ метаданных учётной записи с периодом смены пароля в днях
+const RotationDaysMetadataKey = "rotation_days"
+
+// Настройки напоминаний пользователя
+type ReminderPreferences struct {
+	UserID             uuid.UUID `json:"-"`
+	CardExpiry         bool      `json:"card_expiry"`
+	CredentialRotation bool      `json:"credential_rotation"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// Пока пользователь не менял настройки, все напоминания включены
+func NewReminderPreferences(userID uuid.UUID) ReminderPreferences {
+	return ReminderPreferences{
+		UserID:             userID,
+		CardExpiry:         true,
+		CredentialRotation: true,
+	}
+}
+
+// Напоминание о записи. Для карты DueAt - первый день месяца, в котором истекает срок её действия,
+// для учётной записи - момент, к которому пароль нужно было сменить.
+// Напоминание с теми же Kind, DataID и DueAt отправляется один раз.
+type Reminder struct {
+	Kind   ReminderKind
+	UserID uuid.UUID
+	DataID uuid.UUID
+	Name   string
+	DueAt  time.Time
+}
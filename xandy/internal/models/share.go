@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Права получателя на запись, которой с ним поделились
+type SharePermission string
+
+const (
+	// Только чтение записи и скачивание файлов
+	SharePermissionRead SharePermission = "read"
+	// Чтение и изменение полей записи. Удалять запись, менять содержимое файла и вложения
+	// и управлять доступом может только владелец
+	SharePermissionWrite SharePermission = "write"
+)
+
+// Доступ другого пользователя к одной записи владельца
+type Share struct {
+	ID      uuid.UUID `db:"id" json:"id"`
+	OwnerID uuid.UUID `db:"owner_id" json:"owner_id"`
+	// Адреса почты владельца и получателя на момент выдачи доступа
+	OwnerEmail   string          `db:"owner_email" json:"owner_email"`
+	GranteeID    uuid.UUID       `db:"grantee_id" json:"grantee_id"`
+	GranteeEmail string          `db:"grantee_email" json:"grantee_email"`
+	DataKind     DataKind        `db:"data_kind" json:"data_kind"`
+	DataID       uuid.UUID       `db:"data_id" json:"data_id"`
+	Permission   SharePermission `db:"permission" json:"permission" validate:"oneof=read write"`
+	// Ключ записи, заново зашифрованный клиентом для получателя.
+	// Сервер хранит его как есть и не может расшифровать
+	EncryptedKey string    `db:"encrypted_key" json:"encrypted_key,omitempty"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+}
+
+func NewShare(ownerID uuid.UUID, ownerEmail string, granteeID uuid.UUID, granteeEmail string, dataKind DataKind, dataID uuid.UUID, permission SharePermission, encryptedKey string) (Share, error) {
+	now := time.Now()
+	share := Share{
+		ID:           uuid.New(),
+		OwnerID:      ownerID,
+		OwnerEmail:   ownerEmail,
+		GranteeID:    granteeID,
+		GranteeEmail: granteeEmail,
+		DataKind:     dataKind,
+		DataID:       dataID,
+		Permission:   permission,
+		EncryptedKey: encryptedKey,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	return share, Validate(share)
+}
+
+// Запись, которой поделились, вместе с доступом к ней
+type SharedRecord struct {
+	Share Share       `json:"share"`
+	Data  interface{} `json:"data"`
+}
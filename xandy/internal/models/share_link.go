@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Одноразовая ссылка на снимок записи для человека без аккаунта.
+// Сервер хранит только зашифрованный снимок, ключ передаётся во фрагменте ссылки.
+type ShareLink struct {
+	ID       uuid.UUID `db:"id" json:"id"`
+	OwnerID  uuid.UUID `db:"owner_id" json:"owner_id"`
+	DataKind DataKind  `db:"data_kind" json:"data_kind"`
+	DataID   uuid.UUID `db:"data_id" json:"data_id"`
+	// Зашифрованный снимок записи, стирается после последнего просмотра
+	Content []byte `db:"content" json:"-"`
+	// Пустой, если ссылка открывается без фразы-пароля
+	PassphraseHash []byte    `db:"passphrase_hash" json:"-"`
+	MaxViews       int       `db:"max_views" json:"max_views" validate:"min=1,max=100"`
+	Views          int       `db:"views" json:"views"`
+	ExpiresAt      time.Time `db:"expires_at" json:"expires_at"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+}
+
+func NewShareLink(ownerID uuid.UUID, dataKind DataKind, dataID uuid.UUID, content []byte, passphraseHash []byte, maxViews int, expiresAt time.Time) (ShareLink, error) {
+	shareLink := ShareLink{
+		ID:             uuid.New(),
+		OwnerID:        ownerID,
+		DataKind:       dataKind,
+		DataID:         dataID,
+		Content:        content,
+		PassphraseHash: passphraseHash,
+		MaxViews:       maxViews,
+		ExpiresAt:      expiresAt,
+		CreatedAt:      time.Now(),
+	}
+	return shareLink, Validate(shareLink)
+}
+
+func (l ShareLink) HasPassphrase() bool {
+	return len(l.PassphraseHash) > 0
+}
+
+func (l ShareLink) ViewsLeft() int {
+	return l.MaxViews - l.Views
+}
+
+// Сведения о ссылке, доступные без аккаунта и без расхода просмотра
+type PublicShareLink struct {
+	DataKind      DataKind  `json:"data_kind"`
+	HasPassphrase bool      `json:"has_passphrase"`
+	ViewsLeft     int       `json:"views_left"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	// Зашифрованный снимок, заполняется только при открытии ссылки
+	Content []byte `json:"content,omitempty"`
+}
+
+func NewPublicShareLink(l *ShareLink) PublicShareLink {
+	return PublicShareLink{
+		DataKind:      l.DataKind,
+		HasPassphrase: l.HasPassphrase(),
+		ViewsLeft:     l.ViewsLeft(),
+		ExpiresAt:     l.ExpiresAt,
+	}
+}
@@ -0,0 +1,10 @@
+package models
+
+// Занятое пользователем место и количество его записей
+type Usage struct {
+	// Суммарный размер файлов, включая вложения
+	Bytes int64
+	// Заявленный размер незавершённых загрузок по частям
+	UploadBytes int64
+	Records     map[DataKind]int64
+}
@@ -14,6 +14,16 @@ import (
 // Метаданные для сущностей
 type Metadata map[string]interface{}
 
+// Вид пользовательских данных
+type DataKind string
+
+const (
+	KindAuthInfo DataKind = "auth_info"
+	KindTextData DataKind = "text_data"
+	KindFileData DataKind = "file_data"
+	KindBankCard DataKind = "bank_card"
+)
+
 var validator *gpvalidator.Validate
 
 func init() {
@@ -57,8 +67,31 @@ type BaseUserData struct {
 	Name      string    `db:"name" json:"name" validate:"required"`
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+	// Коллекция организации, которой принадлежит запись. У личных записей не заполнена,
+	// у записей коллекции UserID - автор записи
+	CollectionID *uuid.UUID `db:"collection_id" json:"collection_id,omitempty"`
+	// Когда запись удалится сама. После этого момента запись не видна, её удаляет фоновая задача
+	ExpiresAt *time.Time `db:"expires_at" json:"expires_at,omitempty"`
 
 	Metadata Metadata `db:"metadata" json:"metadata"`
+
+	// Прикреплённые файлы, заполняются сервисом при чтении записи
+	Attachments []UserFileData `db:"-" json:"attachments,omitempty"`
+}
+
+// Personal сообщает, что запись принадлежит пользователю, а не коллекции организации
+func (b BaseUserData) Personal() bool {
+	return b.CollectionID == nil
+}
+
+// Expired сообщает, что срок жизни записи истёк к моменту now
+func (b BaseUserData) Expired(now time.Time) bool {
+	return b.ExpiresAt != nil && !b.ExpiresAt.After(now)
+}
+
+// Base возвращает общие поля записи любого вида
+func (b *BaseUserData) Base() *BaseUserData {
+	return b
 }
 
 func NewBaseUserData(name string, userID uuid.UUID, metadata Metadata) BaseUserData {
@@ -105,19 +138,70 @@ func NewUserTextData(name string, userID uuid.UUID, metadata Metadata, text stri
 // Бинарные данные
 type UserFileData struct {
 	BaseUserData
-	PathToFile string `db:"path_to_file" json:"-"`
-	Ext        string `db:"ext" json:"ext"`
+	// Ключ содержимого в BlobStore, одно содержимое может быть у нескольких записей
+	BlobKey string `db:"blob_key" json:"-"`
+	Ext     string `db:"ext" json:"ext"`
+	// SHA-256 содержимого в hex и MIME тип, определённый по содержимому при загрузке
+	SHA256   string `db:"sha256" json:"sha256"`
+	MimeType string `db:"mime_type" json:"mime_type"`
+	// Размер содержимого в байтах
+	Size int64 `db:"size" json:"size"`
+	// Имя файла, с которым он был загружен
+	OriginalFileName string `db:"original_file_name" json:"original_file_name" validate:"max=255"`
+	// Запись, к которой прикреплён файл. У самостоятельных файлов не заполнены
+	ParentKind DataKind   `db:"parent_kind" json:"parent_kind,omitempty"`
+	ParentID   *uuid.UUID `db:"parent_id" json:"parent_id,omitempty"`
+	// Результат проверки на вредоносное содержимое, ScanResult - найденная сигнатура или причина ошибки
+	ScanStatus ScanStatus `db:"scan_status" json:"scan_status"`
+	ScanResult string     `db:"scan_result" json:"scan_result,omitempty"`
+	ScannedAt  *time.Time `db:"scanned_at" json:"scanned_at,omitempty"`
 }
 
-func NewUserFileData(name string, userID uuid.UUID, pathToFile, ext string) (UserFileData, error) {
+// Состояние проверки файла на вредоносное содержимое
+type ScanStatus string
+
+const (
+	// Файл ещё не проверен, скачать его нельзя
+	ScanStatusPending ScanStatus = "pending"
+	ScanStatusClean   ScanStatus = "clean"
+	// Найдено вредоносное содержимое, скачать файл нельзя
+	ScanStatusInfected ScanStatus = "infected"
+	// Файл не удалось проверить, например его содержимое пропало
+	ScanStatusFailed ScanStatus = "failed"
+	// Проверка отключена
+	ScanStatusSkipped ScanStatus = "skipped"
+)
+
+func NewUserFileData(name string, userID uuid.UUID, metadata Metadata, ext, originalFileName string) (UserFileData, error) {
 	userFileData := UserFileData{
-		BaseUserData: NewBaseUserData(name, userID, Metadata{}),
-		PathToFile:   pathToFile,
-		Ext:          ext,
+		BaseUserData:     NewBaseUserData(name, userID, metadata),
+		Ext:              ext,
+		OriginalFileName: originalFileName,
 	}
 	return userFileData, Validate(userFileData)
 }
 
+// FileDataFilter ограничивает список файлов, пустые поля не учитываются
+type FileDataFilter struct {
+	// Начало MIME типа: "image/" или "text/plain"
+	MimeType string
+	MinSize  *int64
+	MaxSize  *int64
+	// Часть исходного имени файла без учёта регистра
+	OriginalFileName string
+	// По умолчанию в список попадают только самостоятельные файлы, без вложений
+	WithAttachments bool
+}
+
+// Запись, срок жизни которой скоро истечёт. Секретные поля в список не попадают
+type ExpiringRecord struct {
+	DataKind     DataKind   `json:"data_kind"`
+	ID           uuid.UUID  `json:"id"`
+	Name         string     `json:"name"`
+	CollectionID *uuid.UUID `json:"collection_id,omitempty"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+}
+
 // Банковская карта
 type UserBankCard struct {
 	BaseUserData
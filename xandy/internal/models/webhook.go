@@ -0,0 +1,82 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebhookEvent string
+
+const (
+	WebhookEventCreated WebhookEvent = "created"
+	WebhookEventUpdated WebhookEvent = "updated"
+	WebhookEventDeleted WebhookEvent = "deleted"
+	WebhookEventShared  WebhookEvent = "shared"
+)
+
+// Адрес, на который отправляются события изменения записей, доступных пользователю:
+// его личных записей и записей коллекций, в которых он участвует
+type Webhook struct {
+	ID     uuid.UUID      `db:"id" json:"id"`
+	UserID uuid.UUID      `db:"user_id" json:"-"`
+	URL    string         `db:"url" json:"url" validate:"required,http_url,max=2048"`
+	Events []WebhookEvent `db:"events" json:"events" validate:"required,min=1,dive,oneof=created updated deleted shared"`
+	// Ключ подписи HMAC-SHA256, показывается только при создании
+	Secret    string    `db:"secret" json:"secret,omitempty"`
+	Active    bool      `db:"active" json:"active"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+func NewWebhook(userID uuid.UUID, url string, events []WebhookEvent) (Webhook, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Webhook{}, err
+	}
+	now := time.Now()
+	webhook := Webhook{
+		ID:        uuid.New(),
+		UserID:    userID,
+		URL:       url,
+		Events:    events,
+		Secret:    hex.EncodeToString(secret),
+		Active:    true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return webhook, Validate(webhook)
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	// Все попытки исчерпаны, доставку можно повторить вручную
+	WebhookDeliveryFailed WebhookDeliveryStatus = "failed"
+)
+
+// Доставка события на вебхук. Записи доставок образуют журнал, по которому видно,
+// сколько было попыток и чем закончилась последняя
+type WebhookDelivery struct {
+	ID             uuid.UUID             `db:"id" json:"id"`
+	WebhookID      uuid.UUID             `db:"webhook_id" json:"webhook_id"`
+	EventID        uuid.UUID             `db:"event_id" json:"event_id"`
+	Event          WebhookEvent          `db:"event" json:"event"`
+	Payload        json.RawMessage       `db:"payload" json:"payload"`
+	Status         WebhookDeliveryStatus `db:"status" json:"status"`
+	Attempts       int                   `db:"attempts" json:"attempts"`
+	NextAttemptAt  time.Time             `db:"next_attempt_at" json:"next_attempt_at"`
+	LastStatusCode int                   `db:"last_status_code" json:"last_status_code"`
+	LastError      string                `db:"last_error" json:"last_error"`
+	CreatedAt      time.Time             `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time             `db:"updated_at" json:"updated_at"`
+
+	// Заполняются, когда доставка взята в отправку
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
@@ -0,0 +1,112 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Размер куска INSTREAM, clamd отклоняет куски больше StreamMaxLength целиком
+const clamdChunkSize = 64 * 1024
+
+// ClamdScanner передаёт содержимое демону clamd по TCP командой INSTREAM
+type ClamdScanner struct {
+	address string
+	timeout time.Duration
+	dialer  net.Dialer
+}
+
+// NewClamdScanner создаёт сканер для clamd по адресу host:port.
+// timeout ограничивает проверку одного файла, если у ctx нет своего срока.
+func NewClamdScanner(address string, timeout time.Duration) *ClamdScanner {
+	return &ClamdScanner{
+		address: address,
+		timeout: timeout,
+	}
+}
+
+func (cs *ClamdScanner) Scan(ctx context.Context, content io.Reader) (Result, error) {
+	if _, ok := ctx.Deadline(); !ok && cs.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cs.timeout)
+		defer cancel()
+	}
+	conn, err := cs.dialer.DialContext(ctx, "tcp", cs.address)
+	if err != nil {
+		return Result{}, fmt.Errorf("scanner: connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Отмена ctx прерывает запись и чтение
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	if err := cs.stream(conn, content); err != nil {
+		if ctx.Err() != nil {
+			return Result{}, ctx.Err()
+		}
+		return Result{}, err
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		if ctx.Err() != nil {
+			return Result{}, ctx.Err()
+		}
+		return Result{}, fmt.Errorf("scanner: read clamd reply: %w", err)
+	}
+	return parseClamdReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// stream отправляет команду zINSTREAM и содержимое кусками с длиной в 4 байта big-endian,
+// нулевой кусок завершает поток
+func (cs *ClamdScanner) stream(conn net.Conn, content io.Reader) error {
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return fmt.Errorf("scanner: send clamd command: %w", err)
+	}
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := io.ReadFull(content, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := conn.Write(buf[:4+n]); werr != nil {
+				return fmt.Errorf("scanner: send content to clamd: %w", werr)
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("scanner: finish clamd stream: %w", err)
+	}
+	return nil
+}
+
+// parseClamdReply разбирает ответ вида "stream: OK", "stream: <сигнатура> FOUND" или "... ERROR"
+func parseClamdReply(reply string) (Result, error) {
+	status := reply
+	if i := strings.Index(reply, ": "); i >= 0 {
+		status = reply[i+2:]
+	}
+	switch {
+	case status == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(status, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(status, " FOUND")}, nil
+	default:
+		return Result{}, fmt.Errorf("%w: clamd: %s", ErrRejected, strings.TrimSpace(reply))
+	}
+}
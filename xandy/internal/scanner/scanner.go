@@ -0,0 +1,63 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrRejected - сканер не смог проверить именно это содержимое, например оно слишком большое.
+// Повторная проверка того же содержимого не поможет, в отличие от недоступности сканера.
+var ErrRejected = errors.New("scanner: content rejected")
+
+// Result - результат проверки содержимого, Signature заполнена только у заражённого содержимого
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+// Scanner проверяет содержимое файлов на вредоносное содержимое
+type Scanner interface {
+	Scan(ctx context.Context, content io.Reader) (Result, error)
+}
+
+// Тестовая строка EICAR, которую антивирусы определяют как вирус
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// FakeScanner считает заражённым только содержимое с тестовой строкой EICAR.
+// Нужен для разработки и тестов без ClamAV.
+type FakeScanner struct{}
+
+func NewFakeScanner() *FakeScanner {
+	return &FakeScanner{}
+}
+
+func (fs *FakeScanner) Scan(ctx context.Context, content io.Reader) (Result, error) {
+	pattern := []byte(eicar)
+	buf := make([]byte, 32*1024)
+	// Хвост предыдущего куска, чтобы найти строку на границе чтений
+	var tail []byte
+	for {
+		if err := ctx.Err(); err != nil {
+			return Result{}, err
+		}
+		n, err := content.Read(buf)
+		if n > 0 {
+			window := append(tail, buf[:n]...)
+			if bytes.Contains(window, pattern) {
+				return Result{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+			}
+			if len(window) > len(pattern) {
+				window = window[len(window)-len(pattern):]
+			}
+			tail = append(tail[:0], window...)
+		}
+		if err == io.EOF {
+			return Result{}, nil
+		}
+		if err != nil {
+			return Result{}, err
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeScanner(t *testing.T) {
+	ctx := context.Background()
+	scanner := NewFakeScanner()
+
+	result, err := scanner.Scan(ctx, strings.NewReader("hello world"))
+	require.NoError(t, err)
+	assert.False(t, result.Infected)
+
+	// Строка EICAR на границе двух чтений
+	content := strings.Repeat("a", 32*1024-10) + eicar + "tail"
+	result, err = scanner.Scan(ctx, strings.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, Result{Infected: true, Signature: "Eicar-Test-Signature"}, result)
+}
+
+// fakeClamd принимает одно соединение, читает поток INSTREAM и отвечает reply(содержимое)
+func fakeClamd(t *testing.T, reply func(content []byte) string) (string, <-chan []byte) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		command, err := r.ReadString(0)
+		if err != nil || command != "zINSTREAM\x00" {
+			return
+		}
+		var content bytes.Buffer
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			if _, err := io.CopyN(&content, r, int64(size)); err != nil {
+				return
+			}
+		}
+		received <- content.Bytes()
+		conn.Write([]byte(reply(content.Bytes()) + "\x00"))
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestClamdScanner(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Clean", func(t *testing.T) {
+		address, received := fakeClamd(t, func(content []byte) string { return "stream: OK" })
+		content := strings.Repeat("x", 3*clamdChunkSize+17)
+		result, err := NewClamdScanner(address, time.Second).Scan(ctx, strings.NewReader(content))
+		require.NoError(t, err)
+		assert.False(t, result.Infected)
+		assert.Equal(t, content, string(<-received))
+	})
+
+	t.Run("Infected", func(t *testing.T) {
+		address, _ := fakeClamd(t, func(content []byte) string { return "stream: Win.Test.EICAR_HDB-1 FOUND" })
+		result, err := NewClamdScanner(address, time.Second).Scan(ctx, strings.NewReader(eicar))
+		require.NoError(t, err)
+		assert.Equal(t, Result{Infected: true, Signature: "Win.Test.EICAR_HDB-1"}, result)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		address, _ := fakeClamd(t, func(content []byte) string { return "INSTREAM size limit exceeded. ERROR" })
+		_, err := NewClamdScanner(address, time.Second).Scan(ctx, strings.NewReader("data"))
+		assert.ErrorIs(t, err, ErrRejected)
+		assert.ErrorContains(t, err, "size limit exceeded")
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		// Сервер принимает соединение и молчит
+		go func() {
+			conn, err := listener.Accept()
+			if err == nil {
+				defer conn.Close()
+				io.Copy(io.Discard, conn)
+			}
+		}()
+		_, err = NewClamdScanner(listener.Addr().String(), 100*time.Millisecond).Scan(ctx, strings.NewReader("data"))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
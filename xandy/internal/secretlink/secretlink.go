@@ -0,0 +1,97 @@
+package secretlink
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Содержимое одноразовой ссылки шифруется AES-256-GCM случайным ключом.
+// Ключ отдаётся создателю ссылки один раз в base64url и передаётся во фрагменте URL,
+// поэтому сервер его не хранит и не получает при открытии ссылки.
+//
+// Формат зашифрованного содержимого: nonce(12) | AES-256-GCM ciphertext.
+// Формат хэша фразы-пароля: salt(16) | argon2id(32).
+const (
+	keySize  = 32
+	saltSize = 16
+
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+)
+
+var (
+	ErrInvalidSecret = errors.New("invalid link secret")
+	ErrDecryption    = errors.New("wrong link secret or corrupted content")
+)
+
+// Seal шифрует содержимое новым ключом и возвращает его вместе с ключом для фрагмента ссылки
+func Seal(plaintext []byte) ([]byte, string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, "", err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), base64.RawURLEncoding.EncodeToString(key), nil
+}
+
+// Open расшифровывает содержимое ключом из фрагмента ссылки. На сервере не используется,
+// нужна клиентам на Go и для проверки формата.
+func Open(sealed []byte, secret string) ([]byte, error) {
+	key, err := base64.RawURLEncoding.DecodeString(secret)
+	if err != nil || len(key) != keySize {
+		return nil, ErrInvalidSecret
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrDecryption
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return plaintext, nil
+}
+
+// HashPassphrase возвращает хэш фразы-пароля вместе с солью
+func HashPassphrase(passphrase string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return append(salt, argon2.IDKey([]byte(passphrase), salt, argon2Time, argon2Memory, argon2Threads, keySize)...), nil
+}
+
+// CheckPassphrase сравнивает фразу-пароль с хэшем за постоянное время
+func CheckPassphrase(hash []byte, passphrase string) bool {
+	if len(hash) != saltSize+keySize {
+		return false
+	}
+	key := argon2.IDKey([]byte(passphrase), hash[:saltSize], argon2Time, argon2Memory, argon2Threads, keySize)
+	return subtle.ConstantTimeCompare(key, hash[saltSize:]) == 1
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
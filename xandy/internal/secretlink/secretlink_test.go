@@ -0,0 +1,35 @@
+package secretlink
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpen(t *testing.T) {
+	sealed, secret, err := Seal([]byte("login: admin"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "admin")
+
+	plaintext, err := Open(sealed, secret)
+	require.NoError(t, err)
+	assert.Equal(t, "login: admin", string(plaintext))
+
+	_, otherSecret, err := Seal([]byte("other"))
+	require.NoError(t, err)
+	_, err = Open(sealed, otherSecret)
+	assert.ErrorIs(t, err, ErrDecryption)
+	_, err = Open(sealed, "short")
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+	_, err = Open(sealed[:5], secret)
+	assert.ErrorIs(t, err, ErrDecryption)
+}
+
+func TestPassphrase(t *testing.T) {
+	hash, err := HashPassphrase("correct horse")
+	require.NoError(t, err)
+	assert.True(t, CheckPassphrase(hash, "correct horse"))
+	assert.False(t, CheckPassphrase(hash, "battery staple"))
+	assert.False(t, CheckPassphrase(nil, "correct horse"))
+}
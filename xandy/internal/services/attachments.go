@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+// Вложения - это обычные записи UserFileData с заполненными ParentKind и ParentID.
+// Они не попадают в общий список файлов, отдаются внутри родительской записи
+// и удаляются вместе с ней.
+
+// getAttachmentParent возвращает родительскую запись, если пользователь может её менять
+func (uds *UserDataService) getAttachmentParent(ctx context.Context, userID uuid.UUID, parentKind models.DataKind, parentID uuid.UUID) (*models.BaseUserData, error) {
+	var parent *models.BaseUserData
+	switch parentKind {
+	case models.KindAuthInfo:
+		userAuthInfo, err := uds.store.GetUserAuthInfo(ctx, parentID, userID)
+		if err != nil {
+			return nil, err
+		}
+		parent = &userAuthInfo.BaseUserData
+	case models.KindTextData:
+		userTextData, err := uds.store.GetUserTextData(ctx, parentID, userID)
+		if err != nil {
+			return nil, err
+		}
+		parent = &userTextData.BaseUserData
+	case models.KindBankCard:
+		userBankCard, err := uds.store.GetUserBankCard(ctx, parentID, userID)
+		if err != nil {
+			return nil, err
+		}
+		parent = &userBankCard.BaseUserData
+	case models.KindFileData:
+		userFileData, err := uds.store.GetUserFileData(ctx, parentID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if userFileData.ParentID != nil {
+			return nil, httperror.New(nil, "Attachments can not have attachments", http.StatusUnprocessableEntity)
+		}
+		parent = &userFileData.BaseUserData
+	default:
+		return nil, httperror.New(nil, "Unknown data kind", http.StatusBadRequest)
+	}
+	if err := uds.checkWritable(ctx, userID, parent); err != nil {
+		return nil, err
+	}
+	return parent, nil
+}
+
+func (uds *UserDataService) InsertAttachment(
+	ctx context.Context,
+	userID uuid.UUID,
+	parentKind models.DataKind,
+	parentID uuid.UUID,
+	name string,
+	fileName string,
+	metadata map[string]interface{},
+	content io.Reader,
+) (*models.UserFileData, error) {
+	parent, err := uds.getAttachmentParent(ctx, userID, parentKind, parentID)
+	if err != nil {
+		return nil, err
+	}
+	userFileData, err := newUserFileData(userID, name, fileName, metadata)
+	if err != nil {
+		return nil, err
+	}
+	userFileData.ParentKind = parentKind
+	userFileData.ParentID = &parentID
+	// Вложение записи коллекции тоже принадлежит организации
+	userFileData.CollectionID = parent.CollectionID
+	if err := uds.insertUserFile(ctx, &userFileData, content); err != nil {
+		return nil, err
+	}
+	return &userFileData, nil
+}
+
+// getAttachment возвращает вложение, только если оно прикреплено к указанной записи
+func (uds *UserDataService) getAttachment(
+	ctx context.Context,
+	userID uuid.UUID,
+	parentKind models.DataKind,
+	parentID uuid.UUID,
+	attachmentID uuid.UUID,
+) (*models.UserFileData, error) {
+	userFileData, err := uds.store.GetUserFileData(ctx, attachmentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if userFileData.ParentKind != parentKind || userFileData.ParentID == nil || *userFileData.ParentID != parentID {
+		return nil, httperror.New(nil, "Attachment not found", http.StatusNotFound)
+	}
+	return userFileData, nil
+}
+
+func (uds *UserDataService) GetAttachmentContent(
+	ctx context.Context,
+	userID uuid.UUID,
+	parentKind models.DataKind,
+	parentID uuid.UUID,
+	attachmentID uuid.UUID,
+) (*models.UserFileData, io.ReadSeekCloser, error) {
+	if _, err := uds.getAttachment(ctx, userID, parentKind, parentID, attachmentID); err != nil {
+		return nil, nil, err
+	}
+	return uds.GetUserFileContent(ctx, attachmentID, userID)
+}
+
+func (uds *UserDataService) DeleteAttachment(
+	ctx context.Context,
+	userID uuid.UUID,
+	parentKind models.DataKind,
+	parentID uuid.UUID,
+	attachmentID uuid.UUID,
+) error {
+	return uds.store.WithTx(ctx, func(ctx context.Context) error {
+		userFileData, err := uds.getAttachment(ctx, userID, parentKind, parentID, attachmentID)
+		if err != nil {
+			return err
+		}
+		if err := uds.checkWritable(ctx, userID, &userFileData.BaseUserData); err != nil {
+			return err
+		}
+		if err := uds.store.DeleteUserFileData(ctx, attachmentID, userID); err != nil {
+			return err
+		}
+		uds.audit.recordChange(ctx, models.AuditActionDelete, models.KindFileData, &userFileData.BaseUserData)
+		return uds.contents.Release(ctx, userFileData.BlobKey)
+	})
+}
+
+// loadAttachments заполняет Attachments у записей одним запросом
+func (uds *UserDataService) loadAttachments(ctx context.Context, userID uuid.UUID, records ...*models.BaseUserData) error {
+	if len(records) == 0 {
+		return nil
+	}
+	parentIDs := make([]uuid.UUID, len(records))
+	for i, record := range records {
+		parentIDs[i] = record.ID
+	}
+	attachments, err := uds.store.GetUserFileDataAttachments(ctx, userID, parentIDs)
+	if err != nil {
+		return err
+	}
+	byParent := make(map[uuid.UUID][]models.UserFileData, len(records))
+	for _, attachment := range attachments {
+		byParent[*attachment.ParentID] = append(byParent[*attachment.ParentID], attachment)
+	}
+	for _, record := range records {
+		record.Attachments = byParent[record.ID]
+	}
+	return nil
+}
+
+// deleteAttachments удаляет вложения уже удалённой записи
+func (uds *UserDataService) deleteAttachments(ctx context.Context, userID uuid.UUID, parentID uuid.UUID) error {
+	attachments, err := uds.store.GetUserFileDataAttachments(ctx, userID, []uuid.UUID{parentID})
+	if err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		if err := uds.store.DeleteUserFileData(ctx, attachment.ID, userID); err != nil {
+			if _, statusCode := httperror.GetMessageAndStatusCode(err); statusCode == http.StatusNotFound {
+				continue
+			}
+			return err
+		}
+		if err := uds.contents.Release(ctx, attachment.BlobKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
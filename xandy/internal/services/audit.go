@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+type IAuditStore interface {
+	InsertAuditEvents(ctx context.Context, auditEvents []models.AuditEvent) error
+	GetAuditEvents(ctx context.Context, userID uuid.UUID, filter models.AuditFilter, offset int) ([]models.AuditEvent, error)
+	ExportOrganizationAuditEvents(ctx context.Context, organizationID uuid.UUID, filter models.AuditFilter, fn func(*models.AuditEvent) error) error
+}
+
+type auditActorKey struct{}
+
+// WithAuditActor сохраняет в контексте запроса, кто его выполняет
+func WithAuditActor(ctx context.Context, actor models.AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// AuditActorFromContext возвращает исполнителя запроса, для фоновых задач он пуст
+func AuditActorFromContext(ctx context.Context) models.AuditActor {
+	actor, _ := ctx.Value(auditActorKey{}).(models.AuditActor)
+	return actor
+}
+
+// AuditService ведёт журнал чтения и изменения записей.
+// Нулевой *AuditService ничего не записывает, это удобно в тестах других сервисов.
+type AuditService struct {
+	store IAuditStore
+}
+
+func NewAuditService(auditStore IAuditStore) *AuditService {
+	return &AuditService{
+		store: auditStore,
+	}
+}
+
+// Record записывает действие над записями, исполнитель берётся из контекста.
+// Секрет не отдаётся, если чтение не удалось записать, поэтому ошибка возвращается вызывающему.
+func (as *AuditService) Record(ctx context.Context, action models.AuditAction, dataKind models.DataKind, records ...*models.BaseUserData) error {
+	if as == nil || len(records) == 0 {
+		return nil
+	}
+	actor := AuditActorFromContext(ctx)
+	auditEvents := make([]models.AuditEvent, len(records))
+	for i, record := range records {
+		auditEvent := models.NewAuditEvent(actor, action)
+		auditEvent.OwnerID = &record.UserID
+		auditEvent.DataKind = dataKind
+		auditEvent.DataID = &record.ID
+		auditEvent.CollectionID = record.CollectionID
+		auditEvent.Details = models.Metadata{}
+		auditEvents[i] = auditEvent
+	}
+	return as.store.InsertAuditEvents(ctx, auditEvents)
+}
+
+// RecordEvent записывает события, собранные вызывающим, например с подробностями действия
+func (as *AuditService) RecordEvent(ctx context.Context, auditEvents ...models.AuditEvent) error {
+	if as == nil || len(auditEvents) == 0 {
+		return nil
+	}
+	for i := range auditEvents {
+		if auditEvents[i].Details == nil {
+			auditEvents[i].Details = models.Metadata{}
+		}
+	}
+	return as.store.InsertAuditEvents(ctx, auditEvents)
+}
+
+// dataEvent создаёт событие над записью ownerID, исполнитель берётся из контекста
+func dataEvent(ctx context.Context, action models.AuditAction, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID, details models.Metadata) models.AuditEvent {
+	auditEvent := models.NewAuditEvent(AuditActorFromContext(ctx), action)
+	auditEvent.OwnerID = &ownerID
+	auditEvent.DataKind = dataKind
+	auditEvent.DataID = &dataID
+	auditEvent.Details = details
+	return auditEvent
+}
+
+// recordChange записывает уже выполненное изменение. Изменение нельзя откатить,
+// поэтому ошибка журнала только логируется и не возвращается клиенту
+func (as *AuditService) recordChange(ctx context.Context, action models.AuditAction, dataKind models.DataKind, records ...*models.BaseUserData) {
+	if err := as.Record(context.WithoutCancel(ctx), action, dataKind, records...); err != nil {
+		log.Printf("record audit event %s: %s\n", action, err)
+	}
+}
+
+// recordEventChange записывает уже выполненные действия, как recordChange
+func (as *AuditService) recordEventChange(ctx context.Context, auditEvents ...models.AuditEvent) {
+	if err := as.RecordEvent(context.WithoutCancel(ctx), auditEvents...); err != nil {
+		log.Printf("record audit events: %s\n", err)
+	}
+}
+
+// GetEvents возвращает события, которые выполнил пользователь или которые затронули его записи
+func (as *AuditService) GetEvents(ctx context.Context, userID uuid.UUID, filter models.AuditFilter, offset int) ([]models.AuditEvent, error) {
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, httperror.New(nil, "from must be before to", http.StatusBadRequest)
+	}
+	return as.store.GetAuditEvents(ctx, userID, filter, offset)
+}
+
+// exportOrganization пишет события организации в w, по одному JSON-объекту в строке
+func (as *AuditService) exportOrganization(ctx context.Context, organizationID uuid.UUID, filter models.AuditFilter, w io.Writer) error {
+	if as == nil {
+		return nil
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return httperror.New(nil, "from must be before to", http.StatusBadRequest)
+	}
+	encoder := json.NewEncoder(w)
+	return as.store.ExportOrganizationAuditEvents(ctx, organizationID, filter, func(auditEvent *models.AuditEvent) error {
+		return encoder.Encode(auditEvent)
+	})
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/eac0de/xandy/internal/blobstore"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// auditTestStore копит события в памяти, err имитирует недоступный журнал
+type auditTestStore struct {
+	events []models.AuditEvent
+	err    error
+}
+
+func (s *auditTestStore) InsertAuditEvents(ctx context.Context, auditEvents []models.AuditEvent) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, auditEvents...)
+	return nil
+}
+
+func (s *auditTestStore) GetAuditEvents(ctx context.Context, userID uuid.UUID, filter models.AuditFilter, offset int) ([]models.AuditEvent, error) {
+	return s.events, nil
+}
+
+func (s *auditTestStore) ExportOrganizationAuditEvents(ctx context.Context, organizationID uuid.UUID, filter models.AuditFilter, fn func(*models.AuditEvent) error) error {
+	return nil
+}
+
+// last возвращает последнее событие и очищает журнал
+func (s *auditTestStore) last(t *testing.T) models.AuditEvent {
+	t.Helper()
+	require.NotEmpty(t, s.events)
+	auditEvent := s.events[len(s.events)-1]
+	s.events = nil
+	return auditEvent
+}
+
+func TestAuditService(t *testing.T) {
+	ownerID, granteeID := uuid.New(), uuid.New()
+	sessionID := uuid.New()
+	store := &shareTestStore{
+		fileDataStore: &fileDataStore{},
+		texts:         make(map[uuid.UUID]models.UserTextData),
+		shares:        make(map[uuid.UUID]models.Share),
+	}
+	auditStore := &auditTestStore{}
+	contents := NewFileContentStore(blobstore.NewLocalStore(t.TempDir()), &memoryFileBlobStore{refs: make(map[string]int)})
+	userData := NewUserDataService(store, contents, NewQuotaService(nil, Quotas{}), NewAuditService(auditStore))
+	shares := NewShareService(store, fakeUserDirectory{"owner@example.com": ownerID, "friend@example.com": granteeID}, userData)
+
+	note, err := models.NewUserTextData("note", ownerID, models.Metadata{}, "secret")
+	require.NoError(t, err)
+	store.texts[note.ID] = note
+
+	ownerCtx := WithAuditActor(context.Background(), models.AuditActor{UserID: &ownerID, SessionID: &sessionID, IP: "203.0.113.7", UserAgent: "xandy-cli/1.0"})
+	granteeCtx := WithAuditActor(context.Background(), models.AuditActor{UserID: &granteeID, IP: "198.51.100.1"})
+
+	t.Run("ReadIsRecorded", func(t *testing.T) {
+		_, err := userData.GetUserTextData(ownerCtx, note.ID, ownerID)
+		require.NoError(t, err)
+
+		auditEvent := auditStore.last(t)
+		assert.Equal(t, models.AuditActionRead, auditEvent.Action)
+		assert.Equal(t, &ownerID, auditEvent.ActorID)
+		assert.Equal(t, &sessionID, auditEvent.SessionID)
+		assert.Equal(t, "203.0.113.7", auditEvent.IP)
+		assert.Equal(t, "xandy-cli/1.0", auditEvent.UserAgent)
+		assert.Equal(t, &ownerID, auditEvent.OwnerID)
+		assert.Equal(t, models.KindTextData, auditEvent.DataKind)
+		assert.Equal(t, &note.ID, auditEvent.DataID)
+	})
+
+	t.Run("ShareIsRecordedWithoutRead", func(t *testing.T) {
+		share, err := shares.ShareRecord(ownerCtx, ownerID, models.KindTextData, note.ID, "friend@example.com", models.SharePermissionRead, "")
+		require.NoError(t, err)
+		require.Len(t, auditStore.events, 1)
+		auditEvent := auditStore.last(t)
+		assert.Equal(t, models.AuditActionShare, auditEvent.Action)
+		assert.Equal(t, "friend@example.com", auditEvent.Details["grantee_email"])
+
+		_, err = shares.GetSharedRecord(granteeCtx, granteeID, share.ID)
+		require.NoError(t, err)
+		auditEvent = auditStore.last(t)
+		assert.Equal(t, models.AuditActionRead, auditEvent.Action)
+		assert.Equal(t, &granteeID, auditEvent.ActorID)
+		assert.Equal(t, &ownerID, auditEvent.OwnerID)
+	})
+
+	t.Run("SecretIsNotReturnedWithoutAudit", func(t *testing.T) {
+		auditStore.err = errors.New("audit log is unavailable")
+		defer func() { auditStore.err = nil }()
+
+		_, err := userData.GetUserTextData(ownerCtx, note.ID, ownerID)
+		assert.Error(t, err)
+
+		// Изменение уже сохранено, поэтому ошибка журнала его не отменяет
+		updated, err := userData.UpdateUserTextData(ownerCtx, ownerID, note.ID, "note", "rotated", models.Metadata{})
+		require.NoError(t, err)
+		assert.Equal(t, "rotated", updated.Data)
+	})
+
+	t.Run("UpdateIsRecorded", func(t *testing.T) {
+		_, err := userData.UpdateUserTextData(ownerCtx, ownerID, note.ID, "note", "rotated again", models.Metadata{})
+		require.NoError(t, err)
+		assert.Equal(t, models.AuditActionUpdate, auditStore.last(t).Action)
+	})
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+// Наибольшее число операций в одном пакете
+const MaxBatchOperations = 100
+
+type BatchMode string
+
+const (
+	// Все операции выполняются в одной транзакции: либо применяются все, либо ни одна
+	BatchModeAtomic BatchMode = "atomic"
+	// Каждая операция применяется отдельно, ошибка одной не отменяет остальные
+	BatchModeBestEffort BatchMode = "best_effort"
+)
+
+type BatchOp string
+
+const (
+	BatchOpCreate BatchOp = "create"
+	BatchOpUpdate BatchOp = "update"
+	BatchOpDelete BatchOp = "delete"
+)
+
+// BatchOperation - одна операция пакета. Поля записи задаются как в RecordUpdate,
+// для create и update нужны все поля вида записи. Файлы пакетом не создаются,
+// их содержимое загружается отдельно.
+type BatchOperation struct {
+	Op   BatchOp         `json:"op"`
+	Kind models.DataKind `json:"kind"`
+	// Запись для update и delete
+	ID *uuid.UUID `json:"id"`
+	RecordUpdate
+}
+
+type BatchItemResult struct {
+	Index  int             `json:"index"`
+	Op     BatchOp         `json:"op"`
+	Kind   models.DataKind `json:"kind"`
+	Status int             `json:"status"`
+	ID     *uuid.UUID      `json:"id,omitempty"`
+	Data   interface{}     `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type BatchReport struct {
+	Mode      BatchMode         `json:"mode"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Items     []BatchItemResult `json:"items"`
+}
+
+type ITransactor interface {
+	// WithTx выполняет fn в транзакции, запросы хранилища с контекстом fn участвуют в ней
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// BatchService выполняет пакет операций над записями разных видов за один запрос
+type BatchService struct {
+	transactor ITransactor
+	userData   *UserDataService
+}
+
+func NewBatchService(transactor ITransactor, userData *UserDataService) *BatchService {
+	return &BatchService{
+		transactor: transactor,
+		userData:   userData,
+	}
+}
+
+// Run выполняет операции по порядку. В режиме atomic первая ошибка откатывает весь пакет
+// и возвращается с номером операции, в режиме best_effort ошибки попадают в отчёт.
+func (bs *BatchService) Run(ctx context.Context, userID uuid.UUID, mode BatchMode, operations []BatchOperation) (*BatchReport, error) {
+	if mode != BatchModeAtomic && mode != BatchModeBestEffort {
+		return nil, httperror.New(nil, "Unknown batch mode", http.StatusBadRequest)
+	}
+	if len(operations) == 0 || len(operations) > MaxBatchOperations {
+		return nil, httperror.New(nil, fmt.Sprintf("Batch must contain from 1 to %d operations", MaxBatchOperations), http.StatusBadRequest)
+	}
+	report := &BatchReport{Mode: mode, Items: make([]BatchItemResult, 0, len(operations))}
+	if mode == BatchModeAtomic {
+		var items []BatchItemResult
+		err := bs.transactor.WithTx(ctx, func(ctx context.Context) error {
+			// При конфликте транзакция повторяется, результаты прошлой попытки не нужны
+			items = make([]BatchItemResult, 0, len(operations))
+			for i, operation := range operations {
+				result, err := bs.apply(ctx, userID, operation)
+				if err != nil {
+					msg, statusCode := httperror.GetMessageAndStatusCode(err)
+					return httperror.New(err, fmt.Sprintf("Operation %d: %s", i, msg), statusCode)
+				}
+				result.Index = i
+				items = append(items, *result)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		report.Items = items
+		report.Succeeded = len(report.Items)
+		return report, nil
+	}
+	for i, operation := range operations {
+		var result *BatchItemResult
+		// Операция из нескольких запросов, например удаление записи с вложениями, применяется целиком
+		err := bs.transactor.WithTx(ctx, func(ctx context.Context) error {
+			var err error
+			result, err = bs.apply(ctx, userID, operation)
+			return err
+		})
+		if err != nil {
+			msg, statusCode := httperror.GetMessageAndStatusCode(err)
+			result = &BatchItemResult{Op: operation.Op, Kind: operation.Kind, ID: operation.ID, Status: statusCode, Error: msg}
+			report.Failed++
+		} else {
+			report.Succeeded++
+		}
+		result.Index = i
+		report.Items = append(report.Items, *result)
+	}
+	return report, nil
+}
+
+func (bs *BatchService) apply(ctx context.Context, userID uuid.UUID, operation BatchOperation) (*BatchItemResult, error) {
+	result := &BatchItemResult{Op: operation.Op, Kind: operation.Kind}
+	switch operation.Op {
+	case BatchOpCreate:
+		if operation.ID != nil {
+			return nil, httperror.New(nil, "id is not allowed for create", http.StatusBadRequest)
+		}
+		data, err := bs.create(ctx, userID, operation)
+		if err != nil {
+			return nil, err
+		}
+		result.Status = http.StatusCreated
+		result.ID = &data.Base().ID
+		result.Data = data
+	case BatchOpUpdate:
+		if operation.ID == nil {
+			return nil, httperror.New(nil, "id is required for update", http.StatusBadRequest)
+		}
+		data, err := bs.update(ctx, userID, *operation.ID, operation)
+		if err != nil {
+			return nil, err
+		}
+		result.Status = http.StatusOK
+		result.ID = operation.ID
+		result.Data = data
+	case BatchOpDelete:
+		if operation.ID == nil {
+			return nil, httperror.New(nil, "id is required for delete", http.StatusBadRequest)
+		}
+		if err := bs.delete(ctx, userID, *operation.ID, operation.Kind); err != nil {
+			return nil, err
+		}
+		result.Status = http.StatusNoContent
+		result.ID = operation.ID
+	default:
+		return nil, httperror.New(nil, "Unknown operation", http.StatusBadRequest)
+	}
+	return result, nil
+}
+
+// Запись любого вида, созданная или изменённая операцией
+type batchRecord interface {
+	Base() *models.BaseUserData
+}
+
+func (bs *BatchService) create(ctx context.Context, userID uuid.UUID, operation BatchOperation) (batchRecord, error) {
+	switch operation.Kind {
+	case models.KindAuthInfo:
+		return bs.userData.InsertUserAuthInfo(ctx, userID, operation.Name, operation.Login, operation.Password, operation.Metadata)
+	case models.KindTextData:
+		return bs.userData.InsertUserTextData(ctx, userID, operation.Name, operation.Data, operation.Metadata)
+	case models.KindBankCard:
+		return bs.userData.InsertUserBankCard(ctx, userID, operation.Name, operation.Number, operation.CardHolder, operation.ExpireDate, operation.CSC, operation.Metadata)
+	case models.KindFileData:
+		return nil, httperror.New(nil, "Files can not be created in a batch, upload them separately", http.StatusBadRequest)
+	default:
+		return nil, httperror.New(nil, "Unknown data kind", http.StatusBadRequest)
+	}
+}
+
+func (bs *BatchService) update(ctx context.Context, userID uuid.UUID, dataID uuid.UUID, operation BatchOperation) (batchRecord, error) {
+	switch operation.Kind {
+	case models.KindAuthInfo:
+		return bs.userData.UpdateUserAuthInfo(ctx, userID, dataID, operation.Name, operation.Login, operation.Password, operation.Metadata)
+	case models.KindTextData:
+		return bs.userData.UpdateUserTextData(ctx, userID, dataID, operation.Name, operation.Data, operation.Metadata)
+	case models.KindBankCard:
+		return bs.userData.UpdateUserBankCard(ctx, userID, dataID, operation.Name, operation.Number, operation.CardHolder, operation.ExpireDate, operation.CSC, operation.Metadata)
+	case models.KindFileData:
+		return bs.userData.UpdateUserFileData(ctx, userID, dataID, operation.Name, operation.Metadata)
+	default:
+		return nil, httperror.New(nil, "Unknown data kind", http.StatusBadRequest)
+	}
+}
+
+func (bs *BatchService) delete(ctx context.Context, userID uuid.UUID, dataID uuid.UUID, dataKind models.DataKind) error {
+	switch dataKind {
+	case models.KindAuthInfo:
+		return bs.userData.DeleteUserAuthInfo(ctx, dataID, userID)
+	case models.KindTextData:
+		return bs.userData.DeleteUserTextData(ctx, dataID, userID)
+	case models.KindBankCard:
+		return bs.userData.DeleteUserBankCard(ctx, dataID, userID)
+	case models.KindFileData:
+		return bs.userData.DeleteUserFileData(ctx, dataID, userID)
+	default:
+		return httperror.New(nil, "Unknown data kind", http.StatusBadRequest)
+	}
+}
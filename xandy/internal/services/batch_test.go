@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"testing"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchTestStore хранит только текстовые записи, а транзакцию имитирует снимком записей
+type batchTestStore struct {
+	*fileDataStore
+	texts map[uuid.UUID]models.UserTextData
+	// Выполнять fn дважды, как при повторе транзакции после конфликта
+	retry bool
+	inTx  bool
+	// Записи, заблокированные внутри транзакции
+	locked []uuid.UUID
+}
+
+func (s *batchTestStore) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !s.inTx {
+		s.inTx = true
+		defer func() { s.inTx = false }()
+	}
+	snapshot := maps.Clone(s.texts)
+	if s.retry {
+		fn(ctx)
+		s.texts = maps.Clone(snapshot)
+	}
+	if err := fn(ctx); err != nil {
+		s.texts = snapshot
+		return err
+	}
+	return nil
+}
+
+func (s *batchTestStore) LockUserData(ctx context.Context, dataKind models.DataKind, dataID uuid.UUID) error {
+	if !s.inTx {
+		return errors.New("lock outside of transaction")
+	}
+	s.locked = append(s.locked, dataID)
+	return nil
+}
+
+func (s *batchTestStore) InsertUserTextData(ctx context.Context, userTextData *models.UserTextData) error {
+	s.texts[userTextData.ID] = *userTextData
+	return nil
+}
+
+func (s *batchTestStore) GetUserTextData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserTextData, error) {
+	userTextData, ok := s.texts[dataID]
+	if !ok || userTextData.UserID != userID {
+		return nil, httperror.New(nil, "UserTextData not found", http.StatusNotFound)
+	}
+	return &userTextData, nil
+}
+
+func (s *batchTestStore) UpdateUserTextData(ctx context.Context, userTextData *models.UserTextData, userID uuid.UUID) error {
+	s.texts[userTextData.ID] = *userTextData
+	return nil
+}
+
+func (s *batchTestStore) DeleteUserTextData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) error {
+	delete(s.texts, dataID)
+	return nil
+}
+
+func (s *batchTestStore) GetUserFileDataAttachments(ctx context.Context, userID uuid.UUID, parentIDs []uuid.UUID) ([]models.UserFileData, error) {
+	return nil, nil
+}
+
+func TestBatchService(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	store := &batchTestStore{fileDataStore: &fileDataStore{}, texts: make(map[uuid.UUID]models.UserTextData)}
+	service := NewBatchService(store, NewUserDataService(store, nil, NewQuotaService(nil, Quotas{}), nil))
+
+	existing, err := models.NewUserTextData("existing", userID, models.Metadata{}, "old")
+	require.NoError(t, err)
+	store.texts[existing.ID] = existing
+	missingID := uuid.New()
+
+	operations := []BatchOperation{
+		{Op: BatchOpCreate, Kind: models.KindTextData, RecordUpdate: RecordUpdate{Name: "new", Data: "text"}},
+		{Op: BatchOpUpdate, Kind: models.KindTextData, ID: &existing.ID, RecordUpdate: RecordUpdate{Name: "renamed", Data: "new"}},
+		{Op: BatchOpDelete, Kind: models.KindTextData, ID: &missingID},
+	}
+
+	t.Run("Validation", func(t *testing.T) {
+		_, err := service.Run(ctx, userID, "partial", operations)
+		_, statusCode := httperror.GetMessageAndStatusCode(err)
+		assert.Equal(t, http.StatusBadRequest, statusCode)
+
+		_, err = service.Run(ctx, userID, BatchModeAtomic, nil)
+		_, statusCode = httperror.GetMessageAndStatusCode(err)
+		assert.Equal(t, http.StatusBadRequest, statusCode)
+
+		_, err = service.Run(ctx, userID, BatchModeAtomic, make([]BatchOperation, MaxBatchOperations+1))
+		_, statusCode = httperror.GetMessageAndStatusCode(err)
+		assert.Equal(t, http.StatusBadRequest, statusCode)
+	})
+
+	t.Run("AtomicRollsBack", func(t *testing.T) {
+		_, err := service.Run(ctx, userID, BatchModeAtomic, operations)
+		msg, statusCode := httperror.GetMessageAndStatusCode(err)
+		assert.Equal(t, http.StatusNotFound, statusCode)
+		assert.Equal(t, "Operation 2: UserTextData not found", msg)
+		require.Len(t, store.texts, 1)
+		assert.Equal(t, "existing", store.texts[existing.ID].Name)
+	})
+
+	t.Run("BestEffort", func(t *testing.T) {
+		report, err := service.Run(ctx, userID, BatchModeBestEffort, operations)
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.Succeeded)
+		assert.Equal(t, 1, report.Failed)
+		require.Len(t, report.Items, 3)
+		assert.Equal(t, http.StatusCreated, report.Items[0].Status)
+		assert.Equal(t, http.StatusOK, report.Items[1].Status)
+		assert.Equal(t, http.StatusNotFound, report.Items[2].Status)
+		assert.Equal(t, 2, report.Items[2].Index)
+		assert.Len(t, store.texts, 2)
+		assert.Equal(t, "renamed", store.texts[existing.ID].Name)
+	})
+
+	t.Run("AtomicRetried", func(t *testing.T) {
+		store.retry = true
+		defer func() { store.retry = false }()
+		report, err := service.Run(ctx, userID, BatchModeAtomic, []BatchOperation{
+			{Op: BatchOpCreate, Kind: models.KindTextData, RecordUpdate: RecordUpdate{Name: "retried", Data: "text"}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Succeeded)
+		require.Len(t, report.Items, 1)
+		assert.Len(t, store.texts, 3)
+	})
+
+	t.Run("AtomicCommits", func(t *testing.T) {
+		report, err := service.Run(ctx, userID, BatchModeAtomic, []BatchOperation{
+			{Op: BatchOpDelete, Kind: models.KindTextData, ID: &existing.ID},
+			{Op: BatchOpCreate, Kind: models.KindFileData, RecordUpdate: RecordUpdate{Name: "scan"}},
+		})
+		assert.Nil(t, report)
+		_, statusCode := httperror.GetMessageAndStatusCode(err)
+		assert.Equal(t, http.StatusBadRequest, statusCode)
+		assert.Contains(t, store.texts, existing.ID)
+
+		report, err = service.Run(ctx, userID, BatchModeAtomic, []BatchOperation{
+			{Op: BatchOpDelete, Kind: models.KindTextData, ID: &existing.ID},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Succeeded)
+		assert.Equal(t, http.StatusNoContent, report.Items[0].Status)
+		assert.NotContains(t, store.texts, existing.ID)
+	})
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/emailsender"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+type IEmergencyAccessStore interface {
+	InsertEmergencyAccess(ctx context.Context, emergencyAccess *models.EmergencyAccess) error
+	GetEmergencyAccess(ctx context.Context, accessID uuid.UUID) (*models.EmergencyAccess, error)
+	GetGrantorEmergencyAccess(ctx context.Context, grantorID uuid.UUID) ([]models.EmergencyAccess, error)
+	GetGranteeEmergencyAccess(ctx context.Context, granteeID uuid.UUID) ([]models.EmergencyAccess, error)
+	RequestEmergencyAccess(ctx context.Context, accessID uuid.UUID, granteeID uuid.UUID, requestedAt time.Time) error
+	RejectEmergencyAccess(ctx context.Context, accessID uuid.UUID, grantorID uuid.UUID, updatedAt time.Time) error
+	DeleteEmergencyAccess(ctx context.Context, accessID uuid.UUID, userID uuid.UUID) error
+	TakeOverVault(ctx context.Context, accessID uuid.UUID, granteeID uuid.UUID, now time.Time) (int, error)
+}
+
+// EmergencyAccessService даёт доверенному контакту доступ к личным записям владельца,
+// если владелец не отклонил запрос контакта за время ожидания.
+// Записи организаций в экстренный доступ не попадают.
+type EmergencyAccessService struct {
+	store       IEmergencyAccessStore
+	users       IUserDirectory
+	userData    *UserDataService
+	emailSender emailsender.IEmailSender
+}
+
+func NewEmergencyAccessService(
+	emergencyAccessStore IEmergencyAccessStore,
+	users IUserDirectory,
+	userData *UserDataService,
+	emailSender emailsender.IEmailSender,
+) *EmergencyAccessService {
+	return &EmergencyAccessService{
+		store:       emergencyAccessStore,
+		users:       users,
+		userData:    userData,
+		emailSender: emailSender,
+	}
+}
+
+// AddContact назначает пользователя с адресом email доверенным контактом владельца
+func (eas *EmergencyAccessService) AddContact(
+	ctx context.Context,
+	grantorID uuid.UUID,
+	email string,
+	accessType models.EmergencyAccessType,
+	waitDays int,
+) (*models.EmergencyAccess, error) {
+	grantee, err := eas.users.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if grantee.ID == grantorID {
+		return nil, httperror.New(nil, "You can not be your own trusted contact", http.StatusUnprocessableEntity)
+	}
+	grantor, err := eas.users.GetUserByID(ctx, grantorID)
+	if err != nil {
+		return nil, err
+	}
+	emergencyAccess, err := models.NewEmergencyAccess(grantorID, grantor.Email, grantee.ID, grantee.Email, accessType, waitDays)
+	if err != nil {
+		return nil, err
+	}
+	if err := eas.store.InsertEmergencyAccess(ctx, &emergencyAccess); err != nil {
+		return nil, err
+	}
+	eas.notify(
+		grantee.Email,
+		"Вы назначены доверенным контактом",
+		fmt.Sprintf("%s назначил вас доверенным контактом в xandy. Вы сможете запросить экстренный доступ к записям, время ожидания - %d дн.", grantor.Email, waitDays),
+	)
+	return &emergencyAccess, nil
+}
+
+func (eas *EmergencyAccessService) GetContacts(ctx context.Context, grantorID uuid.UUID) ([]models.EmergencyAccess, error) {
+	emergencyAccessList, err := eas.store.GetGrantorEmergencyAccess(ctx, grantorID)
+	if err != nil {
+		return nil, err
+	}
+	if emergencyAccessList == nil {
+		emergencyAccessList = []models.EmergencyAccess{}
+	}
+	return emergencyAccessList, nil
+}
+
+// RejectRequest отклоняет запрос контакта до конца ожидания
+func (eas *EmergencyAccessService) RejectRequest(ctx context.Context, grantorID uuid.UUID, accessID uuid.UUID) error {
+	emergencyAccess, err := eas.getGrantorAccess(ctx, grantorID, accessID)
+	if err != nil {
+		return err
+	}
+	if err := eas.store.RejectEmergencyAccess(ctx, accessID, grantorID, time.Now()); err != nil {
+		return err
+	}
+	eas.notify(
+		emergencyAccess.GranteeEmail,
+		"Запрос экстренного доступа отклонён",
+		fmt.Sprintf("%s отклонил ваш запрос экстренного доступа в xandy.", emergencyAccess.GrantorEmail),
+	)
+	return nil
+}
+
+// RemoveContact удаляет доверенный контакт вместе с выданным ему доступом
+func (eas *EmergencyAccessService) RemoveContact(ctx context.Context, grantorID uuid.UUID, accessID uuid.UUID) error {
+	if _, err := eas.getGrantorAccess(ctx, grantorID, accessID); err != nil {
+		return err
+	}
+	return eas.store.DeleteEmergencyAccess(ctx, accessID, grantorID)
+}
+
+// GetGrantedToMe возвращает владельцев, назначивших пользователя доверенным контактом
+func (eas *EmergencyAccessService) GetGrantedToMe(ctx context.Context, granteeID uuid.UUID) ([]models.EmergencyAccess, error) {
+	emergencyAccessList, err := eas.store.GetGranteeEmergencyAccess(ctx, granteeID)
+	if err != nil {
+		return nil, err
+	}
+	if emergencyAccessList == nil {
+		emergencyAccessList = []models.EmergencyAccess{}
+	}
+	return emergencyAccessList, nil
+}
+
+// RequestAccess начинает ожидание. Владелец узнаёт о запросе по почте,
+// поэтому если письмо не отправилось, запрос не создаётся.
+func (eas *EmergencyAccessService) RequestAccess(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID) (*models.EmergencyAccess, error) {
+	emergencyAccess, err := eas.getGranteeAccess(ctx, granteeID, accessID)
+	if err != nil {
+		return nil, err
+	}
+	if emergencyAccess.Status != models.EmergencyAccessIdle {
+		return nil, httperror.New(nil, "Emergency access is already requested", http.StatusConflict)
+	}
+	// Адрес владельца мог измениться после назначения контакта
+	grantor, err := eas.users.GetUserByID(ctx, emergencyAccess.GrantorID)
+	if err != nil {
+		return nil, err
+	}
+	err = eas.emailSender.Send(
+		"Запрошен экстренный доступ",
+		fmt.Sprintf(
+			"%s запросил экстренный доступ к вашим записям в xandy. Если вы не отклоните запрос, доступ откроется через %d дн.",
+			emergencyAccess.GranteeEmail,
+			emergencyAccess.WaitDays,
+		),
+		grantor.Email,
+	)
+	if err != nil {
+		return nil, httperror.New(err, "Failed to notify the owner, try again later", http.StatusBadGateway)
+	}
+	now := time.Now()
+	if err := eas.store.RequestEmergencyAccess(ctx, accessID, granteeID, now); err != nil {
+		return nil, err
+	}
+	emergencyAccess.Status = models.EmergencyAccessRequested
+	emergencyAccess.RequestedAt = &now
+	emergencyAccess.UpdatedAt = now
+	return emergencyAccess, nil
+}
+
+// LeaveAccess отказывается от роли доверенного контакта
+func (eas *EmergencyAccessService) LeaveAccess(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID) error {
+	if _, err := eas.getGranteeAccess(ctx, granteeID, accessID); err != nil {
+		return err
+	}
+	return eas.store.DeleteEmergencyAccess(ctx, accessID, granteeID)
+}
+
+// GetVault возвращает личные записи владельца после окончания ожидания
+func (eas *EmergencyAccessService) GetVault(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID) (*models.EmergencyVault, error) {
+	emergencyAccess, err := eas.getGrantedAccess(ctx, granteeID, accessID)
+	if err != nil {
+		return nil, err
+	}
+	grantorID := emergencyAccess.GrantorID
+	vault := &models.EmergencyVault{}
+	if vault.AuthInfo, err = listAll(ctx, grantorID, eas.userData.GetUserAuthInfoList); err != nil {
+		return nil, err
+	}
+	if vault.TextData, err = listAll(ctx, grantorID, eas.userData.GetUserTextDataList); err != nil {
+		return nil, err
+	}
+	if vault.BankCards, err = listAll(ctx, grantorID, eas.userData.GetUserBankCardList); err != nil {
+		return nil, err
+	}
+	fileDataList := func(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserFileData, error) {
+		return eas.userData.GetUserFileDataList(ctx, userID, models.FileDataFilter{}, offset)
+	}
+	if vault.FileData, err = listAll(ctx, grantorID, fileDataList); err != nil {
+		return nil, err
+	}
+	vault.AuthInfo = append([]models.UserAuthInfo{}, personalOnly(vault.AuthInfo)...)
+	vault.TextData = append([]models.UserTextData{}, personalOnly(vault.TextData)...)
+	vault.BankCards = append([]models.UserBankCard{}, personalOnly(vault.BankCards)...)
+	vault.FileData = append([]models.UserFileData{}, personalOnly(vault.FileData)...)
+	return vault, nil
+}
+
+// GetFileContent отдаёт содержимое личного файла или вложения владельца
+func (eas *EmergencyAccessService) GetFileContent(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID, fileID uuid.UUID) (*models.UserFileData, io.ReadSeekCloser, error) {
+	emergencyAccess, err := eas.getGrantedAccess(ctx, granteeID, accessID)
+	if err != nil {
+		return nil, nil, err
+	}
+	userFileData, content, err := eas.userData.GetUserFileContent(ctx, fileID, emergencyAccess.GrantorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !userFileData.Personal() {
+		content.Close()
+		return nil, nil, httperror.New(nil, "UserFileData not found", http.StatusNotFound)
+	}
+	return userFileData, content, nil
+}
+
+// TakeOver переносит личные записи владельца к контакту и возвращает их количество.
+// После переноса экстренные доступы владельца удаляются.
+func (eas *EmergencyAccessService) TakeOver(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID) (int, error) {
+	emergencyAccess, err := eas.getGrantedAccess(ctx, granteeID, accessID)
+	if err != nil {
+		return 0, err
+	}
+	if emergencyAccess.AccessType != models.EmergencyAccessTakeover {
+		return 0, httperror.New(nil, "Only view access is granted", http.StatusForbidden)
+	}
+	moved, err := eas.store.TakeOverVault(ctx, accessID, granteeID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	auditEvent := models.NewAuditEvent(AuditActorFromContext(ctx), models.AuditActionTakeover)
+	auditEvent.OwnerID = &emergencyAccess.GrantorID
+	auditEvent.Details = models.Metadata{"emergency_access_id": accessID, "moved": moved}
+	eas.userData.audit.recordEventChange(ctx, auditEvent)
+	eas.notify(
+		emergencyAccess.GrantorEmail,
+		"Записи переданы доверенному контакту",
+		fmt.Sprintf("%s получил экстренный доступ и забрал ваши личные записи в xandy: %d шт.", emergencyAccess.GranteeEmail, moved),
+	)
+	return moved, nil
+}
+
+// getGrantorAccess возвращает доступ, только если его выдал пользователь
+func (eas *EmergencyAccessService) getGrantorAccess(ctx context.Context, grantorID uuid.UUID, accessID uuid.UUID) (*models.EmergencyAccess, error) {
+	emergencyAccess, err := eas.store.GetEmergencyAccess(ctx, accessID)
+	if err != nil {
+		return nil, err
+	}
+	if emergencyAccess.GrantorID != grantorID {
+		return nil, httperror.New(nil, "Emergency access not found", http.StatusNotFound)
+	}
+	return emergencyAccess, nil
+}
+
+// getGranteeAccess возвращает доступ, только если он выдан пользователю
+func (eas *EmergencyAccessService) getGranteeAccess(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID) (*models.EmergencyAccess, error) {
+	emergencyAccess, err := eas.store.GetEmergencyAccess(ctx, accessID)
+	if err != nil {
+		return nil, err
+	}
+	if emergencyAccess.GranteeID != granteeID {
+		return nil, httperror.New(nil, "Emergency access not found", http.StatusNotFound)
+	}
+	return emergencyAccess, nil
+}
+
+// getGrantedAccess возвращает доступ контакта, только если ожидание закончилось
+func (eas *EmergencyAccessService) getGrantedAccess(ctx context.Context, granteeID uuid.UUID, accessID uuid.UUID) (*models.EmergencyAccess, error) {
+	emergencyAccess, err := eas.getGranteeAccess(ctx, granteeID, accessID)
+	if err != nil {
+		return nil, err
+	}
+	if !emergencyAccess.Granted(time.Now()) {
+		return nil, httperror.New(nil, "Emergency access is not granted yet", http.StatusForbidden)
+	}
+	return emergencyAccess, nil
+}
+
+// notify отправляет уведомление, ошибка отправки только пишется в лог
+func (eas *EmergencyAccessService) notify(recipient string, subject string, body string) {
+	if err := eas.emailSender.Send(subject, body, recipient); err != nil {
+		log.Printf("send emergency access email: %s\n", err)
+	}
+}
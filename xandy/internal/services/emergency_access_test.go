@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/internal/blobstore"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// emergencyTestStore хранит экстренные доступы в памяти поверх текстовых записей и файлов
+type emergencyTestStore struct {
+	*shareTestStore
+	access map[uuid.UUID]models.EmergencyAccess
+}
+
+func (s *emergencyTestStore) GetUserTextDataList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserTextData, error) {
+	if offset > 0 {
+		return nil, nil
+	}
+	var list []models.UserTextData
+	for _, userTextData := range s.texts {
+		if userTextData.UserID == userID {
+			list = append(list, userTextData)
+		}
+	}
+	return list, nil
+}
+
+func (s *emergencyTestStore) GetUserAuthInfoList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserAuthInfo, error) {
+	return nil, nil
+}
+
+func (s *emergencyTestStore) GetUserBankCardList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserBankCard, error) {
+	return nil, nil
+}
+
+func (s *emergencyTestStore) InsertEmergencyAccess(ctx context.Context, emergencyAccess *models.EmergencyAccess) error {
+	for _, existing := range s.access {
+		if existing.GrantorID == emergencyAccess.GrantorID && existing.GranteeID == emergencyAccess.GranteeID {
+			return httperror.New(nil, "This user is already your trusted contact", http.StatusConflict)
+		}
+	}
+	s.access[emergencyAccess.ID] = *emergencyAccess
+	return nil
+}
+
+func (s *emergencyTestStore) GetEmergencyAccess(ctx context.Context, accessID uuid.UUID) (*models.EmergencyAccess, error) {
+	emergencyAccess, ok := s.access[accessID]
+	if !ok {
+		return nil, httperror.New(nil, "Emergency access not found", http.StatusNotFound)
+	}
+	return &emergencyAccess, nil
+}
+
+func (s *emergencyTestStore) GetGrantorEmergencyAccess(ctx context.Context, grantorID uuid.UUID) ([]models.EmergencyAccess, error) {
+	var list []models.EmergencyAccess
+	for _, emergencyAccess := range s.access {
+		if emergencyAccess.GrantorID == grantorID {
+			list = append(list, emergencyAccess)
+		}
+	}
+	return list, nil
+}
+
+func (s *emergencyTestStore) GetGranteeEmergencyAccess(ctx context.Context, granteeID uuid.UUID) ([]models.EmergencyAccess, error) {
+	var list []models.EmergencyAccess
+	for _, emergencyAccess := range s.access {
+		if emergencyAccess.GranteeID == granteeID {
+			list = append(list, emergencyAccess)
+		}
+	}
+	return list, nil
+}
+
+func (s *emergencyTestStore) RequestEmergencyAccess(ctx context.Context, accessID uuid.UUID, granteeID uuid.UUID, requestedAt time.Time) error {
+	emergencyAccess, ok := s.access[accessID]
+	if !ok || emergencyAccess.GranteeID != granteeID || emergencyAccess.Status != models.EmergencyAccessIdle {
+		return httperror.New(nil, "Emergency access is already requested", http.StatusConflict)
+	}
+	emergencyAccess.Status = models.EmergencyAccessRequested
+	emergencyAccess.RequestedAt = &requestedAt
+	s.access[accessID] = emergencyAccess
+	return nil
+}
+
+func (s *emergencyTestStore) RejectEmergencyAccess(ctx context.Context, accessID uuid.UUID, grantorID uuid.UUID, updatedAt time.Time) error {
+	emergencyAccess, ok := s.access[accessID]
+	if !ok || emergencyAccess.GrantorID != grantorID || emergencyAccess.Status != models.EmergencyAccessRequested {
+		return httperror.New(nil, "Emergency access is not requested", http.StatusConflict)
+	}
+	emergencyAccess.Status = models.EmergencyAccessIdle
+	emergencyAccess.RequestedAt = nil
+	s.access[accessID] = emergencyAccess
+	return nil
+}
+
+func (s *emergencyTestStore) DeleteEmergencyAccess(ctx context.Context, accessID uuid.UUID, userID uuid.UUID) error {
+	emergencyAccess, ok := s.access[accessID]
+	if !ok || (emergencyAccess.GrantorID != userID && emergencyAccess.GranteeID != userID) {
+		return httperror.New(nil, "Emergency access not found", http.StatusNotFound)
+	}
+	delete(s.access, accessID)
+	return nil
+}
+
+func (s *emergencyTestStore) TakeOverVault(ctx context.Context, accessID uuid.UUID, granteeID uuid.UUID, now time.Time) (int, error) {
+	emergencyAccess, ok := s.access[accessID]
+	if !ok || emergencyAccess.GranteeID != granteeID || emergencyAccess.AccessType != models.EmergencyAccessTakeover || !emergencyAccess.Granted(now) {
+		return 0, httperror.New(nil, "Takeover is not granted", http.StatusForbidden)
+	}
+	moved := 0
+	for id, userTextData := range s.texts {
+		if userTextData.UserID == emergencyAccess.GrantorID && userTextData.Personal() {
+			userTextData.UserID = granteeID
+			s.texts[id] = userTextData
+			moved++
+		}
+	}
+	for id, other := range s.access {
+		if other.GrantorID == emergencyAccess.GrantorID {
+			delete(s.access, id)
+		}
+	}
+	return moved, nil
+}
+
+// recordingEmailSender запоминает адресатов отправленных писем
+type recordingEmailSender struct {
+	recipients []string
+	err        error
+}
+
+func (s *recordingEmailSender) Send(subject, body string, recipients ...string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.recipients = append(s.recipients, recipients...)
+	return nil
+}
+
+// elapseWait переносит запрос в прошлое, как будто ожидание уже закончилось
+func (s *emergencyTestStore) elapseWait(accessID uuid.UUID) {
+	emergencyAccess := s.access[accessID]
+	requestedAt := emergencyAccess.RequestedAt.AddDate(0, 0, -emergencyAccess.WaitDays)
+	emergencyAccess.RequestedAt = &requestedAt
+	s.access[accessID] = emergencyAccess
+}
+
+func newEmergencyTestService(t *testing.T, users fakeUserDirectory) (*EmergencyAccessService, *emergencyTestStore, *recordingEmailSender, *FileContentStore) {
+	store := &emergencyTestStore{
+		shareTestStore: &shareTestStore{
+			fileDataStore: &fileDataStore{},
+			texts:         make(map[uuid.UUID]models.UserTextData),
+			shares:        make(map[uuid.UUID]models.Share),
+		},
+		access: make(map[uuid.UUID]models.EmergencyAccess),
+	}
+	contents := NewFileContentStore(blobstore.NewLocalStore(t.TempDir()), &memoryFileBlobStore{refs: make(map[string]int)})
+	sender := &recordingEmailSender{}
+	service := NewEmergencyAccessService(store, users, NewUserDataService(store, contents, NewQuotaService(nil, Quotas{}), nil), sender)
+	return service, store, sender, contents
+}
+
+func TestEmergencyAccessView(t *testing.T) {
+	ctx := context.Background()
+	ownerID, contactID, strangerID := uuid.New(), uuid.New(), uuid.New()
+	users := fakeUserDirectory{"owner@example.com": ownerID, "contact@example.com": contactID, "stranger@example.com": strangerID}
+	service, store, sender, contents := newEmergencyTestService(t, users)
+
+	note, err := models.NewUserTextData("note", ownerID, models.Metadata{}, "secret")
+	require.NoError(t, err)
+	store.texts[note.ID] = note
+	collectionID := uuid.New()
+	teamNote, err := models.NewUserTextData("team note", ownerID, models.Metadata{}, "team secret")
+	require.NoError(t, err)
+	teamNote.CollectionID = &collectionID
+	store.texts[teamNote.ID] = teamNote
+	file, err := models.NewUserFileData("scan", ownerID, models.Metadata{}, ".txt", "scan.txt")
+	require.NoError(t, err)
+	stored, err := contents.Save(ctx, strings.NewReader("scan content"))
+	require.NoError(t, err)
+	stored.apply(&file)
+	file.ScanStatus = models.ScanStatusClean
+	store.files = append(store.files, file)
+
+	_, err = service.AddContact(ctx, ownerID, "owner@example.com", models.EmergencyAccessView, 3)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode(err))
+	_, err = service.AddContact(ctx, ownerID, "contact@example.com", "admin", 3)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode(err))
+	_, err = service.AddContact(ctx, ownerID, "contact@example.com", models.EmergencyAccessView, 0)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode(err))
+
+	emergencyAccess, err := service.AddContact(ctx, ownerID, "contact@example.com", models.EmergencyAccessView, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"contact@example.com"}, sender.recipients)
+	_, err = service.AddContact(ctx, ownerID, "contact@example.com", models.EmergencyAccessView, 3)
+	assert.Equal(t, http.StatusConflict, statusCode(err))
+
+	// До запроса и во время ожидания записи недоступны
+	_, err = service.GetVault(ctx, contactID, emergencyAccess.ID)
+	assert.Equal(t, http.StatusForbidden, statusCode(err))
+	_, err = service.RequestAccess(ctx, strangerID, emergencyAccess.ID)
+	assert.Equal(t, http.StatusNotFound, statusCode(err))
+
+	// Если владельца не удалось уведомить, запрос не создаётся
+	sender.err = errors.New("smtp is down")
+	_, err = service.RequestAccess(ctx, contactID, emergencyAccess.ID)
+	assert.Equal(t, http.StatusBadGateway, statusCode(err))
+	assert.Equal(t, models.EmergencyAccessIdle, store.access[emergencyAccess.ID].Status)
+	sender.err = nil
+
+	requested, err := service.RequestAccess(ctx, contactID, emergencyAccess.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.EmergencyAccessRequested, requested.Status)
+	assert.Equal(t, "owner@example.com", sender.recipients[len(sender.recipients)-1])
+	_, err = service.RequestAccess(ctx, contactID, emergencyAccess.ID)
+	assert.Equal(t, http.StatusConflict, statusCode(err))
+	_, err = service.GetVault(ctx, contactID, emergencyAccess.ID)
+	assert.Equal(t, http.StatusForbidden, statusCode(err))
+
+	// Владелец отклоняет запрос во время ожидания
+	assert.Equal(t, http.StatusNotFound, statusCode(service.RejectRequest(ctx, contactID, emergencyAccess.ID)))
+	require.NoError(t, service.RejectRequest(ctx, ownerID, emergencyAccess.ID))
+	assert.Equal(t, "contact@example.com", sender.recipients[len(sender.recipients)-1])
+	assert.Equal(t, http.StatusConflict, statusCode(service.RejectRequest(ctx, ownerID, emergencyAccess.ID)))
+
+	_, err = service.RequestAccess(ctx, contactID, emergencyAccess.ID)
+	require.NoError(t, err)
+	store.elapseWait(emergencyAccess.ID)
+
+	vault, err := service.GetVault(ctx, contactID, emergencyAccess.ID)
+	require.NoError(t, err)
+	require.Len(t, vault.TextData, 1)
+	assert.Equal(t, "secret", vault.TextData[0].Data)
+	require.Len(t, vault.FileData, 1)
+	assert.NotNil(t, vault.AuthInfo)
+
+	_, content, err := service.GetFileContent(ctx, contactID, emergencyAccess.ID, file.ID)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(content)
+	content.Close()
+	assert.Equal(t, "scan content", string(data))
+
+	// Доступ на чтение не даёт забрать записи
+	_, err = service.TakeOver(ctx, contactID, emergencyAccess.ID)
+	assert.Equal(t, http.StatusForbidden, statusCode(err))
+
+	require.NoError(t, service.RemoveContact(ctx, ownerID, emergencyAccess.ID))
+	_, err = service.GetVault(ctx, contactID, emergencyAccess.ID)
+	assert.Equal(t, http.StatusNotFound, statusCode(err))
+}
+
+func TestEmergencyAccessTakeover(t *testing.T) {
+	ctx := context.Background()
+	ownerID, contactID := uuid.New(), uuid.New()
+	users := fakeUserDirectory{"owner@example.com": ownerID, "contact@example.com": contactID}
+	service, store, _, _ := newEmergencyTestService(t, users)
+
+	note, err := models.NewUserTextData("note", ownerID, models.Metadata{}, "secret")
+	require.NoError(t, err)
+	store.texts[note.ID] = note
+
+	emergencyAccess, err := service.AddContact(ctx, ownerID, "contact@example.com", models.EmergencyAccessTakeover, 1)
+	require.NoError(t, err)
+	_, err = service.RequestAccess(ctx, contactID, emergencyAccess.ID)
+	require.NoError(t, err)
+	_, err = service.TakeOver(ctx, contactID, emergencyAccess.ID)
+	assert.Equal(t, http.StatusForbidden, statusCode(err))
+
+	store.elapseWait(emergencyAccess.ID)
+	moved, err := service.TakeOver(ctx, contactID, emergencyAccess.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, moved)
+	assert.Equal(t, contactID, store.texts[note.ID].UserID)
+
+	contacts, err := service.GetContacts(ctx, ownerID)
+	require.NoError(t, err)
+	assert.Empty(t, contacts)
+}
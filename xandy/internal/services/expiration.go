@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+// Сколько истёкших записей удаляется одним запросом
+const expiredBatchSize = 100
+
+// Наибольшее окно для списка записей, срок жизни которых скоро истечёт
+const MaxExpiringWindow = 365 * 24 * time.Hour
+
+// SetExpiration задаёт срок жизни записи, nil снимает его. После этого момента запись перестаёт
+// быть видна и удаляется фоновой задачей вместе с вложениями
+func (uds *UserDataService) SetExpiration(
+	ctx context.Context,
+	userID uuid.UUID,
+	dataKind models.DataKind,
+	dataID uuid.UUID,
+	expiresAt *time.Time,
+) (*models.BaseUserData, error) {
+	now := time.Now()
+	if expiresAt != nil && !expiresAt.After(now) {
+		return nil, httperror.New(nil, "expires_at must be in the future", http.StatusUnprocessableEntity)
+	}
+	record, err := uds.store.SetUserDataExpiration(ctx, dataKind, dataID, userID, expiresAt, now)
+	if err != nil {
+		return nil, err
+	}
+	auditEvent := dataEvent(ctx, models.AuditActionUpdate, record.UserID, dataKind, record.ID, models.Metadata{"expires_at": record.ExpiresAt})
+	auditEvent.CollectionID = record.CollectionID
+	uds.audit.recordEventChange(ctx, auditEvent)
+	return record, nil
+}
+
+// GetExpiring возвращает записи, срок жизни которых истекает в ближайшие within
+func (uds *UserDataService) GetExpiring(ctx context.Context, userID uuid.UUID, within time.Duration) ([]models.ExpiringRecord, error) {
+	if within <= 0 || within > MaxExpiringWindow {
+		return nil, httperror.New(nil, "Window must be positive and at most 365 days", http.StatusBadRequest)
+	}
+	now := time.Now()
+	return uds.store.GetExpiringUserData(ctx, userID, now, now.Add(within))
+}
+
+// DeleteExpired удаляет истёкшие записи всех видов вместе с вложениями и освобождает содержимое файлов
+func (uds *UserDataService) DeleteExpired(ctx context.Context) (int, error) {
+	now := time.Now()
+	deleted := 0
+	for _, dataKind := range []models.DataKind{models.KindAuthInfo, models.KindTextData, models.KindBankCard, models.KindFileData} {
+		for {
+			// Записи удаляются вместе с событиями аудита и ссылками на содержимое
+			records, err := withTx(ctx, uds.store, func(ctx context.Context) ([]models.BaseUserData, error) {
+				records, blobKeys, err := uds.store.DeleteExpiredUserData(ctx, dataKind, now, expiredBatchSize)
+				if err != nil {
+					return nil, err
+				}
+				auditEvents := make([]models.AuditEvent, len(records))
+				for i, record := range records {
+					auditEvents[i] = dataEvent(ctx, models.AuditActionDelete, record.UserID, dataKind, record.ID, models.Metadata{"reason": "expired"})
+					auditEvents[i].CollectionID = record.CollectionID
+				}
+				uds.audit.recordEventChange(ctx, auditEvents...)
+				for _, blobKey := range blobKeys {
+					if err := uds.contents.Release(ctx, blobKey); err != nil {
+						return nil, err
+					}
+				}
+				return records, nil
+			})
+			if err != nil {
+				return deleted, err
+			}
+			deleted += len(records)
+			if len(records) < expiredBatchSize {
+				break
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// RunExpirationSweep периодически удаляет истёкшие записи до отмены контекста
+func (uds *UserDataService) RunExpirationSweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := uds.DeleteExpired(ctx)
+			if err != nil {
+				log.Printf("delete expired records: %s\n", err)
+			}
+			if deleted > 0 {
+				log.Printf("deleted %d expired records\n", deleted)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/internal/blobstore"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expirationTestStore хранит срок жизни только у файлов, остальные виды записей пусты
+type expirationTestStore struct {
+	*fileDataStore
+}
+
+func (s *expirationTestStore) SetUserDataExpiration(ctx context.Context, dataKind models.DataKind, dataID uuid.UUID, userID uuid.UUID, expiresAt *time.Time, now time.Time) (*models.BaseUserData, error) {
+	for i := range s.files {
+		record := &s.files[i].BaseUserData
+		if dataKind == models.KindFileData && record.ID == dataID && record.UserID == userID && !record.Expired(now) {
+			record.ExpiresAt = expiresAt
+			record.UpdatedAt = now
+			base := *record
+			return &base, nil
+		}
+	}
+	return nil, httperror.New(nil, "Record not found", http.StatusNotFound)
+}
+
+func (s *expirationTestStore) DeleteExpiredUserData(ctx context.Context, dataKind models.DataKind, now time.Time, limit int) ([]models.BaseUserData, []string, error) {
+	if dataKind != models.KindFileData {
+		return nil, nil, nil
+	}
+	var deleted []models.BaseUserData
+	var blobKeys []string
+	kept := s.files[:0]
+	for _, userFileData := range s.files {
+		if len(deleted) < limit && userFileData.Expired(now) {
+			deleted = append(deleted, userFileData.BaseUserData)
+			blobKeys = append(blobKeys, userFileData.BlobKey)
+			continue
+		}
+		kept = append(kept, userFileData)
+	}
+	s.files = kept
+	return deleted, blobKeys, nil
+}
+
+func TestUserDataExpiration(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	refs := &memoryFileBlobStore{refs: make(map[string]int)}
+	contents := NewFileContentStore(blobstore.NewLocalStore(t.TempDir()), refs)
+	store := &expirationTestStore{fileDataStore: &fileDataStore{}}
+	auditStore := &auditTestStore{}
+	userData := NewUserDataService(store, contents, NewQuotaService(nil, Quotas{}), NewAuditService(auditStore))
+
+	for _, name := range []string{"kept", "expiring"} {
+		userFileData, err := models.NewUserFileData(name, userID, models.Metadata{}, ".txt", name+".txt")
+		require.NoError(t, err)
+		stored, err := contents.Save(ctx, strings.NewReader(name+" content"))
+		require.NoError(t, err)
+		stored.apply(&userFileData)
+		store.files = append(store.files, userFileData)
+	}
+	expiring := store.files[1]
+
+	t.Run("PastMoment", func(t *testing.T) {
+		past := time.Now().Add(-time.Minute)
+		_, err := userData.SetExpiration(ctx, userID, models.KindFileData, expiring.ID, &past)
+		_, statusCode := httperror.GetMessageAndStatusCode(err)
+		assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	})
+
+	t.Run("Window", func(t *testing.T) {
+		for _, within := range []time.Duration{0, -time.Hour, MaxExpiringWindow + time.Hour} {
+			_, err := userData.GetExpiring(ctx, userID, within)
+			_, statusCode := httperror.GetMessageAndStatusCode(err)
+			assert.Equal(t, http.StatusBadRequest, statusCode)
+		}
+	})
+
+	t.Run("SetAndSweep", func(t *testing.T) {
+		expiresAt := time.Now().Add(50 * time.Millisecond)
+		record, err := userData.SetExpiration(ctx, userID, models.KindFileData, expiring.ID, &expiresAt)
+		require.NoError(t, err)
+		require.NotNil(t, record.ExpiresAt)
+		assert.Equal(t, models.AuditActionUpdate, auditStore.last(t).Action)
+
+		deleted, err := userData.DeleteExpired(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, deleted)
+
+		time.Sleep(60 * time.Millisecond)
+		deleted, err = userData.DeleteExpired(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+		require.Len(t, store.files, 1)
+		assert.Equal(t, "kept", store.files[0].Name)
+		assert.NotContains(t, refs.refs, expiring.BlobKey)
+
+		auditEvent := auditStore.last(t)
+		assert.Equal(t, models.AuditActionDelete, auditEvent.Action)
+		assert.Equal(t, "expired", auditEvent.Details["reason"])
+	})
+
+	t.Run("ClearOnMissingRecord", func(t *testing.T) {
+		_, err := userData.SetExpiration(ctx, userID, models.KindFileData, expiring.ID, nil)
+		_, statusCode := httperror.GetMessageAndStatusCode(err)
+		assert.Equal(t, http.StatusNotFound, statusCode)
+	})
+}
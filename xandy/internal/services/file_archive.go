@@ -0,0 +1,228 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/eac0de/xandy/internal/blobstore"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+type ArchiveFormat string
+
+const (
+	ArchiveFormatZip   ArchiveFormat = "zip"
+	ArchiveFormatTarGz ArchiveFormat = "tar.gz"
+)
+
+// Сколько файлов можно запросить по идентификаторам за один раз
+const maxArchiveIDs = 1000
+
+// FileArchiveService собирает несколько файлов пользователя в один архив.
+// Архив пишется сразу в ответ, без промежуточных файлов.
+type FileArchiveService struct {
+	store    IUserDataStore
+	contents *FileContentStore
+	// Ограничение на суммарный размер файлов в архиве
+	maxSize int64
+	audit   *AuditService
+}
+
+func NewFileArchiveService(userDataStore IUserDataStore, contents *FileContentStore, maxSize int64, audit *AuditService) *FileArchiveService {
+	return &FileArchiveService{
+		store:    userDataStore,
+		contents: contents,
+		maxSize:  maxSize,
+		audit:    audit,
+	}
+}
+
+type archiveEntry struct {
+	userFileData models.UserFileData
+	name         string
+	size         int64
+}
+
+// Export пишет в w архив с файлами ids, а если ids пусты - с файлами, подходящими под filter.
+// Все проверки выполняются до начала записи, чтобы ошибку можно было вернуть обычным ответом.
+func (fas *FileArchiveService) Export(
+	ctx context.Context,
+	userID uuid.UUID,
+	ids []uuid.UUID,
+	filter models.FileDataFilter,
+	format ArchiveFormat,
+	w io.Writer,
+) error {
+	if format != ArchiveFormatZip && format != ArchiveFormatTarGz {
+		return httperror.New(nil, fmt.Sprintf("Unknown archive format %q", format), http.StatusBadRequest)
+	}
+	userFileDataList, err := fas.selectFiles(ctx, userID, ids, filter)
+	if err != nil {
+		return err
+	}
+	if len(userFileDataList) == 0 {
+		return httperror.New(nil, "No files selected", http.StatusUnprocessableEntity)
+	}
+
+	entries := make([]archiveEntry, 0, len(userFileDataList))
+	names := make(map[string]bool, len(userFileDataList))
+	var total int64
+	for _, userFileData := range userFileDataList {
+		if err := checkScanStatus(&userFileData); err != nil {
+			return err
+		}
+		info, err := fas.contents.Stat(ctx, userFileData.BlobKey)
+		if err != nil {
+			if errors.Is(err, blobstore.ErrNotFound) {
+				return httperror.New(err, fmt.Sprintf("Content of file %s not found", userFileData.ID), http.StatusNotFound)
+			}
+			return err
+		}
+		total += info.Size
+		if total > fas.maxSize {
+			return httperror.New(nil, fmt.Sprintf("Archive exceeds the size limit of %d bytes", fas.maxSize), http.StatusRequestEntityTooLarge)
+		}
+		entries = append(entries, archiveEntry{
+			userFileData: userFileData,
+			name:         uniqueArchiveName(names, userFileData.Name, userFileData.Ext),
+			size:         info.Size,
+		})
+	}
+	if err := fas.audit.Record(ctx, models.AuditActionDownload, models.KindFileData, baseRecords(userFileDataList)...); err != nil {
+		return err
+	}
+
+	if format == ArchiveFormatZip {
+		return fas.writeZip(ctx, entries, w)
+	}
+	return fas.writeTarGz(ctx, entries, w)
+}
+
+func (fas *FileArchiveService) selectFiles(ctx context.Context, userID uuid.UUID, ids []uuid.UUID, filter models.FileDataFilter) ([]models.UserFileData, error) {
+	if len(ids) == 0 {
+		return listAll(ctx, userID, func(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserFileData, error) {
+			return fas.store.GetUserFileDataList(ctx, userID, filter, offset)
+		})
+	}
+	if len(ids) > maxArchiveIDs {
+		return nil, httperror.New(nil, fmt.Sprintf("At most %d files can be archived at once", maxArchiveIDs), http.StatusBadRequest)
+	}
+	userFileDataList := make([]models.UserFileData, 0, len(ids))
+	seen := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		userFileData, err := fas.store.GetUserFileData(ctx, id, userID)
+		if err != nil {
+			return nil, err
+		}
+		userFileDataList = append(userFileDataList, *userFileData)
+	}
+	return userFileDataList, nil
+}
+
+// uniqueArchiveName добавляет к имени счётчик, если такое имя в архиве уже есть: name (1).ext.
+// Регистр не учитывается, чтобы архив распаковывался и на нечувствительных к нему файловых системах.
+func uniqueArchiveName(names map[string]bool, name, ext string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		name = "file"
+	}
+	candidate := name + ext
+	for count := 1; names[strings.ToLower(candidate)]; count++ {
+		candidate = fmt.Sprintf("%s (%d)%s", name, count, ext)
+	}
+	names[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+func (fas *FileArchiveService) copyContent(ctx context.Context, entry archiveEntry, w io.Writer) error {
+	content, _, err := fas.contents.Open(ctx, entry.userFileData.BlobKey)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	written, err := io.Copy(w, content)
+	if err != nil {
+		return err
+	}
+	if written != entry.size {
+		return fmt.Errorf("file %s: expected %d bytes, got %d", entry.userFileData.ID, entry.size, written)
+	}
+	return nil
+}
+
+func (fas *FileArchiveService) writeZip(ctx context.Context, entries []archiveEntry, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	for _, entry := range entries {
+		method := zip.Deflate
+		// Уже сжатые форматы повторно не сжимаем
+		if isCompressedMimeType(entry.userFileData.MimeType) {
+			method = zip.Store
+		}
+		fileWriter, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     entry.name,
+			Method:   method,
+			Modified: entry.userFileData.UpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if err := fas.copyContent(ctx, entry, fileWriter); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func (fas *FileArchiveService) writeTarGz(ctx context.Context, entries []archiveEntry, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	for _, entry := range entries {
+		err := archive.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     entry.name,
+			Size:     entry.size,
+			Mode:     0o644,
+			ModTime:  entry.userFileData.UpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if err := fas.copyContent(ctx, entry, archive); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func isCompressedMimeType(mimeType string) bool {
+	mediaType, _, _ := strings.Cut(mimeType, ";")
+	switch {
+	case strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml" && mediaType != "image/bmp":
+		return true
+	case strings.HasPrefix(mediaType, "video/"), strings.HasPrefix(mediaType, "audio/"):
+		return true
+	}
+	switch mediaType {
+	case "application/zip", "application/gzip", "application/x-7z-compressed", "application/x-rar-compressed",
+		"application/x-xz", "application/x-bzip2", "application/zstd":
+		return true
+	}
+	return false
+}
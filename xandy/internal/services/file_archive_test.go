@@ -0,0 +1,154 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/eac0de/xandy/internal/blobstore"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fileDataStore хранит только записи UserFileData, остальные методы IUserDataStore не нужны
+type fileDataStore struct {
+	IUserDataStore
+	files []models.UserFileData
+}
+
+// WithTx выполняет fn без транзакции, в памяти откатывать нечего
+func (s *fileDataStore) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (s *fileDataStore) LockUserData(ctx context.Context, dataKind models.DataKind, dataID uuid.UUID) error {
+	return nil
+}
+
+func (s *fileDataStore) GetUserFileData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserFileData, error) {
+	for _, userFileData := range s.files {
+		if userFileData.ID == dataID && userFileData.UserID == userID {
+			return &userFileData, nil
+		}
+	}
+	return nil, httperror.New(nil, "UserFileData not found", http.StatusNotFound)
+}
+
+func (s *fileDataStore) GetUserFileDataList(ctx context.Context, userID uuid.UUID, filter models.FileDataFilter, offset int) ([]models.UserFileData, error) {
+	var list []models.UserFileData
+	for _, userFileData := range s.files {
+		if userFileData.UserID == userID && strings.HasPrefix(userFileData.MimeType, filter.MimeType) {
+			list = append(list, userFileData)
+		}
+	}
+	if offset >= len(list) {
+		return nil, nil
+	}
+	return list[offset:], nil
+}
+
+func newArchiveTestService(t *testing.T, userID uuid.UUID, maxSize int64) (*FileArchiveService, *fileDataStore) {
+	ctx := context.Background()
+	contents := NewFileContentStore(blobstore.NewLocalStore(t.TempDir()), &memoryFileBlobStore{refs: make(map[string]int)})
+	store := &fileDataStore{}
+	for _, file := range []struct{ name, ext, content string }{
+		{"report", ".txt", "first report"},
+		{"Report", ".txt", "second report"},
+		{"photo", ".png", "\x89PNG\r\n\x1a\n"},
+	} {
+		userFileData, err := models.NewUserFileData(file.name, userID, models.Metadata{}, file.ext, file.name+file.ext)
+		require.NoError(t, err)
+		stored, err := contents.Save(ctx, strings.NewReader(file.content))
+		require.NoError(t, err)
+		stored.apply(&userFileData)
+		userFileData.ScanStatus = models.ScanStatusClean
+		store.files = append(store.files, userFileData)
+	}
+	return NewFileArchiveService(store, contents, maxSize, nil), store
+}
+
+func TestFileArchiveServiceZip(t *testing.T) {
+	userID := uuid.New()
+	service, store := newArchiveTestService(t, userID, 1024)
+
+	var buf bytes.Buffer
+	ids := []uuid.UUID{store.files[0].ID, store.files[1].ID, store.files[0].ID}
+	require.NoError(t, service.Export(context.Background(), userID, ids, models.FileDataFilter{}, ArchiveFormatZip, &buf))
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, archive.File, 2)
+	assert.Equal(t, "report.txt", archive.File[0].Name)
+	assert.Equal(t, "Report (1).txt", archive.File[1].Name)
+	file, err := archive.File[1].Open()
+	require.NoError(t, err)
+	content, _ := io.ReadAll(file)
+	assert.Equal(t, "second report", string(content))
+}
+
+func TestFileArchiveServiceTarGzFilter(t *testing.T) {
+	userID := uuid.New()
+	service, _ := newArchiveTestService(t, userID, 1024)
+
+	var buf bytes.Buffer
+	filter := models.FileDataFilter{MimeType: "image/"}
+	require.NoError(t, service.Export(context.Background(), userID, nil, filter, ArchiveFormatTarGz, &buf))
+
+	gz, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	archive := tar.NewReader(gz)
+	header, err := archive.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "photo.png", header.Name)
+	assert.Equal(t, int64(8), header.Size)
+	_, err = archive.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestFileArchiveServiceErrors(t *testing.T) {
+	userID := uuid.New()
+	service, store := newArchiveTestService(t, userID, 20)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	err := service.Export(ctx, userID, nil, models.FileDataFilter{}, ArchiveFormatZip, &buf)
+	_, statusCode := httperror.GetMessageAndStatusCode(err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, statusCode)
+
+	err = service.Export(ctx, userID, nil, models.FileDataFilter{MimeType: "video/"}, ArchiveFormatZip, &buf)
+	_, statusCode = httperror.GetMessageAndStatusCode(err)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+
+	err = service.Export(ctx, userID, []uuid.UUID{store.files[0].ID}, models.FileDataFilter{}, "rar", &buf)
+	_, statusCode = httperror.GetMessageAndStatusCode(err)
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+
+	err = service.Export(ctx, uuid.New(), []uuid.UUID{store.files[0].ID}, models.FileDataFilter{}, ArchiveFormatZip, &buf)
+	_, statusCode = httperror.GetMessageAndStatusCode(err)
+	assert.Equal(t, http.StatusNotFound, statusCode)
+
+	// Файл, который ещё не проверен на вирусы, не попадает в архив
+	store.files[1].ScanStatus = models.ScanStatusPending
+	err = service.Export(ctx, userID, []uuid.UUID{store.files[0].ID, store.files[1].ID}, models.FileDataFilter{}, ArchiveFormatZip, &buf)
+	_, statusCode = httperror.GetMessageAndStatusCode(err)
+	assert.Equal(t, http.StatusLocked, statusCode)
+	assert.Zero(t, buf.Len())
+}
+
+func TestUniqueArchiveName(t *testing.T) {
+	names := make(map[string]bool)
+	assert.Equal(t, "a.txt", uniqueArchiveName(names, "a", ".txt"))
+	assert.Equal(t, "A (1).txt", uniqueArchiveName(names, "A", ".txt"))
+	assert.Equal(t, "a (2).txt", uniqueArchiveName(names, "a", ".txt"))
+	assert.Equal(t, ".._x.txt", uniqueArchiveName(names, "../x", ".txt"))
+	assert.Equal(t, "file", uniqueArchiveName(names, "", ""))
+}
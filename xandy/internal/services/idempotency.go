@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+// Наибольшая длина ключа идемпотентности
+const MaxIdempotencyKeyLength = 255
+
+type IIdempotencyStore interface {
+	ClaimIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) (bool, *models.IdempotencyKey, error)
+	CompleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error
+	ReleaseIdempotencyKey(ctx context.Context, userID uuid.UUID, key string, requestHash string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int, error)
+}
+
+// IdempotencyService запоминает ответы на запросы с заголовком Idempotency-Key,
+// чтобы повтор запроса, например после обрыва связи, не создавал запись ещё раз.
+// Ключи уникальны в пределах пользователя и хранятся ttl
+type IdempotencyService struct {
+	store IIdempotencyStore
+	ttl   time.Duration
+}
+
+func NewIdempotencyService(idempotencyStore IIdempotencyStore, ttl time.Duration) *IdempotencyService {
+	return &IdempotencyService{
+		store: idempotencyStore,
+		ttl:   ttl,
+	}
+}
+
+// Begin занимает ключ для запроса с хэшем requestHash. Возвращает nil, если запрос нужно выполнить,
+// или сохранённый ответ, если запрос с этим ключом уже выполнен.
+// Ключ, использованный с другим запросом или занятый выполняющимся запросом, отклоняется
+func (is *IdempotencyService) Begin(ctx context.Context, userID uuid.UUID, key string, requestHash string) (*models.IdempotencyKey, error) {
+	if key == "" || len(key) > MaxIdempotencyKeyLength {
+		return nil, httperror.New(nil, "Idempotency-Key must be 1 to 255 characters long", http.StatusBadRequest)
+	}
+	now := time.Now()
+	claimed, existing, err := is.store.ClaimIdempotencyKey(ctx, &models.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(is.ttl),
+	})
+	if err != nil {
+		if httperror.IsNotFound(err) {
+			// Ключ освободили между попыткой занять его и чтением
+			return nil, httperror.New(err, "A request with this Idempotency-Key is in progress", http.StatusConflict)
+		}
+		return nil, err
+	}
+	if claimed {
+		return nil, nil
+	}
+	if existing.RequestHash != requestHash {
+		return nil, httperror.New(nil, "Idempotency-Key was already used with a different request", http.StatusUnprocessableEntity)
+	}
+	if !existing.Completed() {
+		return nil, httperror.New(nil, "A request with this Idempotency-Key is in progress", http.StatusConflict)
+	}
+	return existing, nil
+}
+
+// Complete сохраняет ответ на запрос, занявший ключ. После ошибки сервера или ошибки сохранения
+// ключ освобождается, чтобы запрос можно было повторить
+func (is *IdempotencyService) Complete(ctx context.Context, userID uuid.UUID, key string, requestHash string, statusCode int, contentType string, body []byte) error {
+	if statusCode >= http.StatusInternalServerError {
+		return is.store.ReleaseIdempotencyKey(ctx, userID, key, requestHash)
+	}
+	err := is.store.CompleteIdempotencyKey(ctx, &models.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		StatusCode:  statusCode,
+		ContentType: contentType,
+		Body:        body,
+	})
+	if err != nil {
+		// Незавершённый ключ отклонял бы повторы с 409 до истечения срока
+		if releaseErr := is.store.ReleaseIdempotencyKey(ctx, userID, key, requestHash); releaseErr != nil {
+			log.Printf("release idempotency key: %s\n", releaseErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Release освобождает ключ запроса, который не дошёл до Complete, например из-за паники обработчика
+func (is *IdempotencyService) Release(ctx context.Context, userID uuid.UUID, key string, requestHash string) error {
+	return is.store.ReleaseIdempotencyKey(ctx, userID, key, requestHash)
+}
+
+// RunCleanup периодически удаляет ключи с истёкшим сроком до отмены контекста
+func (is *IdempotencyService) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := is.store.DeleteExpiredIdempotencyKeys(ctx, time.Now())
+			if err != nil {
+				log.Printf("delete expired idempotency keys: %s\n", err)
+			}
+			if deleted > 0 {
+				log.Printf("deleted %d expired idempotency keys\n", deleted)
+			}
+		}
+	}
+}
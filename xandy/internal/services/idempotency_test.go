@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type idempotencyKeyID struct {
+	userID uuid.UUID
+	key    string
+}
+
+type idempotencyTestStore struct {
+	keys        map[idempotencyKeyID]models.IdempotencyKey
+	completeErr error
+}
+
+func (s *idempotencyTestStore) ClaimIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) (bool, *models.IdempotencyKey, error) {
+	id := idempotencyKeyID{key.UserID, key.Key}
+	existing, ok := s.keys[id]
+	if ok && existing.ExpiresAt.After(key.CreatedAt) {
+		return false, &existing, nil
+	}
+	s.keys[id] = *key
+	return true, nil, nil
+}
+
+func (s *idempotencyTestStore) CompleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	if s.completeErr != nil {
+		return s.completeErr
+	}
+	id := idempotencyKeyID{key.UserID, key.Key}
+	existing := s.keys[id]
+	existing.StatusCode = key.StatusCode
+	existing.ContentType = key.ContentType
+	existing.Body = key.Body
+	s.keys[id] = existing
+	return nil
+}
+
+func (s *idempotencyTestStore) ReleaseIdempotencyKey(ctx context.Context, userID uuid.UUID, key string, requestHash string) error {
+	delete(s.keys, idempotencyKeyID{userID, key})
+	return nil
+}
+
+func (s *idempotencyTestStore) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int, error) {
+	deleted := 0
+	for id, key := range s.keys {
+		if !key.ExpiresAt.After(now) {
+			delete(s.keys, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func TestIdempotencyService(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	store := &idempotencyTestStore{keys: make(map[idempotencyKeyID]models.IdempotencyKey)}
+	service := NewIdempotencyService(store, time.Hour)
+
+	statusCode := func(err error) int {
+		_, statusCode := httperror.GetMessageAndStatusCode(err)
+		return statusCode
+	}
+
+	t.Run("InvalidKey", func(t *testing.T) {
+		_, err := service.Begin(ctx, userID, string(make([]byte, MaxIdempotencyKeyLength+1)), "hash")
+		assert.Equal(t, http.StatusBadRequest, statusCode(err))
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		stored, err := service.Begin(ctx, userID, "create-1", "hash")
+		require.NoError(t, err)
+		assert.Nil(t, stored)
+
+		// Пока первый запрос выполняется, повтор отклоняется
+		_, err = service.Begin(ctx, userID, "create-1", "hash")
+		assert.Equal(t, http.StatusConflict, statusCode(err))
+
+		require.NoError(t, service.Complete(ctx, userID, "create-1", "hash", http.StatusCreated, "application/json", []byte(`{"id":"1"}`)))
+		stored, err = service.Begin(ctx, userID, "create-1", "hash")
+		require.NoError(t, err)
+		require.NotNil(t, stored)
+		assert.Equal(t, http.StatusCreated, stored.StatusCode)
+		assert.Equal(t, `{"id":"1"}`, string(stored.Body))
+
+		_, err = service.Begin(ctx, userID, "create-1", "other-hash")
+		assert.Equal(t, http.StatusUnprocessableEntity, statusCode(err))
+
+		// Ключи разных пользователей не пересекаются
+		stored, err = service.Begin(ctx, uuid.New(), "create-1", "other-hash")
+		require.NoError(t, err)
+		assert.Nil(t, stored)
+	})
+
+	t.Run("ServerErrorReleasesKey", func(t *testing.T) {
+		_, err := service.Begin(ctx, userID, "create-2", "hash")
+		require.NoError(t, err)
+		require.NoError(t, service.Complete(ctx, userID, "create-2", "hash", http.StatusInternalServerError, "application/json", nil))
+		stored, err := service.Begin(ctx, userID, "create-2", "hash")
+		require.NoError(t, err)
+		assert.Nil(t, stored)
+	})
+
+	t.Run("CompleteErrorReleasesKey", func(t *testing.T) {
+		_, err := service.Begin(ctx, userID, "create-3", "hash")
+		require.NoError(t, err)
+		store.completeErr = errors.New("connection reset")
+		defer func() { store.completeErr = nil }()
+		assert.Error(t, service.Complete(ctx, userID, "create-3", "hash", http.StatusCreated, "application/json", nil))
+		stored, err := service.Begin(ctx, userID, "create-3", "hash")
+		require.NoError(t, err)
+		assert.Nil(t, stored)
+	})
+
+	t.Run("Expiration", func(t *testing.T) {
+		id := idempotencyKeyID{userID, "create-1"}
+		expired := store.keys[id]
+		expired.ExpiresAt = time.Now().Add(-time.Minute)
+		store.keys[id] = expired
+
+		// Истёкший ключ можно использовать заново, в том числе с другим запросом
+		stored, err := service.Begin(ctx, userID, "create-1", "other-hash")
+		require.NoError(t, err)
+		assert.Nil(t, stored)
+
+		store.keys[id] = expired
+		deleted, err := store.DeleteExpiredIdempotencyKeys(ctx, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+	})
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/eac0de/xandy/internal/importers"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+// Статусы записей в отчёте об импорте
+const (
+	ImportStatusCreated   = "created"
+	ImportStatusReady     = "ready"
+	ImportStatusDuplicate = "duplicate"
+	ImportStatusError     = "error"
+)
+
+type ImportItemResult struct {
+	Index  int             `json:"index"`
+	Kind   models.DataKind `json:"kind"`
+	Name   string          `json:"name"`
+	Status string          `json:"status"`
+	ID     *uuid.UUID      `json:"id,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type ImportReport struct {
+	Format     importers.Format   `json:"format"`
+	DryRun     bool               `json:"dry_run"`
+	Total      int                `json:"total"`
+	Created    int                `json:"created"`
+	Ready      int                `json:"ready"`
+	Duplicates int                `json:"duplicates"`
+	Failed     int                `json:"failed"`
+	Items      []ImportItemResult `json:"items"`
+}
+
+func (r *ImportReport) add(result ImportItemResult) {
+	switch result.Status {
+	case ImportStatusCreated:
+		r.Created++
+	case ImportStatusReady:
+		r.Ready++
+	case ImportStatusDuplicate:
+		r.Duplicates++
+	case ImportStatusError:
+		r.Failed++
+	}
+	r.Items = append(r.Items, result)
+}
+
+type ImportService struct {
+	store    IUserDataStore
+	contents *FileContentStore
+	quotas   *QuotaService
+	audit    *AuditService
+}
+
+func NewImportService(userDataStore IUserDataStore, contents *FileContentStore, quotas *QuotaService, audit *AuditService) *ImportService {
+	return &ImportService{
+		store:    userDataStore,
+		contents: contents,
+		quotas:   quotas,
+		audit:    audit,
+	}
+}
+
+// Import разбирает экспорт стороннего менеджера паролей и создаёт записи пользователя.
+// Записи, совпадающие с уже существующими или с ранее импортированными из этого же файла, пропускаются.
+// При dryRun ничего не сохраняется, отчёт показывает, что было бы создано.
+func (is *ImportService) Import(
+	ctx context.Context,
+	userID uuid.UUID,
+	format importers.Format,
+	data []byte,
+	password string,
+	dryRun bool,
+) (*ImportReport, error) {
+	items, err := importers.Parse(format, data, password)
+	if err != nil {
+		return nil, err
+	}
+	seen, err := is.existingKeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{Format: format, DryRun: dryRun, Total: len(items), Items: make([]ImportItemResult, 0, len(items))}
+	for i, item := range items {
+		result := ImportItemResult{Index: i, Kind: item.Kind, Name: item.Name}
+		if item.Err != nil {
+			result.Status = ImportStatusError
+			result.Error = item.Err.Error()
+			report.add(result)
+			continue
+		}
+		key := importKey(item)
+		if seen[key] {
+			result.Status = ImportStatusDuplicate
+			report.add(result)
+			continue
+		}
+		id, err := is.importItem(ctx, userID, item, dryRun)
+		if err != nil {
+			result.Status = ImportStatusError
+			result.Error, _ = httperror.GetMessageAndStatusCode(err)
+			result.Error = strings.TrimSpace(result.Error)
+			report.add(result)
+			continue
+		}
+		seen[key] = true
+		if dryRun {
+			result.Status = ImportStatusReady
+		} else {
+			result.Status = ImportStatusCreated
+			result.ID = &id
+		}
+		report.add(result)
+	}
+	return report, nil
+}
+
+func (is *ImportService) importItem(ctx context.Context, userID uuid.UUID, item importers.Item, dryRun bool) (uuid.UUID, error) {
+	// Предварительная проверка, чтобы не сохранять содержимое зря, окончательная - в insert
+	if !dryRun {
+		if err := is.quotas.CheckRecord(ctx, userID, item.Kind); err != nil {
+			return uuid.Nil, err
+		}
+	}
+	switch item.Kind {
+	case models.KindAuthInfo:
+		userAuthInfo, err := models.NewUserAuthInfo(item.Name, userID, item.Metadata, item.Login, item.Password)
+		if err != nil || dryRun {
+			return userAuthInfo.ID, err
+		}
+		err = is.insert(ctx, userID, item.Kind, 0, func(ctx context.Context) error { return is.store.InsertUserAuthInfo(ctx, &userAuthInfo) })
+		if err != nil {
+			return uuid.Nil, err
+		}
+		is.audit.recordChange(ctx, models.AuditActionImport, item.Kind, &userAuthInfo.BaseUserData)
+		return userAuthInfo.ID, nil
+	case models.KindTextData:
+		userTextData, err := models.NewUserTextData(item.Name, userID, item.Metadata, item.Text)
+		if err != nil || dryRun {
+			return userTextData.ID, err
+		}
+		err = is.insert(ctx, userID, item.Kind, 0, func(ctx context.Context) error { return is.store.InsertUserTextData(ctx, &userTextData) })
+		if err != nil {
+			return uuid.Nil, err
+		}
+		is.audit.recordChange(ctx, models.AuditActionImport, item.Kind, &userTextData.BaseUserData)
+		return userTextData.ID, nil
+	case models.KindBankCard:
+		userBankCard, err := models.NewUserBankCard(item.Name, userID, item.Metadata, item.Number, item.CardHolder, item.ExpireDate, item.CSC)
+		if err != nil || dryRun {
+			return userBankCard.ID, err
+		}
+		err = is.insert(ctx, userID, item.Kind, 0, func(ctx context.Context) error { return is.store.InsertUserBankCard(ctx, &userBankCard) })
+		if err != nil {
+			return uuid.Nil, err
+		}
+		is.audit.recordChange(ctx, models.AuditActionImport, item.Kind, &userBankCard.BaseUserData)
+		return userBankCard.ID, nil
+	case models.KindFileData:
+		if item.FileName == "" {
+			return uuid.Nil, httperror.New(nil, "File name is required", http.StatusUnprocessableEntity)
+		}
+		name, ext := splitFileName(item.FileName)
+		userFileData, err := models.NewUserFileData(name, userID, item.Metadata, ext, name+ext)
+		if err != nil || dryRun {
+			return userFileData.ID, err
+		}
+		content, release, err := is.quotas.LimitFile(ctx, userID, bytes.NewReader(item.FileData), 0)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		defer release()
+		stored, err := is.contents.Save(ctx, content)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		stored.apply(&userFileData)
+		err = is.insert(ctx, userID, item.Kind, userFileData.Size, func(ctx context.Context) error { return is.store.InsertUserFileData(ctx, &userFileData) })
+		if err != nil {
+			is.contents.Release(context.WithoutCancel(ctx), stored.Key)
+			return uuid.Nil, err
+		}
+		is.audit.recordChange(ctx, models.AuditActionImport, item.Kind, &userFileData.BaseUserData)
+		return userFileData.ID, nil
+	default:
+		return uuid.Nil, fmt.Errorf("unknown data kind %q", item.Kind)
+	}
+}
+
+// insert создаёт запись в одной транзакции с окончательной проверкой квот, size - размер файла
+func (is *ImportService) insert(ctx context.Context, userID uuid.UUID, kind models.DataKind, size int64, insert func(ctx context.Context) error) error {
+	return is.store.WithTx(ctx, func(ctx context.Context) error {
+		if err := is.quotas.CheckRecord(ctx, userID, kind); err != nil {
+			return err
+		}
+		if kind == models.KindFileData {
+			if err := is.quotas.CheckStorage(ctx, userID, size, 0); err != nil {
+				return err
+			}
+		}
+		return insert(ctx)
+	})
+}
+
+// existingKeys собирает ключи дубликатов для всех записей пользователя
+func (is *ImportService) existingKeys(ctx context.Context, userID uuid.UUID) (map[string]bool, error) {
+	keys := make(map[string]bool)
+	authInfoList, err := listAll(ctx, userID, is.store.GetUserAuthInfoList)
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range authInfoList {
+		keys[importKey(importers.Item{Kind: models.KindAuthInfo, Name: data.Name, Login: data.Login})] = true
+	}
+	textDataList, err := listAll(ctx, userID, is.store.GetUserTextDataList)
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range textDataList {
+		keys[importKey(importers.Item{Kind: models.KindTextData, Name: data.Name, Text: data.Data})] = true
+	}
+	bankCardList, err := listAll(ctx, userID, is.store.GetUserBankCardList)
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range bankCardList {
+		keys[importKey(importers.Item{Kind: models.KindBankCard, Number: data.Number})] = true
+	}
+	fileDataList, err := listAll(ctx, userID, allUserFileData(is.store))
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range fileDataList {
+		keys[importKey(importers.Item{Kind: models.KindFileData, FileName: data.Name + data.Ext})] = true
+	}
+	return keys, nil
+}
+
+// importKey возвращает ключ, по которому запись считается дубликатом
+func importKey(item importers.Item) string {
+	switch item.Kind {
+	case models.KindAuthInfo:
+		return fmt.Sprintf("%s\x00%s\x00%s", item.Kind, strings.ToLower(item.Name), item.Login)
+	case models.KindTextData:
+		return fmt.Sprintf("%s\x00%s\x00%s", item.Kind, strings.ToLower(item.Name), item.Text)
+	case models.KindBankCard:
+		return fmt.Sprintf("%s\x00%s", item.Kind, strings.ReplaceAll(item.Number, " ", ""))
+	default:
+		return fmt.Sprintf("%s\x00%s", item.Kind, item.FileName)
+	}
+}
@@ -0,0 +1,39 @@
+package services
+
+import "sync"
+
+// keyedMutex выдаёт отдельную блокировку на каждый ключ.
+// Блокировка удаляется из карты, когда её больше никто не ждёт.
+type keyedMutex[K comparable] struct {
+	mu    sync.Mutex
+	locks map[K]*refMutex
+}
+
+type refMutex struct {
+	sync.Mutex
+	refs int
+}
+
+func (km *keyedMutex[K]) lock(key K) func() {
+	km.mu.Lock()
+	if km.locks == nil {
+		km.locks = make(map[K]*refMutex)
+	}
+	l, ok := km.locks[key]
+	if !ok {
+		l = &refMutex{}
+		km.locks[key] = l
+	}
+	l.refs++
+	km.mu.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		km.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(km.locks, key)
+		}
+		km.mu.Unlock()
+	}
+}
@@ -0,0 +1,365 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+type IOrganizationStore interface {
+	InsertOrganization(ctx context.Context, organization *models.Organization, owner *models.OrganizationMember) error
+	GetOrganization(ctx context.Context, organizationID uuid.UUID, userID uuid.UUID) (*models.Organization, error)
+	GetUserOrganizations(ctx context.Context, userID uuid.UUID) ([]models.Organization, error)
+	UpdateOrganization(ctx context.Context, organization *models.Organization) error
+	DeleteOrganization(ctx context.Context, organizationID uuid.UUID) error
+
+	InsertOrganizationMember(ctx context.Context, member *models.OrganizationMember) error
+	GetOrganizationMember(ctx context.Context, organizationID uuid.UUID, userID uuid.UUID) (*models.OrganizationMember, error)
+	GetOrganizationMembers(ctx context.Context, organizationID uuid.UUID) ([]models.OrganizationMember, error)
+	UpdateOrganizationMember(ctx context.Context, member *models.OrganizationMember) error
+	DeleteOrganizationMember(ctx context.Context, organizationID uuid.UUID, userID uuid.UUID) error
+
+	InsertCollection(ctx context.Context, collection *models.Collection) error
+	GetCollection(ctx context.Context, organizationID uuid.UUID, collectionID uuid.UUID) (*models.Collection, error)
+	GetUserCollections(ctx context.Context, organizationID uuid.UUID, userID uuid.UUID) ([]models.Collection, error)
+	UpdateCollection(ctx context.Context, collection *models.Collection) error
+	DeleteCollection(ctx context.Context, collectionID uuid.UUID) error
+
+	UpsertCollectionGrant(ctx context.Context, grant *models.CollectionGrant) error
+	GetCollectionGrants(ctx context.Context, collectionID uuid.UUID) ([]models.CollectionGrant, error)
+	DeleteCollectionGrant(ctx context.Context, collectionID uuid.UUID, userID uuid.UUID) error
+
+	MoveRecordToCollection(ctx context.Context, dataKind models.DataKind, dataID uuid.UUID, userID uuid.UUID, collectionID uuid.UUID, updatedAt time.Time) error
+}
+
+// OrganizationService управляет организациями, их участниками и коллекциями.
+// Записи коллекций читаются и меняются через UserDataService: запросы к записям
+// сами проверяют членство и доступы участника.
+type OrganizationService struct {
+	store    IOrganizationStore
+	users    IUserDirectory
+	userData *UserDataService
+}
+
+func NewOrganizationService(organizationStore IOrganizationStore, users IUserDirectory, userData *UserDataService) *OrganizationService {
+	return &OrganizationService{
+		store:    organizationStore,
+		users:    users,
+		userData: userData,
+	}
+}
+
+// CreateOrganization создаёт организацию, пользователь становится её владельцем
+func (orgs *OrganizationService) CreateOrganization(ctx context.Context, userID uuid.UUID, name string) (*models.Organization, error) {
+	organization, err := models.NewOrganization(name)
+	if err != nil {
+		return nil, err
+	}
+	user, err := orgs.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := models.NewOrganizationMember(organization.ID, userID, user.Email, models.OrganizationRoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	if err := orgs.store.InsertOrganization(ctx, &organization, &owner); err != nil {
+		return nil, err
+	}
+	organization.Role = owner.Role
+	return &organization, nil
+}
+
+func (orgs *OrganizationService) GetOrganizations(ctx context.Context, userID uuid.UUID) ([]models.Organization, error) {
+	organizations, err := orgs.store.GetUserOrganizations(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if organizations == nil {
+		organizations = []models.Organization{}
+	}
+	return organizations, nil
+}
+
+func (orgs *OrganizationService) GetOrganization(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID) (*models.Organization, error) {
+	return orgs.store.GetOrganization(ctx, organizationID, userID)
+}
+
+func (orgs *OrganizationService) UpdateOrganization(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, name string) (*models.Organization, error) {
+	organization, err := orgs.requireRole(ctx, userID, organizationID, models.OrganizationRoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	organization.Name = name
+	organization.UpdatedAt = time.Now()
+	if err := models.Validate(organization); err != nil {
+		return nil, err
+	}
+	if err := orgs.store.UpdateOrganization(ctx, organization); err != nil {
+		return nil, err
+	}
+	return organization, nil
+}
+
+// DeleteOrganization удаляет организацию, в которой не осталось коллекций
+func (orgs *OrganizationService) DeleteOrganization(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID) error {
+	if _, err := orgs.requireRole(ctx, userID, organizationID, models.OrganizationRoleOwner); err != nil {
+		return err
+	}
+	return orgs.store.DeleteOrganization(ctx, organizationID)
+}
+
+func (orgs *OrganizationService) GetMembers(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID) ([]models.OrganizationMember, error) {
+	if _, err := orgs.store.GetOrganization(ctx, organizationID, userID); err != nil {
+		return nil, err
+	}
+	members, err := orgs.store.GetOrganizationMembers(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if members == nil {
+		members = []models.OrganizationMember{}
+	}
+	return members, nil
+}
+
+// AddMember добавляет в организацию пользователя с адресом email
+func (orgs *OrganizationService) AddMember(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, email string, role models.OrganizationRole) (*models.OrganizationMember, error) {
+	organization, err := orgs.requireRole(ctx, userID, organizationID, models.OrganizationRoleOwner, models.OrganizationRoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAssignableRole(organization.Role, role); err != nil {
+		return nil, err
+	}
+	user, err := orgs.users.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	member, err := models.NewOrganizationMember(organizationID, user.ID, user.Email, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := orgs.store.InsertOrganizationMember(ctx, &member); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// UpdateMember меняет роль участника. Администратор не может менять роль владельцев
+func (orgs *OrganizationService) UpdateMember(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, memberID uuid.UUID, role models.OrganizationRole) (*models.OrganizationMember, error) {
+	organization, err := orgs.requireRole(ctx, userID, organizationID, models.OrganizationRoleOwner, models.OrganizationRoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	member, err := orgs.store.GetOrganizationMember(ctx, organizationID, memberID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAssignableRole(organization.Role, member.Role); err != nil {
+		return nil, err
+	}
+	if err := checkAssignableRole(organization.Role, role); err != nil {
+		return nil, err
+	}
+	member.Role = role
+	member.UpdatedAt = time.Now()
+	if err := models.Validate(member); err != nil {
+		return nil, err
+	}
+	if err := orgs.store.UpdateOrganizationMember(ctx, member); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// RemoveMember исключает участника из организации, участник может и сам выйти из неё.
+// Доступы исключённого участника удаляются вместе с ним, а его записи в коллекциях остаются у организации
+func (orgs *OrganizationService) RemoveMember(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, memberID uuid.UUID) error {
+	if memberID == userID {
+		if _, err := orgs.store.GetOrganization(ctx, organizationID, userID); err != nil {
+			return err
+		}
+		return orgs.store.DeleteOrganizationMember(ctx, organizationID, memberID)
+	}
+	organization, err := orgs.requireRole(ctx, userID, organizationID, models.OrganizationRoleOwner, models.OrganizationRoleAdmin)
+	if err != nil {
+		return err
+	}
+	member, err := orgs.store.GetOrganizationMember(ctx, organizationID, memberID)
+	if err != nil {
+		return err
+	}
+	if err := checkAssignableRole(organization.Role, member.Role); err != nil {
+		return err
+	}
+	return orgs.store.DeleteOrganizationMember(ctx, organizationID, memberID)
+}
+
+// GetCollections возвращает коллекции организации, доступные пользователю
+func (orgs *OrganizationService) GetCollections(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID) ([]models.Collection, error) {
+	if _, err := orgs.store.GetOrganization(ctx, organizationID, userID); err != nil {
+		return nil, err
+	}
+	collections, err := orgs.store.GetUserCollections(ctx, organizationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if collections == nil {
+		collections = []models.Collection{}
+	}
+	return collections, nil
+}
+
+func (orgs *OrganizationService) CreateCollection(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, name string) (*models.Collection, error) {
+	if _, err := orgs.requireRole(ctx, userID, organizationID, models.OrganizationRoleOwner, models.OrganizationRoleAdmin); err != nil {
+		return nil, err
+	}
+	collection, err := models.NewCollection(organizationID, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := orgs.store.InsertCollection(ctx, &collection); err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+func (orgs *OrganizationService) UpdateCollection(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, collectionID uuid.UUID, name string) (*models.Collection, error) {
+	collection, err := orgs.getManagedCollection(ctx, userID, organizationID, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	collection.Name = name
+	collection.UpdatedAt = time.Now()
+	if err := models.Validate(collection); err != nil {
+		return nil, err
+	}
+	if err := orgs.store.UpdateCollection(ctx, collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+// DeleteCollection удаляет пустую коллекцию вместе с доступами к ней
+func (orgs *OrganizationService) DeleteCollection(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, collectionID uuid.UUID) error {
+	if _, err := orgs.getManagedCollection(ctx, userID, organizationID, collectionID); err != nil {
+		return err
+	}
+	return orgs.store.DeleteCollection(ctx, collectionID)
+}
+
+func (orgs *OrganizationService) GetCollectionGrants(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, collectionID uuid.UUID) ([]models.CollectionGrant, error) {
+	if _, err := orgs.getManagedCollection(ctx, userID, organizationID, collectionID); err != nil {
+		return nil, err
+	}
+	grants, err := orgs.store.GetCollectionGrants(ctx, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	if grants == nil {
+		grants = []models.CollectionGrant{}
+	}
+	return grants, nil
+}
+
+// GrantCollection выдаёт участнику доступ к коллекции, повторный вызов меняет права
+func (orgs *OrganizationService) GrantCollection(
+	ctx context.Context,
+	userID uuid.UUID,
+	organizationID uuid.UUID,
+	collectionID uuid.UUID,
+	memberID uuid.UUID,
+	permission models.CollectionPermission,
+) (*models.CollectionGrant, error) {
+	collection, err := orgs.getManagedCollection(ctx, userID, organizationID, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	member, err := orgs.store.GetOrganizationMember(ctx, organizationID, memberID)
+	if err != nil {
+		return nil, err
+	}
+	grant, err := models.NewCollectionGrant(collection, member, permission)
+	if err != nil {
+		return nil, err
+	}
+	if err := orgs.store.UpsertCollectionGrant(ctx, &grant); err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+func (orgs *OrganizationService) RevokeCollection(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, collectionID uuid.UUID, memberID uuid.UUID) error {
+	if _, err := orgs.getManagedCollection(ctx, userID, organizationID, collectionID); err != nil {
+		return err
+	}
+	return orgs.store.DeleteCollectionGrant(ctx, collectionID, memberID)
+}
+
+// MoveRecord переносит запись вместе с вложениями в коллекцию организации.
+// Личная запись после переноса принадлежит организации, а выданные по ней личные доступы удаляются
+func (orgs *OrganizationService) MoveRecord(ctx context.Context, userID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID, collectionID uuid.UUID) error {
+	if dataKind == models.KindFileData {
+		userFileData, err := orgs.userData.GetUserFileData(ctx, dataID, userID)
+		if err != nil {
+			return err
+		}
+		if userFileData.ParentID != nil {
+			return httperror.New(nil, "Attachments are moved together with the parent record", http.StatusUnprocessableEntity)
+		}
+	}
+	if err := orgs.store.MoveRecordToCollection(ctx, dataKind, dataID, userID, collectionID, time.Now()); err != nil {
+		return err
+	}
+	auditEvent := dataEvent(ctx, models.AuditActionMove, userID, dataKind, dataID, models.Metadata{})
+	auditEvent.CollectionID = &collectionID
+	orgs.userData.audit.recordEventChange(ctx, auditEvent)
+	return nil
+}
+
+// ExportAudit пишет в w журнал событий над записями коллекций организации.
+// Журнал доступен владельцу и администраторам организации
+func (orgs *OrganizationService) ExportAudit(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, filter models.AuditFilter, w io.Writer) error {
+	if _, err := orgs.requireRole(ctx, userID, organizationID, models.OrganizationRoleOwner, models.OrganizationRoleAdmin); err != nil {
+		return err
+	}
+	return orgs.userData.audit.exportOrganization(ctx, organizationID, filter, w)
+}
+
+// requireRole возвращает организацию, если у пользователя одна из ролей roles
+func (orgs *OrganizationService) requireRole(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, roles ...models.OrganizationRole) (*models.Organization, error) {
+	organization, err := orgs.store.GetOrganization(ctx, organizationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		if organization.Role == role {
+			return organization, nil
+		}
+	}
+	return nil, httperror.New(nil, "Not enough rights in the organization", http.StatusForbidden)
+}
+
+// getManagedCollection возвращает коллекцию, если пользователь управляет организацией
+func (orgs *OrganizationService) getManagedCollection(ctx context.Context, userID uuid.UUID, organizationID uuid.UUID, collectionID uuid.UUID) (*models.Collection, error) {
+	if _, err := orgs.requireRole(ctx, userID, organizationID, models.OrganizationRoleOwner, models.OrganizationRoleAdmin); err != nil {
+		return nil, err
+	}
+	return orgs.store.GetCollection(ctx, organizationID, collectionID)
+}
+
+// checkAssignableRole проверяет, что участник с ролью actorRole может назначать роль role
+// и управлять участниками с этой ролью. Владельцами управляют только владельцы
+func checkAssignableRole(actorRole models.OrganizationRole, role models.OrganizationRole) error {
+	if role == models.OrganizationRoleOwner && actorRole != models.OrganizationRoleOwner {
+		return httperror.New(nil, "Only owners can manage owners", http.StatusForbidden)
+	}
+	return nil
+}
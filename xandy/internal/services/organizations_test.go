@@ -0,0 +1,366 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// organizationTestStore хранит организации и текстовые записи в памяти
+// и проверяет доступ к записям так же, как collection_access
+type organizationTestStore struct {
+	IUserDataStore
+	organizations map[uuid.UUID]models.Organization
+	members       map[[2]uuid.UUID]models.OrganizationMember
+	collections   map[uuid.UUID]models.Collection
+	grants        map[[2]uuid.UUID]models.CollectionGrant
+	texts         map[uuid.UUID]models.UserTextData
+}
+
+func (s *organizationTestStore) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func newOrganizationTestStore() *organizationTestStore {
+	return &organizationTestStore{
+		organizations: make(map[uuid.UUID]models.Organization),
+		members:       make(map[[2]uuid.UUID]models.OrganizationMember),
+		collections:   make(map[uuid.UUID]models.Collection),
+		grants:        make(map[[2]uuid.UUID]models.CollectionGrant),
+		texts:         make(map[uuid.UUID]models.UserTextData),
+	}
+}
+
+func (s *organizationTestStore) access(collectionID uuid.UUID, userID uuid.UUID) (bool, bool) {
+	collection, ok := s.collections[collectionID]
+	if !ok {
+		return false, false
+	}
+	member, ok := s.members[[2]uuid.UUID{collection.OrganizationID, userID}]
+	if !ok {
+		return false, false
+	}
+	if member.Role == models.OrganizationRoleOwner || member.Role == models.OrganizationRoleAdmin {
+		return true, true
+	}
+	grant, ok := s.grants[[2]uuid.UUID{collectionID, userID}]
+	if !ok {
+		return false, false
+	}
+	return true, grant.Permission == models.CollectionPermissionWrite && member.Role == models.OrganizationRoleMember
+}
+
+func (s *organizationTestStore) allowed(record models.BaseUserData, userID uuid.UUID, write bool) bool {
+	if record.Personal() {
+		return record.UserID == userID
+	}
+	found, canWrite := s.access(*record.CollectionID, userID)
+	return found && (canWrite || !write)
+}
+
+func (s *organizationTestStore) GetUserTextData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserTextData, error) {
+	userTextData, ok := s.texts[dataID]
+	if !ok || !s.allowed(userTextData.BaseUserData, userID, false) {
+		return nil, httperror.New(nil, "UserTextData not found", http.StatusNotFound)
+	}
+	return &userTextData, nil
+}
+
+func (s *organizationTestStore) UpdateUserTextData(ctx context.Context, userTextData *models.UserTextData, userID uuid.UUID) error {
+	existing, ok := s.texts[userTextData.ID]
+	if !ok || !s.allowed(existing.BaseUserData, userID, true) {
+		return httperror.New(nil, "UserTextData not found", http.StatusNotFound)
+	}
+	s.texts[userTextData.ID] = *userTextData
+	return nil
+}
+
+func (s *organizationTestStore) GetUserFileDataAttachments(ctx context.Context, userID uuid.UUID, parentIDs []uuid.UUID) ([]models.UserFileData, error) {
+	return nil, nil
+}
+
+func (s *organizationTestStore) GetCollectionAccess(ctx context.Context, collectionID uuid.UUID, userID uuid.UUID) (bool, error) {
+	found, canWrite := s.access(collectionID, userID)
+	if !found {
+		return false, httperror.New(nil, "Collection not found", http.StatusNotFound)
+	}
+	return canWrite, nil
+}
+
+func (s *organizationTestStore) InsertOrganization(ctx context.Context, organization *models.Organization, owner *models.OrganizationMember) error {
+	s.organizations[organization.ID] = *organization
+	s.members[[2]uuid.UUID{organization.ID, owner.UserID}] = *owner
+	return nil
+}
+
+func (s *organizationTestStore) GetOrganization(ctx context.Context, organizationID uuid.UUID, userID uuid.UUID) (*models.Organization, error) {
+	organization, ok := s.organizations[organizationID]
+	member, isMember := s.members[[2]uuid.UUID{organizationID, userID}]
+	if !ok || !isMember {
+		return nil, httperror.New(nil, "Organization not found", http.StatusNotFound)
+	}
+	organization.Role = member.Role
+	return &organization, nil
+}
+
+func (s *organizationTestStore) GetUserOrganizations(ctx context.Context, userID uuid.UUID) ([]models.Organization, error) {
+	var organizations []models.Organization
+	for id := range s.organizations {
+		if organization, err := s.GetOrganization(ctx, id, userID); err == nil {
+			organizations = append(organizations, *organization)
+		}
+	}
+	return organizations, nil
+}
+
+func (s *organizationTestStore) UpdateOrganization(ctx context.Context, organization *models.Organization) error {
+	s.organizations[organization.ID] = *organization
+	return nil
+}
+
+func (s *organizationTestStore) DeleteOrganization(ctx context.Context, organizationID uuid.UUID) error {
+	for _, collection := range s.collections {
+		if collection.OrganizationID == organizationID {
+			return httperror.New(nil, "Delete collections of the organization first", http.StatusConflict)
+		}
+	}
+	delete(s.organizations, organizationID)
+	return nil
+}
+
+func (s *organizationTestStore) InsertOrganizationMember(ctx context.Context, member *models.OrganizationMember) error {
+	key := [2]uuid.UUID{member.OrganizationID, member.UserID}
+	if _, ok := s.members[key]; ok {
+		return httperror.New(nil, "User is already a member of the organization", http.StatusConflict)
+	}
+	s.members[key] = *member
+	return nil
+}
+
+func (s *organizationTestStore) GetOrganizationMember(ctx context.Context, organizationID uuid.UUID, userID uuid.UUID) (*models.OrganizationMember, error) {
+	member, ok := s.members[[2]uuid.UUID{organizationID, userID}]
+	if !ok {
+		return nil, httperror.New(nil, "Member not found", http.StatusNotFound)
+	}
+	return &member, nil
+}
+
+func (s *organizationTestStore) GetOrganizationMembers(ctx context.Context, organizationID uuid.UUID) ([]models.OrganizationMember, error) {
+	var members []models.OrganizationMember
+	for _, member := range s.members {
+		if member.OrganizationID == organizationID {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+// otherOwner сообщает, останется ли в организации владелец без участника userID
+func (s *organizationTestStore) otherOwner(organizationID uuid.UUID, userID uuid.UUID) bool {
+	for _, member := range s.members {
+		if member.OrganizationID == organizationID && member.UserID != userID && member.Role == models.OrganizationRoleOwner {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *organizationTestStore) UpdateOrganizationMember(ctx context.Context, member *models.OrganizationMember) error {
+	key := [2]uuid.UUID{member.OrganizationID, member.UserID}
+	if s.members[key].Role == models.OrganizationRoleOwner && member.Role != models.OrganizationRoleOwner && !s.otherOwner(member.OrganizationID, member.UserID) {
+		return httperror.New(nil, "Organization must have at least one owner", http.StatusConflict)
+	}
+	s.members[key] = *member
+	return nil
+}
+
+func (s *organizationTestStore) DeleteOrganizationMember(ctx context.Context, organizationID uuid.UUID, userID uuid.UUID) error {
+	key := [2]uuid.UUID{organizationID, userID}
+	if s.members[key].Role == models.OrganizationRoleOwner && !s.otherOwner(organizationID, userID) {
+		return httperror.New(nil, "Organization must have at least one owner", http.StatusConflict)
+	}
+	delete(s.members, key)
+	for grantKey, grant := range s.grants {
+		if grant.OrganizationID == organizationID && grant.UserID == userID {
+			delete(s.grants, grantKey)
+		}
+	}
+	return nil
+}
+
+func (s *organizationTestStore) InsertCollection(ctx context.Context, collection *models.Collection) error {
+	s.collections[collection.ID] = *collection
+	return nil
+}
+
+func (s *organizationTestStore) GetCollection(ctx context.Context, organizationID uuid.UUID, collectionID uuid.UUID) (*models.Collection, error) {
+	collection, ok := s.collections[collectionID]
+	if !ok || collection.OrganizationID != organizationID {
+		return nil, httperror.New(nil, "Collection not found", http.StatusNotFound)
+	}
+	return &collection, nil
+}
+
+func (s *organizationTestStore) GetUserCollections(ctx context.Context, organizationID uuid.UUID, userID uuid.UUID) ([]models.Collection, error) {
+	var collections []models.Collection
+	for _, collection := range s.collections {
+		if found, _ := s.access(collection.ID, userID); found && collection.OrganizationID == organizationID {
+			collections = append(collections, collection)
+		}
+	}
+	return collections, nil
+}
+
+func (s *organizationTestStore) UpdateCollection(ctx context.Context, collection *models.Collection) error {
+	s.collections[collection.ID] = *collection
+	return nil
+}
+
+func (s *organizationTestStore) DeleteCollection(ctx context.Context, collectionID uuid.UUID) error {
+	for _, userTextData := range s.texts {
+		if userTextData.CollectionID != nil && *userTextData.CollectionID == collectionID {
+			return httperror.New(nil, "Collection is not empty", http.StatusConflict)
+		}
+	}
+	delete(s.collections, collectionID)
+	return nil
+}
+
+func (s *organizationTestStore) UpsertCollectionGrant(ctx context.Context, grant *models.CollectionGrant) error {
+	s.grants[[2]uuid.UUID{grant.CollectionID, grant.UserID}] = *grant
+	return nil
+}
+
+func (s *organizationTestStore) GetCollectionGrants(ctx context.Context, collectionID uuid.UUID) ([]models.CollectionGrant, error) {
+	var grants []models.CollectionGrant
+	for _, grant := range s.grants {
+		if grant.CollectionID == collectionID {
+			grants = append(grants, grant)
+		}
+	}
+	return grants, nil
+}
+
+func (s *organizationTestStore) DeleteCollectionGrant(ctx context.Context, collectionID uuid.UUID, userID uuid.UUID) error {
+	key := [2]uuid.UUID{collectionID, userID}
+	if _, ok := s.grants[key]; !ok {
+		return httperror.New(nil, "Grant not found", http.StatusNotFound)
+	}
+	delete(s.grants, key)
+	return nil
+}
+
+func (s *organizationTestStore) MoveRecordToCollection(ctx context.Context, dataKind models.DataKind, dataID uuid.UUID, userID uuid.UUID, collectionID uuid.UUID, updatedAt time.Time) error {
+	userTextData, ok := s.texts[dataID]
+	_, canWrite := s.access(collectionID, userID)
+	if !ok || dataKind != models.KindTextData || !s.allowed(userTextData.BaseUserData, userID, true) || !canWrite {
+		return httperror.New(nil, "Record can not be moved to this collection", http.StatusForbidden)
+	}
+	userTextData.CollectionID = &collectionID
+	userTextData.UpdatedAt = updatedAt
+	s.texts[dataID] = userTextData
+	return nil
+}
+
+func TestOrganizationService(t *testing.T) {
+	ctx := context.Background()
+	ownerID, adminID, memberID, readerID, strangerID := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	store := newOrganizationTestStore()
+	users := fakeUserDirectory{
+		"owner@example.com":    ownerID,
+		"admin@example.com":    adminID,
+		"member@example.com":   memberID,
+		"reader@example.com":   readerID,
+		"stranger@example.com": strangerID,
+	}
+	userData := NewUserDataService(store, nil, NewQuotaService(nil, Quotas{}), nil)
+	service := NewOrganizationService(store, users, userData)
+
+	organization, err := service.CreateOrganization(ctx, ownerID, "Team")
+	require.NoError(t, err)
+	assert.Equal(t, models.OrganizationRoleOwner, organization.Role)
+	_, err = service.CreateOrganization(ctx, ownerID, "")
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode(err))
+
+	_, err = service.AddMember(ctx, ownerID, organization.ID, "admin@example.com", models.OrganizationRoleAdmin)
+	require.NoError(t, err)
+	_, err = service.AddMember(ctx, adminID, organization.ID, "member@example.com", models.OrganizationRoleMember)
+	require.NoError(t, err)
+	_, err = service.AddMember(ctx, adminID, organization.ID, "reader@example.com", models.OrganizationRoleReadOnly)
+	require.NoError(t, err)
+	_, err = service.AddMember(ctx, adminID, organization.ID, "member@example.com", models.OrganizationRoleMember)
+	assert.Equal(t, http.StatusConflict, statusCode(err))
+	// Администратор не назначает владельцев, участник не управляет организацией
+	_, err = service.AddMember(ctx, adminID, organization.ID, "stranger@example.com", models.OrganizationRoleOwner)
+	assert.Equal(t, http.StatusForbidden, statusCode(err))
+	_, err = service.AddMember(ctx, memberID, organization.ID, "stranger@example.com", models.OrganizationRoleMember)
+	assert.Equal(t, http.StatusForbidden, statusCode(err))
+	_, err = service.AddMember(ctx, ownerID, organization.ID, "stranger@example.com", "guest")
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode(err))
+	_, err = service.GetMembers(ctx, strangerID, organization.ID)
+	assert.Equal(t, http.StatusNotFound, statusCode(err))
+
+	// Последний владелец не может выйти из организации или сменить роль
+	assert.Equal(t, http.StatusConflict, statusCode(service.RemoveMember(ctx, ownerID, organization.ID, ownerID)))
+	_, err = service.UpdateMember(ctx, ownerID, organization.ID, ownerID, models.OrganizationRoleAdmin)
+	assert.Equal(t, http.StatusConflict, statusCode(err))
+	assert.Equal(t, http.StatusForbidden, statusCode(service.RemoveMember(ctx, adminID, organization.ID, ownerID)))
+
+	collection, err := service.CreateCollection(ctx, adminID, organization.ID, "Servers")
+	require.NoError(t, err)
+	_, err = service.CreateCollection(ctx, memberID, organization.ID, "Mine")
+	assert.Equal(t, http.StatusForbidden, statusCode(err))
+
+	note, err := models.NewUserTextData("root", ownerID, models.Metadata{}, "password")
+	require.NoError(t, err)
+	store.texts[note.ID] = note
+	require.NoError(t, service.MoveRecord(ctx, ownerID, models.KindTextData, note.ID, collection.ID))
+	assert.Equal(t, http.StatusConflict, statusCode(service.DeleteCollection(ctx, ownerID, organization.ID, collection.ID)))
+
+	// Без доступа к коллекции участник не видит её записи
+	_, err = userData.GetUserTextData(ctx, note.ID, memberID)
+	assert.Equal(t, http.StatusNotFound, statusCode(err))
+	collections, err := service.GetCollections(ctx, memberID, organization.ID)
+	require.NoError(t, err)
+	assert.Empty(t, collections)
+
+	_, err = service.GrantCollection(ctx, adminID, organization.ID, collection.ID, memberID, models.CollectionPermissionWrite)
+	require.NoError(t, err)
+	_, err = service.GrantCollection(ctx, adminID, organization.ID, collection.ID, readerID, models.CollectionPermissionWrite)
+	require.NoError(t, err)
+	_, err = service.GrantCollection(ctx, adminID, organization.ID, collection.ID, strangerID, models.CollectionPermissionRead)
+	assert.Equal(t, http.StatusNotFound, statusCode(err))
+
+	updated, err := userData.UpdateUserTextData(ctx, memberID, note.ID, "root", "rotated", models.Metadata{})
+	require.NoError(t, err)
+	assert.Equal(t, ownerID, updated.UserID)
+	// Участник только для чтения не меняет записи даже с доступом на запись
+	read, err := userData.GetUserTextData(ctx, note.ID, readerID)
+	require.NoError(t, err)
+	assert.Equal(t, "rotated", read.Data)
+	_, err = userData.UpdateUserTextData(ctx, readerID, note.ID, "root", "hacked", models.Metadata{})
+	assert.Equal(t, http.StatusForbidden, statusCode(err))
+
+	// Исключённый участник сразу теряет доступ
+	require.NoError(t, service.RemoveMember(ctx, adminID, organization.ID, memberID))
+	_, err = userData.GetUserTextData(ctx, note.ID, memberID)
+	assert.Equal(t, http.StatusNotFound, statusCode(err))
+	_, err = service.AddMember(ctx, adminID, organization.ID, "member@example.com", models.OrganizationRoleMember)
+	require.NoError(t, err)
+	_, err = userData.GetUserTextData(ctx, note.ID, memberID)
+	assert.Equal(t, http.StatusNotFound, statusCode(err))
+
+	// Участник может выйти сам, организация с коллекциями не удаляется
+	require.NoError(t, service.RemoveMember(ctx, readerID, organization.ID, readerID))
+	_, err = userData.GetUserTextData(ctx, note.ID, readerID)
+	assert.Equal(t, http.StatusNotFound, statusCode(err))
+	assert.Equal(t, http.StatusForbidden, statusCode(service.DeleteOrganization(ctx, adminID, organization.ID)))
+	assert.Equal(t, http.StatusConflict, statusCode(service.DeleteOrganization(ctx, ownerID, organization.ID)))
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+// Поля, которые можно изменить частичным обновлением записи каждого вида
+var patchableFields = map[models.DataKind][]string{
+	models.KindAuthInfo: {"name", "metadata", "login", "password"},
+	models.KindTextData: {"name", "metadata", "data"},
+	models.KindFileData: {"name", "metadata"},
+	models.KindBankCard: {"name", "metadata", "number", "card_holder", "expire_date", "csc"},
+}
+
+// MergePatch применяет к target изменения patch по RFC 7396: значения объектов
+// объединяются по ключам, null удаляет ключ, остальные значения заменяются целиком
+func MergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	merged := make(map[string]interface{}, len(targetObject))
+	for key, value := range targetObject {
+		merged[key] = value
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = MergePatch(merged[key], value)
+	}
+	return merged
+}
+
+// PatchRecord меняет только переданные в patch поля записи, метаданные объединяются по ключам.
+// Остальные поля и проверки такие же, как у полного обновления записи
+func (uds *UserDataService) PatchRecord(
+	ctx context.Context,
+	userID uuid.UUID,
+	dataKind models.DataKind,
+	ID uuid.UUID,
+	patch map[string]interface{},
+) (interface{}, error) {
+	fields, ok := patchableFields[dataKind]
+	if !ok {
+		return nil, httperror.New(nil, "Unknown data kind", http.StatusBadRequest)
+	}
+	for key := range patch {
+		if !slices.Contains(fields, key) {
+			return nil, httperror.New(nil, fmt.Sprintf("Field %s can not be patched", key), http.StatusBadRequest)
+		}
+	}
+	// Запись блокируется до чтения, иначе параллельный PATCH перезапишет эти изменения
+	return withTx(ctx, uds.store, func(ctx context.Context) (interface{}, error) {
+		if err := uds.store.LockUserData(ctx, dataKind, ID); err != nil {
+			return nil, err
+		}
+		current, err := uds.recordUpdate(ctx, userID, dataKind, ID)
+		if err != nil {
+			return nil, err
+		}
+		update, err := applyMergePatch(current, patch)
+		if err != nil {
+			return nil, err
+		}
+		switch dataKind {
+		case models.KindAuthInfo:
+			return uds.UpdateUserAuthInfo(ctx, userID, ID, update.Name, update.Login, update.Password, update.Metadata)
+		case models.KindTextData:
+			return uds.UpdateUserTextData(ctx, userID, ID, update.Name, update.Data, update.Metadata)
+		case models.KindBankCard:
+			return uds.UpdateUserBankCard(ctx, userID, ID, update.Name, update.Number, update.CardHolder, update.ExpireDate, update.CSC, update.Metadata)
+		default:
+			return uds.UpdateUserFileData(ctx, userID, ID, update.Name, update.Metadata)
+		}
+	})
+}
+
+// recordUpdate возвращает текущие значения изменяемых полей записи
+func (uds *UserDataService) recordUpdate(ctx context.Context, userID uuid.UUID, dataKind models.DataKind, ID uuid.UUID) (*RecordUpdate, error) {
+	switch dataKind {
+	case models.KindAuthInfo:
+		record, err := uds.store.GetUserAuthInfo(ctx, ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		return &RecordUpdate{Name: record.Name, Metadata: record.Metadata, Login: record.Login, Password: record.Password}, nil
+	case models.KindTextData:
+		record, err := uds.store.GetUserTextData(ctx, ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		return &RecordUpdate{Name: record.Name, Metadata: record.Metadata, Data: record.Data}, nil
+	case models.KindBankCard:
+		record, err := uds.store.GetUserBankCard(ctx, ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		return &RecordUpdate{
+			Name:       record.Name,
+			Metadata:   record.Metadata,
+			Number:     record.Number,
+			CardHolder: record.CardHolder,
+			ExpireDate: record.ExpireDate,
+			CSC:        record.CSC,
+		}, nil
+	default:
+		record, err := uds.store.GetUserFileData(ctx, ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		return &RecordUpdate{Name: record.Name, Metadata: record.Metadata}, nil
+	}
+}
+
+// applyMergePatch применяет patch к JSON представлению полей записи
+func applyMergePatch(current *RecordUpdate, patch map[string]interface{}) (*RecordUpdate, error) {
+	raw, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	var target map[string]interface{}
+	if err := json.Unmarshal(raw, &target); err != nil {
+		return nil, err
+	}
+	raw, err = json.Marshal(MergePatch(target, patch))
+	if err != nil {
+		return nil, err
+	}
+	var update RecordUpdate
+	if err := json.Unmarshal(raw, &update); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, httperror.New(err, fmt.Sprintf("Invalid value for field %s", typeErr.Field), http.StatusBadRequest)
+		}
+		return nil, err
+	}
+	if update.Metadata == nil {
+		update.Metadata = models.Metadata{}
+	}
+	return &update, nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePatch(t *testing.T) {
+	// Примеры из приложения A RFC 7396
+	tests := []struct {
+		target interface{}
+		patch  interface{}
+		want   interface{}
+	}{
+		{map[string]interface{}{"a": "b"}, map[string]interface{}{"a": "c"}, map[string]interface{}{"a": "c"}},
+		{map[string]interface{}{"a": "b"}, map[string]interface{}{"b": "c"}, map[string]interface{}{"a": "b", "b": "c"}},
+		{map[string]interface{}{"a": "b"}, map[string]interface{}{"a": nil}, map[string]interface{}{}},
+		{map[string]interface{}{"a": "b", "b": "c"}, map[string]interface{}{"a": nil}, map[string]interface{}{"b": "c"}},
+		{map[string]interface{}{"a": []interface{}{"b"}}, map[string]interface{}{"a": "c"}, map[string]interface{}{"a": "c"}},
+		{map[string]interface{}{"a": "c"}, map[string]interface{}{"a": []interface{}{"b"}}, map[string]interface{}{"a": []interface{}{"b"}}},
+		{
+			map[string]interface{}{"a": map[string]interface{}{"b": "c"}},
+			map[string]interface{}{"a": map[string]interface{}{"b": "d", "c": nil}},
+			map[string]interface{}{"a": map[string]interface{}{"b": "d"}},
+		},
+		{map[string]interface{}{"a": "foo"}, nil, nil},
+		{map[string]interface{}{"a": "foo"}, "bar", "bar"},
+		{map[string]interface{}{"e": nil}, map[string]interface{}{"a": 1}, map[string]interface{}{"e": nil, "a": 1}},
+		{[]interface{}{1, 2}, map[string]interface{}{"a": "b", "c": nil}, map[string]interface{}{"a": "b"}},
+		{map[string]interface{}{}, map[string]interface{}{"a": map[string]interface{}{"bb": map[string]interface{}{"ccc": nil}}}, map[string]interface{}{"a": map[string]interface{}{"bb": map[string]interface{}{}}}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, MergePatch(tt.target, tt.patch))
+	}
+}
+
+func TestPatchRecord(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	store := &batchTestStore{fileDataStore: &fileDataStore{}, texts: make(map[uuid.UUID]models.UserTextData)}
+	service := NewUserDataService(store, nil, NewQuotaService(nil, Quotas{}), nil)
+
+	note, err := models.NewUserTextData("note", userID, models.Metadata{
+		"site": "example.com",
+		"tags": map[string]interface{}{"work": true, "old": true},
+	}, "secret")
+	require.NoError(t, err)
+	store.texts[note.ID] = note
+
+	statusCode := func(err error) int {
+		_, statusCode := httperror.GetMessageAndStatusCode(err)
+		return statusCode
+	}
+
+	t.Run("OnlySentFieldsChange", func(t *testing.T) {
+		record, err := service.PatchRecord(ctx, userID, models.KindTextData, note.ID, map[string]interface{}{
+			"name": "renamed",
+			"metadata": map[string]interface{}{
+				"site": nil,
+				"tags": map[string]interface{}{"old": nil, "new": true},
+			},
+		})
+		require.NoError(t, err)
+		patched := record.(*models.UserTextData)
+		assert.Equal(t, "renamed", patched.Name)
+		assert.Equal(t, "secret", patched.Data)
+		assert.Equal(t, models.Metadata{"tags": map[string]interface{}{"work": true, "new": true}}, patched.Metadata)
+		assert.Equal(t, "secret", store.texts[note.ID].Data)
+		// Запись читается под блокировкой в той же транзакции, что и обновление
+		assert.Equal(t, []uuid.UUID{note.ID}, store.locked)
+	})
+
+	t.Run("NullMetadataClearsIt", func(t *testing.T) {
+		record, err := service.PatchRecord(ctx, userID, models.KindTextData, note.ID, map[string]interface{}{"metadata": nil})
+		require.NoError(t, err)
+		assert.Equal(t, models.Metadata{}, record.(*models.UserTextData).Metadata)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := service.PatchRecord(ctx, userID, models.KindTextData, note.ID, map[string]interface{}{"id": uuid.New().String()})
+		assert.Equal(t, http.StatusBadRequest, statusCode(err))
+
+		_, err = service.PatchRecord(ctx, userID, models.KindTextData, note.ID, map[string]interface{}{"login": "me"})
+		assert.Equal(t, http.StatusBadRequest, statusCode(err))
+
+		_, err = service.PatchRecord(ctx, userID, models.KindTextData, note.ID, map[string]interface{}{"name": 5})
+		msg, code := httperror.GetMessageAndStatusCode(err)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "Invalid value for field name", msg)
+
+		// Обязательное поле нельзя удалить
+		_, err = service.PatchRecord(ctx, userID, models.KindTextData, note.ID, map[string]interface{}{"data": nil})
+		assert.Equal(t, http.StatusUnprocessableEntity, statusCode(err))
+		assert.Equal(t, "secret", store.texts[note.ID].Data)
+
+		_, err = service.PatchRecord(ctx, userID, models.KindTextData, uuid.New(), map[string]interface{}{"name": "x"})
+		assert.Equal(t, http.StatusNotFound, statusCode(err))
+	})
+}
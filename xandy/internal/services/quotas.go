@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+type IUsageStore interface {
+	GetUserUsage(ctx context.Context, userID uuid.UUID) (*models.Usage, error)
+	LockUserUsage(ctx context.Context, userID uuid.UUID) error
+}
+
+// Quotas - ограничения для одного пользователя, 0 означает отсутствие ограничения
+type Quotas struct {
+	// Максимальный размер одного файла
+	MaxFileSize int64
+	// Суммарный размер всех файлов пользователя
+	MaxStorage int64
+	// Количество записей каждого вида, вложения считаются записями file_data
+	MaxRecordsPerKind int64
+}
+
+type UsageLimit struct {
+	Used  int64  `json:"used"`
+	Limit *int64 `json:"limit"`
+}
+
+type UsageReport struct {
+	Storage     UsageLimit                     `json:"storage"`
+	MaxFileSize *int64                         `json:"max_file_size"`
+	Records     map[models.DataKind]UsageLimit `json:"records"`
+}
+
+// QuotaService проверяет ограничения на размер файлов, занятое место и количество записей
+// личных записей пользователя, записи коллекций принадлежат организации и в квоты не входят.
+// Размер файла проверяется по мере чтения содержимого, поэтому слишком большой файл
+// не сохраняется в BlobStore целиком. Эта проверка приблизительная, окончательно
+// CheckRecord и CheckStorage проверяют квоты в транзакции сохранения записи.
+type QuotaService struct {
+	store  IUsageStore
+	quotas Quotas
+
+	mu sync.Mutex
+	// Байты файлов, которые сейчас читаются и ещё не попали в базу.
+	// Учитываются только загрузки в этом процессе.
+	pending map[uuid.UUID]int64
+}
+
+func NewQuotaService(usageStore IUsageStore, quotas Quotas) *QuotaService {
+	return &QuotaService{
+		store:   usageStore,
+		quotas:  quotas,
+		pending: make(map[uuid.UUID]int64),
+	}
+}
+
+func limitOrNil(limit int64) *int64 {
+	if limit <= 0 {
+		return nil
+	}
+	return &limit
+}
+
+func (qs *QuotaService) GetUsage(ctx context.Context, userID uuid.UUID) (*UsageReport, error) {
+	usage, err := qs.store.GetUserUsage(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	report := &UsageReport{
+		Storage:     UsageLimit{Used: usage.Bytes + usage.UploadBytes, Limit: limitOrNil(qs.quotas.MaxStorage)},
+		MaxFileSize: limitOrNil(qs.quotas.MaxFileSize),
+		Records:     make(map[models.DataKind]UsageLimit, len(usage.Records)),
+	}
+	for kind, count := range usage.Records {
+		report.Records[kind] = UsageLimit{Used: count, Limit: limitOrNil(qs.quotas.MaxRecordsPerKind)}
+	}
+	return report, nil
+}
+
+// CheckRecord проверяет, что пользователь может создать ещё одну запись вида kind.
+// Вызывается в одной транзакции с созданием записи: квоты пользователя блокируются
+// до её конца, поэтому параллельные запросы не создадут записей сверх лимита.
+func (qs *QuotaService) CheckRecord(ctx context.Context, userID uuid.UUID, kind models.DataKind) error {
+	if qs.quotas.MaxRecordsPerKind <= 0 {
+		return nil
+	}
+	if err := qs.store.LockUserUsage(ctx, userID); err != nil {
+		return err
+	}
+	usage, err := qs.store.GetUserUsage(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if usage.Records[kind] >= qs.quotas.MaxRecordsPerKind {
+		return httperror.New(nil, fmt.Sprintf("Limit of %d %s records reached", qs.quotas.MaxRecordsPerKind, kind), http.StatusInsufficientStorage)
+	}
+	return nil
+}
+
+func (qs *QuotaService) fileTooLarge() error {
+	return httperror.New(nil, fmt.Sprintf("File exceeds the maximum size of %d bytes", qs.quotas.MaxFileSize), http.StatusRequestEntityTooLarge)
+}
+
+func (qs *QuotaService) storageExceeded() error {
+	return httperror.New(nil, fmt.Sprintf("Storage quota of %d bytes exceeded", qs.quotas.MaxStorage), http.StatusInsufficientStorage)
+}
+
+// storageAllowance возвращает, сколько байт пользователь ещё может занять, math.MaxInt64 без ограничения.
+// reserved - байты, которые уже учтены в занятом месте и освободятся после сохранения,
+// например прежнее содержимое заменяемого файла.
+func (qs *QuotaService) storageAllowance(ctx context.Context, userID uuid.UUID, reserved int64) (int64, error) {
+	if qs.quotas.MaxStorage <= 0 {
+		return math.MaxInt64, nil
+	}
+	usage, err := qs.store.GetUserUsage(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	qs.mu.Lock()
+	pending := qs.pending[userID]
+	qs.mu.Unlock()
+	return qs.quotas.MaxStorage - usage.Bytes - usage.UploadBytes - pending + reserved, nil
+}
+
+// CheckStorage проверяет, что файл размера size помещается в квоту, reserved - как в storageAllowance.
+// Как и CheckRecord, вызывается в одной транзакции с сохранением записи о файле.
+// Читаемые в этот момент файлы не учитываются, каждый из них проверяется при своём сохранении.
+func (qs *QuotaService) CheckStorage(ctx context.Context, userID uuid.UUID, size int64, reserved int64) error {
+	if qs.quotas.MaxStorage <= 0 {
+		return nil
+	}
+	if err := qs.store.LockUserUsage(ctx, userID); err != nil {
+		return err
+	}
+	usage, err := qs.store.GetUserUsage(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if usage.Bytes+usage.UploadBytes-reserved+size > qs.quotas.MaxStorage {
+		return qs.storageExceeded()
+	}
+	return nil
+}
+
+// CheckFileSize проверяет заранее известный размер файла, например при создании загрузки по частям
+func (qs *QuotaService) CheckFileSize(ctx context.Context, userID uuid.UUID, size int64) error {
+	if qs.quotas.MaxFileSize > 0 && size > qs.quotas.MaxFileSize {
+		return qs.fileTooLarge()
+	}
+	allowance, err := qs.storageAllowance(ctx, userID, 0)
+	if err != nil {
+		return err
+	}
+	if size > allowance {
+		return qs.storageExceeded()
+	}
+	return nil
+}
+
+// LimitFile оборачивает содержимое файла, чтение прерывается ошибкой 413 или 507,
+// как только файл выходит за ограничения. Прочитанные байты считаются занятыми
+// до вызова release, его нужно вызвать после сохранения записи или ошибки.
+func (qs *QuotaService) LimitFile(ctx context.Context, userID uuid.UUID, content io.Reader, reserved int64) (io.Reader, func(), error) {
+	allowance, err := qs.storageAllowance(ctx, userID, reserved)
+	if err != nil {
+		return nil, nil, err
+	}
+	qr := &quotaReader{r: content, qs: qs, userID: userID, allowance: allowance}
+	release := func() {
+		qs.mu.Lock()
+		defer qs.mu.Unlock()
+		qs.pending[userID] -= qr.counted
+		if qs.pending[userID] <= 0 {
+			delete(qs.pending, userID)
+		}
+	}
+	return qr.wrap(content), release, nil
+}
+
+// LimitFileSize ограничивает только размер файла, например файла коллекции, который не входит в квоты пользователей
+func (qs *QuotaService) LimitFileSize(content io.Reader) io.Reader {
+	qr := &quotaReader{r: content, qs: qs, allowance: math.MaxInt64, untracked: true}
+	return qr.wrap(content)
+}
+
+// quotaReader считает прочитанные байты по наибольшей позиции в потоке,
+// поэтому повторное чтение после перемотки не учитывается дважды
+type quotaReader struct {
+	r         io.Reader
+	qs        *QuotaService
+	userID    uuid.UUID
+	allowance int64
+	pos       int64
+	counted   int64
+	// Прочитанные байты не считаются занятыми пользователем
+	untracked bool
+}
+
+// wrap сохраняет возможность перемотки исходного содержимого
+func (qr *quotaReader) wrap(content io.Reader) io.Reader {
+	if seeker, ok := content.(io.ReadSeeker); ok {
+		return &quotaReadSeeker{quotaReader: qr, seeker: seeker}
+	}
+	return qr
+}
+
+func (qr *quotaReader) Read(p []byte) (int, error) {
+	n, err := qr.r.Read(p)
+	qr.pos += int64(n)
+	if qr.pos > qr.counted {
+		if !qr.untracked {
+			qr.qs.mu.Lock()
+			qr.qs.pending[qr.userID] += qr.pos - qr.counted
+			qr.qs.mu.Unlock()
+		}
+		qr.counted = qr.pos
+	}
+	if qr.qs.quotas.MaxFileSize > 0 && qr.counted > qr.qs.quotas.MaxFileSize {
+		return n, qr.qs.fileTooLarge()
+	}
+	if qr.counted > qr.allowance {
+		return n, qr.qs.storageExceeded()
+	}
+	return n, err
+}
+
+type quotaReadSeeker struct {
+	*quotaReader
+	seeker io.Seeker
+}
+
+func (qrs *quotaReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := qrs.seeker.Seek(offset, whence)
+	if err == nil {
+		qrs.pos = pos
+	}
+	return pos, err
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/eac0de/xandy/internal/blobstore"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type usageStore struct {
+	usage  models.Usage
+	locked []uuid.UUID
+}
+
+func (s *usageStore) GetUserUsage(ctx context.Context, userID uuid.UUID) (*models.Usage, error) {
+	usage := s.usage
+	return &usage, nil
+}
+
+func (s *usageStore) LockUserUsage(ctx context.Context, userID uuid.UUID) error {
+	s.locked = append(s.locked, userID)
+	return nil
+}
+
+func statusCode(err error) int {
+	_, statusCode := httperror.GetMessageAndStatusCode(err)
+	return statusCode
+}
+
+func TestQuotaServiceLimitFile(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	store := &usageStore{usage: models.Usage{Bytes: 80, UploadBytes: 10}}
+	quotas := NewQuotaService(store, Quotas{MaxFileSize: 20, MaxStorage: 100})
+	blobs := blobstore.NewLocalStore(t.TempDir())
+	contents := NewFileContentStore(blobs, &memoryFileBlobStore{refs: make(map[string]int)})
+
+	t.Run("FileTooLarge", func(t *testing.T) {
+		content, release, err := quotas.LimitFile(ctx, userID, io.MultiReader(strings.NewReader(strings.Repeat("a", 21))), 0)
+		require.NoError(t, err)
+		defer release()
+		_, err = contents.Save(ctx, content)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, statusCode(err))
+	})
+
+	t.Run("StorageExceeded", func(t *testing.T) {
+		content, release, err := quotas.LimitFile(ctx, userID, strings.NewReader(strings.Repeat("b", 11)), 0)
+		require.NoError(t, err)
+		defer release()
+		_, err = contents.Save(ctx, content)
+		assert.Equal(t, http.StatusInsufficientStorage, statusCode(err))
+		// Содержимое не попадает в BlobStore
+		sum := sha256.Sum256([]byte(strings.Repeat("b", 11)))
+		_, err = blobs.Stat(ctx, contentKey(hex.EncodeToString(sum[:])))
+		assert.ErrorIs(t, err, blobstore.ErrNotFound)
+	})
+
+	t.Run("ReservedAndRewind", func(t *testing.T) {
+		// Прежнее содержимое заменяемого файла освобождает место,
+		// а повторное чтение после перемотки не считается дважды
+		content, release, err := quotas.LimitFile(ctx, userID, strings.NewReader(strings.Repeat("c", 15)), 5)
+		require.NoError(t, err)
+		stored, err := contents.Save(ctx, content)
+		require.NoError(t, err)
+		assert.Equal(t, int64(15), stored.Size)
+		assert.Equal(t, int64(15), quotas.pending[userID])
+
+		// Пока файл не сохранён в базе, его байты занимают место
+		assert.Equal(t, http.StatusInsufficientStorage, statusCode(quotas.CheckFileSize(ctx, userID, 1)))
+		release()
+		assert.NoError(t, quotas.CheckFileSize(ctx, userID, 10))
+		assert.Empty(t, quotas.pending)
+	})
+
+	t.Run("CheckFileSize", func(t *testing.T) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, statusCode(quotas.CheckFileSize(ctx, userID, 21)))
+		assert.Equal(t, http.StatusInsufficientStorage, statusCode(quotas.CheckFileSize(ctx, userID, 11)))
+	})
+
+	t.Run("CheckStorage", func(t *testing.T) {
+		store.locked = nil
+		// Окончательная проверка не учитывает читаемые сейчас файлы, они проверяются при своём сохранении
+		_, release, err := quotas.LimitFile(ctx, userID, strings.NewReader("pending"), 0)
+		require.NoError(t, err)
+		defer release()
+		assert.NoError(t, quotas.CheckStorage(ctx, userID, 10, 0))
+		assert.Equal(t, http.StatusInsufficientStorage, statusCode(quotas.CheckStorage(ctx, userID, 11, 0)))
+		assert.NoError(t, quotas.CheckStorage(ctx, userID, 15, 5))
+		// Квоты пользователя блокируются до конца транзакции сохранения
+		assert.Equal(t, []uuid.UUID{userID, userID, userID}, store.locked)
+	})
+
+	t.Run("LimitFileSize", func(t *testing.T) {
+		content := quotas.LimitFileSize(strings.NewReader(strings.Repeat("d", 20)))
+		_, err := contents.Save(ctx, content)
+		require.NoError(t, err)
+		_, err = contents.Save(ctx, quotas.LimitFileSize(strings.NewReader(strings.Repeat("d", 21))))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, statusCode(err))
+		assert.Empty(t, quotas.pending)
+	})
+}
+
+func TestQuotaServiceRecords(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	store := &usageStore{usage: models.Usage{
+		Bytes:   1024,
+		Records: map[models.DataKind]int64{models.KindAuthInfo: 2, models.KindTextData: 1},
+	}}
+	quotas := NewQuotaService(store, Quotas{MaxRecordsPerKind: 2})
+
+	err := quotas.CheckRecord(ctx, userID, models.KindAuthInfo)
+	assert.Equal(t, http.StatusInsufficientStorage, statusCode(err))
+	assert.NoError(t, quotas.CheckRecord(ctx, userID, models.KindTextData))
+	assert.Equal(t, []uuid.UUID{userID, userID}, store.locked)
+
+	report, err := quotas.GetUsage(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1024), report.Storage.Used)
+	assert.Nil(t, report.Storage.Limit)
+	assert.Nil(t, report.MaxFileSize)
+	assert.Equal(t, int64(2), report.Records[models.KindAuthInfo].Used)
+	assert.Equal(t, int64(2), *report.Records[models.KindAuthInfo].Limit)
+
+	// Без ограничений ничего не проверяется
+	unlimited := NewQuotaService(store, Quotas{})
+	assert.NoError(t, unlimited.CheckRecord(ctx, userID, models.KindAuthInfo))
+	assert.NoError(t, unlimited.CheckStorage(ctx, userID, 1<<40, 0))
+	assert.Len(t, store.locked, 2)
+	content, release, err := unlimited.LimitFile(ctx, userID, strings.NewReader("data"), 0)
+	require.NoError(t, err)
+	defer release()
+	data, err := io.ReadAll(content)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/emailsender"
+
+	"github.com/google/uuid"
+)
+
+type IReminderStore interface {
+	GetReminderPreferences(ctx context.Context, userID uuid.UUID) (*models.ReminderPreferences, error)
+	UpsertReminderPreferences(ctx context.Context, preferences *models.ReminderPreferences) error
+	GetDueReminders(ctx context.Context, cardMonth time.Time, now time.Time) ([]models.Reminder, error)
+	ClaimReminders(ctx context.Context, reminders []models.Reminder, sentAt time.Time) ([]models.Reminder, error)
+	UnclaimReminders(ctx context.Context, reminders []models.Reminder) error
+}
+
+// ReminderService рассылает пользователям письма-сводки о картах, срок действия которых истекает
+// в следующем месяце, и о паролях, которые пора сменить. Период смены пароля задаётся в метаданных
+// учётной записи ключом rotation_days.
+type ReminderService struct {
+	store       IReminderStore
+	users       IUserDirectory
+	emailSender emailsender.IEmailSender
+}
+
+func NewReminderService(reminderStore IReminderStore, users IUserDirectory, emailSender emailsender.IEmailSender) *ReminderService {
+	return &ReminderService{
+		store:       reminderStore,
+		users:       users,
+		emailSender: emailSender,
+	}
+}
+
+func (rs *ReminderService) GetPreferences(ctx context.Context, userID uuid.UUID) (*models.ReminderPreferences, error) {
+	return rs.store.GetReminderPreferences(ctx, userID)
+}
+
+// UpdatePreferences включает или выключает напоминания, nil оставляет настройку без изменений
+func (rs *ReminderService) UpdatePreferences(ctx context.Context, userID uuid.UUID, cardExpiry *bool, credentialRotation *bool) (*models.ReminderPreferences, error) {
+	preferences, err := rs.store.GetReminderPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if cardExpiry != nil {
+		preferences.CardExpiry = *cardExpiry
+	}
+	if credentialRotation != nil {
+		preferences.CredentialRotation = *credentialRotation
+	}
+	preferences.UpdatedAt = time.Now()
+	if err := rs.store.UpsertReminderPreferences(ctx, preferences); err != nil {
+		return nil, err
+	}
+	return preferences, nil
+}
+
+// SendReminders отправляет каждому пользователю одно письмо со всеми новыми напоминаниями.
+// Напоминание отмечается отправленным до отправки письма, а если письмо не ушло, отметка снимается
+// и напоминание попадёт в следующую рассылку. Возвращает число отправленных напоминаний.
+func (rs *ReminderService) SendReminders(ctx context.Context) (int, error) {
+	now := time.Now()
+	cardMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	reminders, err := rs.store.GetDueReminders(ctx, cardMonth, now)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for start := 0; start < len(reminders); {
+		end := start
+		for end < len(reminders) && reminders[end].UserID == reminders[start].UserID {
+			end++
+		}
+		userReminders := reminders[start:end]
+		start = end
+
+		claimed, err := rs.store.ClaimReminders(ctx, userReminders, now)
+		if err != nil {
+			if len(claimed) > 0 {
+				if err := rs.store.UnclaimReminders(ctx, claimed); err != nil {
+					log.Printf("unclaim reminders: %s\n", err)
+				}
+			}
+			return sent, err
+		}
+		if len(claimed) == 0 {
+			continue
+		}
+		if err := rs.sendDigest(ctx, claimed[0].UserID, claimed); err != nil {
+			log.Printf("send reminders to user %s: %s\n", claimed[0].UserID, err)
+			if err := rs.store.UnclaimReminders(ctx, claimed); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		sent += len(claimed)
+	}
+	return sent, nil
+}
+
+func (rs *ReminderService) sendDigest(ctx context.Context, userID uuid.UUID, reminders []models.Reminder) error {
+	user, err := rs.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return rs.emailSender.Send("Напоминания xandy", reminderDigest(reminders), user.Email)
+}
+
+// reminderDigest собирает текст письма, напоминания одного вида идут подряд
+func reminderDigest(reminders []models.Reminder) string {
+	var cards, credentials strings.Builder
+	for _, reminder := range reminders {
+		switch reminder.Kind {
+		case models.ReminderCardExpiry:
+			fmt.Fprintf(&cards, "- %s (до конца %s)\n", reminder.Name, reminder.DueAt.Format("01.2006"))
+		case models.ReminderCredentialRotation:
+			fmt.Fprintf(&credentials, "- %s (нужно было сменить %s)\n", reminder.Name, reminder.DueAt.Format("02.01.2006"))
+		}
+	}
+	var body strings.Builder
+	if cards.Len() > 0 {
+		body.WriteString("В следующем месяце истекает срок действия карт:\n")
+		body.WriteString(cards.String())
+	}
+	if credentials.Len() > 0 {
+		if body.Len() > 0 {
+			body.WriteString("\n")
+		}
+		body.WriteString("Пора сменить пароли:\n")
+		body.WriteString(credentials.String())
+	}
+	return body.String()
+}
+
+// RunReminders периодически рассылает напоминания до отмены контекста
+func (rs *ReminderService) RunReminders(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sent, err := rs.SendReminders(ctx)
+			if err != nil {
+				log.Printf("send reminders: %s\n", err)
+			}
+			if sent > 0 {
+				log.Printf("sent %d reminders\n", sent)
+			}
+		}
+	}
+}
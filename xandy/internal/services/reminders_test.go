@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reminderTestStore отдаёт заранее заданные напоминания и помнит отправленные
+type reminderTestStore struct {
+	preferences map[uuid.UUID]models.ReminderPreferences
+	due         []models.Reminder
+	sent        map[models.Reminder]bool
+}
+
+func (s *reminderTestStore) GetReminderPreferences(ctx context.Context, userID uuid.UUID) (*models.ReminderPreferences, error) {
+	preferences, ok := s.preferences[userID]
+	if !ok {
+		preferences = models.NewReminderPreferences(userID)
+	}
+	return &preferences, nil
+}
+
+func (s *reminderTestStore) UpsertReminderPreferences(ctx context.Context, preferences *models.ReminderPreferences) error {
+	s.preferences[preferences.UserID] = *preferences
+	return nil
+}
+
+func (s *reminderTestStore) GetDueReminders(ctx context.Context, cardMonth time.Time, now time.Time) ([]models.Reminder, error) {
+	var reminders []models.Reminder
+	for _, reminder := range s.due {
+		if !s.sent[reminder] {
+			reminders = append(reminders, reminder)
+		}
+	}
+	return reminders, nil
+}
+
+func (s *reminderTestStore) ClaimReminders(ctx context.Context, reminders []models.Reminder, sentAt time.Time) ([]models.Reminder, error) {
+	var claimed []models.Reminder
+	for _, reminder := range reminders {
+		if !s.sent[reminder] {
+			s.sent[reminder] = true
+			claimed = append(claimed, reminder)
+		}
+	}
+	return claimed, nil
+}
+
+func (s *reminderTestStore) UnclaimReminders(ctx context.Context, reminders []models.Reminder) error {
+	for _, reminder := range reminders {
+		delete(s.sent, reminder)
+	}
+	return nil
+}
+
+func TestReminderService(t *testing.T) {
+	ctx := context.Background()
+	firstID, secondID := uuid.New(), uuid.New()
+	cardMonth := time.Date(2030, time.March, 1, 0, 0, 0, 0, time.UTC)
+	store := &reminderTestStore{
+		preferences: make(map[uuid.UUID]models.ReminderPreferences),
+		due: []models.Reminder{
+			{Kind: models.ReminderCardExpiry, UserID: firstID, DataID: uuid.New(), Name: "visa", DueAt: cardMonth},
+			{Kind: models.ReminderCredentialRotation, UserID: firstID, DataID: uuid.New(), Name: "mail", DueAt: cardMonth.AddDate(0, -2, 0)},
+			{Kind: models.ReminderCardExpiry, UserID: secondID, DataID: uuid.New(), Name: "mastercard", DueAt: cardMonth},
+		},
+		sent: make(map[models.Reminder]bool),
+	}
+	emailSender := &recordingEmailSender{}
+	service := NewReminderService(store, fakeUserDirectory{"first@example.com": firstID, "second@example.com": secondID}, emailSender)
+
+	t.Run("DefaultPreferences", func(t *testing.T) {
+		preferences, err := service.GetPreferences(ctx, firstID)
+		require.NoError(t, err)
+		assert.True(t, preferences.CardExpiry)
+		assert.True(t, preferences.CredentialRotation)
+	})
+
+	t.Run("UpdateOnlyGivenPreference", func(t *testing.T) {
+		disabled := false
+		preferences, err := service.UpdatePreferences(ctx, secondID, nil, &disabled)
+		require.NoError(t, err)
+		assert.True(t, preferences.CardExpiry)
+		assert.False(t, preferences.CredentialRotation)
+		assert.False(t, store.preferences[secondID].CredentialRotation)
+	})
+
+	t.Run("SendFailureRetried", func(t *testing.T) {
+		emailSender.err = errors.New("smtp unavailable")
+		sent, err := service.SendReminders(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, sent)
+		assert.Empty(t, store.sent)
+		emailSender.err = nil
+	})
+
+	t.Run("DigestPerUserOnce", func(t *testing.T) {
+		sent, err := service.SendReminders(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 3, sent)
+		assert.ElementsMatch(t, []string{"first@example.com", "second@example.com"}, emailSender.recipients)
+
+		sent, err = service.SendReminders(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, sent)
+		assert.Len(t, emailSender.recipients, 2)
+	})
+}
+
+func TestReminderDigest(t *testing.T) {
+	body := reminderDigest([]models.Reminder{
+		{Kind: models.ReminderCredentialRotation, Name: "mail", DueAt: time.Date(2030, time.January, 15, 0, 0, 0, 0, time.UTC)},
+		{Kind: models.ReminderCardExpiry, Name: "visa", DueAt: time.Date(2030, time.March, 1, 0, 0, 0, 0, time.UTC)},
+	})
+	assert.Contains(t, body, "- visa (до конца 03.2030)")
+	assert.Contains(t, body, "- mail (нужно было сменить 15.01.2030)")
+	assert.Less(t, strings.Index(body, "visa"), strings.Index(body, "mail"))
+}
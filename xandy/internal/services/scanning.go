@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/eac0de/xandy/internal/blobstore"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/internal/scanner"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+// Сколько файлов проверяется за один проход
+const scanBatchSize = 100
+
+type IScanStore interface {
+	GetPendingUserFileData(ctx context.Context, limit int) ([]models.UserFileData, error)
+	SetUserFileScanResult(ctx context.Context, dataID uuid.UUID, blobKey string, status models.ScanStatus, result string, scannedAt time.Time) (bool, error)
+}
+
+// ScanService проверяет загруженные файлы сканером после сохранения.
+// Пока файл не проверен, его содержимое не отдаётся. Без сканера файлы помечаются непроверенными
+// и становятся доступны сразу.
+type ScanService struct {
+	store    IScanStore
+	contents *FileContentStore
+	scanner  scanner.Scanner
+}
+
+func NewScanService(scanStore IScanStore, contents *FileContentStore, contentScanner scanner.Scanner) *ScanService {
+	return &ScanService{
+		store:    scanStore,
+		contents: contents,
+		scanner:  contentScanner,
+	}
+}
+
+type scanOutcome struct {
+	status models.ScanStatus
+	result string
+}
+
+// ScanPending проверяет один пакет файлов, ожидающих проверки, и возвращает количество проверенных.
+// Если сканер недоступен, проход прерывается, а файлы остаются в ожидании.
+func (ss *ScanService) ScanPending(ctx context.Context) (int, error) {
+	userFileDataList, err := ss.store.GetPendingUserFileData(ctx, scanBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	// Одинаковое содержимое нескольких записей проверяется один раз
+	outcomes := make(map[string]scanOutcome)
+	scanned := 0
+	for _, userFileData := range userFileDataList {
+		outcome, ok := outcomes[userFileData.BlobKey]
+		if !ok {
+			outcome, err = ss.scan(ctx, userFileData.BlobKey)
+			if err != nil {
+				return scanned, err
+			}
+			outcomes[userFileData.BlobKey] = outcome
+		}
+		// Запись не обновится, если её содержимое заменили во время проверки
+		if _, err := ss.store.SetUserFileScanResult(ctx, userFileData.ID, userFileData.BlobKey, outcome.status, outcome.result, time.Now()); err != nil {
+			return scanned, err
+		}
+		scanned++
+	}
+	return scanned, nil
+}
+
+func (ss *ScanService) scan(ctx context.Context, key string) (scanOutcome, error) {
+	if ss.scanner == nil {
+		return scanOutcome{status: models.ScanStatusSkipped}, nil
+	}
+	content, _, err := ss.contents.Open(ctx, key)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			return scanOutcome{status: models.ScanStatusFailed, result: "File content not found"}, nil
+		}
+		return scanOutcome{}, err
+	}
+	defer content.Close()
+	result, err := ss.scanner.Scan(ctx, content)
+	if err != nil {
+		if errors.Is(err, scanner.ErrRejected) {
+			return scanOutcome{status: models.ScanStatusFailed, result: err.Error()}, nil
+		}
+		return scanOutcome{}, err
+	}
+	if result.Infected {
+		return scanOutcome{status: models.ScanStatusInfected, result: result.Signature}, nil
+	}
+	return scanOutcome{status: models.ScanStatusClean}, nil
+}
+
+// Run проверяет новые файлы раз в interval до отмены контекста.
+// Пока находятся файлы, пакеты проверяются подряд без ожидания.
+func (ss *ScanService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				scanned, err := ss.ScanPending(ctx)
+				if err != nil && ctx.Err() == nil {
+					log.Printf("scan pending files: %s\n", err)
+				}
+				if err != nil || scanned < scanBatchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// checkScanStatus не даёт скачать файл, который ещё не проверен или в котором найден вирус
+func checkScanStatus(userFileData *models.UserFileData) error {
+	switch userFileData.ScanStatus {
+	case models.ScanStatusClean, models.ScanStatusSkipped:
+		return nil
+	case models.ScanStatusPending:
+		return httperror.New(nil, fmt.Sprintf("File %s is waiting for a malware scan", userFileData.ID), http.StatusLocked)
+	case models.ScanStatusInfected:
+		return httperror.New(nil, fmt.Sprintf("File %s contains malware: %s", userFileData.ID, userFileData.ScanResult), http.StatusForbidden)
+	default:
+		return httperror.New(nil, fmt.Sprintf("File %s could not be scanned for malware", userFileData.ID), http.StatusForbidden)
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/internal/blobstore"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/internal/scanner"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scanStore хранит записи в fileDataStore и считает вызовы сохранения результата
+type scanStore struct {
+	*fileDataStore
+	results int
+}
+
+func (s *scanStore) GetPendingUserFileData(ctx context.Context, limit int) ([]models.UserFileData, error) {
+	var pending []models.UserFileData
+	for _, userFileData := range s.files {
+		if userFileData.ScanStatus == models.ScanStatusPending && len(pending) < limit {
+			pending = append(pending, userFileData)
+		}
+	}
+	return pending, nil
+}
+
+func (s *scanStore) SetUserFileScanResult(ctx context.Context, dataID uuid.UUID, blobKey string, status models.ScanStatus, result string, scannedAt time.Time) (bool, error) {
+	s.results++
+	for i := range s.files {
+		userFileData := &s.files[i]
+		if userFileData.ID == dataID && userFileData.BlobKey == blobKey && userFileData.ScanStatus == models.ScanStatusPending {
+			userFileData.ScanStatus = status
+			userFileData.ScanResult = result
+			userFileData.ScannedAt = &scannedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// countingScanner считает проверки и может притвориться недоступным
+type countingScanner struct {
+	scanner.Scanner
+	scans int
+	err   error
+}
+
+func (cs *countingScanner) Scan(ctx context.Context, content io.Reader) (scanner.Result, error) {
+	cs.scans++
+	if cs.err != nil {
+		return scanner.Result{}, cs.err
+	}
+	return cs.Scanner.Scan(ctx, content)
+}
+
+func newScanTestStore(t *testing.T, userID uuid.UUID, contents ...string) (*scanStore, *FileContentStore) {
+	ctx := context.Background()
+	fileContentStore := NewFileContentStore(blobstore.NewLocalStore(t.TempDir()), &memoryFileBlobStore{refs: make(map[string]int)})
+	store := &scanStore{fileDataStore: &fileDataStore{}}
+	for _, content := range contents {
+		userFileData, err := models.NewUserFileData("file", userID, models.Metadata{}, ".txt", "file.txt")
+		require.NoError(t, err)
+		stored, err := fileContentStore.Save(ctx, strings.NewReader(content))
+		require.NoError(t, err)
+		stored.apply(&userFileData)
+		store.files = append(store.files, userFileData)
+	}
+	return store, fileContentStore
+}
+
+func TestScanServiceScanPending(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	infected := `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+	store, contents := newScanTestStore(t, userID, "clean content", infected, "clean content")
+	assert.Equal(t, models.ScanStatusPending, store.files[0].ScanStatus)
+
+	contentScanner := &countingScanner{Scanner: scanner.NewFakeScanner(), err: errors.New("connection refused")}
+	service := NewScanService(store, contents, contentScanner)
+
+	// Сканер недоступен: файлы остаются в ожидании
+	_, err := service.ScanPending(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, models.ScanStatusPending, store.files[0].ScanStatus)
+
+	contentScanner.err = nil
+	contentScanner.scans = 0
+	scanned, err := service.ScanPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, scanned)
+	// Одинаковое содержимое проверяется один раз
+	assert.Equal(t, 2, contentScanner.scans)
+	assert.Equal(t, models.ScanStatusClean, store.files[0].ScanStatus)
+	assert.Equal(t, models.ScanStatusClean, store.files[2].ScanStatus)
+	assert.Equal(t, models.ScanStatusInfected, store.files[1].ScanStatus)
+	assert.Equal(t, "Eicar-Test-Signature", store.files[1].ScanResult)
+	assert.NotNil(t, store.files[1].ScannedAt)
+
+	scanned, err = service.ScanPending(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, scanned)
+
+	// Содержимое, отклонённое сканером, и пропавшее содержимое не проверить
+	store, contents = newScanTestStore(t, userID, "too large", "missing")
+	require.NoError(t, contents.Release(ctx, store.files[1].BlobKey))
+	service = NewScanService(store, contents, &countingScanner{err: scanner.ErrRejected})
+	_, err = service.ScanPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, models.ScanStatusFailed, store.files[0].ScanStatus)
+	assert.Equal(t, models.ScanStatusFailed, store.files[1].ScanStatus)
+	assert.Equal(t, "File content not found", store.files[1].ScanResult)
+}
+
+func TestScanServiceWithoutScanner(t *testing.T) {
+	store, contents := newScanTestStore(t, uuid.New(), "content")
+	scanned, err := NewScanService(store, contents, nil).ScanPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, scanned)
+	assert.Equal(t, models.ScanStatusSkipped, store.files[0].ScanStatus)
+}
+
+func TestGetUserFileContentScanStatus(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	store, contents := newScanTestStore(t, userID, "content")
+	service := NewUserDataService(store.fileDataStore, contents, NewQuotaService(nil, Quotas{}), nil)
+	dataID := store.files[0].ID
+
+	for status, want := range map[models.ScanStatus]int{
+		models.ScanStatusPending:  http.StatusLocked,
+		models.ScanStatusInfected: http.StatusForbidden,
+		models.ScanStatusFailed:   http.StatusForbidden,
+	} {
+		store.files[0].ScanStatus = status
+		_, _, err := service.GetUserFileContent(ctx, dataID, userID)
+		require.Error(t, err, status)
+		_, statusCode := httperror.GetMessageAndStatusCode(err)
+		assert.Equal(t, want, statusCode, status)
+	}
+
+	for _, status := range []models.ScanStatus{models.ScanStatusClean, models.ScanStatusSkipped} {
+		store.files[0].ScanStatus = status
+		_, content, err := service.GetUserFileContent(ctx, dataID, userID)
+		require.NoError(t, err, status)
+		data, _ := io.ReadAll(content)
+		content.Close()
+		assert.Equal(t, "content", string(data))
+	}
+}
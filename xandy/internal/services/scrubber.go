@@ -0,0 +1,346 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eac0de/xandy/internal/blobstore"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+// Префикс ключей, под которые переносится содержимое на карантин
+const quarantinePrefix = "quarantine/"
+
+type IScrubStore interface {
+	GetAllUserFileData(ctx context.Context) ([]models.UserFileData, error)
+	UpdateUserFileDigest(ctx context.Context, dataID uuid.UUID, blobKey string, sha256 string, size int64) error
+	GetFileBlob(ctx context.Context, key string) (*models.FileBlob, error)
+	ListFileBlobs(ctx context.Context) ([]models.FileBlob, error)
+	RecountFileBlob(ctx context.Context, key string, unchangedSince time.Time) (bool, error)
+}
+
+type ScrubIssueKind string
+
+const (
+	// Содержимое, на которое не ссылается ни одна запись
+	ScrubOrphanBlob ScrubIssueKind = "orphan_blob"
+	// Запись, содержимого которой нет в BlobStore
+	ScrubMissingBlob ScrubIssueKind = "missing_blob"
+	// SHA-256 содержимого не совпадает с ключом или с записями
+	ScrubCorruptBlob ScrubIssueKind = "corrupt_blob"
+	// Счётчик ссылок в file_blobs не совпадает с количеством записей
+	ScrubRefCount ScrubIssueKind = "ref_count"
+	// Размер или SHA-256 в записи не совпадают с содержимым
+	ScrubFileDigest ScrubIssueKind = "file_digest"
+)
+
+// Что сделано с найденной проблемой
+const (
+	ScrubActionRepaired    = "repaired"
+	ScrubActionDeleted     = "deleted"
+	ScrubActionQuarantined = "quarantined"
+)
+
+type ScrubIssue struct {
+	Kind   ScrubIssueKind `json:"kind"`
+	Key    string         `json:"key"`
+	FileID *uuid.UUID     `json:"file_id,omitempty"`
+	Detail string         `json:"detail"`
+	// Пусто, если проблема только обнаружена
+	Action string `json:"action,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ScrubReport struct {
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at"`
+	Blobs      int          `json:"blobs"`
+	Files      int          `json:"files"`
+	Verified   int          `json:"verified"`
+	Issues     []ScrubIssue `json:"issues"`
+}
+
+type ScrubOptions struct {
+	// Перечитывать всё содержимое и сверять SHA-256
+	Verify bool
+	// Исправлять счётчики ссылок, размер и SHA-256 в записях, удалять содержимое без записей
+	Repair bool
+	// Переносить содержимое без записей и повреждённое содержимое в quarantine/ вместо удаления
+	Quarantine bool
+	// Содержимое и ссылки, изменённые позже, не исправляются:
+	// они могут принадлежать загрузке, которая ещё не закончилась
+	GracePeriod time.Duration
+}
+
+// Scrubber сверяет записи UserFileData, счётчики ссылок в file_blobs и содержимое в BlobStore.
+// Без Repair и Quarantine только сообщает о найденных проблемах.
+type Scrubber struct {
+	store IScrubStore
+	blobs blobstore.BlobStore
+}
+
+func NewScrubber(scrubStore IScrubStore, blobs blobstore.BlobStore) *Scrubber {
+	return &Scrubber{
+		store: scrubStore,
+		blobs: blobs,
+	}
+}
+
+type scrubRun struct {
+	*Scrubber
+	opts   ScrubOptions
+	cutoff time.Time
+	report *ScrubReport
+}
+
+func (sr *scrubRun) issue(issue ScrubIssue, action func() (string, error)) {
+	if action != nil {
+		var err error
+		issue.Action, err = action()
+		if err != nil {
+			issue.Action = ""
+			issue.Error = err.Error()
+		}
+	}
+	sr.report.Issues = append(sr.report.Issues, issue)
+}
+
+func (s *Scrubber) Run(ctx context.Context, opts ScrubOptions) (*ScrubReport, error) {
+	sr := &scrubRun{
+		Scrubber: s,
+		opts:     opts,
+		cutoff:   time.Now().Add(-opts.GracePeriod),
+		report:   &ScrubReport{StartedAt: time.Now(), Issues: []ScrubIssue{}},
+	}
+
+	// Содержимое перечисляется первым: всё, что появится позже, уже будет иметь ссылку.
+	// Перечисляются только ключи содержимого, в хранилище могут быть и чужие объекты
+	blobs := make(map[string]blobstore.Info)
+	err := s.blobs.List(ctx, contentKeyPrefix, func(key string, info blobstore.Info) error {
+		blobs[key] = info
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fileBlobList, err := s.store.ListFileBlobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fileBlobs := make(map[string]models.FileBlob, len(fileBlobList))
+	for _, fileBlob := range fileBlobList {
+		fileBlobs[fileBlob.Key] = fileBlob
+	}
+	userFileDataList, err := s.store.GetAllUserFileData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]models.UserFileData)
+	for _, userFileData := range userFileDataList {
+		files[userFileData.BlobKey] = append(files[userFileData.BlobKey], userFileData)
+	}
+	// Ключи, сохранённые до перехода на SHA-256, в список не попадают и проверяются по записям
+	for key := range files {
+		if _, ok := blobs[key]; ok || strings.HasPrefix(key, contentKeyPrefix) {
+			continue
+		}
+		info, err := s.blobs.Stat(ctx, key)
+		if err != nil {
+			if errors.Is(err, blobstore.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		blobs[key] = info
+	}
+	sr.report.Blobs = len(blobs)
+	sr.report.Files = len(userFileDataList)
+
+	keys := make(map[string]bool, len(blobs)+len(fileBlobs)+len(files))
+	for key := range blobs {
+		keys[key] = true
+	}
+	for key := range fileBlobs {
+		keys[key] = true
+	}
+	for key := range files {
+		keys[key] = true
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	for _, key := range sortedKeys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		info, hasBlob := blobs[key]
+		fileBlob, hasRef := fileBlobs[key]
+		if len(files[key]) > 0 {
+			sr.checkFiles(ctx, key, files[key], info, hasBlob)
+		} else if hasBlob {
+			sr.checkOrphan(ctx, key, info, fileBlob, hasRef)
+			continue
+		}
+		sr.checkRefCount(ctx, key, int64(len(files[key])), fileBlob)
+	}
+	sr.report.FinishedAt = time.Now()
+	return sr.report, nil
+}
+
+// checkFiles проверяет содержимое, на которое ссылаются записи
+func (sr *scrubRun) checkFiles(ctx context.Context, key string, files []models.UserFileData, info blobstore.Info, hasBlob bool) {
+	if !hasBlob {
+		for _, userFileData := range files {
+			sr.issue(ScrubIssue{Kind: ScrubMissingBlob, Key: key, FileID: &userFileData.ID, Detail: "File content is missing"}, nil)
+		}
+		return
+	}
+	sum := ""
+	if sr.opts.Verify {
+		var size int64
+		var err error
+		sum, size, err = sr.digest(ctx, key)
+		if err != nil {
+			sr.issue(ScrubIssue{Kind: ScrubCorruptBlob, Key: key, Detail: "Content can not be read", Error: err.Error()}, nil)
+			return
+		}
+		sr.report.Verified++
+		if expected := expectedSHA256(key, files); expected != "" && expected != sum {
+			sr.issue(ScrubIssue{Kind: ScrubCorruptBlob, Key: key, Detail: fmt.Sprintf("SHA-256 is %s, expected %s", sum, expected)}, func() (string, error) {
+				if !sr.opts.Quarantine {
+					return "", nil
+				}
+				return ScrubActionQuarantined, sr.quarantine(ctx, key, size)
+			})
+			return
+		}
+		info.Size = size
+	}
+	for _, userFileData := range files {
+		if userFileData.Size == info.Size && (sum == "" || userFileData.SHA256 == sum) {
+			continue
+		}
+		digest := sum
+		if digest == "" {
+			digest = userFileData.SHA256
+		}
+		sr.issue(ScrubIssue{
+			Kind:   ScrubFileDigest,
+			Key:    key,
+			FileID: &userFileData.ID,
+			Detail: fmt.Sprintf("Record has size %d and SHA-256 %q, content has size %d and SHA-256 %q", userFileData.Size, userFileData.SHA256, info.Size, sum),
+		}, func() (string, error) {
+			if !sr.opts.Repair {
+				return "", nil
+			}
+			return ScrubActionRepaired, sr.store.UpdateUserFileDigest(ctx, userFileData.ID, key, digest, info.Size)
+		})
+	}
+}
+
+// checkOrphan проверяет содержимое, на которое не ссылается ни одна запись
+func (sr *scrubRun) checkOrphan(ctx context.Context, key string, info blobstore.Info, fileBlob models.FileBlob, hasRef bool) {
+	// Загрузка получает ссылку до записи содержимого и создаёт запись после,
+	// поэтому недавнее содержимое может быть ещё не сохранённым файлом
+	if info.ModTime.After(sr.cutoff) || (hasRef && fileBlob.UpdatedAt.After(sr.cutoff)) {
+		return
+	}
+	if hasRef {
+		sr.checkRefCount(ctx, key, 0, fileBlob)
+	}
+	sr.issue(ScrubIssue{Kind: ScrubOrphanBlob, Key: key, Detail: fmt.Sprintf("Content of %d bytes is not referenced", info.Size)}, func() (string, error) {
+		if !sr.opts.Quarantine && !sr.opts.Repair {
+			return "", nil
+		}
+		// Пока шла проверка, на содержимое могла появиться ссылка
+		current, err := sr.store.GetFileBlob(ctx, key)
+		if err == nil && (!hasRef || current.UpdatedAt.After(fileBlob.UpdatedAt)) {
+			return "", fmt.Errorf("content was referenced during the check")
+		}
+		if err != nil {
+			if _, statusCode := httperror.GetMessageAndStatusCode(err); statusCode != http.StatusNotFound {
+				return "", err
+			}
+		}
+		if sr.opts.Quarantine {
+			return ScrubActionQuarantined, sr.quarantine(ctx, key, info.Size)
+		}
+		return ScrubActionDeleted, sr.blobs.Delete(ctx, key)
+	})
+}
+
+// checkRefCount сверяет счётчик ссылок с количеством записей
+func (sr *scrubRun) checkRefCount(ctx context.Context, key string, want int64, fileBlob models.FileBlob) {
+	// Лишняя недавняя ссылка может принадлежать загрузке, которая ещё не создала запись
+	if fileBlob.RefCount == want || (fileBlob.RefCount > want && fileBlob.UpdatedAt.After(sr.cutoff)) {
+		return
+	}
+	sr.issue(ScrubIssue{Kind: ScrubRefCount, Key: key, Detail: fmt.Sprintf("Reference count is %d, records %d", fileBlob.RefCount, want)}, func() (string, error) {
+		if !sr.opts.Repair {
+			return "", nil
+		}
+		recounted, err := sr.store.RecountFileBlob(ctx, key, sr.cutoff)
+		if err != nil || !recounted {
+			return "", err
+		}
+		return ScrubActionRepaired, nil
+	})
+}
+
+func (sr *scrubRun) digest(ctx context.Context, key string) (string, int64, error) {
+	body, err := sr.blobs.Get(ctx, key, 0, -1)
+	if err != nil {
+		return "", 0, err
+	}
+	defer body.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, body)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// quarantine переносит содержимое под префикс quarantine/, записи продолжают ссылаться на старый ключ
+func (sr *scrubRun) quarantine(ctx context.Context, key string, size int64) error {
+	body, err := sr.blobs.Get(ctx, key, 0, -1)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	defer body.Close()
+	if err := sr.blobs.Put(ctx, quarantinePrefix+key, body, size); err != nil {
+		return err
+	}
+	return sr.blobs.Delete(ctx, key)
+}
+
+// expectedSHA256 берёт хеш из ключа, а для ключей, сохранённых до перехода на SHA-256, из записей
+func expectedSHA256(key string, files []models.UserFileData) string {
+	if strings.HasPrefix(key, contentKeyPrefix) {
+		return path.Base(key)
+	}
+	for _, userFileData := range files {
+		if userFileData.SHA256 != "" {
+			return userFileData.SHA256
+		}
+	}
+	return ""
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/internal/blobstore"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type scrubStore struct {
+	files     []models.UserFileData
+	fileBlobs map[string]models.FileBlob
+}
+
+func (s *scrubStore) GetAllUserFileData(ctx context.Context) ([]models.UserFileData, error) {
+	return append([]models.UserFileData(nil), s.files...), nil
+}
+
+func (s *scrubStore) UpdateUserFileDigest(ctx context.Context, dataID uuid.UUID, blobKey string, sha256 string, size int64) error {
+	for i := range s.files {
+		if s.files[i].ID == dataID && s.files[i].BlobKey == blobKey {
+			s.files[i].SHA256 = sha256
+			s.files[i].Size = size
+		}
+	}
+	return nil
+}
+
+func (s *scrubStore) GetFileBlob(ctx context.Context, key string) (*models.FileBlob, error) {
+	fileBlob, ok := s.fileBlobs[key]
+	if !ok {
+		return nil, httperror.New(nil, "FileBlob not found", http.StatusNotFound)
+	}
+	return &fileBlob, nil
+}
+
+func (s *scrubStore) ListFileBlobs(ctx context.Context) ([]models.FileBlob, error) {
+	var fileBlobs []models.FileBlob
+	for _, fileBlob := range s.fileBlobs {
+		fileBlobs = append(fileBlobs, fileBlob)
+	}
+	return fileBlobs, nil
+}
+
+func (s *scrubStore) RecountFileBlob(ctx context.Context, key string, unchangedSince time.Time) (bool, error) {
+	fileBlob, ok := s.fileBlobs[key]
+	if ok && !fileBlob.UpdatedAt.Before(unchangedSince) {
+		return false, nil
+	}
+	var refCount int64
+	for _, userFileData := range s.files {
+		if userFileData.BlobKey == key {
+			refCount++
+		}
+	}
+	if refCount == 0 {
+		delete(s.fileBlobs, key)
+		return ok, nil
+	}
+	s.fileBlobs[key] = models.FileBlob{Key: key, RefCount: refCount, UpdatedAt: time.Now()}
+	return true, nil
+}
+
+func sha256Key(content string) (string, string) {
+	sum := sha256.Sum256([]byte(content))
+	hexSum := hex.EncodeToString(sum[:])
+	return contentKey(hexSum), hexSum
+}
+
+func TestScrubber(t *testing.T) {
+	ctx := context.Background()
+	blobs := blobstore.NewLocalStore(t.TempDir())
+	old := time.Now().Add(-2 * time.Hour)
+
+	goodKey, goodSum := sha256Key("good")
+	corruptKey, corruptSum := sha256Key("original")
+	orphanKey, _ := sha256Key("orphan")
+	missingKey, _ := sha256Key("missing")
+	legacyKey := uuid.NewString() + "/report.pdf"
+	for key, content := range map[string]string{goodKey: "good", corruptKey: "bit rot", orphanKey: "orphan", legacyKey: "legacy"} {
+		require.NoError(t, blobs.Put(ctx, key, strings.NewReader(content), int64(len(content))))
+	}
+
+	good := models.UserFileData{BaseUserData: models.BaseUserData{ID: uuid.New()}, BlobKey: goodKey, SHA256: goodSum, Size: 4}
+	corrupt := models.UserFileData{BaseUserData: models.BaseUserData{ID: uuid.New()}, BlobKey: corruptKey, SHA256: corruptSum, Size: 7}
+	missing := models.UserFileData{BaseUserData: models.BaseUserData{ID: uuid.New()}, BlobKey: missingKey, Size: 7}
+	// Файл, загруженный до появления размера и SHA-256 в записи
+	legacy := models.UserFileData{BaseUserData: models.BaseUserData{ID: uuid.New()}, BlobKey: legacyKey}
+	store := &scrubStore{
+		files: []models.UserFileData{good, corrupt, missing, legacy},
+		fileBlobs: map[string]models.FileBlob{
+			goodKey:    {Key: goodKey, RefCount: 2, UpdatedAt: old},
+			corruptKey: {Key: corruptKey, RefCount: 1, UpdatedAt: old},
+			missingKey: {Key: missingKey, RefCount: 1, UpdatedAt: old},
+			legacyKey:  {Key: legacyKey, RefCount: 1, UpdatedAt: old},
+		},
+	}
+	scrubber := NewScrubber(store, blobs)
+
+	issueKinds := func(report *ScrubReport) map[string]ScrubIssueKind {
+		kinds := map[string]ScrubIssueKind{}
+		for _, issue := range report.Issues {
+			kinds[issue.Key] = issue.Kind
+		}
+		return kinds
+	}
+
+	t.Run("ReportOnly", func(t *testing.T) {
+		report, err := scrubber.Run(ctx, ScrubOptions{Verify: true})
+		require.NoError(t, err)
+		assert.Equal(t, 4, report.Blobs)
+		assert.Equal(t, 4, report.Files)
+		assert.Equal(t, 3, report.Verified)
+		assert.Equal(t, map[string]ScrubIssueKind{
+			goodKey:    ScrubRefCount,
+			corruptKey: ScrubCorruptBlob,
+			orphanKey:  ScrubOrphanBlob,
+			missingKey: ScrubMissingBlob,
+			legacyKey:  ScrubFileDigest,
+		}, issueKinds(report))
+		for _, issue := range report.Issues {
+			assert.Empty(t, issue.Action)
+		}
+		_, err = blobs.Stat(ctx, orphanKey)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), store.fileBlobs[goodKey].RefCount)
+	})
+
+	t.Run("GracePeriod", func(t *testing.T) {
+		// Недавнее содержимое без записей может быть ещё не законченной загрузкой
+		report, err := scrubber.Run(ctx, ScrubOptions{GracePeriod: time.Hour})
+		require.NoError(t, err)
+		assert.NotContains(t, issueKinds(report), orphanKey)
+	})
+
+	t.Run("RepairAndQuarantine", func(t *testing.T) {
+		report, err := scrubber.Run(ctx, ScrubOptions{Verify: true, Repair: true, Quarantine: true})
+		require.NoError(t, err)
+		actions := map[string]string{}
+		for _, issue := range report.Issues {
+			assert.Empty(t, issue.Error)
+			actions[issue.Key] = issue.Action
+		}
+		assert.Equal(t, map[string]string{
+			goodKey:    ScrubActionRepaired,
+			legacyKey:  ScrubActionRepaired,
+			corruptKey: ScrubActionQuarantined,
+			orphanKey:  ScrubActionQuarantined,
+			missingKey: "",
+		}, actions)
+
+		assert.Equal(t, int64(1), store.fileBlobs[goodKey].RefCount)
+		_, err = blobs.Stat(ctx, orphanKey)
+		assert.ErrorIs(t, err, blobstore.ErrNotFound)
+		_, err = blobs.Stat(ctx, quarantinePrefix+orphanKey)
+		assert.NoError(t, err)
+		_, err = blobs.Stat(ctx, quarantinePrefix+corruptKey)
+		assert.NoError(t, err)
+		legacySum := sha256.Sum256([]byte("legacy"))
+		assert.Equal(t, hex.EncodeToString(legacySum[:]), store.files[3].SHA256)
+		assert.Equal(t, int64(6), store.files[3].Size)
+	})
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/internal/secretlink"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// Наибольший срок жизни одноразовой ссылки
+	MaxShareLinkTTL = 30 * 24 * time.Hour
+	// После стольких неверных фраз-паролей подряд ссылка уничтожается
+	MaxShareLinkPassphraseAttempts = 5
+)
+
+type IShareLinkStore interface {
+	InsertShareLink(ctx context.Context, shareLink *models.ShareLink) error
+	GetActiveShareLink(ctx context.Context, linkID uuid.UUID, now time.Time) (*models.ShareLink, error)
+	CountShareLinkAttempt(ctx context.Context, linkID uuid.UUID, now time.Time, maxAttempts int) (int, error)
+	BurnShareLink(ctx context.Context, linkID uuid.UUID) error
+	ViewShareLink(ctx context.Context, linkID uuid.UUID, now time.Time) (*models.ShareLink, error)
+	GetDataShareLinks(ctx context.Context, ownerID uuid.UUID, dataID uuid.UUID, now time.Time) ([]models.ShareLink, error)
+	DeleteShareLink(ctx context.Context, linkID uuid.UUID, ownerID uuid.UUID) error
+	DeleteInactiveShareLinks(ctx context.Context, now time.Time) (int, error)
+}
+
+// shareLinkSnapshot - содержимое записи, которое шифруется в ссылку
+type shareLinkSnapshot struct {
+	DataKind models.DataKind `json:"data_kind"`
+	Name     string          `json:"name"`
+	Data     string          `json:"data,omitempty"`
+	Login    string          `json:"login,omitempty"`
+	Password string          `json:"password,omitempty"`
+}
+
+// ShareLinkService создаёт одноразовые ссылки на текстовые записи и учётные данные.
+// В ссылку попадает снимок записи на момент создания, зашифрованный ключом,
+// который сервер отдаёт создателю и сразу забывает.
+type ShareLinkService struct {
+	store    IShareLinkStore
+	userData *UserDataService
+}
+
+func NewShareLinkService(shareLinkStore IShareLinkStore, userData *UserDataService) *ShareLinkService {
+	return &ShareLinkService{
+		store:    shareLinkStore,
+		userData: userData,
+	}
+}
+
+// getSnapshot возвращает снимок личной записи владельца
+func (sls *ShareLinkService) getSnapshot(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID) (*shareLinkSnapshot, error) {
+	var snapshot shareLinkSnapshot
+	var record *models.BaseUserData
+	switch dataKind {
+	case models.KindAuthInfo:
+		userAuthInfo, err := sls.userData.getUserAuthInfo(ctx, dataID, ownerID)
+		if err != nil {
+			return nil, err
+		}
+		snapshot = shareLinkSnapshot{DataKind: dataKind, Name: userAuthInfo.Name, Login: userAuthInfo.Login, Password: userAuthInfo.Password}
+		record = &userAuthInfo.BaseUserData
+	case models.KindTextData:
+		userTextData, err := sls.userData.getUserTextData(ctx, dataID, ownerID)
+		if err != nil {
+			return nil, err
+		}
+		snapshot = shareLinkSnapshot{DataKind: dataKind, Name: userTextData.Name, Data: userTextData.Data}
+		record = &userTextData.BaseUserData
+	default:
+		return nil, httperror.New(nil, "Links can be created only for text data and auth info", http.StatusBadRequest)
+	}
+	if !record.Personal() {
+		return nil, httperror.New(nil, "Records of an organization can not be shared by link", http.StatusUnprocessableEntity)
+	}
+	return &snapshot, nil
+}
+
+// CreateLink создаёт ссылку и возвращает её вместе с ключом для фрагмента URL.
+// Пустая passphrase - ссылка открывается без фразы-пароля.
+func (sls *ShareLinkService) CreateLink(
+	ctx context.Context,
+	ownerID uuid.UUID,
+	dataKind models.DataKind,
+	dataID uuid.UUID,
+	ttl time.Duration,
+	maxViews int,
+	passphrase string,
+) (*models.ShareLink, string, error) {
+	if ttl < time.Minute || ttl > MaxShareLinkTTL {
+		return nil, "", httperror.New(nil, "Link lifetime must be from 1 minute to 30 days", http.StatusUnprocessableEntity)
+	}
+	snapshot, err := sls.getSnapshot(ctx, ownerID, dataKind, dataID)
+	if err != nil {
+		return nil, "", err
+	}
+	plaintext, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, "", err
+	}
+	content, secret, err := secretlink.Seal(plaintext)
+	if err != nil {
+		return nil, "", err
+	}
+	var passphraseHash []byte
+	if passphrase != "" {
+		passphraseHash, err = secretlink.HashPassphrase(passphrase)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	shareLink, err := models.NewShareLink(ownerID, dataKind, dataID, content, passphraseHash, maxViews, time.Now().Add(ttl))
+	if err != nil {
+		return nil, "", err
+	}
+	if err := sls.store.InsertShareLink(ctx, &shareLink); err != nil {
+		return nil, "", err
+	}
+	sls.userData.audit.recordEventChange(ctx, dataEvent(ctx, models.AuditActionLinkCreate, ownerID, dataKind, dataID, models.Metadata{
+		"link_id":    shareLink.ID,
+		"max_views":  shareLink.MaxViews,
+		"expires_at": shareLink.ExpiresAt,
+	}))
+	return &shareLink, secret, nil
+}
+
+// GetLinks возвращает действующие ссылки на запись владельца
+func (sls *ShareLinkService) GetLinks(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID) ([]models.ShareLink, error) {
+	if _, err := sls.getSnapshot(ctx, ownerID, dataKind, dataID); err != nil {
+		return nil, err
+	}
+	shareLinks, err := sls.store.GetDataShareLinks(ctx, ownerID, dataID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if shareLinks == nil {
+		shareLinks = []models.ShareLink{}
+	}
+	return shareLinks, nil
+}
+
+// RevokeLink удаляет ссылку до истечения срока
+func (sls *ShareLinkService) RevokeLink(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID, linkID uuid.UUID) error {
+	shareLinks, err := sls.GetLinks(ctx, ownerID, dataKind, dataID)
+	if err != nil {
+		return err
+	}
+	for _, shareLink := range shareLinks {
+		if shareLink.ID == linkID {
+			if err := sls.store.DeleteShareLink(ctx, linkID, ownerID); err != nil {
+				return err
+			}
+			sls.userData.audit.recordEventChange(ctx, dataEvent(ctx, models.AuditActionLinkRevoke, ownerID, dataKind, dataID, models.Metadata{"link_id": linkID}))
+			return nil
+		}
+	}
+	return httperror.New(nil, "Link not found", http.StatusNotFound)
+}
+
+// GetPublicLink возвращает сведения о ссылке, не расходуя просмотр
+func (sls *ShareLinkService) GetPublicLink(ctx context.Context, linkID uuid.UUID) (*models.PublicShareLink, error) {
+	shareLink, err := sls.store.GetActiveShareLink(ctx, linkID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	publicLink := models.NewPublicShareLink(shareLink)
+	return &publicLink, nil
+}
+
+// OpenLink расходует просмотр и возвращает зашифрованный снимок записи.
+// Неверная фраза-пароль просмотр не расходует, но после MaxShareLinkPassphraseAttempts
+// неверных фраз подряд ссылка уничтожается, чтобы фразу нельзя было подобрать.
+func (sls *ShareLinkService) OpenLink(ctx context.Context, linkID uuid.UUID, passphrase string) (*models.PublicShareLink, error) {
+	shareLink, err := sls.store.GetActiveShareLink(ctx, linkID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if shareLink.HasPassphrase() {
+		// Попытка засчитывается до проверки, иначе одновременные запросы обходили бы лимит
+		attempt, err := sls.store.CountShareLinkAttempt(ctx, linkID, time.Now(), MaxShareLinkPassphraseAttempts)
+		if err != nil {
+			return nil, err
+		}
+		if !secretlink.CheckPassphrase(shareLink.PassphraseHash, passphrase) {
+			if attempt < MaxShareLinkPassphraseAttempts {
+				return nil, httperror.New(nil, "Wrong passphrase", http.StatusForbidden)
+			}
+			if err := sls.store.BurnShareLink(ctx, linkID); err != nil {
+				return nil, err
+			}
+			return nil, httperror.New(nil, "Wrong passphrase, the link is destroyed after too many attempts", http.StatusForbidden)
+		}
+	}
+	shareLink, err = sls.store.ViewShareLink(ctx, linkID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	sls.userData.audit.recordEventChange(ctx, dataEvent(ctx, models.AuditActionLinkOpen, shareLink.OwnerID, shareLink.DataKind, shareLink.DataID, models.Metadata{
+		"link_id": shareLink.ID,
+		"views":   shareLink.Views,
+	}))
+	publicLink := models.NewPublicShareLink(shareLink)
+	publicLink.Content = shareLink.Content
+	return &publicLink, nil
+}
+
+// RunCleanup периодически удаляет истёкшие и использованные ссылки до отмены контекста
+func (sls *ShareLinkService) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := sls.store.DeleteInactiveShareLinks(ctx, time.Now())
+			if err != nil {
+				log.Printf("delete inactive share links: %s\n", err)
+			}
+			if deleted > 0 {
+				log.Printf("deleted %d inactive share links\n", deleted)
+			}
+		}
+	}
+}
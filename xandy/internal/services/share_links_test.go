@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/internal/blobstore"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/internal/secretlink"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shareLinkTestStore хранит ссылки в памяти поверх текстовых записей
+type shareLinkTestStore struct {
+	*shareTestStore
+	links    map[uuid.UUID]models.ShareLink
+	attempts map[uuid.UUID]int
+}
+
+func (s *shareLinkTestStore) InsertShareLink(ctx context.Context, shareLink *models.ShareLink) error {
+	s.links[shareLink.ID] = *shareLink
+	return nil
+}
+
+func (s *shareLinkTestStore) GetActiveShareLink(ctx context.Context, linkID uuid.UUID, now time.Time) (*models.ShareLink, error) {
+	shareLink, ok := s.links[linkID]
+	if !ok || shareLink.Views >= shareLink.MaxViews || !shareLink.ExpiresAt.After(now) {
+		return nil, httperror.New(nil, "Link not found or expired", http.StatusNotFound)
+	}
+	return &shareLink, nil
+}
+
+func (s *shareLinkTestStore) CountShareLinkAttempt(ctx context.Context, linkID uuid.UUID, now time.Time, maxAttempts int) (int, error) {
+	if _, err := s.GetActiveShareLink(ctx, linkID, now); err != nil {
+		return 0, err
+	}
+	if s.attempts[linkID] >= maxAttempts {
+		return 0, httperror.New(nil, "Link not found or expired", http.StatusNotFound)
+	}
+	s.attempts[linkID]++
+	return s.attempts[linkID], nil
+}
+
+func (s *shareLinkTestStore) BurnShareLink(ctx context.Context, linkID uuid.UUID) error {
+	shareLink := s.links[linkID]
+	shareLink.Views = shareLink.MaxViews
+	shareLink.Content = nil
+	s.links[linkID] = shareLink
+	return nil
+}
+
+func (s *shareLinkTestStore) ViewShareLink(ctx context.Context, linkID uuid.UUID, now time.Time) (*models.ShareLink, error) {
+	shareLink, err := s.GetActiveShareLink(ctx, linkID, now)
+	if err != nil {
+		return nil, err
+	}
+	delete(s.attempts, linkID)
+	viewed := *shareLink
+	shareLink.Views++
+	if shareLink.Views >= shareLink.MaxViews {
+		shareLink.Content = nil
+	}
+	s.links[linkID] = *shareLink
+	viewed.Views = shareLink.Views
+	return &viewed, nil
+}
+
+func (s *shareLinkTestStore) GetDataShareLinks(ctx context.Context, ownerID uuid.UUID, dataID uuid.UUID, now time.Time) ([]models.ShareLink, error) {
+	var shareLinks []models.ShareLink
+	for _, shareLink := range s.links {
+		if shareLink.OwnerID == ownerID && shareLink.DataID == dataID && shareLink.Views < shareLink.MaxViews && shareLink.ExpiresAt.After(now) {
+			shareLinks = append(shareLinks, shareLink)
+		}
+	}
+	return shareLinks, nil
+}
+
+func (s *shareLinkTestStore) DeleteShareLink(ctx context.Context, linkID uuid.UUID, ownerID uuid.UUID) error {
+	shareLink, ok := s.links[linkID]
+	if !ok || shareLink.OwnerID != ownerID {
+		return httperror.New(nil, "Link not found", http.StatusNotFound)
+	}
+	delete(s.links, linkID)
+	return nil
+}
+
+func (s *shareLinkTestStore) DeleteInactiveShareLinks(ctx context.Context, now time.Time) (int, error) {
+	deleted := 0
+	for id, shareLink := range s.links {
+		if shareLink.Views >= shareLink.MaxViews || !shareLink.ExpiresAt.After(now) {
+			delete(s.links, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func TestShareLinkService(t *testing.T) {
+	ctx := context.Background()
+	ownerID, strangerID := uuid.New(), uuid.New()
+	store := &shareLinkTestStore{
+		shareTestStore: &shareTestStore{
+			fileDataStore: &fileDataStore{},
+			texts:         make(map[uuid.UUID]models.UserTextData),
+			shares:        make(map[uuid.UUID]models.Share),
+		},
+		links:    make(map[uuid.UUID]models.ShareLink),
+		attempts: make(map[uuid.UUID]int),
+	}
+	contents := NewFileContentStore(blobstore.NewLocalStore(t.TempDir()), &memoryFileBlobStore{refs: make(map[string]int)})
+	service := NewShareLinkService(store, NewUserDataService(store, contents, NewQuotaService(nil, Quotas{}), nil))
+
+	note, err := models.NewUserTextData("wifi", ownerID, models.Metadata{}, "hunter2")
+	require.NoError(t, err)
+	store.texts[note.ID] = note
+
+	_, _, err = service.CreateLink(ctx, ownerID, models.KindBankCard, note.ID, time.Hour, 1, "")
+	assert.Equal(t, http.StatusBadRequest, statusCode(err))
+	_, _, err = service.CreateLink(ctx, ownerID, models.KindTextData, note.ID, MaxShareLinkTTL+time.Hour, 1, "")
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode(err))
+	_, _, err = service.CreateLink(ctx, ownerID, models.KindTextData, note.ID, time.Hour, 0, "")
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode(err))
+	// Ссылку можно создать только на свою запись
+	_, _, err = service.CreateLink(ctx, strangerID, models.KindTextData, note.ID, time.Hour, 1, "")
+	assert.Equal(t, http.StatusNotFound, statusCode(err))
+
+	shareLink, secret, err := service.CreateLink(ctx, ownerID, models.KindTextData, note.ID, time.Hour, 2, "open sesame")
+	require.NoError(t, err)
+	// Сервер хранит только зашифрованный снимок и хэш фразы-пароля
+	assert.NotContains(t, string(store.links[shareLink.ID].Content), "hunter2")
+	assert.NotContains(t, string(store.links[shareLink.ID].PassphraseHash), "open sesame")
+
+	publicLink, err := service.GetPublicLink(ctx, shareLink.ID)
+	require.NoError(t, err)
+	assert.True(t, publicLink.HasPassphrase)
+	assert.Equal(t, 2, publicLink.ViewsLeft)
+	assert.Empty(t, publicLink.Content)
+
+	// Неверная фраза-пароль не расходует просмотр
+	_, err = service.OpenLink(ctx, shareLink.ID, "wrong")
+	assert.Equal(t, http.StatusForbidden, statusCode(err))
+	assert.Equal(t, 0, store.links[shareLink.ID].Views)
+
+	for viewsLeft := 1; viewsLeft >= 0; viewsLeft-- {
+		opened, err := service.OpenLink(ctx, shareLink.ID, "open sesame")
+		require.NoError(t, err)
+		assert.Equal(t, viewsLeft, opened.ViewsLeft)
+		plaintext, err := secretlink.Open(opened.Content, secret)
+		require.NoError(t, err)
+		var snapshot map[string]string
+		require.NoError(t, json.Unmarshal(plaintext, &snapshot))
+		assert.Equal(t, "hunter2", snapshot["data"])
+	}
+	// После последнего просмотра ссылка сгорает
+	_, err = service.OpenLink(ctx, shareLink.ID, "open sesame")
+	assert.Equal(t, http.StatusNotFound, statusCode(err))
+	assert.Empty(t, store.links[shareLink.ID].Content)
+
+	shareLink, _, err = service.CreateLink(ctx, ownerID, models.KindTextData, note.ID, time.Hour, 1, "")
+	require.NoError(t, err)
+	links, err := service.GetLinks(ctx, ownerID, models.KindTextData, note.ID)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, shareLink.ID, links[0].ID)
+
+	assert.Equal(t, http.StatusNotFound, statusCode(service.RevokeLink(ctx, strangerID, models.KindTextData, note.ID, shareLink.ID)))
+	require.NoError(t, service.RevokeLink(ctx, ownerID, models.KindTextData, note.ID, shareLink.ID))
+	_, err = service.GetPublicLink(ctx, shareLink.ID)
+	assert.Equal(t, http.StatusNotFound, statusCode(err))
+
+	deleted, err := store.DeleteInactiveShareLinks(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+}
+
+func TestShareLinkServicePassphraseAttempts(t *testing.T) {
+	ctx := context.Background()
+	ownerID := uuid.New()
+	store := &shareLinkTestStore{
+		shareTestStore: &shareTestStore{
+			fileDataStore: &fileDataStore{},
+			texts:         make(map[uuid.UUID]models.UserTextData),
+			shares:        make(map[uuid.UUID]models.Share),
+		},
+		links:    make(map[uuid.UUID]models.ShareLink),
+		attempts: make(map[uuid.UUID]int),
+	}
+	contents := NewFileContentStore(blobstore.NewLocalStore(t.TempDir()), &memoryFileBlobStore{refs: make(map[string]int)})
+	service := NewShareLinkService(store, NewUserDataService(store, contents, NewQuotaService(nil, Quotas{}), nil))
+
+	note, err := models.NewUserTextData("wifi", ownerID, models.Metadata{}, "hunter2")
+	require.NoError(t, err)
+	store.texts[note.ID] = note
+	shareLink, _, err := service.CreateLink(ctx, ownerID, models.KindTextData, note.ID, time.Hour, 3, "open sesame")
+	require.NoError(t, err)
+
+	// Верная фраза-пароль обнуляет счётчик неверных попыток
+	for i := 1; i < MaxShareLinkPassphraseAttempts; i++ {
+		_, err = service.OpenLink(ctx, shareLink.ID, "wrong")
+		assert.Equal(t, http.StatusForbidden, statusCode(err))
+	}
+	_, err = service.OpenLink(ctx, shareLink.ID, "open sesame")
+	require.NoError(t, err)
+
+	for i := 1; i <= MaxShareLinkPassphraseAttempts; i++ {
+		_, err = service.OpenLink(ctx, shareLink.ID, "wrong")
+		assert.Equal(t, http.StatusForbidden, statusCode(err))
+	}
+	// После исчерпания попыток ссылка уничтожена и не открывается даже верной фразой
+	assert.Empty(t, store.links[shareLink.ID].Content)
+	_, err = service.OpenLink(ctx, shareLink.ID, "open sesame")
+	assert.Equal(t, http.StatusNotFound, statusCode(err))
+}
+
+func TestShareLinkServiceOrganizationRecord(t *testing.T) {
+	ctx := context.Background()
+	ownerID := uuid.New()
+	store := &shareLinkTestStore{
+		shareTestStore: &shareTestStore{
+			fileDataStore: &fileDataStore{},
+			texts:         make(map[uuid.UUID]models.UserTextData),
+			shares:        make(map[uuid.UUID]models.Share),
+		},
+		links:    make(map[uuid.UUID]models.ShareLink),
+		attempts: make(map[uuid.UUID]int),
+	}
+	contents := NewFileContentStore(blobstore.NewLocalStore(t.TempDir()), &memoryFileBlobStore{refs: make(map[string]int)})
+	service := NewShareLinkService(store, NewUserDataService(store, contents, NewQuotaService(nil, Quotas{}), nil))
+
+	note, err := models.NewUserTextData("team wifi", ownerID, models.Metadata{}, "hunter2")
+	require.NoError(t, err)
+	collectionID := uuid.New()
+	note.CollectionID = &collectionID
+	store.texts[note.ID] = note
+
+	_, _, err = service.CreateLink(ctx, ownerID, models.KindTextData, note.ID, time.Hour, 1, "")
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode(err))
+}
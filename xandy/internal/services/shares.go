@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/eac0de/xandy/internal/authclient"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+type IShareStore interface {
+	UpsertShare(ctx context.Context, share *models.Share) error
+	GetShare(ctx context.Context, shareID uuid.UUID) (*models.Share, error)
+	GetDataShares(ctx context.Context, ownerID uuid.UUID, dataID uuid.UUID) ([]models.Share, error)
+	GetGranteeShares(ctx context.Context, granteeID uuid.UUID, offset int) ([]models.Share, error)
+	DeleteShare(ctx context.Context, shareID uuid.UUID, userID uuid.UUID) error
+}
+
+type IUserDirectory interface {
+	GetUserByEmail(ctx context.Context, email string) (*authclient.User, error)
+	GetUserByID(ctx context.Context, userID uuid.UUID) (*authclient.User, error)
+}
+
+// RecordUpdate - новые значения полей записи, которые получатель меняет по доступу на запись.
+// Используются только поля вида записи, которой поделились.
+type RecordUpdate struct {
+	Name       string                 `json:"name"`
+	Metadata   map[string]interface{} `json:"metadata"`
+	Data       string                 `json:"data"`
+	Login      string                 `json:"login"`
+	Password   string                 `json:"password"`
+	Number     string                 `json:"number"`
+	CardHolder string                 `json:"card_holder"`
+	ExpireDate string                 `json:"expire_date"`
+	CSC        string                 `json:"csc"`
+}
+
+// ShareService даёт другим пользователям доступ к отдельным записям.
+// Получатель обращается к записи только через доступ, а сама запись читается и меняется
+// от имени владельца, поэтому запросы к записям по-прежнему ограничены user_id.
+type ShareService struct {
+	store    IShareStore
+	users    IUserDirectory
+	userData *UserDataService
+}
+
+func NewShareService(shareStore IShareStore, users IUserDirectory, userData *UserDataService) *ShareService {
+	return &ShareService{
+		store:    shareStore,
+		users:    users,
+		userData: userData,
+	}
+}
+
+// getOwnRecord возвращает личную запись владельца вместе с вложениями
+func (ss *ShareService) getOwnRecord(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID) (interface{}, error) {
+	var data interface{}
+	var record *models.BaseUserData
+	switch dataKind {
+	case models.KindAuthInfo:
+		userAuthInfo, err := ss.userData.getUserAuthInfo(ctx, dataID, ownerID)
+		if err != nil {
+			return nil, err
+		}
+		data, record = userAuthInfo, &userAuthInfo.BaseUserData
+	case models.KindTextData:
+		userTextData, err := ss.userData.getUserTextData(ctx, dataID, ownerID)
+		if err != nil {
+			return nil, err
+		}
+		data, record = userTextData, &userTextData.BaseUserData
+	case models.KindBankCard:
+		userBankCard, err := ss.userData.getUserBankCard(ctx, dataID, ownerID)
+		if err != nil {
+			return nil, err
+		}
+		data, record = userBankCard, &userBankCard.BaseUserData
+	case models.KindFileData:
+		userFileData, err := ss.userData.GetUserFileData(ctx, dataID, ownerID)
+		if err != nil {
+			return nil, err
+		}
+		if userFileData.ParentID != nil {
+			return nil, httperror.New(nil, "Attachments can not be shared, share the parent record instead", http.StatusUnprocessableEntity)
+		}
+		data, record = userFileData, &userFileData.BaseUserData
+	default:
+		return nil, httperror.New(nil, "Unknown data kind", http.StatusBadRequest)
+	}
+	// Доступом к записям организации управляют через коллекции
+	if !record.Personal() {
+		return nil, httperror.New(nil, "Records of an organization can not be shared, grant access to the collection instead", http.StatusUnprocessableEntity)
+	}
+	return data, nil
+}
+
+// ShareRecord даёт пользователю с адресом email доступ к записи владельца.
+// Повторный вызов для того же получателя меняет права и ключ.
+func (ss *ShareService) ShareRecord(
+	ctx context.Context,
+	ownerID uuid.UUID,
+	dataKind models.DataKind,
+	dataID uuid.UUID,
+	email string,
+	permission models.SharePermission,
+	encryptedKey string,
+) (*models.Share, error) {
+	if _, err := ss.getOwnRecord(ctx, ownerID, dataKind, dataID); err != nil {
+		return nil, err
+	}
+	grantee, err := ss.users.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if grantee.ID == ownerID {
+		return nil, httperror.New(nil, "You can not share a record with yourself", http.StatusUnprocessableEntity)
+	}
+	owner, err := ss.users.GetUserByID(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	share, err := models.NewShare(ownerID, owner.Email, grantee.ID, grantee.Email, dataKind, dataID, permission, encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := ss.store.UpsertShare(ctx, &share); err != nil {
+		return nil, err
+	}
+	ss.userData.audit.recordEventChange(ctx, dataEvent(ctx, models.AuditActionShare, ownerID, dataKind, dataID, models.Metadata{
+		"share_id":      share.ID,
+		"grantee_email": share.GranteeEmail,
+		"permission":    share.Permission,
+	}))
+	return &share, nil
+}
+
+func (ss *ShareService) GetRecordShares(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID) ([]models.Share, error) {
+	if _, err := ss.getOwnRecord(ctx, ownerID, dataKind, dataID); err != nil {
+		return nil, err
+	}
+	shares, err := ss.store.GetDataShares(ctx, ownerID, dataID)
+	if err != nil {
+		return nil, err
+	}
+	if shares == nil {
+		shares = []models.Share{}
+	}
+	return shares, nil
+}
+
+// RevokeShare отзывает доступ к записи владельца
+func (ss *ShareService) RevokeShare(ctx context.Context, ownerID uuid.UUID, dataKind models.DataKind, dataID uuid.UUID, shareID uuid.UUID) error {
+	share, err := ss.store.GetShare(ctx, shareID)
+	if err != nil {
+		return err
+	}
+	if share.OwnerID != ownerID || share.DataKind != dataKind || share.DataID != dataID {
+		return httperror.New(nil, "Share not found", http.StatusNotFound)
+	}
+	if err := ss.store.DeleteShare(ctx, shareID, ownerID); err != nil {
+		return err
+	}
+	ss.recordUnshare(ctx, share)
+	return nil
+}
+
+// LeaveShare убирает запись из списка получателя
+func (ss *ShareService) LeaveShare(ctx context.Context, granteeID uuid.UUID, shareID uuid.UUID) error {
+	share, err := ss.getGranteeShare(ctx, granteeID, shareID)
+	if err != nil {
+		return err
+	}
+	if err := ss.store.DeleteShare(ctx, shareID, granteeID); err != nil {
+		return err
+	}
+	ss.recordUnshare(ctx, share)
+	return nil
+}
+
+func (ss *ShareService) recordUnshare(ctx context.Context, share *models.Share) {
+	ss.userData.audit.recordEventChange(ctx, dataEvent(ctx, models.AuditActionUnshare, share.OwnerID, share.DataKind, share.DataID, models.Metadata{
+		"share_id":      share.ID,
+		"grantee_email": share.GranteeEmail,
+	}))
+}
+
+// getGranteeShare возвращает доступ, только если он выдан пользователю
+func (ss *ShareService) getGranteeShare(ctx context.Context, granteeID uuid.UUID, shareID uuid.UUID) (*models.Share, error) {
+	share, err := ss.store.GetShare(ctx, shareID)
+	if err != nil {
+		return nil, err
+	}
+	if share.GranteeID != granteeID {
+		return nil, httperror.New(nil, "Share not found", http.StatusNotFound)
+	}
+	return share, nil
+}
+
+// GetSharedWithMe возвращает доступы, выданные пользователю, без самих записей
+func (ss *ShareService) GetSharedWithMe(ctx context.Context, granteeID uuid.UUID, offset int) ([]models.Share, error) {
+	shares, err := ss.store.GetGranteeShares(ctx, granteeID, offset)
+	if err != nil {
+		return nil, err
+	}
+	if shares == nil {
+		shares = []models.Share{}
+	}
+	return shares, nil
+}
+
+func (ss *ShareService) GetSharedRecord(ctx context.Context, granteeID uuid.UUID, shareID uuid.UUID) (*models.SharedRecord, error) {
+	share, err := ss.getGranteeShare(ctx, granteeID, shareID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ss.getOwnRecord(ctx, share.OwnerID, share.DataKind, share.DataID)
+	if err != nil {
+		return nil, err
+	}
+	// Описание файла секретов не содержит, его содержимое записывается в журнал при скачивании
+	if share.DataKind != models.KindFileData {
+		auditEvent := dataEvent(ctx, models.AuditActionRead, share.OwnerID, share.DataKind, share.DataID, models.Metadata{"share_id": share.ID})
+		if err := ss.userData.audit.RecordEvent(ctx, auditEvent); err != nil {
+			return nil, err
+		}
+	}
+	return &models.SharedRecord{Share: *share, Data: data}, nil
+}
+
+// UpdateSharedRecord меняет поля записи, если у получателя есть доступ на запись
+func (ss *ShareService) UpdateSharedRecord(ctx context.Context, granteeID uuid.UUID, shareID uuid.UUID, update RecordUpdate) (*models.SharedRecord, error) {
+	share, err := ss.getGranteeShare(ctx, granteeID, shareID)
+	if err != nil {
+		return nil, err
+	}
+	if share.Permission != models.SharePermissionWrite {
+		return nil, httperror.New(nil, "Record is shared read-only", http.StatusForbidden)
+	}
+	var data interface{}
+	switch share.DataKind {
+	case models.KindAuthInfo:
+		data, err = ss.userData.UpdateUserAuthInfo(ctx, share.OwnerID, share.DataID, update.Name, update.Login, update.Password, update.Metadata)
+	case models.KindTextData:
+		data, err = ss.userData.UpdateUserTextData(ctx, share.OwnerID, share.DataID, update.Name, update.Data, update.Metadata)
+	case models.KindBankCard:
+		data, err = ss.userData.UpdateUserBankCard(ctx, share.OwnerID, share.DataID, update.Name, update.Number, update.CardHolder, update.ExpireDate, update.CSC, update.Metadata)
+	case models.KindFileData:
+		data, err = ss.userData.UpdateUserFileData(ctx, share.OwnerID, share.DataID, update.Name, update.Metadata)
+	default:
+		return nil, httperror.New(nil, "Unknown data kind", http.StatusBadRequest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &models.SharedRecord{Share: *share, Data: data}, nil
+}
+
+// GetSharedFileContent отдаёт содержимое файла, которым поделились, или вложения записи, которой поделились.
+// attachmentID равен nil для самого файла.
+func (ss *ShareService) GetSharedFileContent(ctx context.Context, granteeID uuid.UUID, shareID uuid.UUID, attachmentID *uuid.UUID) (*models.UserFileData, io.ReadSeekCloser, error) {
+	share, err := ss.getGranteeShare(ctx, granteeID, shareID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if attachmentID != nil {
+		return ss.userData.GetAttachmentContent(ctx, share.OwnerID, share.DataKind, share.DataID, *attachmentID)
+	}
+	if share.DataKind != models.KindFileData {
+		return nil, nil, httperror.New(nil, "Shared record is not a file", http.StatusBadRequest)
+	}
+	return ss.userData.GetUserFileContent(ctx, share.DataID, share.OwnerID)
+}
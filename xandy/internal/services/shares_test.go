@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/eac0de/xandy/internal/authclient"
+	"github.com/eac0de/xandy/internal/blobstore"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shareTestStore хранит доступы, текстовые записи и файлы в памяти
+type shareTestStore struct {
+	*fileDataStore
+	texts  map[uuid.UUID]models.UserTextData
+	shares map[uuid.UUID]models.Share
+}
+
+func (s *shareTestStore) GetUserTextData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserTextData, error) {
+	userTextData, ok := s.texts[dataID]
+	if !ok || userTextData.UserID != userID {
+		return nil, httperror.New(nil, "UserTextData not found", http.StatusNotFound)
+	}
+	return &userTextData, nil
+}
+
+func (s *shareTestStore) UpdateUserTextData(ctx context.Context, userTextData *models.UserTextData, userID uuid.UUID) error {
+	s.texts[userTextData.ID] = *userTextData
+	return nil
+}
+
+func (s *shareTestStore) GetUserFileDataAttachments(ctx context.Context, userID uuid.UUID, parentIDs []uuid.UUID) ([]models.UserFileData, error) {
+	var attachments []models.UserFileData
+	for _, userFileData := range s.files {
+		for _, parentID := range parentIDs {
+			if userFileData.UserID == userID && userFileData.ParentID != nil && *userFileData.ParentID == parentID {
+				attachments = append(attachments, userFileData)
+			}
+		}
+	}
+	return attachments, nil
+}
+
+func (s *shareTestStore) UpsertShare(ctx context.Context, share *models.Share) error {
+	for id, existing := range s.shares {
+		if existing.DataID == share.DataID && existing.GranteeID == share.GranteeID {
+			share.ID = id
+			share.CreatedAt = existing.CreatedAt
+		}
+	}
+	s.shares[share.ID] = *share
+	return nil
+}
+
+func (s *shareTestStore) GetShare(ctx context.Context, shareID uuid.UUID) (*models.Share, error) {
+	share, ok := s.shares[shareID]
+	if !ok {
+		return nil, httperror.New(nil, "Share not found", http.StatusNotFound)
+	}
+	return &share, nil
+}
+
+func (s *shareTestStore) GetDataShares(ctx context.Context, ownerID uuid.UUID, dataID uuid.UUID) ([]models.Share, error) {
+	var shares []models.Share
+	for _, share := range s.shares {
+		if share.OwnerID == ownerID && share.DataID == dataID {
+			shares = append(shares, share)
+		}
+	}
+	return shares, nil
+}
+
+func (s *shareTestStore) GetGranteeShares(ctx context.Context, granteeID uuid.UUID, offset int) ([]models.Share, error) {
+	var shares []models.Share
+	for _, share := range s.shares {
+		if share.GranteeID == granteeID {
+			shares = append(shares, share)
+		}
+	}
+	return shares, nil
+}
+
+func (s *shareTestStore) DeleteShare(ctx context.Context, shareID uuid.UUID, userID uuid.UUID) error {
+	share, ok := s.shares[shareID]
+	if !ok || (share.OwnerID != userID && share.GranteeID != userID) {
+		return httperror.New(nil, "Share not found", http.StatusNotFound)
+	}
+	delete(s.shares, shareID)
+	return nil
+}
+
+type fakeUserDirectory map[string]uuid.UUID
+
+func (d fakeUserDirectory) GetUserByEmail(ctx context.Context, email string) (*authclient.User, error) {
+	userID, ok := d[email]
+	if !ok {
+		return nil, httperror.New(nil, "User not found", http.StatusNotFound)
+	}
+	return &authclient.User{ID: userID, Email: email}, nil
+}
+
+func (d fakeUserDirectory) GetUserByID(ctx context.Context, userID uuid.UUID) (*authclient.User, error) {
+	for email, id := range d {
+		if id == userID {
+			return &authclient.User{ID: id, Email: email}, nil
+		}
+	}
+	return nil, httperror.New(nil, "User not found", http.StatusNotFound)
+}
+
+func TestShareService(t *testing.T) {
+	ctx := context.Background()
+	ownerID, granteeID, strangerID := uuid.New(), uuid.New(), uuid.New()
+	store := &shareTestStore{
+		fileDataStore: &fileDataStore{},
+		texts:         make(map[uuid.UUID]models.UserTextData),
+		shares:        make(map[uuid.UUID]models.Share),
+	}
+	contents := NewFileContentStore(blobstore.NewLocalStore(t.TempDir()), &memoryFileBlobStore{refs: make(map[string]int)})
+	users := fakeUserDirectory{"owner@example.com": ownerID, "friend@example.com": granteeID, "stranger@example.com": strangerID}
+	service := NewShareService(store, users, NewUserDataService(store, contents, NewQuotaService(nil, Quotas{}), nil))
+
+	note, err := models.NewUserTextData("note", ownerID, models.Metadata{}, "secret")
+	require.NoError(t, err)
+	store.texts[note.ID] = note
+
+	_, err = service.ShareRecord(ctx, ownerID, models.KindTextData, note.ID, "owner@example.com", models.SharePermissionRead, "")
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode(err))
+	_, err = service.ShareRecord(ctx, ownerID, models.KindTextData, note.ID, "nobody@example.com", models.SharePermissionRead, "")
+	assert.Equal(t, http.StatusNotFound, statusCode(err))
+	_, err = service.ShareRecord(ctx, ownerID, models.KindTextData, note.ID, "friend@example.com", "admin", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode(err))
+	// Поделиться можно только своей записью
+	_, err = service.ShareRecord(ctx, strangerID, models.KindTextData, note.ID, "friend@example.com", models.SharePermissionRead, "")
+	assert.Equal(t, http.StatusNotFound, statusCode(err))
+
+	share, err := service.ShareRecord(ctx, ownerID, models.KindTextData, note.ID, "friend@example.com", models.SharePermissionRead, "wrapped-key")
+	require.NoError(t, err)
+	assert.Equal(t, "owner@example.com", share.OwnerEmail)
+
+	sharedWithMe, err := service.GetSharedWithMe(ctx, granteeID, 0)
+	require.NoError(t, err)
+	require.Len(t, sharedWithMe, 1)
+	assert.Equal(t, "wrapped-key", sharedWithMe[0].EncryptedKey)
+
+	sharedRecord, err := service.GetSharedRecord(ctx, granteeID, share.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", sharedRecord.Data.(*models.UserTextData).Data)
+	_, err = service.GetSharedRecord(ctx, strangerID, share.ID)
+	assert.Equal(t, http.StatusNotFound, statusCode(err))
+
+	update := RecordUpdate{Name: "note", Data: "changed"}
+	_, err = service.UpdateSharedRecord(ctx, granteeID, share.ID, update)
+	assert.Equal(t, http.StatusForbidden, statusCode(err))
+
+	// Повторная выдача меняет права существующего доступа
+	upgraded, err := service.ShareRecord(ctx, ownerID, models.KindTextData, note.ID, "friend@example.com", models.SharePermissionWrite, "wrapped-key")
+	require.NoError(t, err)
+	assert.Equal(t, share.ID, upgraded.ID)
+	_, err = service.UpdateSharedRecord(ctx, granteeID, share.ID, update)
+	require.NoError(t, err)
+	assert.Equal(t, "changed", store.texts[note.ID].Data)
+	assert.Equal(t, ownerID, store.texts[note.ID].UserID)
+
+	// Отозвать доступ может только владелец записи
+	assert.Equal(t, http.StatusNotFound, statusCode(service.RevokeShare(ctx, granteeID, models.KindTextData, note.ID, share.ID)))
+	require.NoError(t, service.RevokeShare(ctx, ownerID, models.KindTextData, note.ID, share.ID))
+	_, err = service.GetSharedRecord(ctx, granteeID, share.ID)
+	assert.Equal(t, http.StatusNotFound, statusCode(err))
+
+	// Получатель может убрать запись из своего списка
+	share, err = service.ShareRecord(ctx, ownerID, models.KindTextData, note.ID, "friend@example.com", models.SharePermissionRead, "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, statusCode(service.LeaveShare(ctx, strangerID, share.ID)))
+	require.NoError(t, service.LeaveShare(ctx, granteeID, share.ID))
+	shares, err := service.GetRecordShares(ctx, ownerID, models.KindTextData, note.ID)
+	require.NoError(t, err)
+	assert.Empty(t, shares)
+}
+
+func TestShareServiceFiles(t *testing.T) {
+	ctx := context.Background()
+	ownerID, granteeID := uuid.New(), uuid.New()
+	store := &shareTestStore{
+		fileDataStore: &fileDataStore{},
+		texts:         make(map[uuid.UUID]models.UserTextData),
+		shares:        make(map[uuid.UUID]models.Share),
+	}
+	contents := NewFileContentStore(blobstore.NewLocalStore(t.TempDir()), &memoryFileBlobStore{refs: make(map[string]int)})
+	users := fakeUserDirectory{"owner@example.com": ownerID, "friend@example.com": granteeID}
+	service := NewShareService(store, users, NewUserDataService(store, contents, NewQuotaService(nil, Quotas{}), nil))
+
+	newFile := func(parentID *uuid.UUID) models.UserFileData {
+		userFileData, err := models.NewUserFileData("report", ownerID, models.Metadata{}, ".txt", "report.txt")
+		require.NoError(t, err)
+		stored, err := contents.Save(ctx, strings.NewReader("report content"))
+		require.NoError(t, err)
+		stored.apply(&userFileData)
+		userFileData.ScanStatus = models.ScanStatusClean
+		if parentID != nil {
+			userFileData.ParentKind = models.KindFileData
+			userFileData.ParentID = parentID
+		}
+		store.files = append(store.files, userFileData)
+		return userFileData
+	}
+	file := newFile(nil)
+	attachment := newFile(&file.ID)
+
+	_, err := service.ShareRecord(ctx, ownerID, models.KindFileData, attachment.ID, "friend@example.com", models.SharePermissionRead, "")
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode(err))
+
+	share, err := service.ShareRecord(ctx, ownerID, models.KindFileData, file.ID, "friend@example.com", models.SharePermissionRead, "")
+	require.NoError(t, err)
+
+	for _, attachmentID := range []*uuid.UUID{nil, &attachment.ID} {
+		_, content, err := service.GetSharedFileContent(ctx, granteeID, share.ID, attachmentID)
+		require.NoError(t, err)
+		data, _ := io.ReadAll(content)
+		content.Close()
+		assert.Equal(t, "report content", string(data))
+	}
+}
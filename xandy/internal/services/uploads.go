@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+type IFileUploadStore interface {
+	InsertFileUpload(ctx context.Context, fileUpload *models.FileUpload) error
+	UpdateFileUpload(ctx context.Context, fileUpload *models.FileUpload) error
+	GetFileUpload(ctx context.Context, uploadID uuid.UUID, userID uuid.UUID) (*models.FileUpload, error)
+	DeleteFileUpload(ctx context.Context, uploadID uuid.UUID, userID uuid.UUID) error
+	GetExpiredFileUploads(ctx context.Context, now time.Time) ([]models.FileUpload, error)
+}
+
+// UploadService принимает файлы по частям: загрузка создаётся заранее,
+// части дописываются в промежуточный файл на локальном диске по текущему смещению,
+// после получения последней части файл переносится в BlobStore, проверяется контрольная сумма
+// и создаётся запись UserFileData
+type UploadService struct {
+	store         IFileUploadStore
+	userDataStore IUserDataStore
+	contents      *FileContentStore
+	quotas        *QuotaService
+	audit         *AuditService
+	stagingDir    string
+	expiration    time.Duration
+
+	// Не даёт параллельно дописывать одну и ту же загрузку
+	locks keyedMutex[uuid.UUID]
+}
+
+func NewUploadService(
+	fileUploadStore IFileUploadStore,
+	userDataStore IUserDataStore,
+	contents *FileContentStore,
+	quotas *QuotaService,
+	audit *AuditService,
+	stagingDir string,
+	expiration time.Duration,
+) *UploadService {
+	return &UploadService{
+		store:         fileUploadStore,
+		userDataStore: userDataStore,
+		contents:      contents,
+		quotas:        quotas,
+		audit:         audit,
+		stagingDir:    stagingDir,
+		expiration:    expiration,
+	}
+}
+
+func (us *UploadService) CreateUpload(
+	ctx context.Context,
+	userID uuid.UUID,
+	fileName string,
+	size int64,
+	checksum string,
+) (*models.FileUpload, error) {
+	fileUpload, err := models.NewFileUpload(userID, filepath.Base(fileName), size, strings.ToLower(checksum), us.expiration)
+	if err != nil {
+		return nil, err
+	}
+	// Заявленный размер сразу считается занятым, чтобы не принимать части файла, который не поместится
+	if err := us.quotas.CheckRecord(ctx, userID, models.KindFileData); err != nil {
+		return nil, err
+	}
+	if err := us.quotas.CheckFileSize(ctx, userID, size); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(us.stagingDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	fileUpload.StagingPath = filepath.Join(us.stagingDir, fileUpload.ID.String())
+	file, err := os.Create(fileUpload.StagingPath)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	// Проверки выше не видят параллельно создаваемые загрузки, окончательно место проверяется вместе с созданием
+	err = us.userDataStore.WithTx(ctx, func(ctx context.Context) error {
+		if err := us.quotas.CheckStorage(ctx, userID, size, 0); err != nil {
+			return err
+		}
+		return us.store.InsertFileUpload(ctx, &fileUpload)
+	})
+	if err != nil {
+		os.Remove(fileUpload.StagingPath)
+		return nil, err
+	}
+	return &fileUpload, nil
+}
+
+func (us *UploadService) GetUpload(ctx context.Context, userID uuid.UUID, uploadID uuid.UUID) (*models.FileUpload, error) {
+	return us.store.GetFileUpload(ctx, uploadID, userID)
+}
+
+// AppendChunk дописывает часть файла с указанного смещения.
+// Смещение должно совпадать с уже принятым количеством байт.
+// Если соединение оборвалось посередине, принятые байты сохраняются и загрузку можно продолжить.
+// После последней части возвращается созданная запись UserFileData.
+func (us *UploadService) AppendChunk(
+	ctx context.Context,
+	userID uuid.UUID,
+	uploadID uuid.UUID,
+	offset int64,
+	chunk io.Reader,
+) (*models.FileUpload, *models.UserFileData, error) {
+	unlock := us.locks.lock(uploadID)
+	defer unlock()
+
+	fileUpload, err := us.store.GetFileUpload(ctx, uploadID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if time.Now().After(fileUpload.ExpiresAt) {
+		return nil, nil, httperror.New(nil, "Upload has expired", http.StatusGone)
+	}
+	if offset != fileUpload.Offset {
+		return fileUpload, nil, httperror.New(nil, "Upload-Offset does not match the current offset", http.StatusConflict)
+	}
+	remaining := fileUpload.Size - fileUpload.Offset
+
+	file, err := os.OpenFile(fileUpload.StagingPath, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Отбрасываем хвост от прерванной записи, который не попал в сохранённое смещение
+	if err := file.Truncate(fileUpload.Offset); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if _, err := file.Seek(fileUpload.Offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	written, copyErr := io.Copy(file, io.LimitReader(chunk, remaining+1))
+	if written > remaining {
+		file.Truncate(fileUpload.Offset)
+		file.Close()
+		return fileUpload, nil, httperror.New(nil, "Chunk exceeds the upload length", http.StatusRequestEntityTooLarge)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	// Клиент мог оборвать соединение, но принятые байты всё равно нужно учесть
+	ctx = context.WithoutCancel(ctx)
+	fileUpload.Offset += written
+	fileUpload.UpdatedAt = time.Now()
+	fileUpload.ExpiresAt = fileUpload.UpdatedAt.Add(us.expiration)
+	if err := us.store.UpdateFileUpload(ctx, fileUpload); err != nil {
+		return nil, nil, err
+	}
+	if copyErr != nil {
+		return fileUpload, nil, copyErr
+	}
+	if fileUpload.Offset < fileUpload.Size {
+		return fileUpload, nil, nil
+	}
+	userFileData, err := us.complete(ctx, fileUpload)
+	if err != nil {
+		return fileUpload, nil, err
+	}
+	return fileUpload, userFileData, nil
+}
+
+func (us *UploadService) complete(ctx context.Context, fileUpload *models.FileUpload) (*models.UserFileData, error) {
+	staged, err := os.Open(fileUpload.StagingPath)
+	if err != nil {
+		return nil, err
+	}
+	defer staged.Close()
+	name, ext := splitFileName(fileUpload.FileName)
+	userFileData, err := models.NewUserFileData(name, fileUpload.UserID, models.Metadata{}, ext, name+ext)
+	if err != nil {
+		return nil, err
+	}
+	// Загрузка уже учтена в занятом месте своим заявленным размером
+	content, release, err := us.quotas.LimitFile(ctx, fileUpload.UserID, staged, fileUpload.Size)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	stored, err := us.contents.Save(ctx, content)
+	if err != nil {
+		return nil, err
+	}
+	if stored.SHA256 != fileUpload.Checksum {
+		// Начинаем загрузку заново, повреждённые данные не сохраняем
+		us.contents.Release(ctx, stored.Key)
+		if err := os.Truncate(fileUpload.StagingPath, 0); err != nil {
+			return nil, err
+		}
+		fileUpload.Offset = 0
+		fileUpload.UpdatedAt = time.Now()
+		if err := us.store.UpdateFileUpload(ctx, fileUpload); err != nil {
+			return nil, err
+		}
+		return nil, httperror.New(nil, "Checksum mismatch, upload has been reset", http.StatusUnprocessableEntity)
+	}
+	stored.apply(&userFileData)
+	err = us.userDataStore.WithTx(ctx, func(ctx context.Context) error {
+		if err := us.quotas.CheckRecord(ctx, fileUpload.UserID, models.KindFileData); err != nil {
+			return err
+		}
+		if err := us.quotas.CheckStorage(ctx, fileUpload.UserID, userFileData.Size, fileUpload.Size); err != nil {
+			return err
+		}
+		if err := us.userDataStore.InsertUserFileData(ctx, &userFileData); err != nil {
+			return err
+		}
+		us.audit.recordChange(ctx, models.AuditActionCreate, models.KindFileData, &userFileData.BaseUserData)
+		return us.store.DeleteFileUpload(ctx, fileUpload.ID, fileUpload.UserID)
+	})
+	if err != nil {
+		// Промежуточный файл остаётся, завершение можно повторить
+		us.contents.Release(ctx, stored.Key)
+		return nil, err
+	}
+	os.Remove(fileUpload.StagingPath)
+	return &userFileData, nil
+}
+
+func (us *UploadService) CancelUpload(ctx context.Context, userID uuid.UUID, uploadID uuid.UUID) error {
+	unlock := us.locks.lock(uploadID)
+	defer unlock()
+
+	fileUpload, err := us.store.GetFileUpload(ctx, uploadID, userID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fileUpload.StagingPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return us.store.DeleteFileUpload(ctx, uploadID, userID)
+}
+
+// DeleteExpiredUploads удаляет заброшенные загрузки вместе с промежуточными файлами
+func (us *UploadService) DeleteExpiredUploads(ctx context.Context) (int, error) {
+	fileUploads, err := us.store.GetExpiredFileUploads(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, fileUpload := range fileUploads {
+		if err := us.CancelUpload(ctx, fileUpload.UserID, fileUpload.ID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// RunCleanup периодически удаляет заброшенные загрузки до отмены контекста
+func (us *UploadService) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := us.DeleteExpiredUploads(ctx)
+			if err != nil {
+				log.Printf("delete expired uploads: %s\n", err)
+			}
+			if deleted > 0 {
+				log.Printf("deleted %d expired uploads\n", deleted)
+			}
+		}
+	}
+}
@@ -2,25 +2,33 @@ package services
 
 import (
 	"context"
-	"fmt"
-	"os"
+	"errors"
+	"io"
+	"net/http"
 	"time"
 
+	"github.com/eac0de/xandy/internal/blobstore"
 	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
 
 	"github.com/google/uuid"
 )
 
 type IUserDataStore interface {
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+	LockUserData(ctx context.Context, dataKind models.DataKind, dataID uuid.UUID) error
+
 	InsertUserTextData(ctx context.Context, data *models.UserTextData) error
 	InsertUserFileData(ctx context.Context, data *models.UserFileData) error
 	InsertUserAuthInfo(ctx context.Context, data *models.UserAuthInfo) error
 	InsertUserBankCard(ctx context.Context, data *models.UserBankCard) error
 
-	UpdateUserTextData(ctx context.Context, data *models.UserTextData) error
-	UpdateUserFileData(ctx context.Context, data *models.UserFileData) error
-	UpdateUserAuthInfo(ctx context.Context, data *models.UserAuthInfo) error
-	UpdateUserBankCard(ctx context.Context, data *models.UserBankCard) error
+	// Записи меняет и удаляет userID: владелец личной записи или участник организации с правом на запись
+	UpdateUserTextData(ctx context.Context, data *models.UserTextData, userID uuid.UUID) error
+	UpdateUserFileData(ctx context.Context, data *models.UserFileData, userID uuid.UUID) error
+	ReplaceUserFileContent(ctx context.Context, data *models.UserFileData, oldBlobKey string, userID uuid.UUID) error
+	UpdateUserAuthInfo(ctx context.Context, data *models.UserAuthInfo, userID uuid.UUID) error
+	UpdateUserBankCard(ctx context.Context, data *models.UserBankCard, userID uuid.UUID) error
 
 	GetUserTextData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserTextData, error)
 	GetUserFileData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserFileData, error)
@@ -28,7 +36,8 @@ type IUserDataStore interface {
 	GetUserBankCard(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserBankCard, error)
 
 	GetUserTextDataList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserTextData, error)
-	GetUserFileDataList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserFileData, error)
+	GetUserFileDataList(ctx context.Context, userID uuid.UUID, filter models.FileDataFilter, offset int) ([]models.UserFileData, error)
+	GetUserFileDataAttachments(ctx context.Context, userID uuid.UUID, parentIDs []uuid.UUID) ([]models.UserFileData, error)
 	GetUserAuthInfoList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserAuthInfo, error)
 	GetUserBankCardList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserBankCard, error)
 
@@ -36,15 +45,27 @@ type IUserDataStore interface {
 	DeleteUserFileData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) error
 	DeleteUserAuthInfo(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) error
 	DeleteUserBankCard(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) error
+
+	GetCollectionAccess(ctx context.Context, collectionID uuid.UUID, userID uuid.UUID) (bool, error)
+
+	SetUserDataExpiration(ctx context.Context, dataKind models.DataKind, dataID uuid.UUID, userID uuid.UUID, expiresAt *time.Time, now time.Time) (*models.BaseUserData, error)
+	GetExpiringUserData(ctx context.Context, userID uuid.UUID, now time.Time, until time.Time) ([]models.ExpiringRecord, error)
+	DeleteExpiredUserData(ctx context.Context, dataKind models.DataKind, now time.Time, limit int) ([]models.BaseUserData, []string, error)
 }
 
 type UserDataService struct {
-	store IUserDataStore
+	store    IUserDataStore
+	contents *FileContentStore
+	quotas   *QuotaService
+	audit    *AuditService
 }
 
-func NewUserDataService(userDataStore IUserDataStore) *UserDataService {
+func NewUserDataService(userDataStore IUserDataStore, contents *FileContentStore, quotas *QuotaService, audit *AuditService) *UserDataService {
 	return &UserDataService{
-		store: userDataStore,
+		store:    userDataStore,
+		contents: contents,
+		quotas:   quotas,
+		audit:    audit,
 	}
 }
 
@@ -59,33 +80,85 @@ func (uds *UserDataService) InsertUserTextData(
 	if err != nil {
 
 	}
-	err = uds.store.InsertUserTextData(ctx, &userTextData)
-	if err != nil {
-		return nil, err
-	}
-
-	return &userTextData, nil
+	return withTx(ctx, uds.store, func(ctx context.Context) (*models.UserTextData, error) {
+		if err := uds.quotas.CheckRecord(ctx, userID, models.KindTextData); err != nil {
+			return nil, err
+		}
+		if err := uds.store.InsertUserTextData(ctx, &userTextData); err != nil {
+			return nil, err
+		}
+		uds.audit.recordChange(ctx, models.AuditActionCreate, models.KindTextData, &userTextData.BaseUserData)
+		return &userTextData, nil
+	})
 }
 
+// InsertUserFileData сохраняет файл, name - отображаемое имя, по умолчанию берётся из имени файла
 func (uds *UserDataService) InsertUserFileData(
 	ctx context.Context,
 	userID uuid.UUID,
 	name string,
-	pathToFile string,
-	ext string,
+	fileName string,
+	metadata map[string]interface{},
+	content io.Reader,
 ) (*models.UserFileData, error) {
-	userFileData, err := models.NewUserFileData(name, userID, pathToFile, ext)
+	userFileData, err := newUserFileData(userID, name, fileName, metadata)
 	if err != nil {
-
+		return nil, err
 	}
-	err = uds.store.InsertUserFileData(ctx, &userFileData)
-	if err != nil {
+	if err := uds.insertUserFile(ctx, &userFileData, content); err != nil {
 		return nil, err
 	}
-
 	return &userFileData, nil
 }
 
+// newUserFileData создаёт запись о загружаемом файле, пустое name заменяется именем файла
+func newUserFileData(userID uuid.UUID, name string, fileName string, metadata map[string]interface{}) (models.UserFileData, error) {
+	baseName, ext := splitFileName(fileName)
+	if name == "" {
+		name = baseName
+	}
+	if metadata == nil {
+		metadata = models.Metadata{}
+	}
+	return models.NewUserFileData(name, userID, metadata, ext, baseName+ext)
+}
+
+// insertUserFile сохраняет содержимое и запись о файле.
+// Квота на количество записей проверяется и до чтения содержимого, чтобы не читать его зря.
+func (uds *UserDataService) insertUserFile(ctx context.Context, userFileData *models.UserFileData, content io.Reader) error {
+	if err := uds.quotas.CheckRecord(ctx, userFileData.UserID, models.KindFileData); err != nil {
+		return err
+	}
+	content, release, err := uds.quotas.LimitFile(ctx, userFileData.UserID, content, 0)
+	if err != nil {
+		return err
+	}
+	defer release()
+	stored, err := uds.contents.Save(ctx, content)
+	if err != nil {
+		return err
+	}
+	stored.apply(userFileData)
+	err = uds.store.WithTx(ctx, func(ctx context.Context) error {
+		if err := uds.quotas.CheckRecord(ctx, userFileData.UserID, models.KindFileData); err != nil {
+			return err
+		}
+		if err := uds.quotas.CheckStorage(ctx, userFileData.UserID, userFileData.Size, 0); err != nil {
+			return err
+		}
+		if err := uds.store.InsertUserFileData(ctx, userFileData); err != nil {
+			return err
+		}
+		uds.audit.recordChange(ctx, models.AuditActionCreate, models.KindFileData, &userFileData.BaseUserData)
+		return nil
+	})
+	if err != nil {
+		uds.contents.Release(context.WithoutCancel(ctx), stored.Key)
+		return err
+	}
+	return nil
+}
+
 func (uds *UserDataService) InsertUserAuthInfo(
 	ctx context.Context,
 	userID uuid.UUID,
@@ -97,11 +170,16 @@ func (uds *UserDataService) InsertUserAuthInfo(
 	if err != nil {
 		return nil, err
 	}
-	err = uds.store.InsertUserAuthInfo(ctx, &userAuthInfo)
-	if err != nil {
-		return nil, err
-	}
-	return &userAuthInfo, nil
+	return withTx(ctx, uds.store, func(ctx context.Context) (*models.UserAuthInfo, error) {
+		if err := uds.quotas.CheckRecord(ctx, userID, models.KindAuthInfo); err != nil {
+			return nil, err
+		}
+		if err := uds.store.InsertUserAuthInfo(ctx, &userAuthInfo); err != nil {
+			return nil, err
+		}
+		uds.audit.recordChange(ctx, models.AuditActionCreate, models.KindAuthInfo, &userAuthInfo.BaseUserData)
+		return &userAuthInfo, nil
+	})
 }
 
 func (uds *UserDataService) InsertUserBankCard(
@@ -115,11 +193,16 @@ func (uds *UserDataService) InsertUserBankCard(
 	if err != nil {
 		return nil, err
 	}
-	err = uds.store.InsertUserBankCard(ctx, &userBankCard)
-	if err != nil {
-		return nil, err
-	}
-	return &userBankCard, nil
+	return withTx(ctx, uds.store, func(ctx context.Context) (*models.UserBankCard, error) {
+		if err := uds.quotas.CheckRecord(ctx, userID, models.KindBankCard); err != nil {
+			return nil, err
+		}
+		if err := uds.store.InsertUserBankCard(ctx, &userBankCard); err != nil {
+			return nil, err
+		}
+		uds.audit.recordChange(ctx, models.AuditActionCreate, models.KindBankCard, &userBankCard.BaseUserData)
+		return &userBankCard, nil
+	})
 }
 
 func (uds *UserDataService) UpdateUserTextData(
@@ -130,23 +213,29 @@ func (uds *UserDataService) UpdateUserTextData(
 	text string,
 	metadata map[string]interface{},
 ) (*models.UserTextData, error) {
-	userTextData, err := uds.store.GetUserTextData(ctx, ID, userID)
-	if err != nil {
-		return nil, err
-	}
-	userTextData.Name = name
-	userTextData.Data = text
-	userTextData.Metadata = metadata
-	userTextData.UpdatedAt = time.Now()
-	err = models.Validate(userTextData)
-	if err != nil {
-		return nil, err
-	}
-	err = uds.store.UpdateUserTextData(ctx, userTextData)
-	if err != nil {
-		return nil, err
-	}
-	return userTextData, nil
+	return withTx(ctx, uds.store, func(ctx context.Context) (*models.UserTextData, error) {
+		userTextData, err := uds.store.GetUserTextData(ctx, ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if err := uds.checkWritable(ctx, userID, &userTextData.BaseUserData); err != nil {
+			return nil, err
+		}
+		userTextData.Name = name
+		userTextData.Data = text
+		userTextData.Metadata = metadata
+		userTextData.UpdatedAt = time.Now()
+		err = models.Validate(userTextData)
+		if err != nil {
+			return nil, err
+		}
+		err = uds.store.UpdateUserTextData(ctx, userTextData, userID)
+		if err != nil {
+			return nil, err
+		}
+		uds.audit.recordChange(ctx, models.AuditActionUpdate, models.KindTextData, &userTextData.BaseUserData)
+		return userTextData, nil
+	})
 }
 
 func (uds *UserDataService) UpdateUserFileData(
@@ -155,51 +244,79 @@ func (uds *UserDataService) UpdateUserFileData(
 	ID uuid.UUID,
 	name string,
 	metadata map[string]interface{},
+) (*models.UserFileData, error) {
+	return withTx(ctx, uds.store, func(ctx context.Context) (*models.UserFileData, error) {
+		userFileData, err := uds.store.GetUserFileData(ctx, ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if err := uds.checkWritable(ctx, userID, &userFileData.BaseUserData); err != nil {
+			return nil, err
+		}
+		userFileData.Name = name
+		userFileData.Metadata = metadata
+		userFileData.UpdatedAt = time.Now()
+		err = models.Validate(userFileData)
+		if err != nil {
+			return nil, err
+		}
+		err = uds.store.UpdateUserFileData(ctx, userFileData, userID)
+		if err != nil {
+			return nil, err
+		}
+		uds.audit.recordChange(ctx, models.AuditActionUpdate, models.KindFileData, &userFileData.BaseUserData)
+		return userFileData, nil
+	})
+}
+
+// ReplaceUserFileContent заменяет содержимое файла, сохраняя идентификатор, имя и метаданные записи.
+// Новое содержимое сохраняется до изменения записи, поэтому при ошибке остаётся прежнее.
+func (uds *UserDataService) ReplaceUserFileContent(
+	ctx context.Context,
+	userID uuid.UUID,
+	ID uuid.UUID,
+	content io.Reader,
 ) (*models.UserFileData, error) {
 	userFileData, err := uds.store.GetUserFileData(ctx, ID, userID)
 	if err != nil {
 		return nil, err
 	}
-	if name != userFileData.Name {
-		dir := fmt.Sprintf("../user_files/%s", userID.String())
-		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+	if err := uds.checkWritable(ctx, userID, &userFileData.BaseUserData); err != nil {
+		return nil, err
+	}
+	oldBlobKey, oldSize := userFileData.BlobKey, userFileData.Size
+	// Прежнее содержимое освободится после замены, поэтому его размер не считается занятым.
+	// Файл коллекции не входит в квоты пользователей, для него проверяется только размер
+	release := func() {}
+	if userFileData.Personal() {
+		content, release, err = uds.quotas.LimitFile(ctx, userFileData.UserID, content, oldSize)
+		if err != nil {
 			return nil, err
 		}
-		clearName := name
-		pathToFile := fmt.Sprintf("%s/%s%s", dir, name, userFileData.Ext)
-		count := 0
-		for {
-			_, err := os.Stat(pathToFile)
-			if err != nil {
-				if os.IsNotExist(err) {
-					break
-				} else {
-					return nil, err
-				}
-			}
-			count++
-			name = fmt.Sprintf("%s(%d)", clearName, count)
-			pathToFile = fmt.Sprintf("%s/%s%s", dir, name, userFileData.Ext)
-			if name == userFileData.Name {
-				break
-			}
-		}
-		if name != userFileData.Name {
-			if err := os.Rename(userFileData.PathToFile, pathToFile); err != nil {
-				return nil, err
-			}
-			userFileData.Name = name
-			userFileData.PathToFile = pathToFile
-		}
+	} else {
+		content = uds.quotas.LimitFileSize(content)
 	}
-	userFileData.Metadata = metadata
-	userFileData.UpdatedAt = time.Now()
-	err = models.Validate(userFileData)
+	defer release()
+	stored, err := uds.contents.Save(ctx, content)
 	if err != nil {
 		return nil, err
 	}
-	err = uds.store.UpdateUserFileData(ctx, userFileData)
+	stored.apply(userFileData)
+	userFileData.UpdatedAt = time.Now()
+	err = uds.store.WithTx(ctx, func(ctx context.Context) error {
+		if userFileData.Personal() {
+			if err := uds.quotas.CheckStorage(ctx, userFileData.UserID, userFileData.Size, oldSize); err != nil {
+				return err
+			}
+		}
+		if err := uds.store.ReplaceUserFileContent(ctx, userFileData, oldBlobKey, userID); err != nil {
+			return err
+		}
+		uds.audit.recordChange(ctx, models.AuditActionUpdate, models.KindFileData, &userFileData.BaseUserData)
+		return uds.contents.Release(ctx, oldBlobKey)
+	})
 	if err != nil {
+		uds.contents.Release(context.WithoutCancel(ctx), stored.Key)
 		return nil, err
 	}
 	return userFileData, nil
@@ -213,24 +330,30 @@ func (uds *UserDataService) UpdateUserAuthInfo(
 	login, password string,
 	metadata map[string]interface{},
 ) (*models.UserAuthInfo, error) {
-	userAuthInfo, err := uds.store.GetUserAuthInfo(ctx, ID, userID)
-	if err != nil {
-		return nil, err
-	}
-	userAuthInfo.Name = name
-	userAuthInfo.Login = login
-	userAuthInfo.Password = password
-	userAuthInfo.Metadata = metadata
-	userAuthInfo.UpdatedAt = time.Now()
-	err = models.Validate(userAuthInfo)
-	if err != nil {
-		return nil, err
-	}
-	err = uds.store.UpdateUserAuthInfo(ctx, userAuthInfo)
-	if err != nil {
-		return nil, err
-	}
-	return userAuthInfo, nil
+	return withTx(ctx, uds.store, func(ctx context.Context) (*models.UserAuthInfo, error) {
+		userAuthInfo, err := uds.store.GetUserAuthInfo(ctx, ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if err := uds.checkWritable(ctx, userID, &userAuthInfo.BaseUserData); err != nil {
+			return nil, err
+		}
+		userAuthInfo.Name = name
+		userAuthInfo.Login = login
+		userAuthInfo.Password = password
+		userAuthInfo.Metadata = metadata
+		userAuthInfo.UpdatedAt = time.Now()
+		err = models.Validate(userAuthInfo)
+		if err != nil {
+			return nil, err
+		}
+		err = uds.store.UpdateUserAuthInfo(ctx, userAuthInfo, userID)
+		if err != nil {
+			return nil, err
+		}
+		uds.audit.recordChange(ctx, models.AuditActionUpdate, models.KindAuthInfo, &userAuthInfo.BaseUserData)
+		return userAuthInfo, nil
+	})
 }
 
 func (uds *UserDataService) UpdateUserBankCard(
@@ -241,81 +364,323 @@ func (uds *UserDataService) UpdateUserBankCard(
 	number, cardHolder, expireDate, csc string,
 	metadata map[string]interface{},
 ) (*models.UserBankCard, error) {
-	userBankCard, err := uds.store.GetUserBankCard(ctx, ID, userID)
+	return withTx(ctx, uds.store, func(ctx context.Context) (*models.UserBankCard, error) {
+		userBankCard, err := uds.store.GetUserBankCard(ctx, ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if err := uds.checkWritable(ctx, userID, &userBankCard.BaseUserData); err != nil {
+			return nil, err
+		}
+		userBankCard.Name = name
+		userBankCard.Number = number
+		userBankCard.CardHolder = cardHolder
+		userBankCard.ExpireDate = expireDate
+		userBankCard.CSC = csc
+		userBankCard.Metadata = metadata
+		userBankCard.UpdatedAt = time.Now()
+		err = models.Validate(userBankCard)
+		if err != nil {
+			return nil, err
+		}
+		err = uds.store.UpdateUserBankCard(ctx, userBankCard, userID)
+		if err != nil {
+			return nil, err
+		}
+		uds.audit.recordChange(ctx, models.AuditActionUpdate, models.KindBankCard, &userBankCard.BaseUserData)
+		return userBankCard, nil
+	})
+}
+
+func (uds *UserDataService) GetUserTextData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserTextData, error) {
+	userTextData, err := uds.getUserTextData(ctx, dataID, userID)
 	if err != nil {
 		return nil, err
 	}
-	userBankCard.Name = name
-	userBankCard.Number = number
-	userBankCard.CardHolder = cardHolder
-	userBankCard.ExpireDate = expireDate
-	userBankCard.CSC = csc
-	userBankCard.Metadata = metadata
-	userBankCard.UpdatedAt = time.Now()
-	err = models.Validate(userBankCard)
+	return userTextData, uds.audit.Record(ctx, models.AuditActionRead, models.KindTextData, &userTextData.BaseUserData)
+}
+
+// getUserTextData возвращает запись без записи в журнал, для проверок доступа в других сервисах
+func (uds *UserDataService) getUserTextData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserTextData, error) {
+	userTextData, err := uds.store.GetUserTextData(ctx, dataID, userID)
 	if err != nil {
 		return nil, err
 	}
-	err = uds.store.UpdateUserBankCard(ctx, userBankCard)
+	return userTextData, uds.loadAttachments(ctx, userID, &userTextData.BaseUserData)
+}
+
+func (uds *UserDataService) GetUserFileData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserFileData, error) {
+	userFileData, err := uds.store.GetUserFileData(ctx, dataID, userID)
 	if err != nil {
 		return nil, err
 	}
-	return userBankCard, nil
+	return userFileData, uds.loadAttachments(ctx, userID, &userFileData.BaseUserData)
 }
 
-func (uds *UserDataService) GetUserTextData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserTextData, error) {
-	return uds.store.GetUserTextData(ctx, dataID, userID)
+func (uds *UserDataService) GetUserAuthInfo(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserAuthInfo, error) {
+	userAuthInfo, err := uds.getUserAuthInfo(ctx, dataID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return userAuthInfo, uds.audit.Record(ctx, models.AuditActionRead, models.KindAuthInfo, &userAuthInfo.BaseUserData)
 }
 
-func (uds *UserDataService) GetUserFileData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserFileData, error) {
-	return uds.store.GetUserFileData(ctx, dataID, userID)
+// getUserAuthInfo возвращает запись без записи в журнал, для проверок доступа в других сервисах
+func (uds *UserDataService) getUserAuthInfo(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserAuthInfo, error) {
+	userAuthInfo, err := uds.store.GetUserAuthInfo(ctx, dataID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return userAuthInfo, uds.loadAttachments(ctx, userID, &userAuthInfo.BaseUserData)
 }
 
-func (uds *UserDataService) GetUserAuthInfo(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserAuthInfo, error) {
-	return uds.store.GetUserAuthInfo(ctx, dataID, userID)
+func (uds *UserDataService) GetUserBankCard(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserBankCard, error) {
+	userBankCard, err := uds.getUserBankCard(ctx, dataID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return userBankCard, uds.audit.Record(ctx, models.AuditActionRead, models.KindBankCard, &userBankCard.BaseUserData)
 }
 
-func (uds *UserDataService) GetUserBankCard(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserBankCard, error) {
-	return uds.store.GetUserBankCard(ctx, dataID, userID)
+// getUserBankCard возвращает запись без записи в журнал, для проверок доступа в других сервисах
+func (uds *UserDataService) getUserBankCard(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserBankCard, error) {
+	userBankCard, err := uds.store.GetUserBankCard(ctx, dataID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return userBankCard, uds.loadAttachments(ctx, userID, &userBankCard.BaseUserData)
 }
 
 func (uds *UserDataService) GetUserTextDataList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserTextData, error) {
-	return uds.store.GetUserTextDataList(ctx, userID, offset)
+	userTextDataList, err := uds.store.GetUserTextDataList(ctx, userID, offset)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*models.BaseUserData, len(userTextDataList))
+	for i := range userTextDataList {
+		records[i] = &userTextDataList[i].BaseUserData
+	}
+	if err := uds.loadAttachments(ctx, userID, records...); err != nil {
+		return nil, err
+	}
+	return userTextDataList, uds.audit.Record(ctx, models.AuditActionRead, models.KindTextData, records...)
 }
 
-func (uds *UserDataService) GetUserFileDataList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserFileData, error) {
-	return uds.store.GetUserFileDataList(ctx, userID, offset)
+func (uds *UserDataService) GetUserFileDataList(ctx context.Context, userID uuid.UUID, filter models.FileDataFilter, offset int) ([]models.UserFileData, error) {
+	if filter.MinSize != nil && filter.MaxSize != nil && *filter.MinSize > *filter.MaxSize {
+		return nil, httperror.New(nil, "min_size must not exceed max_size", http.StatusBadRequest)
+	}
+	userFileDataList, err := uds.store.GetUserFileDataList(ctx, userID, filter, offset)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*models.BaseUserData, len(userFileDataList))
+	for i := range userFileDataList {
+		records[i] = &userFileDataList[i].BaseUserData
+	}
+	return userFileDataList, uds.loadAttachments(ctx, userID, records...)
 }
 
 func (uds *UserDataService) GetUserAuthInfoList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserAuthInfo, error) {
-	return uds.store.GetUserAuthInfoList(ctx, userID, offset)
+	userAuthInfoList, err := uds.store.GetUserAuthInfoList(ctx, userID, offset)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*models.BaseUserData, len(userAuthInfoList))
+	for i := range userAuthInfoList {
+		records[i] = &userAuthInfoList[i].BaseUserData
+	}
+	if err := uds.loadAttachments(ctx, userID, records...); err != nil {
+		return nil, err
+	}
+	return userAuthInfoList, uds.audit.Record(ctx, models.AuditActionRead, models.KindAuthInfo, records...)
 }
 
 func (uds *UserDataService) GetUserBankCardList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserBankCard, error) {
-	return uds.store.GetUserBankCardList(ctx, userID, offset)
+	userBankCardList, err := uds.store.GetUserBankCardList(ctx, userID, offset)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*models.BaseUserData, len(userBankCardList))
+	for i := range userBankCardList {
+		records[i] = &userBankCardList[i].BaseUserData
+	}
+	if err := uds.loadAttachments(ctx, userID, records...); err != nil {
+		return nil, err
+	}
+	return userBankCardList, uds.audit.Record(ctx, models.AuditActionRead, models.KindBankCard, records...)
 }
 
 func (uds *UserDataService) DeleteUserTextData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) error {
-	return uds.store.DeleteUserTextData(ctx, dataID, userID)
+	return uds.store.WithTx(ctx, func(ctx context.Context) error {
+		userTextData, err := uds.store.GetUserTextData(ctx, dataID, userID)
+		if err != nil {
+			return err
+		}
+		if err := uds.checkWritable(ctx, userID, &userTextData.BaseUserData); err != nil {
+			return err
+		}
+		if err := uds.store.DeleteUserTextData(ctx, dataID, userID); err != nil {
+			return err
+		}
+		uds.audit.recordChange(ctx, models.AuditActionDelete, models.KindTextData, &userTextData.BaseUserData)
+		return uds.deleteAttachments(ctx, userID, dataID)
+	})
 }
 
 func (uds *UserDataService) DeleteUserFileData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) error {
+	return uds.store.WithTx(ctx, func(ctx context.Context) error {
+		userFileData, err := uds.store.GetUserFileData(ctx, dataID, userID)
+		if err != nil {
+			return err
+		}
+		if err := uds.checkWritable(ctx, userID, &userFileData.BaseUserData); err != nil {
+			return err
+		}
+		if err := uds.store.DeleteUserFileData(ctx, dataID, userID); err != nil {
+			return err
+		}
+		uds.audit.recordChange(ctx, models.AuditActionDelete, models.KindFileData, &userFileData.BaseUserData)
+		if err := uds.contents.Release(ctx, userFileData.BlobKey); err != nil {
+			return err
+		}
+		return uds.deleteAttachments(ctx, userID, dataID)
+	})
+}
+
+// GetUserFileContent возвращает запись и содержимое файла с возможностью перемещения по нему
+func (uds *UserDataService) GetUserFileContent(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserFileData, io.ReadSeekCloser, error) {
 	userFileData, err := uds.store.GetUserFileData(ctx, dataID, userID)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	if err := os.Remove(userFileData.PathToFile); err != nil {
-		if !os.IsNotExist(err) {
-			return err
+	if err := checkScanStatus(userFileData); err != nil {
+		return nil, nil, err
+	}
+	if err := uds.audit.Record(ctx, models.AuditActionDownload, models.KindFileData, &userFileData.BaseUserData); err != nil {
+		return nil, nil, err
+	}
+	content, _, err := uds.contents.Open(ctx, userFileData.BlobKey)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			return nil, nil, httperror.New(err, "File content not found", http.StatusNotFound)
 		}
+		return nil, nil, err
 	}
-	return uds.store.DeleteUserFileData(ctx, dataID, userID)
+	return userFileData, content, nil
 }
 
 func (uds *UserDataService) DeleteUserAuthInfo(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) error {
-	return uds.store.DeleteUserAuthInfo(ctx, dataID, userID)
+	return uds.store.WithTx(ctx, func(ctx context.Context) error {
+		userAuthInfo, err := uds.store.GetUserAuthInfo(ctx, dataID, userID)
+		if err != nil {
+			return err
+		}
+		if err := uds.checkWritable(ctx, userID, &userAuthInfo.BaseUserData); err != nil {
+			return err
+		}
+		if err := uds.store.DeleteUserAuthInfo(ctx, dataID, userID); err != nil {
+			return err
+		}
+		uds.audit.recordChange(ctx, models.AuditActionDelete, models.KindAuthInfo, &userAuthInfo.BaseUserData)
+		return uds.deleteAttachments(ctx, userID, dataID)
+	})
 }
 
 func (uds *UserDataService) DeleteUserBankCard(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) error {
-	return uds.store.DeleteUserBankCard(ctx, dataID, userID)
+	return uds.store.WithTx(ctx, func(ctx context.Context) error {
+		userBankCard, err := uds.store.GetUserBankCard(ctx, dataID, userID)
+		if err != nil {
+			return err
+		}
+		if err := uds.checkWritable(ctx, userID, &userBankCard.BaseUserData); err != nil {
+			return err
+		}
+		if err := uds.store.DeleteUserBankCard(ctx, dataID, userID); err != nil {
+			return err
+		}
+		uds.audit.recordChange(ctx, models.AuditActionDelete, models.KindBankCard, &userBankCard.BaseUserData)
+		return uds.deleteAttachments(ctx, userID, dataID)
+	})
+}
+
+// withTx выполняет fn в транзакции и возвращает её результат. При повторе транзакции
+// fn выполняется заново, поэтому результат прошлой попытки не сохраняется
+func withTx[T any](ctx context.Context, transactor ITransactor, fn func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := transactor.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = fn(ctx)
+		return err
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// checkWritable проверяет, что пользователь может менять запись коллекции.
+// Личные записи доступны только владельцу, это проверяет уже сам запрос записи
+func (uds *UserDataService) checkWritable(ctx context.Context, userID uuid.UUID, record *models.BaseUserData) error {
+	if record.Personal() {
+		return nil
+	}
+	canWrite, err := uds.store.GetCollectionAccess(ctx, *record.CollectionID, userID)
+	if err != nil {
+		return err
+	}
+	if !canWrite {
+		return httperror.New(nil, "You have read-only access to this collection", http.StatusForbidden)
+	}
+	return nil
+}
+
+// listAll постранично собирает все записи пользователя одного вида
+func listAll[T any](
+	ctx context.Context,
+	userID uuid.UUID,
+	list func(ctx context.Context, userID uuid.UUID, offset int) ([]T, error),
+) ([]T, error) {
+	var all []T
+	for {
+		page, err := list(ctx, userID, len(all))
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			return all, nil
+		}
+		all = append(all, page...)
+	}
+}
+
+// personalOnly оставляет только личные записи, записи коллекций принадлежат организациям
+func personalOnly[T interface{ Personal() bool }](records []T) []T {
+	personal := records[:0]
+	for _, record := range records {
+		if record.Personal() {
+			personal = append(personal, record)
+		}
+	}
+	return personal
+}
+
+// baseRecords возвращает общие поля записей одного вида
+func baseRecords[T any, P interface {
+	*T
+	Base() *models.BaseUserData
+}](records []T) []*models.BaseUserData {
+	base := make([]*models.BaseUserData, len(records))
+	for i := range records {
+		base[i] = P(&records[i]).Base()
+	}
+	return base
+}
+
+// allUserFileData подходит для listAll: список файлов без фильтров
+func allUserFileData(store IUserDataStore) func(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserFileData, error) {
+	return func(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserFileData, error) {
+		return store.GetUserFileDataList(ctx, userID, models.FileDataFilter{}, offset)
+	}
 }
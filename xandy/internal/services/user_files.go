@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path"
+
+	"github.com/eac0de/xandy/internal/blobstore"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/eac0de/xandy/shared/pkg/psql"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// Сколько байт от начала файла нужно для определения MIME типа
+const mimeSniffLength = 3072
+
+type IFileBlobStore interface {
+	// AcquireFileBlob добавляет ссылку на содержимое, created равен true для первой ссылки
+	AcquireFileBlob(ctx context.Context, key string) (created bool, err error)
+	// ReleaseFileBlob убирает ссылку, released равен true, если ссылок больше не осталось
+	ReleaseFileBlob(ctx context.Context, key string) (released bool, err error)
+	GetFileBlob(ctx context.Context, key string) (*models.FileBlob, error)
+}
+
+// FileContentStore хранит содержимое файлов в BlobStore под ключом из SHA-256.
+// Одинаковое содержимое хранится один раз, на него ссылаются все записи UserFileData,
+// а содержимое удаляется вместе с последней ссылкой.
+type FileContentStore struct {
+	blobs blobstore.BlobStore
+	refs  IFileBlobStore
+	// Ссылки и содержимое одного ключа меняются под одной блокировкой
+	locks keyedMutex[string]
+}
+
+func NewFileContentStore(blobs blobstore.BlobStore, fileBlobStore IFileBlobStore) *FileContentStore {
+	return &FileContentStore{
+		blobs: blobs,
+		refs:  fileBlobStore,
+	}
+}
+
+// storedFile описывает содержимое, сохранённое в FileContentStore
+type storedFile struct {
+	Key      string
+	Size     int64
+	SHA256   string
+	MimeType string
+}
+
+func (sf *storedFile) apply(userFileData *models.UserFileData) {
+	userFileData.BlobKey = sf.Key
+	userFileData.SHA256 = sf.SHA256
+	userFileData.MimeType = sf.MimeType
+	userFileData.Size = sf.Size
+	// Новое содержимое нельзя скачать, пока его не проверит ScanService
+	userFileData.ScanStatus = models.ScanStatusPending
+	userFileData.ScanResult = ""
+	userFileData.ScannedAt = nil
+}
+
+// digestReader считает SHA-256 и запоминает начало потока для определения MIME типа
+type digestReader struct {
+	r    io.Reader
+	hash hash.Hash
+	head []byte
+	size int64
+}
+
+func (dr *digestReader) Read(p []byte) (int, error) {
+	n, err := dr.r.Read(p)
+	dr.hash.Write(p[:n])
+	if missing := mimeSniffLength - len(dr.head); missing > 0 {
+		dr.head = append(dr.head, p[:min(n, missing)]...)
+	}
+	dr.size += int64(n)
+	return n, err
+}
+
+// Префикс ключей содержимого в BlobStore
+const contentKeyPrefix = "sha256/"
+
+// contentKey - ключ содержимого в BlobStore, первые два символа хеша разносят файлы по каталогам
+func contentKey(sha256Hex string) string {
+	return contentKeyPrefix + sha256Hex[:2] + "/" + sha256Hex
+}
+
+// splitFileName отделяет расширение от имени файла, путь в имени отбрасывается
+func splitFileName(fileName string) (name string, ext string) {
+	fileName = path.Base("/" + fileName)
+	if fileName == "/" {
+		fileName = "file"
+	}
+	ext = path.Ext(fileName)
+	return fileName[:len(fileName)-len(ext)], ext
+}
+
+// Save сохраняет содержимое и добавляет на него ссылку.
+// Ссылку нужно вернуть через Release, если запись так и не была сохранена.
+func (fcs *FileContentStore) Save(ctx context.Context, content io.Reader) (*storedFile, error) {
+	// Ключ известен только после чтения всего содержимого, поэтому поток,
+	// который нельзя перечитать, сначала сохраняется во временный файл
+	seeker, ok := content.(io.ReadSeeker)
+	var spool io.Writer = io.Discard
+	if !ok {
+		file, err := os.CreateTemp("", "xandy-content-*")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(file.Name())
+		defer file.Close()
+		seeker = file
+		spool = file
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	digest := &digestReader{r: content, hash: sha256.New()}
+	if _, err := io.Copy(spool, digest); err != nil {
+		return nil, err
+	}
+	if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	sum := hex.EncodeToString(digest.hash.Sum(nil))
+	stored := &storedFile{
+		Key:      contentKey(sum),
+		Size:     digest.size,
+		SHA256:   sum,
+		MimeType: mimetype.Detect(digest.head).String(),
+	}
+
+	unlock := fcs.locks.lock(stored.Key)
+	defer unlock()
+	created, err := fcs.refs.AcquireFileBlob(ctx, stored.Key)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		// Содержимое могло пропасть из BlobStore, тогда его нужно записать заново
+		_, err := fcs.blobs.Stat(ctx, stored.Key)
+		if !errors.Is(err, blobstore.ErrNotFound) {
+			if err != nil {
+				fcs.refs.ReleaseFileBlob(context.WithoutCancel(ctx), stored.Key)
+				return nil, err
+			}
+			return stored, nil
+		}
+	}
+	if err := fcs.blobs.Put(ctx, stored.Key, seeker, stored.Size); err != nil {
+		if created {
+			fcs.refs.ReleaseFileBlob(context.WithoutCancel(ctx), stored.Key)
+		}
+		return nil, err
+	}
+	return stored, nil
+}
+
+// Release убирает ссылку на содержимое и удаляет его, если ссылок больше нет.
+// В транзакции содержимое удаляется только после её фиксации, ведь откат вернёт ссылку.
+func (fcs *FileContentStore) Release(ctx context.Context, key string) error {
+	unlock := fcs.locks.lock(key)
+	defer unlock()
+	released, err := fcs.refs.ReleaseFileBlob(ctx, key)
+	if err != nil || !released {
+		return err
+	}
+	if psql.InTx(ctx) {
+		psql.AfterCommit(ctx, func() {
+			if err := fcs.deleteUnreferenced(psql.WithoutTx(context.WithoutCancel(ctx)), key); err != nil {
+				log.Printf("delete blob %s: %s\n", key, err)
+			}
+		})
+		return nil
+	}
+	return fcs.blobs.Delete(ctx, key)
+}
+
+// deleteUnreferenced удаляет содержимое, если на него так и не появилось новых ссылок.
+// Между освобождением ссылки в транзакции и её фиксацией Save того же содержимого может
+// создать ссылку заново, тогда содержимое нужно ему. Блокировка действует только внутри
+// процесса, поэтому с несколькими экземплярами сервиса такая гонка всё ещё возможна
+func (fcs *FileContentStore) deleteUnreferenced(ctx context.Context, key string) error {
+	unlock := fcs.locks.lock(key)
+	defer unlock()
+	_, err := fcs.refs.GetFileBlob(ctx, key)
+	if err == nil {
+		return nil
+	}
+	if !httperror.IsNotFound(err) {
+		return err
+	}
+	return fcs.blobs.Delete(ctx, key)
+}
+
+// Open открывает содержимое с возможностью перемотки, blobstore.ErrNotFound - если его нет
+func (fcs *FileContentStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, int64, error) {
+	info, err := fcs.blobs.Stat(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return blobstore.NewReadSeeker(ctx, fcs.blobs, key, info.Size), info.Size, nil
+}
+
+// Stat возвращает размер содержимого, blobstore.ErrNotFound - если его нет
+func (fcs *FileContentStore) Stat(ctx context.Context, key string) (blobstore.Info, error) {
+	return fcs.blobs.Stat(ctx, key)
+}
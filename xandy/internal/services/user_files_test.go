@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/eac0de/xandy/internal/blobstore"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryFileBlobStore struct {
+	mu   sync.Mutex
+	refs map[string]int
+}
+
+func (s *memoryFileBlobStore) AcquireFileBlob(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refs[key]++
+	return s.refs[key] == 1, nil
+}
+
+func (s *memoryFileBlobStore) ReleaseFileBlob(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refs[key]--
+	if s.refs[key] > 0 {
+		return false, nil
+	}
+	delete(s.refs, key)
+	return true, nil
+}
+
+func (s *memoryFileBlobStore) GetFileBlob(ctx context.Context, key string) (*models.FileBlob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refCount, ok := s.refs[key]
+	if !ok {
+		return nil, httperror.New(nil, "FileBlob not found", http.StatusNotFound)
+	}
+	return &models.FileBlob{Key: key, RefCount: int64(refCount)}, nil
+}
+
+func TestFileContentStore(t *testing.T) {
+	ctx := context.Background()
+	blobs := blobstore.NewLocalStore(t.TempDir())
+	refs := &memoryFileBlobStore{refs: make(map[string]int)}
+	contents := NewFileContentStore(blobs, refs)
+
+	// Поток без Seek сохраняется через временный файл
+	first, err := contents.Save(ctx, io.MultiReader(strings.NewReader("same content")))
+	require.NoError(t, err)
+	second, err := contents.Save(ctx, strings.NewReader("same content"))
+	require.NoError(t, err)
+	other, err := contents.Save(ctx, strings.NewReader("other content"))
+	require.NoError(t, err)
+
+	assert.Equal(t, first.Key, second.Key)
+	assert.NotEqual(t, first.Key, other.Key)
+	assert.Equal(t, contentKey(first.SHA256), first.Key)
+	assert.Equal(t, int64(12), first.Size)
+	assert.Equal(t, 2, refs.refs[first.Key])
+
+	content, size, err := contents.Open(ctx, first.Key)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(content)
+	content.Close()
+	assert.Equal(t, int64(12), size)
+	assert.Equal(t, "same content", string(data))
+
+	// Содержимое удаляется только вместе с последней ссылкой
+	require.NoError(t, contents.Release(ctx, first.Key))
+	_, err = contents.Stat(ctx, first.Key)
+	assert.NoError(t, err)
+	require.NoError(t, contents.Release(ctx, second.Key))
+	_, err = contents.Stat(ctx, first.Key)
+	assert.ErrorIs(t, err, blobstore.ErrNotFound)
+
+	// Пропавшее содержимое записывается заново при следующем сохранении
+	require.NoError(t, blobs.Delete(ctx, other.Key))
+	_, err = contents.Save(ctx, strings.NewReader("other content"))
+	require.NoError(t, err)
+	_, err = contents.Stat(ctx, other.Key)
+	assert.NoError(t, err)
+}
+
+func TestSplitFileName(t *testing.T) {
+	name, ext := splitFileName("../../etc/report.final.pdf")
+	assert.Equal(t, "report.final", name)
+	assert.Equal(t, ".pdf", ext)
+
+	name, ext = splitFileName("")
+	assert.Equal(t, "file", name)
+	assert.Equal(t, "", ext)
+}
+
+func TestFileContentStoreDeleteUnreferenced(t *testing.T) {
+	ctx := context.Background()
+	blobs := blobstore.NewLocalStore(t.TempDir())
+	refs := &memoryFileBlobStore{refs: make(map[string]int)}
+	contents := NewFileContentStore(blobs, refs)
+
+	stored, err := contents.Save(ctx, strings.NewReader("content"))
+	require.NoError(t, err)
+
+	// Пока удаление ждало фиксации, то же содержимое сохранили заново
+	require.NoError(t, contents.deleteUnreferenced(ctx, stored.Key))
+	_, err = blobs.Stat(ctx, stored.Key)
+	require.NoError(t, err)
+
+	released, err := refs.ReleaseFileBlob(ctx, stored.Key)
+	require.NoError(t, err)
+	require.True(t, released)
+	require.NoError(t, contents.deleteUnreferenced(ctx, stored.Key))
+	_, err = blobs.Stat(ctx, stored.Key)
+	assert.ErrorIs(t, err, blobstore.ErrNotFound)
+}
@@ -0,0 +1,508 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/eac0de/xandy/internal/blobstore"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/internal/vaultarchive"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+
+	"github.com/google/uuid"
+)
+
+const minPassphraseLength = 8
+
+// Режимы восстановления хранилища
+type RestoreMode string
+
+const (
+	// Существующие записи остаются, запись из архива заменяет запись с тем же id, только если она новее
+	RestoreModeMerge RestoreMode = "merge"
+	// Все записи пользователя удаляются и заменяются содержимым архива
+	RestoreModeReplace RestoreMode = "replace"
+)
+
+// Запись из архива не заменяет запись коллекции организации с тем же id
+var errCollectionRecord = httperror.New(nil, "Record with this id belongs to an organization", http.StatusConflict)
+
+type RestoreError struct {
+	Kind  models.DataKind `json:"kind"`
+	ID    uuid.UUID       `json:"id"`
+	Name  string          `json:"name"`
+	Error string          `json:"error"`
+}
+
+type RestoreReport struct {
+	Mode       RestoreMode    `json:"mode"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Total      int            `json:"total"`
+	Created    int            `json:"created"`
+	Updated    int            `json:"updated"`
+	Skipped    int            `json:"skipped"`
+	Deleted    int            `json:"deleted"`
+	Failed     int            `json:"failed"`
+	Errors     []RestoreError `json:"errors"`
+}
+
+// reset обнуляет счётчики перед повтором восстановления в транзакции
+func (r *RestoreReport) reset() {
+	r.Created, r.Updated, r.Skipped, r.Deleted, r.Failed = 0, 0, 0, 0, 0
+	r.Errors = []RestoreError{}
+}
+
+func (r *RestoreReport) fail(kind models.DataKind, record models.BaseUserData, err error) {
+	msg, _ := httperror.GetMessageAndStatusCode(err)
+	r.Failed++
+	r.Errors = append(r.Errors, RestoreError{Kind: kind, ID: record.ID, Name: record.Name, Error: strings.TrimSpace(msg)})
+}
+
+type VaultService struct {
+	store    IUserDataStore
+	contents *FileContentStore
+	quotas   *QuotaService
+	audit    *AuditService
+}
+
+func NewVaultService(userDataStore IUserDataStore, contents *FileContentStore, quotas *QuotaService, audit *AuditService) *VaultService {
+	return &VaultService{
+		store:    userDataStore,
+		contents: contents,
+		quotas:   quotas,
+		audit:    audit,
+	}
+}
+
+// Export записывает в w все записи пользователя вместе с содержимым проверенных файлов,
+// зашифрованные ключом из парольной фразы.
+// Ошибки до начала записи в w возвращаются без частично записанных данных.
+func (vs *VaultService) Export(ctx context.Context, userID uuid.UUID, passphrase string, w io.Writer) error {
+	if err := validatePassphrase(passphrase); err != nil {
+		return err
+	}
+	manifest := &vaultarchive.Manifest{Version: vaultarchive.Version, ExportedAt: time.Now().UTC()}
+	var err error
+	if manifest.AuthInfo, err = listAll(ctx, userID, vs.store.GetUserAuthInfoList); err != nil {
+		return err
+	}
+	if manifest.TextData, err = listAll(ctx, userID, vs.store.GetUserTextDataList); err != nil {
+		return err
+	}
+	if manifest.BankCards, err = listAll(ctx, userID, vs.store.GetUserBankCardList); err != nil {
+		return err
+	}
+	if manifest.FileData, err = listAll(ctx, userID, allUserFileData(vs.store)); err != nil {
+		return err
+	}
+	// В архив попадают только личные записи, записи коллекций остаются в организации
+	manifest.AuthInfo = personalOnly(manifest.AuthInfo)
+	manifest.TextData = personalOnly(manifest.TextData)
+	manifest.BankCards = personalOnly(manifest.BankCards)
+	manifest.FileData = personalOnly(manifest.FileData)
+	sizes := make(map[uuid.UUID]int64, len(manifest.FileData))
+	for _, userFileData := range manifest.FileData {
+		if checkScanStatus(&userFileData) != nil {
+			manifest.UnscannedFiles = append(manifest.UnscannedFiles, userFileData.ID)
+			continue
+		}
+		info, err := vs.contents.Stat(ctx, userFileData.BlobKey)
+		if err != nil {
+			if errors.Is(err, blobstore.ErrNotFound) {
+				manifest.MissingFiles = append(manifest.MissingFiles, userFileData.ID)
+				continue
+			}
+			return err
+		}
+		sizes[userFileData.ID] = info.Size
+	}
+	if err := vs.recordExport(ctx, manifest); err != nil {
+		return err
+	}
+
+	archive, err := vaultarchive.NewWriter(w, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := archive.WriteManifest(manifest); err != nil {
+		return err
+	}
+	for _, userFileData := range manifest.FileData {
+		size, ok := sizes[userFileData.ID]
+		if !ok {
+			continue
+		}
+		err := func() error {
+			content, _, err := vs.contents.Open(ctx, userFileData.BlobKey)
+			if err != nil {
+				return err
+			}
+			defer content.Close()
+			return archive.WriteFile(userFileData.ID, size, content)
+		}()
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// Restore восстанавливает записи из архива, сохраняя их идентификаторы и даты.
+// Архив полностью расшифровывается и проверяется до изменения данных пользователя.
+func (vs *VaultService) Restore(
+	ctx context.Context,
+	userID uuid.UUID,
+	passphrase string,
+	r io.Reader,
+	mode RestoreMode,
+) (*RestoreReport, error) {
+	if mode != RestoreModeMerge && mode != RestoreModeReplace {
+		return nil, httperror.New(nil, fmt.Sprintf("Unsupported restore mode: %s", mode), http.StatusBadRequest)
+	}
+	if err := validatePassphrase(passphrase); err != nil {
+		return nil, err
+	}
+	stagingDir, err := os.MkdirTemp("", "xandy-restore-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stagingDir)
+
+	manifest, err := vaultarchive.Read(r, passphrase, func(id uuid.UUID, content io.Reader) error {
+		file, err := os.Create(filepath.Join(stagingDir, id.String()))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(file, content)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, vaultarchive.ErrDecryption) {
+			return nil, httperror.New(err, "Wrong passphrase or corrupted vault archive", http.StatusUnprocessableEntity)
+		}
+		if errors.Is(err, vaultarchive.ErrInvalidArchive) {
+			return nil, httperror.New(err, err.Error(), http.StatusBadRequest)
+		}
+		return nil, err
+	}
+
+	report := &RestoreReport{
+		Mode:       mode,
+		ExportedAt: manifest.ExportedAt,
+		Total:      len(manifest.AuthInfo) + len(manifest.TextData) + len(manifest.BankCards) + len(manifest.FileData),
+		Errors:     []RestoreError{},
+	}
+	// Восстановление записывается в журнал и при ошибке, в режиме merge часть записей к этому моменту уже изменена
+	defer vs.recordRestore(ctx, userID, report)
+	restoreAll := func(ctx context.Context) {
+		for i := range manifest.AuthInfo {
+			userAuthInfo := &manifest.AuthInfo[i]
+			userAuthInfo.UserID = userID
+			userAuthInfo.CollectionID = nil
+			vs.restoreRecord(ctx, report, models.KindAuthInfo, userAuthInfo.BaseUserData,
+				func() error { return models.Validate(userAuthInfo) },
+				func(ctx context.Context) (time.Time, error) {
+					existing, err := vs.store.GetUserAuthInfo(ctx, userAuthInfo.ID, userID)
+					if err != nil {
+						return time.Time{}, err
+					}
+					if !existing.Personal() {
+						return time.Time{}, errCollectionRecord
+					}
+					return existing.UpdatedAt, nil
+				},
+				func(ctx context.Context) error { return vs.store.InsertUserAuthInfo(ctx, userAuthInfo) },
+				func(ctx context.Context) error { return vs.store.UpdateUserAuthInfo(ctx, userAuthInfo, userID) },
+			)
+		}
+		for i := range manifest.TextData {
+			userTextData := &manifest.TextData[i]
+			userTextData.UserID = userID
+			userTextData.CollectionID = nil
+			vs.restoreRecord(ctx, report, models.KindTextData, userTextData.BaseUserData,
+				func() error { return models.Validate(userTextData) },
+				func(ctx context.Context) (time.Time, error) {
+					existing, err := vs.store.GetUserTextData(ctx, userTextData.ID, userID)
+					if err != nil {
+						return time.Time{}, err
+					}
+					if !existing.Personal() {
+						return time.Time{}, errCollectionRecord
+					}
+					return existing.UpdatedAt, nil
+				},
+				func(ctx context.Context) error { return vs.store.InsertUserTextData(ctx, userTextData) },
+				func(ctx context.Context) error { return vs.store.UpdateUserTextData(ctx, userTextData, userID) },
+			)
+		}
+		for i := range manifest.BankCards {
+			userBankCard := &manifest.BankCards[i]
+			userBankCard.UserID = userID
+			userBankCard.CollectionID = nil
+			vs.restoreRecord(ctx, report, models.KindBankCard, userBankCard.BaseUserData,
+				func() error { return models.Validate(userBankCard) },
+				func(ctx context.Context) (time.Time, error) {
+					existing, err := vs.store.GetUserBankCard(ctx, userBankCard.ID, userID)
+					if err != nil {
+						return time.Time{}, err
+					}
+					if !existing.Personal() {
+						return time.Time{}, errCollectionRecord
+					}
+					return existing.UpdatedAt, nil
+				},
+				func(ctx context.Context) error { return vs.store.InsertUserBankCard(ctx, userBankCard) },
+				func(ctx context.Context) error { return vs.store.UpdateUserBankCard(ctx, userBankCard, userID) },
+			)
+		}
+		for i := range manifest.FileData {
+			userFileData := &manifest.FileData[i]
+			userFileData.UserID = userID
+			userFileData.CollectionID = nil
+			stagedPath := filepath.Join(stagingDir, userFileData.ID.String())
+			var existing *models.UserFileData
+			vs.restoreRecord(ctx, report, models.KindFileData, userFileData.BaseUserData,
+				func() error {
+					if _, err := os.Stat(stagedPath); err != nil {
+						return httperror.New(err, "File content is missing in the archive", http.StatusUnprocessableEntity)
+					}
+					return models.Validate(userFileData)
+				},
+				func(ctx context.Context) (time.Time, error) {
+					var err error
+					existing, err = vs.store.GetUserFileData(ctx, userFileData.ID, userID)
+					if err != nil {
+						return time.Time{}, err
+					}
+					if !existing.Personal() {
+						return time.Time{}, errCollectionRecord
+					}
+					return existing.UpdatedAt, nil
+				},
+				func(ctx context.Context) error { return vs.insertRestoredFile(ctx, userFileData, stagedPath) },
+				func(ctx context.Context) error { return vs.updateRestoredFile(ctx, existing, userFileData, stagedPath) },
+			)
+		}
+	}
+	if mode == RestoreModeMerge {
+		restoreAll(ctx)
+		return report, nil
+	}
+	// Старые записи удаляются вместе с восстановлением новых, при ошибке хранилище остаётся прежним
+	err = vs.store.WithTx(ctx, func(ctx context.Context) error {
+		report.reset()
+		deleted, err := vs.deleteAll(ctx, userID)
+		if err != nil {
+			return err
+		}
+		report.Deleted = deleted
+		restoreAll(ctx)
+		return nil
+	})
+	if err != nil {
+		report.reset()
+		return nil, err
+	}
+	return report, nil
+}
+
+// restoreRecord вставляет запись из архива, а в режиме merge обновляет существующую запись,
+// если в архиве она изменена позже
+func (vs *VaultService) restoreRecord(
+	ctx context.Context,
+	report *RestoreReport,
+	kind models.DataKind,
+	record models.BaseUserData,
+	validate func() error,
+	existingUpdatedAt func(ctx context.Context) (time.Time, error),
+	insert func(ctx context.Context) error,
+	update func(ctx context.Context) error,
+) {
+	if record.ID == uuid.Nil {
+		report.fail(kind, record, httperror.New(nil, "Record id is required", http.StatusUnprocessableEntity))
+		return
+	}
+	if err := validate(); err != nil {
+		report.fail(kind, record, err)
+		return
+	}
+	if report.Mode == RestoreModeMerge {
+		updatedAt, err := existingUpdatedAt(ctx)
+		if err == nil {
+			if !record.UpdatedAt.After(updatedAt) {
+				report.Skipped++
+				return
+			}
+			if err := vs.store.WithTx(ctx, update); err != nil {
+				report.fail(kind, record, err)
+				return
+			}
+			report.Updated++
+			return
+		}
+		if _, statusCode := httperror.GetMessageAndStatusCode(err); statusCode != http.StatusNotFound {
+			report.fail(kind, record, err)
+			return
+		}
+	}
+	// Ошибка одной записи откатывает только её, остальные восстанавливаются дальше
+	err := vs.store.WithTx(ctx, func(ctx context.Context) error {
+		if err := vs.quotas.CheckRecord(ctx, record.UserID, kind); err != nil {
+			return err
+		}
+		return insert(ctx)
+	})
+	if err != nil {
+		report.fail(kind, record, err)
+		return
+	}
+	report.Created++
+}
+
+func (vs *VaultService) insertRestoredFile(ctx context.Context, userFileData *models.UserFileData, stagedPath string) error {
+	staged, err := os.Open(stagedPath)
+	if err != nil {
+		return err
+	}
+	defer staged.Close()
+	content, release, err := vs.quotas.LimitFile(ctx, userFileData.UserID, staged, 0)
+	if err != nil {
+		return err
+	}
+	defer release()
+	stored, err := vs.contents.Save(ctx, content)
+	if err != nil {
+		return err
+	}
+	stored.apply(userFileData)
+	err = vs.quotas.CheckStorage(ctx, userFileData.UserID, userFileData.Size, 0)
+	if err == nil {
+		err = vs.store.InsertUserFileData(ctx, userFileData)
+	}
+	if err != nil {
+		vs.contents.Release(context.WithoutCancel(ctx), stored.Key)
+		return err
+	}
+	return nil
+}
+
+func (vs *VaultService) updateRestoredFile(ctx context.Context, existing, userFileData *models.UserFileData, stagedPath string) error {
+	staged, err := os.Open(stagedPath)
+	if err != nil {
+		return err
+	}
+	defer staged.Close()
+	content, release, err := vs.quotas.LimitFile(ctx, userFileData.UserID, staged, existing.Size)
+	if err != nil {
+		return err
+	}
+	defer release()
+	stored, err := vs.contents.Save(ctx, content)
+	if err != nil {
+		return err
+	}
+	stored.apply(userFileData)
+	err = vs.quotas.CheckStorage(ctx, userFileData.UserID, userFileData.Size, existing.Size)
+	if err == nil {
+		err = vs.store.ReplaceUserFileContent(ctx, userFileData, existing.BlobKey, userFileData.UserID)
+	}
+	if err != nil {
+		vs.contents.Release(context.WithoutCancel(ctx), stored.Key)
+		return err
+	}
+	if err := vs.contents.Release(ctx, existing.BlobKey); err != nil {
+		return err
+	}
+	return vs.store.UpdateUserFileData(ctx, userFileData, userFileData.UserID)
+}
+
+// recordExport записывает в журнал чтение всех выгружаемых записей до начала выгрузки
+func (vs *VaultService) recordExport(ctx context.Context, manifest *vaultarchive.Manifest) error {
+	if err := vs.audit.Record(ctx, models.AuditActionExport, models.KindAuthInfo, baseRecords(manifest.AuthInfo)...); err != nil {
+		return err
+	}
+	if err := vs.audit.Record(ctx, models.AuditActionExport, models.KindTextData, baseRecords(manifest.TextData)...); err != nil {
+		return err
+	}
+	if err := vs.audit.Record(ctx, models.AuditActionExport, models.KindBankCard, baseRecords(manifest.BankCards)...); err != nil {
+		return err
+	}
+	return vs.audit.Record(ctx, models.AuditActionExport, models.KindFileData, baseRecords(manifest.FileData)...)
+}
+
+func (vs *VaultService) recordRestore(ctx context.Context, userID uuid.UUID, report *RestoreReport) {
+	auditEvent := models.NewAuditEvent(AuditActorFromContext(ctx), models.AuditActionRestore)
+	auditEvent.OwnerID = &userID
+	auditEvent.Details = models.Metadata{
+		"mode":    report.Mode,
+		"created": report.Created,
+		"updated": report.Updated,
+		"deleted": report.Deleted,
+		"failed":  report.Failed,
+	}
+	vs.audit.recordEventChange(ctx, auditEvent)
+}
+
+// deleteAll удаляет все личные записи пользователя и их файлы
+func (vs *VaultService) deleteAll(ctx context.Context, userID uuid.UUID) (int, error) {
+	deleted := 0
+	authInfoList, err := listAll(ctx, userID, vs.store.GetUserAuthInfoList)
+	if err != nil {
+		return deleted, err
+	}
+	for _, data := range personalOnly(authInfoList) {
+		if err := vs.store.DeleteUserAuthInfo(ctx, data.ID, userID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	textDataList, err := listAll(ctx, userID, vs.store.GetUserTextDataList)
+	if err != nil {
+		return deleted, err
+	}
+	for _, data := range personalOnly(textDataList) {
+		if err := vs.store.DeleteUserTextData(ctx, data.ID, userID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	bankCardList, err := listAll(ctx, userID, vs.store.GetUserBankCardList)
+	if err != nil {
+		return deleted, err
+	}
+	for _, data := range personalOnly(bankCardList) {
+		if err := vs.store.DeleteUserBankCard(ctx, data.ID, userID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	fileDataList, err := listAll(ctx, userID, allUserFileData(vs.store))
+	if err != nil {
+		return deleted, err
+	}
+	for _, data := range personalOnly(fileDataList) {
+		if err := vs.store.DeleteUserFileData(ctx, data.ID, userID); err != nil {
+			return deleted, err
+		}
+		if err := vs.contents.Release(ctx, data.BlobKey); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func validatePassphrase(passphrase string) error {
+	if len([]rune(passphrase)) < minPassphraseLength {
+		return httperror.New(nil, fmt.Sprintf("Passphrase must be at least %d characters", minPassphraseLength), http.StatusUnprocessableEntity)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/eac0de/xandy/internal/blobstore"
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/internal/vaultarchive"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// vaultTestStore хранит только файлы, остальных записей у пользователя нет
+type vaultTestStore struct {
+	fileDataStore
+}
+
+func (s *vaultTestStore) GetUserAuthInfoList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserAuthInfo, error) {
+	return nil, nil
+}
+
+func (s *vaultTestStore) GetUserTextDataList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserTextData, error) {
+	return nil, nil
+}
+
+func (s *vaultTestStore) GetUserBankCardList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserBankCard, error) {
+	return nil, nil
+}
+
+func TestVaultServiceExportSkipsUnscannedContent(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	contents := NewFileContentStore(blobstore.NewLocalStore(t.TempDir()), &memoryFileBlobStore{refs: make(map[string]int)})
+	store := &vaultTestStore{}
+	for _, file := range []struct {
+		name, content string
+		status        models.ScanStatus
+	}{
+		{"clean", "clean content", models.ScanStatusClean},
+		{"infected", "EICAR-STANDARD-ANTIVIRUS-TEST-FILE", models.ScanStatusInfected},
+		{"pending", "pending content", models.ScanStatusPending},
+	} {
+		userFileData, err := models.NewUserFileData(file.name, userID, models.Metadata{}, ".txt", file.name+".txt")
+		require.NoError(t, err)
+		stored, err := contents.Save(ctx, strings.NewReader(file.content))
+		require.NoError(t, err)
+		stored.apply(&userFileData)
+		userFileData.ScanStatus = file.status
+		store.files = append(store.files, userFileData)
+	}
+	service := NewVaultService(store, contents, nil, nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, service.Export(ctx, userID, "correct horse", &buf))
+
+	exported := make(map[uuid.UUID]string)
+	manifest, err := vaultarchive.Read(&buf, "correct horse", func(id uuid.UUID, content io.Reader) error {
+		data, err := io.ReadAll(content)
+		exported[id] = string(data)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[uuid.UUID]string{store.files[0].ID: "clean content"}, exported)
+	assert.ElementsMatch(t, []uuid.UUID{store.files[1].ID, store.files[2].ID}, manifest.UnscannedFiles)
+	require.Len(t, manifest.FileData, 3)
+	assert.Equal(t, models.ScanStatusInfected, manifest.FileData[1].ScanStatus)
+}
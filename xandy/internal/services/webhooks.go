@@ -0,0 +1,316 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// Сколько событий outbox и доставок обрабатывается за один проход
+	webhookBatchSize = 100
+	// После стольких неудачных попыток доставка считается проваленной
+	webhookMaxAttempts = 10
+	// Задержка перед второй попыткой, дальше она удваивается до webhookMaxRetryDelay
+	webhookBaseRetryDelay = 30 * time.Second
+	webhookMaxRetryDelay  = time.Hour
+)
+
+var errWebhookAddress = errors.New("webhook address is not public")
+
+// Кроме частных, loopback и link-local адресов (там же метаданные облака 169.254.169.254)
+// вебхуки не отправляются в эти служебные сети
+var webhookReservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+type IWebhookStore interface {
+	InsertWebhook(ctx context.Context, webhook *models.Webhook) error
+	GetWebhook(ctx context.Context, webhookID uuid.UUID, userID uuid.UUID) (*models.Webhook, error)
+	GetWebhooks(ctx context.Context, userID uuid.UUID) ([]models.Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook *models.Webhook) error
+	DeleteWebhook(ctx context.Context, webhookID uuid.UUID, userID uuid.UUID) error
+	GetWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, offset int) ([]models.WebhookDelivery, error)
+	ReplayWebhookDelivery(ctx context.Context, webhookID uuid.UUID, deliveryID uuid.UUID, now time.Time) (*models.WebhookDelivery, error)
+	DispatchWebhookOutbox(ctx context.Context, now time.Time, limit int) (int, error)
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]models.WebhookDelivery, error)
+	CompleteWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+}
+
+// WebhookService доставляет события изменения записей на вебхуки пользователей.
+// События пишутся в outbox триггерами базы в одной транзакции с изменением записи,
+// сервис раскладывает их по вебхукам и отправляет с повторами. Тело запроса подписывается
+// HMAC-SHA256 ключом вебхука: заголовок X-Xandy-Signature содержит подпись строки "<X-Xandy-Timestamp>.<тело>".
+type WebhookService struct {
+	store  IWebhookStore
+	client *http.Client
+}
+
+// NewWebhookClient возвращает HTTP-клиент для доставки вебхуков. Адрес проверяется уже после
+// разрешения имени, поэтому через вебхук нельзя обратиться во внутреннюю сеть ни по имени, ни перенаправлением.
+func NewWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			return checkWebhookAddress(address)
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		// Прокси из окружения не используется, иначе проверялся бы адрес прокси, а не получателя
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		// Перенаправления не выполняются, ответ 3xx считается неудачной доставкой
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// checkWebhookAddress разрешает подключение только к публичным адресам
+func checkWebhookAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("%w: %s", errWebhookAddress, ip)
+	}
+	for _, prefix := range webhookReservedPrefixes {
+		if prefix.Contains(ip) {
+			return fmt.Errorf("%w: %s", errWebhookAddress, ip)
+		}
+	}
+	return nil
+}
+
+func NewWebhookService(webhookStore IWebhookStore, client *http.Client) *WebhookService {
+	return &WebhookService{
+		store:  webhookStore,
+		client: client,
+	}
+}
+
+func (ws *WebhookService) CreateWebhook(ctx context.Context, userID uuid.UUID, url string, events []models.WebhookEvent) (*models.Webhook, error) {
+	webhook, err := models.NewWebhook(userID, url, events)
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.store.InsertWebhook(ctx, &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (ws *WebhookService) GetWebhooks(ctx context.Context, userID uuid.UUID) ([]models.Webhook, error) {
+	webhooks, err := ws.store.GetWebhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if webhooks == nil {
+		webhooks = []models.Webhook{}
+	}
+	return webhooks, nil
+}
+
+// UpdateWebhook меняет только переданные поля, ключ подписи остаётся прежним
+func (ws *WebhookService) UpdateWebhook(
+	ctx context.Context,
+	userID uuid.UUID,
+	webhookID uuid.UUID,
+	url *string,
+	events []models.WebhookEvent,
+	active *bool,
+) (*models.Webhook, error) {
+	webhook, err := ws.store.GetWebhook(ctx, webhookID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if url != nil {
+		webhook.URL = *url
+	}
+	if events != nil {
+		webhook.Events = events
+	}
+	if active != nil {
+		webhook.Active = *active
+	}
+	webhook.UpdatedAt = time.Now()
+	if err := models.Validate(webhook); err != nil {
+		return nil, err
+	}
+	if err := ws.store.UpdateWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (ws *WebhookService) DeleteWebhook(ctx context.Context, userID uuid.UUID, webhookID uuid.UUID) error {
+	return ws.store.DeleteWebhook(ctx, webhookID, userID)
+}
+
+func (ws *WebhookService) GetDeliveries(ctx context.Context, userID uuid.UUID, webhookID uuid.UUID, offset int) ([]models.WebhookDelivery, error) {
+	if _, err := ws.store.GetWebhook(ctx, webhookID, userID); err != nil {
+		return nil, err
+	}
+	deliveries, err := ws.store.GetWebhookDeliveries(ctx, webhookID, offset)
+	if err != nil {
+		return nil, err
+	}
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+	return deliveries, nil
+}
+
+// ReplayDelivery повторно отправляет событие из журнала, например после исправления получателя
+func (ws *WebhookService) ReplayDelivery(ctx context.Context, userID uuid.UUID, webhookID uuid.UUID, deliveryID uuid.UUID) (*models.WebhookDelivery, error) {
+	if _, err := ws.store.GetWebhook(ctx, webhookID, userID); err != nil {
+		return nil, err
+	}
+	return ws.store.ReplayWebhookDelivery(ctx, webhookID, deliveryID, time.Now())
+}
+
+// DeliverPending раскладывает новые события по вебхукам и отправляет доставки, время которых наступило.
+// Возвращает число успешных доставок.
+func (ws *WebhookService) DeliverPending(ctx context.Context) (int, error) {
+	for {
+		dispatched, err := ws.store.DispatchWebhookOutbox(ctx, time.Now(), webhookBatchSize)
+		if err != nil {
+			return 0, err
+		}
+		if dispatched < webhookBatchSize {
+			break
+		}
+	}
+	delivered := 0
+	for {
+		now := time.Now()
+		deliveries, err := ws.store.ClaimWebhookDeliveries(ctx, now, now.Add(ws.client.Timeout+time.Minute), webhookBatchSize)
+		if err != nil {
+			return delivered, err
+		}
+		for i := range deliveries {
+			delivery := &deliveries[i]
+			ws.deliver(ctx, delivery)
+			if err := ws.store.CompleteWebhookDelivery(ctx, delivery); err != nil {
+				return delivered, err
+			}
+			if delivery.Status == models.WebhookDeliverySucceeded {
+				delivered++
+			}
+		}
+		if len(deliveries) < webhookBatchSize {
+			return delivered, nil
+		}
+	}
+}
+
+// deliver делает одну попытку доставки и записывает её результат в delivery
+func (ws *WebhookService) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	statusCode, err := ws.send(ctx, delivery)
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.UpdatedAt = now
+	if err == nil {
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.LastError = ""
+		return
+	}
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= webhookMaxAttempts {
+		delivery.Status = models.WebhookDeliveryFailed
+		return
+	}
+	delivery.NextAttemptAt = now.Add(webhookRetryDelay(delivery.Attempts))
+}
+
+func (ws *WebhookService) send(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Xandy-Event", string(delivery.Event))
+	request.Header.Set("X-Xandy-Delivery", delivery.ID.String())
+	request.Header.Set("X-Xandy-Timestamp", timestamp)
+	request.Header.Set("X-Xandy-Signature", "sha256="+SignWebhookPayload(delivery.Secret, timestamp, delivery.Payload))
+	response, err := ws.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	// Тело ответа не сохраняется: получатель мог вернуть то, что пользователю видеть не положено
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// SignWebhookPayload возвращает подпись тела запроса в hex, по ней получатель проверяет, что событие отправил xandy
+func SignWebhookPayload(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRetryDelay возвращает задержку перед следующей попыткой после attempts неудачных
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := webhookBaseRetryDelay
+	for i := 1; i < attempts && delay < webhookMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, webhookMaxRetryDelay)
+}
+
+// Run периодически доставляет события до отмены контекста
+func (ws *WebhookService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			delivered, err := ws.DeliverPending(ctx)
+			if err != nil {
+				log.Printf("deliver webhooks: %s\n", err)
+			}
+			if delivered > 0 {
+				log.Printf("delivered %d webhook events\n", delivered)
+			}
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookTestStore хранит вебхуки и доставки в памяти, outbox заменён готовыми доставками
+type webhookTestStore struct {
+	webhooks   map[uuid.UUID]models.Webhook
+	deliveries []models.WebhookDelivery
+}
+
+func (s *webhookTestStore) InsertWebhook(ctx context.Context, webhook *models.Webhook) error {
+	s.webhooks[webhook.ID] = *webhook
+	return nil
+}
+
+func (s *webhookTestStore) GetWebhook(ctx context.Context, webhookID uuid.UUID, userID uuid.UUID) (*models.Webhook, error) {
+	webhook, ok := s.webhooks[webhookID]
+	if !ok || webhook.UserID != userID {
+		return nil, httperror.New(nil, "Webhook not found", http.StatusNotFound)
+	}
+	webhook.Secret = ""
+	return &webhook, nil
+}
+
+func (s *webhookTestStore) GetWebhooks(ctx context.Context, userID uuid.UUID) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	for _, webhook := range s.webhooks {
+		if webhook.UserID == userID {
+			webhook.Secret = ""
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (s *webhookTestStore) UpdateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	webhook.Secret = s.webhooks[webhook.ID].Secret
+	s.webhooks[webhook.ID] = *webhook
+	webhook.Secret = ""
+	return nil
+}
+
+func (s *webhookTestStore) DeleteWebhook(ctx context.Context, webhookID uuid.UUID, userID uuid.UUID) error {
+	delete(s.webhooks, webhookID)
+	return nil
+}
+
+func (s *webhookTestStore) GetWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, offset int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (s *webhookTestStore) ReplayWebhookDelivery(ctx context.Context, webhookID uuid.UUID, deliveryID uuid.UUID, now time.Time) (*models.WebhookDelivery, error) {
+	for _, delivery := range s.deliveries {
+		if delivery.ID == deliveryID && delivery.WebhookID == webhookID {
+			delivery.ID = uuid.New()
+			delivery.Status = models.WebhookDeliveryPending
+			delivery.Attempts = 0
+			delivery.NextAttemptAt = now
+			s.deliveries = append(s.deliveries, delivery)
+			return &delivery, nil
+		}
+	}
+	return nil, httperror.New(nil, "Webhook delivery not found", http.StatusNotFound)
+}
+
+func (s *webhookTestStore) DispatchWebhookOutbox(ctx context.Context, now time.Time, limit int) (int, error) {
+	return 0, nil
+}
+
+func (s *webhookTestStore) ClaimWebhookDeliveries(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]models.WebhookDelivery, error) {
+	var claimed []models.WebhookDelivery
+	for i := range s.deliveries {
+		delivery := &s.deliveries[i]
+		webhook := s.webhooks[delivery.WebhookID]
+		if delivery.Status != models.WebhookDeliveryPending || delivery.NextAttemptAt.After(now) || !webhook.Active {
+			continue
+		}
+		delivery.NextAttemptAt = leaseUntil
+		claimed = append(claimed, *delivery)
+		claimed[len(claimed)-1].URL = webhook.URL
+		claimed[len(claimed)-1].Secret = webhook.Secret
+	}
+	return claimed, nil
+}
+
+func (s *webhookTestStore) CompleteWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	for i := range s.deliveries {
+		if s.deliveries[i].ID == delivery.ID {
+			delivery.URL, delivery.Secret = "", ""
+			s.deliveries[i] = *delivery
+		}
+	}
+	return nil
+}
+
+// makeDue переносит следующую попытку всех доставок на текущий момент
+func (s *webhookTestStore) makeDue() {
+	for i := range s.deliveries {
+		s.deliveries[i].NextAttemptAt = time.Now()
+	}
+}
+
+func TestWebhookService(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	store := &webhookTestStore{webhooks: make(map[uuid.UUID]models.Webhook)}
+	service := NewWebhookService(store, &http.Client{Timeout: time.Second})
+
+	statusCode := http.StatusInternalServerError
+	var received []*http.Request
+	var receivedBodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, r)
+		receivedBodies = append(receivedBodies, body)
+		w.WriteHeader(statusCode)
+		w.Write([]byte("internal details"))
+	}))
+	defer server.Close()
+
+	t.Run("CreateValidation", func(t *testing.T) {
+		for _, tc := range []struct {
+			url    string
+			events []models.WebhookEvent
+		}{
+			{"ftp://example.com/hook", []models.WebhookEvent{models.WebhookEventCreated}},
+			{server.URL, nil},
+			{server.URL, []models.WebhookEvent{"read"}},
+		} {
+			_, err := service.CreateWebhook(ctx, userID, tc.url, tc.events)
+			_, code := httperror.GetMessageAndStatusCode(err)
+			assert.Equal(t, http.StatusUnprocessableEntity, code, tc.url)
+		}
+	})
+
+	webhook, err := service.CreateWebhook(ctx, userID, server.URL, []models.WebhookEvent{models.WebhookEventUpdated})
+	require.NoError(t, err)
+	assert.Len(t, webhook.Secret, 64)
+	secret := webhook.Secret
+
+	payload := []byte(`{"event":"updated","data":{"kind":"auth_info"}}`)
+	delivery := models.WebhookDelivery{
+		ID:            uuid.New(),
+		WebhookID:     webhook.ID,
+		EventID:       uuid.New(),
+		Event:         models.WebhookEventUpdated,
+		Payload:       payload,
+		Status:        models.WebhookDeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+	store.deliveries = append(store.deliveries, delivery)
+
+	t.Run("RetryWithBackoff", func(t *testing.T) {
+		delivered, err := service.DeliverPending(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+		failed := store.deliveries[0]
+		assert.Equal(t, models.WebhookDeliveryPending, failed.Status)
+		assert.Equal(t, 1, failed.Attempts)
+		assert.Equal(t, http.StatusInternalServerError, failed.LastStatusCode)
+		assert.WithinDuration(t, time.Now().Add(webhookBaseRetryDelay), failed.NextAttemptAt, time.Second)
+
+		// До следующей попытки доставка не отправляется
+		_, err = service.DeliverPending(ctx)
+		require.NoError(t, err)
+		assert.Len(t, received, 1)
+	})
+
+	t.Run("SignedDelivery", func(t *testing.T) {
+		statusCode = http.StatusNoContent
+		store.makeDue()
+		delivered, err := service.DeliverPending(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, delivered)
+		assert.Equal(t, models.WebhookDeliverySucceeded, store.deliveries[0].Status)
+
+		request := received[len(received)-1]
+		assert.Equal(t, payload, receivedBodies[len(receivedBodies)-1])
+		assert.Equal(t, "updated", request.Header.Get("X-Xandy-Event"))
+		assert.Equal(t, delivery.ID.String(), request.Header.Get("X-Xandy-Delivery"))
+		signature := SignWebhookPayload(secret, request.Header.Get("X-Xandy-Timestamp"), payload)
+		assert.Equal(t, "sha256="+signature, request.Header.Get("X-Xandy-Signature"))
+	})
+
+	t.Run("FailedAfterMaxAttempts", func(t *testing.T) {
+		statusCode = http.StatusBadGateway
+		store.deliveries[0].Status = models.WebhookDeliveryPending
+		store.deliveries[0].Attempts = webhookMaxAttempts - 1
+		store.makeDue()
+		_, err := service.DeliverPending(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, models.WebhookDeliveryFailed, store.deliveries[0].Status)
+		// Тело ответа получателя в журнал не попадает
+		assert.Equal(t, "unexpected status 502", store.deliveries[0].LastError)
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		statusCode = http.StatusOK
+		_, err := service.ReplayDelivery(ctx, uuid.New(), webhook.ID, delivery.ID)
+		_, code := httperror.GetMessageAndStatusCode(err)
+		assert.Equal(t, http.StatusNotFound, code)
+
+		replayed, err := service.ReplayDelivery(ctx, userID, webhook.ID, delivery.ID)
+		require.NoError(t, err)
+		assert.NotEqual(t, delivery.ID, replayed.ID)
+		delivered, err := service.DeliverPending(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, delivered)
+
+		deliveries, err := service.GetDeliveries(ctx, userID, webhook.ID, 0)
+		require.NoError(t, err)
+		assert.Len(t, deliveries, 2)
+	})
+
+	t.Run("InactiveWebhookSkipped", func(t *testing.T) {
+		active := false
+		updated, err := service.UpdateWebhook(ctx, userID, webhook.ID, nil, nil, &active)
+		require.NoError(t, err)
+		assert.False(t, updated.Active)
+		assert.Empty(t, updated.Secret)
+
+		_, err = service.ReplayDelivery(ctx, userID, webhook.ID, delivery.ID)
+		require.NoError(t, err)
+		sent := len(received)
+		_, err = service.DeliverPending(ctx)
+		require.NoError(t, err)
+		assert.Len(t, received, sent)
+	})
+}
+
+func TestWebhookClient(t *testing.T) {
+	var hits int
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer target.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+	defer redirect.Close()
+
+	t.Run("InternalAddressRefused", func(t *testing.T) {
+		client := NewWebhookClient(time.Second)
+		_, err := client.Post(target.URL, "application/json", nil)
+		assert.ErrorIs(t, err, errWebhookAddress)
+		assert.Equal(t, 0, hits)
+	})
+
+	t.Run("RedirectNotFollowed", func(t *testing.T) {
+		// Тестовые серверы слушают loopback, поэтому проверка адреса здесь отключена
+		client := NewWebhookClient(time.Second)
+		client.Transport = http.DefaultTransport
+		response, err := client.Post(redirect.URL, "application/json", nil)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusFound, response.StatusCode)
+		assert.Equal(t, 0, hits)
+	})
+}
+
+func TestCheckWebhookAddress(t *testing.T) {
+	for _, address := range []string{
+		"127.0.0.1:80",
+		"[::1]:443",
+		"10.1.2.3:80",
+		"172.16.0.1:80",
+		"192.168.1.1:80",
+		"169.254.169.254:80",
+		"100.100.100.200:80",
+		"0.0.0.0:80",
+		"[::]:80",
+		"[fd00:ec2::254]:80",
+		"[fe80::1]:80",
+		"[::ffff:127.0.0.1]:80",
+	} {
+		assert.ErrorIs(t, checkWebhookAddress(address), errWebhookAddress, address)
+	}
+	for _, address := range []string{"93.184.216.34:443", "[2606:2800:220:1:248:1893:25c8:1946]:443"} {
+		assert.NoError(t, checkWebhookAddress(address), address)
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	assert.Equal(t, webhookBaseRetryDelay, webhookRetryDelay(1))
+	assert.Equal(t, 4*webhookBaseRetryDelay, webhookRetryDelay(3))
+	assert.Equal(t, webhookMaxRetryDelay, webhookRetryDelay(webhookMaxAttempts))
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/google/uuid"
+)
+
+const auditEventColumns = `id, occurred_at, actor_id, session_id, ip, user_agent, action, owner_id, data_kind, data_id, collection_id, organization_id, details`
+
+func scanAuditEvent(row rowScanner) (models.AuditEvent, error) {
+	var auditEvent models.AuditEvent
+	err := row.Scan(
+		&auditEvent.ID,
+		&auditEvent.OccurredAt,
+		&auditEvent.ActorID,
+		&auditEvent.SessionID,
+		&auditEvent.IP,
+		&auditEvent.UserAgent,
+		&auditEvent.Action,
+		&auditEvent.OwnerID,
+		&auditEvent.DataKind,
+		&auditEvent.DataID,
+		&auditEvent.CollectionID,
+		&auditEvent.OrganizationID,
+		&auditEvent.Details,
+	)
+	return auditEvent, err
+}
+
+// Сколько событий добавляется одним запросом, число параметров запроса ограничено
+const auditEventsBatchSize = 1000
+
+// InsertAuditEvents добавляет события пачками. Организация определяется по коллекции записи
+func (s *xandyStorage) InsertAuditEvents(ctx context.Context, auditEvents []models.AuditEvent) error {
+	for len(auditEvents) > auditEventsBatchSize {
+		if err := s.insertAuditEvents(ctx, auditEvents[:auditEventsBatchSize]); err != nil {
+			return err
+		}
+		auditEvents = auditEvents[auditEventsBatchSize:]
+	}
+	if len(auditEvents) == 0 {
+		return nil
+	}
+	return s.insertAuditEvents(ctx, auditEvents)
+}
+
+func (s *xandyStorage) insertAuditEvents(ctx context.Context, auditEvents []models.AuditEvent) error {
+	values := make([]string, 0, len(auditEvents))
+	args := make([]interface{}, 0, len(auditEvents)*12)
+	for _, e := range auditEvents {
+		n := len(args)
+		values = append(values, fmt.Sprintf(
+			"($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d::uuid, (SELECT organization_id FROM collections WHERE id=$%d::uuid), $%d)",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11, n+11, n+12,
+		))
+		args = append(args, e.ID, e.OccurredAt, e.ActorID, e.SessionID, e.IP, e.UserAgent, e.Action, e.OwnerID, e.DataKind, e.DataID, e.CollectionID, e.Details)
+	}
+	query := `INSERT INTO audit_log (` + auditEventColumns + `) VALUES ` + strings.Join(values, ", ")
+	_, err := s.Exec(ctx, query, args...)
+	return err
+}
+
+func auditFilterConditions(filter models.AuditFilter, args []interface{}) (string, []interface{}) {
+	var query string
+	if filter.Action != "" {
+		args = append(args, filter.Action)
+		query += fmt.Sprintf(" AND action=$%d", len(args))
+	}
+	if filter.DataKind != "" {
+		args = append(args, filter.DataKind)
+		query += fmt.Sprintf(" AND data_kind=$%d", len(args))
+	}
+	if filter.DataID != nil {
+		args = append(args, *filter.DataID)
+		query += fmt.Sprintf(" AND data_id=$%d", len(args))
+	}
+	if filter.ActorID != nil {
+		args = append(args, *filter.ActorID)
+		query += fmt.Sprintf(" AND actor_id=$%d", len(args))
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		query += fmt.Sprintf(" AND occurred_at >= $%d", len(args))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		query += fmt.Sprintf(" AND occurred_at < $%d", len(args))
+	}
+	return query, args
+}
+
+// GetAuditEvents возвращает события, которые выполнил пользователь или которые затронули его записи
+func (s *xandyStorage) GetAuditEvents(ctx context.Context, userID uuid.UUID, filter models.AuditFilter, offset int) ([]models.AuditEvent, error) {
+	query := `SELECT ` + auditEventColumns + ` FROM audit_log WHERE (actor_id=$1 OR owner_id=$1)`
+	conditions, args := auditFilterConditions(filter, []interface{}{userID})
+	args = append(args, offset)
+	query += conditions + fmt.Sprintf(" ORDER BY occurred_at DESC LIMIT 50 OFFSET $%d", len(args))
+	rows, err := s.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	auditEvents := []models.AuditEvent{}
+	for rows.Next() {
+		auditEvent, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		auditEvents = append(auditEvents, auditEvent)
+	}
+	return auditEvents, rows.Err()
+}
+
+// ExportOrganizationAuditEvents передаёт в fn события организации в порядке их появления,
+// не загружая весь журнал в память
+func (s *xandyStorage) ExportOrganizationAuditEvents(ctx context.Context, organizationID uuid.UUID, filter models.AuditFilter, fn func(*models.AuditEvent) error) error {
+	query := `SELECT ` + auditEventColumns + ` FROM audit_log WHERE organization_id=$1`
+	conditions, args := auditFilterConditions(filter, []interface{}{organizationID})
+	query += conditions + " ORDER BY occurred_at"
+	rows, err := s.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		auditEvent, err := scanAuditEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(&auditEvent); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+)
+
+const emergencyAccessColumns = `id, grantor_id, grantor_email, grantee_id, grantee_email, access_type, wait_days, status, requested_at, created_at, updated_at`
+
+func scanEmergencyAccess(row rowScanner) (models.EmergencyAccess, error) {
+	var emergencyAccess models.EmergencyAccess
+	err := row.Scan(
+		&emergencyAccess.ID,
+		&emergencyAccess.GrantorID,
+		&emergencyAccess.GrantorEmail,
+		&emergencyAccess.GranteeID,
+		&emergencyAccess.GranteeEmail,
+		&emergencyAccess.AccessType,
+		&emergencyAccess.WaitDays,
+		&emergencyAccess.Status,
+		&emergencyAccess.RequestedAt,
+		&emergencyAccess.CreatedAt,
+		&emergencyAccess.UpdatedAt,
+	)
+	return emergencyAccess, err
+}
+
+func (s *xandyStorage) InsertEmergencyAccess(ctx context.Context, emergencyAccess *models.EmergencyAccess) error {
+	query := `INSERT INTO emergency_access (` + emergencyAccessColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (grantor_id, grantee_id) DO NOTHING`
+	tag, err := s.Exec(
+		ctx,
+		query,
+		emergencyAccess.ID,
+		emergencyAccess.GrantorID,
+		emergencyAccess.GrantorEmail,
+		emergencyAccess.GranteeID,
+		emergencyAccess.GranteeEmail,
+		emergencyAccess.AccessType,
+		emergencyAccess.WaitDays,
+		emergencyAccess.Status,
+		emergencyAccess.RequestedAt,
+		emergencyAccess.CreatedAt,
+		emergencyAccess.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "This user is already your trusted contact", http.StatusConflict)
+	}
+	return nil
+}
+
+func (s *xandyStorage) GetEmergencyAccess(ctx context.Context, accessID uuid.UUID) (*models.EmergencyAccess, error) {
+	query := `SELECT ` + emergencyAccessColumns + ` FROM emergency_access WHERE id=$1`
+	emergencyAccess, err := scanEmergencyAccess(s.QueryRow(ctx, query, accessID))
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, httperror.New(err, "Emergency access not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &emergencyAccess, nil
+}
+
+// GetGrantorEmergencyAccess возвращает доверенные контакты владельца
+func (s *xandyStorage) GetGrantorEmergencyAccess(ctx context.Context, grantorID uuid.UUID) ([]models.EmergencyAccess, error) {
+	query := `SELECT ` + emergencyAccessColumns + ` FROM emergency_access WHERE grantor_id=$1 ORDER BY created_at`
+	return s.queryEmergencyAccess(ctx, query, grantorID)
+}
+
+// GetGranteeEmergencyAccess возвращает владельцев, назначивших пользователя доверенным контактом
+func (s *xandyStorage) GetGranteeEmergencyAccess(ctx context.Context, granteeID uuid.UUID) ([]models.EmergencyAccess, error) {
+	query := `SELECT ` + emergencyAccessColumns + ` FROM emergency_access WHERE grantee_id=$1 ORDER BY created_at`
+	return s.queryEmergencyAccess(ctx, query, granteeID)
+}
+
+// RequestEmergencyAccess начинает ожидание, если доступ ещё не запрошен
+func (s *xandyStorage) RequestEmergencyAccess(ctx context.Context, accessID uuid.UUID, granteeID uuid.UUID, requestedAt time.Time) error {
+	query := `UPDATE emergency_access SET status=$3, requested_at=$4, updated_at=$4 WHERE id=$1 AND grantee_id=$2 AND status=$5`
+	tag, err := s.Exec(ctx, query, accessID, granteeID, models.EmergencyAccessRequested, requestedAt, models.EmergencyAccessIdle)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "Emergency access is already requested", http.StatusConflict)
+	}
+	return nil
+}
+
+// RejectEmergencyAccess отклоняет запрос, контакт снова может запросить доступ позже
+func (s *xandyStorage) RejectEmergencyAccess(ctx context.Context, accessID uuid.UUID, grantorID uuid.UUID, updatedAt time.Time) error {
+	query := `UPDATE emergency_access SET status=$3, requested_at=NULL, updated_at=$4 WHERE id=$1 AND grantor_id=$2 AND status=$5`
+	tag, err := s.Exec(ctx, query, accessID, grantorID, models.EmergencyAccessIdle, updatedAt, models.EmergencyAccessRequested)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "Emergency access is not requested", http.StatusConflict)
+	}
+	return nil
+}
+
+// DeleteEmergencyAccess удаляет доступ, удалить его может и владелец, и контакт
+func (s *xandyStorage) DeleteEmergencyAccess(ctx context.Context, accessID uuid.UUID, userID uuid.UUID) error {
+	query := `DELETE FROM emergency_access WHERE id=$1 AND (grantor_id=$2 OR grantee_id=$2)`
+	tag, err := s.Exec(ctx, query, accessID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "Emergency access not found", http.StatusNotFound)
+	}
+	return nil
+}
+
+// TakeOverVault переносит личные записи владельца к доверенному контакту одним запросом.
+// Доступ проверяется в том же запросе, поэтому отклонённый в последний момент запрос не сработает.
+// Доступы и ссылки на перенесённые записи выдавал прежний владелец, поэтому они удаляются
+// вместе со всеми экстренными доступами к его записям.
+func (s *xandyStorage) TakeOverVault(ctx context.Context, accessID uuid.UUID, granteeID uuid.UUID, now time.Time) (int, error) {
+	query := `WITH granted AS (
+			SELECT grantor_id FROM emergency_access
+			WHERE id=$1 AND grantee_id=$2 AND access_type=$4 AND status=$5 AND requested_at + make_interval(days => wait_days) <= $3
+		), auth_info AS (
+			UPDATE user_auth_info SET user_id=$2, updated_at=$3 WHERE user_id IN (SELECT grantor_id FROM granted) AND collection_id IS NULL RETURNING id
+		), text_data AS (
+			UPDATE user_text_data SET user_id=$2, updated_at=$3 WHERE user_id IN (SELECT grantor_id FROM granted) AND collection_id IS NULL RETURNING id
+		), bank_cards AS (
+			UPDATE user_bank_card SET user_id=$2, updated_at=$3 WHERE user_id IN (SELECT grantor_id FROM granted) AND collection_id IS NULL RETURNING id
+		), file_data AS (
+			UPDATE user_file_data SET user_id=$2, updated_at=$3 WHERE user_id IN (SELECT grantor_id FROM granted) AND collection_id IS NULL RETURNING id
+		), shares AS (
+			DELETE FROM shares WHERE owner_id IN (SELECT grantor_id FROM granted)
+		), share_links AS (
+			DELETE FROM share_links WHERE owner_id IN (SELECT grantor_id FROM granted)
+		), emergency AS (
+			DELETE FROM emergency_access WHERE grantor_id IN (SELECT grantor_id FROM granted)
+		)
+		SELECT
+			(SELECT COUNT(*) FROM granted),
+			(SELECT COUNT(*) FROM auth_info) + (SELECT COUNT(*) FROM text_data) + (SELECT COUNT(*) FROM bank_cards) + (SELECT COUNT(*) FROM file_data)`
+	var granted, moved int
+	err := s.QueryRow(ctx, query, accessID, granteeID, now, models.EmergencyAccessTakeover, models.EmergencyAccessRequested).Scan(&granted, &moved)
+	if err != nil {
+		return 0, err
+	}
+	if granted == 0 {
+		return 0, httperror.New(nil, "Takeover is not granted", http.StatusForbidden)
+	}
+	return moved, nil
+}
+
+func (s *xandyStorage) queryEmergencyAccess(ctx context.Context, query string, args ...interface{}) ([]models.EmergencyAccess, error) {
+	rows, err := s.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emergencyAccessList []models.EmergencyAccess
+	for rows.Next() {
+		emergencyAccess, err := scanEmergencyAccess(rows)
+		if err != nil {
+			return nil, err
+		}
+		emergencyAccessList = append(emergencyAccessList, emergencyAccess)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return emergencyAccessList, nil
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+)
+
+// notExpired отсекает записи, срок жизни которых истёк к моменту nowParam
+func notExpired(nowParam string) string {
+	return `(expires_at IS NULL OR expires_at > ` + nowParam + `)`
+}
+
+// SetUserDataExpiration задаёт или снимает (expiresAt равен nil) срок жизни записи
+func (s *xandyStorage) SetUserDataExpiration(
+	ctx context.Context,
+	dataKind models.DataKind,
+	dataID uuid.UUID,
+	userID uuid.UUID,
+	expiresAt *time.Time,
+	now time.Time,
+) (*models.BaseUserData, error) {
+	table, ok := recordTables[dataKind]
+	if !ok {
+		return nil, httperror.New(nil, "Unknown data kind", http.StatusBadRequest)
+	}
+	query := `UPDATE ` + table + ` SET expires_at=$3, updated_at=$4 WHERE id=$1 AND ` + writableBy("$2") + ` AND ` + notExpired("$4") + `
+		RETURNING id, user_id, collection_id, name, created_at, updated_at, expires_at`
+	var record models.BaseUserData
+	err := s.QueryRow(ctx, query, dataID, userID, expiresAt, now).Scan(
+		&record.ID,
+		&record.UserID,
+		&record.CollectionID,
+		&record.Name,
+		&record.CreatedAt,
+		&record.UpdatedAt,
+		&record.ExpiresAt,
+	)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, httperror.New(err, "Record not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// GetExpiringUserData возвращает записи всех видов, доступные пользователю, срок жизни которых истекает до until
+func (s *xandyStorage) GetExpiringUserData(ctx context.Context, userID uuid.UUID, now time.Time, until time.Time) ([]models.ExpiringRecord, error) {
+	parts := make([]string, 0, len(recordTables))
+	for _, kind := range []models.DataKind{models.KindAuthInfo, models.KindTextData, models.KindFileData, models.KindBankCard} {
+		parts = append(parts, `SELECT '`+string(kind)+`', id, name, collection_id, expires_at FROM `+recordTables[kind]+
+			` WHERE expires_at > $2 AND expires_at <= $3 AND `+readableBy("$1"))
+	}
+	query := strings.Join(parts, " UNION ALL ") + ` ORDER BY expires_at`
+	rows, err := s.Query(ctx, query, userID, now, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	expiringRecords := []models.ExpiringRecord{}
+	for rows.Next() {
+		var expiringRecord models.ExpiringRecord
+		err := rows.Scan(
+			&expiringRecord.DataKind,
+			&expiringRecord.ID,
+			&expiringRecord.Name,
+			&expiringRecord.CollectionID,
+			&expiringRecord.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		expiringRecords = append(expiringRecords, expiringRecord)
+	}
+	return expiringRecords, rows.Err()
+}
+
+// DeleteExpiredUserData удаляет не больше limit истёкших записей вида dataKind вместе с их вложениями.
+// Возвращает удалённые записи и ключи содержимого удалённых файлов, которые нужно освободить.
+// Записи, которые удаляет параллельный запуск, пропускаются.
+func (s *xandyStorage) DeleteExpiredUserData(ctx context.Context, dataKind models.DataKind, now time.Time, limit int) ([]models.BaseUserData, []string, error) {
+	table, ok := recordTables[dataKind]
+	if !ok {
+		return nil, nil, httperror.New(nil, "Unknown data kind", http.StatusBadRequest)
+	}
+	blobKey := "''"
+	if dataKind == models.KindFileData {
+		blobKey = "blob_key"
+	}
+	query := `WITH expired AS (
+			DELETE FROM ` + table + ` WHERE id IN (
+				SELECT id FROM ` + table + ` WHERE expires_at <= $1 ORDER BY expires_at LIMIT $2 FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, user_id, collection_id, name, ` + blobKey + ` AS blob_key
+		), attachments AS (
+			DELETE FROM user_file_data
+			WHERE parent_id IN (SELECT id FROM expired) AND id NOT IN (SELECT id FROM expired)
+			RETURNING parent_id, blob_key
+		)
+		SELECT e.id, e.user_id, e.collection_id, e.name, e.blob_key,
+			COALESCE((SELECT array_agg(a.blob_key) FROM attachments a WHERE a.parent_id=e.id), '{}')
+		FROM expired e`
+	rows, err := s.Query(ctx, query, now, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var records []models.BaseUserData
+	var blobKeys []string
+	for rows.Next() {
+		var record models.BaseUserData
+		var recordBlobKey string
+		var attachmentBlobKeys []string
+		if err := rows.Scan(&record.ID, &record.UserID, &record.CollectionID, &record.Name, &recordBlobKey, &attachmentBlobKeys); err != nil {
+			return nil, nil, err
+		}
+		records = append(records, record)
+		if recordBlobKey != "" {
+			blobKeys = append(blobKeys, recordBlobKey)
+		}
+		blobKeys = append(blobKeys, attachmentBlobKeys...)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return records, blobKeys, nil
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+)
+
+func (s *xandyStorage) AcquireFileBlob(ctx context.Context, key string) (bool, error) {
+	// xmax = 0 только у строки, которая была вставлена, а не обновлена
+	query := `INSERT INTO file_blobs (key, ref_count) VALUES ($1, 1)
+		ON CONFLICT (key) DO UPDATE SET ref_count = file_blobs.ref_count + 1, updated_at = NOW()
+		RETURNING xmax = 0`
+	var created bool
+	err := s.QueryRow(ctx, query, key).Scan(&created)
+	return created, err
+}
+
+func (s *xandyStorage) ReleaseFileBlob(ctx context.Context, key string) (bool, error) {
+	query := `DELETE FROM file_blobs WHERE key=$1 AND ref_count <= 1`
+	tag, err := s.Exec(ctx, query, key)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() > 0 {
+		return true, nil
+	}
+	query = `UPDATE file_blobs SET ref_count = ref_count - 1, updated_at = NOW() WHERE key=$1`
+	_, err = s.Exec(ctx, query, key)
+	return false, err
+}
+
+func (s *xandyStorage) GetFileBlob(ctx context.Context, key string) (*models.FileBlob, error) {
+	query := `SELECT key, ref_count, created_at, updated_at FROM file_blobs WHERE key=$1`
+	var fileBlob models.FileBlob
+	err := s.QueryRow(ctx, query, key).Scan(&fileBlob.Key, &fileBlob.RefCount, &fileBlob.CreatedAt, &fileBlob.UpdatedAt)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, httperror.New(err, "FileBlob not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &fileBlob, nil
+}
+
+func (s *xandyStorage) ListFileBlobs(ctx context.Context) ([]models.FileBlob, error) {
+	query := `SELECT key, ref_count, created_at, updated_at FROM file_blobs ORDER BY key`
+	rows, err := s.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var fileBlobs []models.FileBlob
+	for rows.Next() {
+		var fileBlob models.FileBlob
+		if err := rows.Scan(&fileBlob.Key, &fileBlob.RefCount, &fileBlob.CreatedAt, &fileBlob.UpdatedAt); err != nil {
+			return nil, err
+		}
+		fileBlobs = append(fileBlobs, fileBlob)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return fileBlobs, nil
+}
+
+// RecountFileBlob пересчитывает ссылки по записям user_file_data.
+// Ссылка, изменённая после unchangedSince, не трогается: её держит загрузка или удаление, которое ещё идёт.
+func (s *xandyStorage) RecountFileBlob(ctx context.Context, key string, unchangedSince time.Time) (bool, error) {
+	var refCount int64
+	err := s.QueryRow(ctx, `SELECT COUNT(*) FROM user_file_data WHERE blob_key=$1`, key).Scan(&refCount)
+	if err != nil {
+		return false, err
+	}
+	if refCount == 0 {
+		tag, err := s.Exec(ctx, `DELETE FROM file_blobs WHERE key=$1 AND updated_at < $2`, key, unchangedSince)
+		if err != nil {
+			return false, err
+		}
+		return tag.RowsAffected() > 0, nil
+	}
+	query := `INSERT INTO file_blobs (key, ref_count) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET ref_count = $2, updated_at = NOW() WHERE file_blobs.updated_at < $3`
+	tag, err := s.Exec(ctx, query, key, refCount, unchangedSince)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+)
+
+func (s *xandyStorage) InsertFileUpload(ctx context.Context, fileUpload *models.FileUpload) error {
+	query := `INSERT INTO file_uploads (id, user_id, file_name, size, upload_offset, checksum, staging_path, created_at, updated_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err := s.Exec(
+		ctx,
+		query,
+		fileUpload.ID,
+		fileUpload.UserID,
+		fileUpload.FileName,
+		fileUpload.Size,
+		fileUpload.Offset,
+		fileUpload.Checksum,
+		fileUpload.StagingPath,
+		fileUpload.CreatedAt,
+		fileUpload.UpdatedAt,
+		fileUpload.ExpiresAt,
+	)
+	return err
+}
+
+func (s *xandyStorage) UpdateFileUpload(ctx context.Context, fileUpload *models.FileUpload) error {
+	query := `UPDATE file_uploads SET upload_offset=$3, updated_at=$4, expires_at=$5 WHERE id=$1 AND user_id=$2`
+	_, err := s.Exec(ctx, query, fileUpload.ID, fileUpload.UserID, fileUpload.Offset, fileUpload.UpdatedAt, fileUpload.ExpiresAt)
+	return err
+}
+
+func (s *xandyStorage) GetFileUpload(ctx context.Context, uploadID uuid.UUID, userID uuid.UUID) (*models.FileUpload, error) {
+	query := `SELECT file_name, size, upload_offset, checksum, staging_path, created_at, updated_at, expires_at FROM file_uploads WHERE id=$1 AND user_id=$2`
+	row := s.QueryRow(ctx, query, uploadID, userID)
+	fileUpload := models.FileUpload{ID: uploadID, UserID: userID}
+	err := row.Scan(
+		&fileUpload.FileName,
+		&fileUpload.Size,
+		&fileUpload.Offset,
+		&fileUpload.Checksum,
+		&fileUpload.StagingPath,
+		&fileUpload.CreatedAt,
+		&fileUpload.UpdatedAt,
+		&fileUpload.ExpiresAt,
+	)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, httperror.New(err, "FileUpload not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &fileUpload, nil
+}
+
+func (s *xandyStorage) DeleteFileUpload(ctx context.Context, uploadID uuid.UUID, userID uuid.UUID) error {
+	query := `DELETE FROM file_uploads WHERE id=$1 AND user_id=$2`
+	_, err := s.Exec(ctx, query, uploadID, userID)
+	return err
+}
+
+// GetExpiredFileUploads возвращает загрузки, истёкшие к моменту now
+func (s *xandyStorage) GetExpiredFileUploads(ctx context.Context, now time.Time) ([]models.FileUpload, error) {
+	query := `SELECT id, user_id, file_name, size, upload_offset, checksum, staging_path, created_at, updated_at, expires_at FROM file_uploads WHERE expires_at<=$1`
+
+	rows, err := s.Query(ctx, query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fileUploads []models.FileUpload
+	for rows.Next() {
+		var fileUpload models.FileUpload
+		err := rows.Scan(
+			&fileUpload.ID,
+			&fileUpload.UserID,
+			&fileUpload.FileName,
+			&fileUpload.Size,
+			&fileUpload.Offset,
+			&fileUpload.Checksum,
+			&fileUpload.StagingPath,
+			&fileUpload.CreatedAt,
+			&fileUpload.UpdatedAt,
+			&fileUpload.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		fileUploads = append(fileUploads, fileUpload)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return fileUploads, nil
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+)
+
+// ClaimIdempotencyKey занимает ключ для первого запроса. Ключ с истёкшим сроком занимается заново.
+// Если ключ уже занят, возвращает false и сохранённую запись ключа
+func (s *xandyStorage) ClaimIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) (bool, *models.IdempotencyKey, error) {
+	query := `INSERT INTO idempotency_keys (user_id, idempotency_key, request_hash, status_code, content_type, body, created_at, expires_at)
+		VALUES ($1, $2, $3, 0, '', NULL, $4, $5)
+		ON CONFLICT (user_id, idempotency_key) DO UPDATE SET request_hash=EXCLUDED.request_hash, status_code=0, content_type='', body=NULL,
+			created_at=EXCLUDED.created_at, expires_at=EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= EXCLUDED.created_at
+		RETURNING user_id`
+	var userID uuid.UUID
+	err := s.QueryRow(ctx, query, key.UserID, key.Key, key.RequestHash, key.CreatedAt, key.ExpiresAt).Scan(&userID)
+	if err == nil {
+		return true, nil, nil
+	}
+	if err.Error() != "no rows in result set" {
+		return false, nil, err
+	}
+	existing, err := s.GetIdempotencyKey(ctx, key.UserID, key.Key)
+	if err != nil {
+		return false, nil, err
+	}
+	return false, existing, nil
+}
+
+func (s *xandyStorage) GetIdempotencyKey(ctx context.Context, userID uuid.UUID, key string) (*models.IdempotencyKey, error) {
+	query := `SELECT request_hash, status_code, content_type, body, created_at, expires_at
+		FROM idempotency_keys WHERE user_id=$1 AND idempotency_key=$2`
+	idempotencyKey := models.IdempotencyKey{UserID: userID, Key: key}
+	err := s.QueryRow(ctx, query, userID, key).Scan(
+		&idempotencyKey.RequestHash,
+		&idempotencyKey.StatusCode,
+		&idempotencyKey.ContentType,
+		&idempotencyKey.Body,
+		&idempotencyKey.CreatedAt,
+		&idempotencyKey.ExpiresAt,
+	)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, httperror.New(err, "Idempotency key not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &idempotencyKey, nil
+}
+
+// CompleteIdempotencyKey сохраняет ответ на первый запрос с ключом
+func (s *xandyStorage) CompleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	query := `UPDATE idempotency_keys SET status_code=$3, content_type=$4, body=$5
+		WHERE user_id=$1 AND idempotency_key=$2 AND request_hash=$6`
+	_, err := s.Exec(ctx, query, key.UserID, key.Key, key.StatusCode, key.ContentType, key.Body, key.RequestHash)
+	return err
+}
+
+// ReleaseIdempotencyKey освобождает ключ, занятый запросом с хэшем requestHash, чтобы запрос можно было повторить
+func (s *xandyStorage) ReleaseIdempotencyKey(ctx context.Context, userID uuid.UUID, key string, requestHash string) error {
+	query := `DELETE FROM idempotency_keys WHERE user_id=$1 AND idempotency_key=$2 AND request_hash=$3 AND status_code=0`
+	_, err := s.Exec(ctx, query, userID, key, requestHash)
+	return err
+}
+
+func (s *xandyStorage) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int, error) {
+	query := `DELETE FROM idempotency_keys WHERE expires_at <= $1`
+	tag, err := s.Exec(ctx, query, now)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
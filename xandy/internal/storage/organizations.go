@@ -0,0 +1,402 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+)
+
+// Условия доступа к записям для запросов к таблицам записей, userParam - номер параметра с пользователем.
+// Личная запись доступна только её владельцу, запись коллекции - участникам организации через collection_access.
+// Членство проверяется в каждом запросе, поэтому исключённый участник сразу теряет доступ.
+func readableBy(userParam string) string {
+	return `(collection_id IS NULL AND user_id=` + userParam + ` OR collection_id IN (SELECT collection_id FROM collection_access WHERE user_id=` + userParam + `))`
+}
+
+func writableBy(userParam string) string {
+	return `(collection_id IS NULL AND user_id=` + userParam + ` OR collection_id IN (SELECT collection_id FROM collection_access WHERE user_id=` + userParam + ` AND can_write))`
+}
+
+var recordTables = map[models.DataKind]string{
+	models.KindAuthInfo: "user_auth_info",
+	models.KindTextData: "user_text_data",
+	models.KindFileData: "user_file_data",
+	models.KindBankCard: "user_bank_card",
+}
+
+// LockUserData блокирует строку записи до конца транзакции, чтобы изменение на основе
+// прочитанных значений не потеряло параллельное изменение той же записи
+func (s *xandyStorage) LockUserData(ctx context.Context, dataKind models.DataKind, dataID uuid.UUID) error {
+	table, ok := recordTables[dataKind]
+	if !ok {
+		return httperror.New(nil, "Unknown data kind", http.StatusBadRequest)
+	}
+	_, err := s.Exec(ctx, `SELECT id FROM `+table+` WHERE id=$1 FOR UPDATE`, dataID)
+	return err
+}
+
+// InsertOrganization создаёт организацию вместе с её первым владельцем
+func (s *xandyStorage) InsertOrganization(ctx context.Context, organization *models.Organization, owner *models.OrganizationMember) error {
+	query := `WITH organization AS (
+			INSERT INTO organizations (id, name, created_at, updated_at) VALUES ($1, $2, $3, $4)
+		)
+		INSERT INTO organization_members (organization_id, user_id, email, role, created_at, updated_at) VALUES ($1, $5, $6, $7, $3, $4)`
+	_, err := s.Exec(ctx, query, organization.ID, organization.Name, organization.CreatedAt, organization.UpdatedAt, owner.UserID, owner.Email, owner.Role)
+	return err
+}
+
+// GetOrganization возвращает организацию с ролью пользователя, если он её участник
+func (s *xandyStorage) GetOrganization(ctx context.Context, organizationID uuid.UUID, userID uuid.UUID) (*models.Organization, error) {
+	query := `SELECT o.id, o.name, o.created_at, o.updated_at, m.role FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id AND m.user_id=$2
+		WHERE o.id=$1`
+	var organization models.Organization
+	err := s.QueryRow(ctx, query, organizationID, userID).Scan(
+		&organization.ID,
+		&organization.Name,
+		&organization.CreatedAt,
+		&organization.UpdatedAt,
+		&organization.Role,
+	)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, httperror.New(err, "Organization not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &organization, nil
+}
+
+func (s *xandyStorage) GetUserOrganizations(ctx context.Context, userID uuid.UUID) ([]models.Organization, error) {
+	query := `SELECT o.id, o.name, o.created_at, o.updated_at, m.role FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id AND m.user_id=$1
+		ORDER BY o.created_at`
+	rows, err := s.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var organizations []models.Organization
+	for rows.Next() {
+		var organization models.Organization
+		err := rows.Scan(
+			&organization.ID,
+			&organization.Name,
+			&organization.CreatedAt,
+			&organization.UpdatedAt,
+			&organization.Role,
+		)
+		if err != nil {
+			return nil, err
+		}
+		organizations = append(organizations, organization)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return organizations, nil
+}
+
+func (s *xandyStorage) UpdateOrganization(ctx context.Context, organization *models.Organization) error {
+	query := `UPDATE organizations SET name=$2, updated_at=$3 WHERE id=$1`
+	_, err := s.Exec(ctx, query, organization.ID, organization.Name, organization.UpdatedAt)
+	return err
+}
+
+// DeleteOrganization удаляет организацию вместе с участниками, если в ней не осталось коллекций
+func (s *xandyStorage) DeleteOrganization(ctx context.Context, organizationID uuid.UUID) error {
+	query := `DELETE FROM organizations WHERE id=$1 AND NOT EXISTS (SELECT 1 FROM collections WHERE organization_id=$1)`
+	tag, err := s.Exec(ctx, query, organizationID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "Delete collections of the organization first", http.StatusConflict)
+	}
+	return nil
+}
+
+const organizationMemberColumns = `organization_id, user_id, email, role, created_at, updated_at`
+
+func scanOrganizationMember(row rowScanner) (models.OrganizationMember, error) {
+	var member models.OrganizationMember
+	err := row.Scan(
+		&member.OrganizationID,
+		&member.UserID,
+		&member.Email,
+		&member.Role,
+		&member.CreatedAt,
+		&member.UpdatedAt,
+	)
+	return member, err
+}
+
+func (s *xandyStorage) InsertOrganizationMember(ctx context.Context, member *models.OrganizationMember) error {
+	query := `INSERT INTO organization_members (` + organizationMemberColumns + `) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING`
+	tag, err := s.Exec(ctx, query, member.OrganizationID, member.UserID, member.Email, member.Role, member.CreatedAt, member.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "User is already a member of the organization", http.StatusConflict)
+	}
+	return nil
+}
+
+func (s *xandyStorage) GetOrganizationMember(ctx context.Context, organizationID uuid.UUID, userID uuid.UUID) (*models.OrganizationMember, error) {
+	query := `SELECT ` + organizationMemberColumns + ` FROM organization_members WHERE organization_id=$1 AND user_id=$2`
+	member, err := scanOrganizationMember(s.QueryRow(ctx, query, organizationID, userID))
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, httperror.New(err, "Member not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (s *xandyStorage) GetOrganizationMembers(ctx context.Context, organizationID uuid.UUID) ([]models.OrganizationMember, error) {
+	query := `SELECT ` + organizationMemberColumns + ` FROM organization_members WHERE organization_id=$1 ORDER BY created_at`
+	rows, err := s.Query(ctx, query, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []models.OrganizationMember
+	for rows.Next() {
+		member, err := scanOrganizationMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// Участник-владелец меняется, только если в организации останется другой владелец
+const keepOwnerCondition = `(role <> 'owner' OR EXISTS (SELECT 1 FROM organization_members o WHERE o.organization_id=$1 AND o.role='owner' AND o.user_id <> $2))`
+
+func (s *xandyStorage) UpdateOrganizationMember(ctx context.Context, member *models.OrganizationMember) error {
+	query := `UPDATE organization_members SET role=$3, updated_at=$4 WHERE organization_id=$1 AND user_id=$2 AND (role=$3 OR ` + keepOwnerCondition + `)`
+	tag, err := s.Exec(ctx, query, member.OrganizationID, member.UserID, member.Role, member.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "Organization must have at least one owner", http.StatusConflict)
+	}
+	return nil
+}
+
+// DeleteOrganizationMember исключает участника, его доступы к коллекциям удаляются вместе с ним
+func (s *xandyStorage) DeleteOrganizationMember(ctx context.Context, organizationID uuid.UUID, userID uuid.UUID) error {
+	query := `DELETE FROM organization_members WHERE organization_id=$1 AND user_id=$2 AND ` + keepOwnerCondition
+	tag, err := s.Exec(ctx, query, organizationID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "Organization must have at least one owner", http.StatusConflict)
+	}
+	return nil
+}
+
+const collectionColumns = `id, organization_id, name, created_at, updated_at`
+
+func scanCollection(row rowScanner) (models.Collection, error) {
+	var collection models.Collection
+	err := row.Scan(
+		&collection.ID,
+		&collection.OrganizationID,
+		&collection.Name,
+		&collection.CreatedAt,
+		&collection.UpdatedAt,
+	)
+	return collection, err
+}
+
+func (s *xandyStorage) InsertCollection(ctx context.Context, collection *models.Collection) error {
+	query := `INSERT INTO collections (` + collectionColumns + `) VALUES ($1, $2, $3, $4, $5)`
+	_, err := s.Exec(ctx, query, collection.ID, collection.OrganizationID, collection.Name, collection.CreatedAt, collection.UpdatedAt)
+	return err
+}
+
+func (s *xandyStorage) GetCollection(ctx context.Context, organizationID uuid.UUID, collectionID uuid.UUID) (*models.Collection, error) {
+	query := `SELECT ` + collectionColumns + ` FROM collections WHERE id=$2 AND organization_id=$1`
+	collection, err := scanCollection(s.QueryRow(ctx, query, organizationID, collectionID))
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, httperror.New(err, "Collection not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &collection, nil
+}
+
+// GetUserCollections возвращает коллекции организации, доступные пользователю
+func (s *xandyStorage) GetUserCollections(ctx context.Context, organizationID uuid.UUID, userID uuid.UUID) ([]models.Collection, error) {
+	query := `SELECT ` + collectionColumns + ` FROM collections WHERE organization_id=$1
+		AND id IN (SELECT collection_id FROM collection_access WHERE user_id=$2)
+		ORDER BY created_at`
+	rows, err := s.Query(ctx, query, organizationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []models.Collection
+	for rows.Next() {
+		collection, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return collections, nil
+}
+
+func (s *xandyStorage) UpdateCollection(ctx context.Context, collection *models.Collection) error {
+	query := `UPDATE collections SET name=$2, updated_at=$3 WHERE id=$1`
+	_, err := s.Exec(ctx, query, collection.ID, collection.Name, collection.UpdatedAt)
+	return err
+}
+
+// DeleteCollection удаляет коллекцию вместе с доступами к ней, если в ней не осталось записей
+func (s *xandyStorage) DeleteCollection(ctx context.Context, collectionID uuid.UUID) error {
+	query := `DELETE FROM collections WHERE id=$1
+		AND NOT EXISTS (SELECT 1 FROM user_auth_info WHERE collection_id=$1)
+		AND NOT EXISTS (SELECT 1 FROM user_text_data WHERE collection_id=$1)
+		AND NOT EXISTS (SELECT 1 FROM user_file_data WHERE collection_id=$1)
+		AND NOT EXISTS (SELECT 1 FROM user_bank_card WHERE collection_id=$1)`
+	tag, err := s.Exec(ctx, query, collectionID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "Collection is not empty", http.StatusConflict)
+	}
+	return nil
+}
+
+// GetCollectionAccess возвращает, может ли пользователь менять записи коллекции.
+// Если коллекция пользователю недоступна, возвращается ошибка 404
+func (s *xandyStorage) GetCollectionAccess(ctx context.Context, collectionID uuid.UUID, userID uuid.UUID) (bool, error) {
+	query := `SELECT COUNT(*), COALESCE(BOOL_OR(can_write), FALSE) FROM collection_access WHERE collection_id=$1 AND user_id=$2`
+	var count int
+	var canWrite bool
+	if err := s.QueryRow(ctx, query, collectionID, userID).Scan(&count, &canWrite); err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return false, httperror.New(nil, "Collection not found", http.StatusNotFound)
+	}
+	return canWrite, nil
+}
+
+// MoveRecordToCollection переносит запись вместе с вложениями в коллекцию.
+// Пользователь должен иметь право менять запись и коллекцию, а запись коллекции
+// переносится только в пределах своей организации. Личные доступы и ссылки на запись удаляются.
+func (s *xandyStorage) MoveRecordToCollection(ctx context.Context, dataKind models.DataKind, dataID uuid.UUID, userID uuid.UUID, collectionID uuid.UUID, updatedAt time.Time) error {
+	table, ok := recordTables[dataKind]
+	if !ok {
+		return httperror.New(nil, "Unknown data kind", http.StatusBadRequest)
+	}
+	query := `WITH moved AS (
+			UPDATE ` + table + ` SET collection_id=$3, updated_at=$4 WHERE id=$1 AND ` + writableBy("$2") + `
+				AND $3 IN (SELECT collection_id FROM collection_access WHERE user_id=$2 AND can_write)
+				AND (collection_id IS NULL OR collection_id IN (
+					SELECT id FROM collections WHERE organization_id = (SELECT organization_id FROM collections WHERE id=$3)
+				))
+			RETURNING id
+		), attachments AS (
+			UPDATE user_file_data SET collection_id=$3 WHERE parent_id IN (SELECT id FROM moved)
+		), shares AS (
+			DELETE FROM shares WHERE data_id IN (SELECT id FROM moved)
+		), share_links AS (
+			DELETE FROM share_links WHERE data_id IN (SELECT id FROM moved)
+		)
+		SELECT COUNT(*) FROM moved`
+	var moved int
+	if err := s.QueryRow(ctx, query, dataID, userID, collectionID, updatedAt).Scan(&moved); err != nil {
+		return err
+	}
+	if moved == 0 {
+		return httperror.New(nil, "Record can not be moved to this collection", http.StatusForbidden)
+	}
+	return nil
+}
+
+const collectionGrantColumns = `g.collection_id, g.organization_id, g.user_id, m.email, g.permission, g.created_at, g.updated_at`
+
+func (s *xandyStorage) UpsertCollectionGrant(ctx context.Context, grant *models.CollectionGrant) error {
+	query := `INSERT INTO collection_grants (collection_id, organization_id, user_id, permission, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (collection_id, user_id) DO UPDATE SET permission=EXCLUDED.permission, updated_at=EXCLUDED.updated_at
+		RETURNING created_at`
+	return s.QueryRow(
+		ctx,
+		query,
+		grant.CollectionID,
+		grant.OrganizationID,
+		grant.UserID,
+		grant.Permission,
+		grant.CreatedAt,
+		grant.UpdatedAt,
+	).Scan(&grant.CreatedAt)
+}
+
+func (s *xandyStorage) GetCollectionGrants(ctx context.Context, collectionID uuid.UUID) ([]models.CollectionGrant, error) {
+	query := `SELECT ` + collectionGrantColumns + ` FROM collection_grants g
+		JOIN organization_members m ON m.organization_id = g.organization_id AND m.user_id = g.user_id
+		WHERE g.collection_id=$1 ORDER BY g.created_at`
+	rows, err := s.Query(ctx, query, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grants []models.CollectionGrant
+	for rows.Next() {
+		var grant models.CollectionGrant
+		err := rows.Scan(
+			&grant.CollectionID,
+			&grant.OrganizationID,
+			&grant.UserID,
+			&grant.Email,
+			&grant.Permission,
+			&grant.CreatedAt,
+			&grant.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+func (s *xandyStorage) DeleteCollectionGrant(ctx context.Context, collectionID uuid.UUID, userID uuid.UUID) error {
+	query := `DELETE FROM collection_grants WHERE collection_id=$1 AND user_id=$2`
+	tag, err := s.Exec(ctx, query, collectionID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "Grant not found", http.StatusNotFound)
+	}
+	return nil
+}
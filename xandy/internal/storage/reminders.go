@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/google/uuid"
+)
+
+// GetReminderPreferences возвращает настройки напоминаний, у пользователя без настроек включены все напоминания
+func (s *xandyStorage) GetReminderPreferences(ctx context.Context, userID uuid.UUID) (*models.ReminderPreferences, error) {
+	query := `SELECT card_expiry, credential_rotation, updated_at FROM reminder_preferences WHERE user_id=$1`
+	preferences := models.NewReminderPreferences(userID)
+	err := s.QueryRow(ctx, query, userID).Scan(
+		&preferences.CardExpiry,
+		&preferences.CredentialRotation,
+		&preferences.UpdatedAt,
+	)
+	if err != nil && err.Error() != "no rows in result set" {
+		return nil, err
+	}
+	return &preferences, nil
+}
+
+func (s *xandyStorage) UpsertReminderPreferences(ctx context.Context, preferences *models.ReminderPreferences) error {
+	query := `INSERT INTO reminder_preferences (user_id, card_expiry, credential_rotation, updated_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE SET card_expiry=EXCLUDED.card_expiry, credential_rotation=EXCLUDED.credential_rotation, updated_at=EXCLUDED.updated_at`
+	_, err := s.Exec(
+		ctx,
+		query,
+		preferences.UserID,
+		preferences.CardExpiry,
+		preferences.CredentialRotation,
+		preferences.UpdatedAt,
+	)
+	return err
+}
+
+// GetDueReminders возвращает ещё не отправленные напоминания: карты, срок действия которых истекает
+// в месяце cardMonth, и учётные записи, пароль которых нужно было сменить к моменту now.
+// Срок действия карты понимается в форматах MM/YY и MM/YYYY, карты с другим форматом пропускаются.
+// Напоминания приходят только по личным записям: записью коллекции владеет организация,
+// и её автор мог уже потерять к ней доступ.
+// Напоминания отсортированы по пользователю.
+func (s *xandyStorage) GetDueReminders(ctx context.Context, cardMonth time.Time, now time.Time) ([]models.Reminder, error) {
+	query := `
+		SELECT $3, c.user_id, c.id, c.name, due.due_at
+		FROM user_bank_card c
+		CROSS JOIN LATERAL (SELECT CASE
+			WHEN c.expire_date ~ '^(0[1-9]|1[0-2])/[0-9]{2}$' THEN to_date(c.expire_date, 'MM/YY')::timestamp
+			WHEN c.expire_date ~ '^(0[1-9]|1[0-2])/[0-9]{4}$' THEN to_date(c.expire_date, 'MM/YYYY')::timestamp
+		END AS due_at) due
+		LEFT JOIN reminder_preferences p ON p.user_id = c.user_id
+		WHERE c.collection_id IS NULL AND due.due_at = $1::date AND COALESCE(p.card_expiry, TRUE) AND ` + notExpired("$2") + `
+			AND NOT EXISTS (SELECT 1 FROM reminders_sent r WHERE r.kind = $3 AND r.data_id = c.id AND r.due_at = due.due_at)
+		UNION ALL
+		SELECT $4, a.user_id, a.id, a.name, due.due_at
+		FROM user_auth_info a
+		CROSS JOIN LATERAL (SELECT CASE
+			WHEN a.metadata->>'` + models.RotationDaysMetadataKey + `' ~ '^[1-9][0-9]{0,4}$'
+			THEN a.password_changed_at + make_interval(days => (a.metadata->>'` + models.RotationDaysMetadataKey + `')::int)
+		END AS due_at) due
+		LEFT JOIN reminder_preferences p ON p.user_id = a.user_id
+		WHERE a.collection_id IS NULL AND due.due_at <= $2 AND COALESCE(p.credential_rotation, TRUE) AND ` + notExpired("$2") + `
+			AND NOT EXISTS (SELECT 1 FROM reminders_sent r WHERE r.kind = $4 AND r.data_id = a.id AND r.due_at = due.due_at)
+		ORDER BY 2, 1, 5`
+	rows, err := s.Query(ctx, query, cardMonth, now, models.ReminderCardExpiry, models.ReminderCredentialRotation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []models.Reminder
+	for rows.Next() {
+		var reminder models.Reminder
+		err := rows.Scan(
+			&reminder.Kind,
+			&reminder.UserID,
+			&reminder.DataID,
+			&reminder.Name,
+			&reminder.DueAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, reminder)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return reminders, nil
+}
+
+// ClaimReminders отмечает напоминания отправленными и возвращает те из них, которые ещё никто не отметил.
+// Так каждое напоминание уходит один раз, даже если рассылку запустили несколько экземпляров сервиса.
+func (s *xandyStorage) ClaimReminders(ctx context.Context, reminders []models.Reminder, sentAt time.Time) ([]models.Reminder, error) {
+	query := `INSERT INTO reminders_sent (kind, data_id, due_at, user_id, sent_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING`
+	var claimed []models.Reminder
+	for _, reminder := range reminders {
+		tag, err := s.Exec(ctx, query, reminder.Kind, reminder.DataID, reminder.DueAt, reminder.UserID, sentAt)
+		if err != nil {
+			return claimed, err
+		}
+		if tag.RowsAffected() > 0 {
+			claimed = append(claimed, reminder)
+		}
+	}
+	return claimed, nil
+}
+
+// UnclaimReminders снимает отметку с напоминаний, письмо с которыми не удалось отправить
+func (s *xandyStorage) UnclaimReminders(ctx context.Context, reminders []models.Reminder) error {
+	query := `DELETE FROM reminders_sent WHERE kind=$1 AND data_id=$2 AND due_at=$3`
+	for _, reminder := range reminders {
+		if _, err := s.Exec(ctx, query, reminder.Kind, reminder.DataID, reminder.DueAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
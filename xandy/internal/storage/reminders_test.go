@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDueRemindersSkipsCollectionRecords(t *testing.T) {
+	storage := newTestStorage(t)
+	ctx := context.Background()
+	ownerID, memberID := uuid.New(), uuid.New()
+	cardMonth := time.Date(2031, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+	organization, err := models.NewOrganization("team")
+	require.NoError(t, err)
+	owner, err := models.NewOrganizationMember(organization.ID, ownerID, "owner@example.com", models.OrganizationRoleOwner)
+	require.NoError(t, err)
+	require.NoError(t, storage.InsertOrganization(ctx, &organization, &owner))
+	member, err := models.NewOrganizationMember(organization.ID, memberID, "member@example.com", models.OrganizationRoleMember)
+	require.NoError(t, err)
+	require.NoError(t, storage.InsertOrganizationMember(ctx, &member))
+	collection, err := models.NewCollection(organization.ID, "shared cards")
+	require.NoError(t, err)
+	require.NoError(t, storage.InsertCollection(ctx, &collection))
+
+	personalCard, err := models.NewUserBankCard("personal", memberID, models.Metadata{}, "4111111111111111", "MEMBER", "05/31", "123")
+	require.NoError(t, err)
+	require.NoError(t, storage.InsertUserBankCard(ctx, &personalCard))
+	collectionCard, err := models.NewUserBankCard("corporate", memberID, models.Metadata{}, "5555555555554444", "TEAM", "05/31", "456")
+	require.NoError(t, err)
+	collectionCard.CollectionID = &collection.ID
+	require.NoError(t, storage.InsertUserBankCard(ctx, &collectionCard))
+
+	// Исключённый участник остаётся автором записи коллекции, но напоминание о ней не получает
+	require.NoError(t, storage.DeleteOrganizationMember(ctx, organization.ID, memberID))
+
+	reminders, err := storage.GetDueReminders(ctx, cardMonth, cardMonth)
+	require.NoError(t, err)
+	var dataIDs []uuid.UUID
+	for _, reminder := range reminders {
+		if reminder.UserID == memberID {
+			dataIDs = append(dataIDs, reminder.DataID)
+		}
+	}
+	assert.Equal(t, []uuid.UUID{personalCard.ID}, dataIDs)
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+)
+
+const shareLinkColumns = `id, owner_id, data_kind, data_id, content, passphrase_hash, max_views, views, expires_at, created_at`
+
+func scanShareLink(row rowScanner) (models.ShareLink, error) {
+	var shareLink models.ShareLink
+	err := row.Scan(
+		&shareLink.ID,
+		&shareLink.OwnerID,
+		&shareLink.DataKind,
+		&shareLink.DataID,
+		&shareLink.Content,
+		&shareLink.PassphraseHash,
+		&shareLink.MaxViews,
+		&shareLink.Views,
+		&shareLink.ExpiresAt,
+		&shareLink.CreatedAt,
+	)
+	return shareLink, err
+}
+
+func (s *xandyStorage) InsertShareLink(ctx context.Context, shareLink *models.ShareLink) error {
+	query := `INSERT INTO share_links (` + shareLinkColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err := s.Exec(
+		ctx,
+		query,
+		shareLink.ID,
+		shareLink.OwnerID,
+		shareLink.DataKind,
+		shareLink.DataID,
+		shareLink.Content,
+		shareLink.PassphraseHash,
+		shareLink.MaxViews,
+		shareLink.Views,
+		shareLink.ExpiresAt,
+		shareLink.CreatedAt,
+	)
+	return err
+}
+
+// GetActiveShareLink возвращает ссылку, если она не истекла и просмотры не закончились
+func (s *xandyStorage) GetActiveShareLink(ctx context.Context, linkID uuid.UUID, now time.Time) (*models.ShareLink, error) {
+	query := `SELECT ` + shareLinkColumns + ` FROM share_links WHERE id=$1 AND views<max_views AND expires_at>$2`
+	shareLink, err := scanShareLink(s.QueryRow(ctx, query, linkID, now))
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, httperror.New(err, "Link not found or expired", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &shareLink, nil
+}
+
+// CountShareLinkAttempt засчитывает попытку ввода фразы-пароля до её проверки и возвращает её номер.
+// Попытка засчитывается одним запросом, поэтому одновременные попытки не превышают maxAttempts.
+func (s *xandyStorage) CountShareLinkAttempt(ctx context.Context, linkID uuid.UUID, now time.Time, maxAttempts int) (int, error) {
+	query := `UPDATE share_links SET passphrase_attempts=passphrase_attempts+1
+		WHERE id=$1 AND views<max_views AND expires_at>$2 AND passphrase_attempts<$3
+		RETURNING passphrase_attempts`
+	var attempt int
+	err := s.QueryRow(ctx, query, linkID, now, maxAttempts).Scan(&attempt)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return 0, httperror.New(err, "Link not found or expired", http.StatusNotFound)
+		}
+		return 0, err
+	}
+	return attempt, nil
+}
+
+// BurnShareLink стирает содержимое ссылки и исчерпывает её просмотры
+func (s *xandyStorage) BurnShareLink(ctx context.Context, linkID uuid.UUID) error {
+	query := `UPDATE share_links SET views=max_views, content=''::bytea WHERE id=$1`
+	_, err := s.Exec(ctx, query, linkID)
+	return err
+}
+
+// ViewShareLink засчитывает просмотр и возвращает ссылку с содержимым.
+// Просмотр засчитывается одним запросом, поэтому одновременные открытия не превышают лимит,
+// а после последнего просмотра содержимое стирается. Счётчик попыток ввода фразы-пароля обнуляется.
+func (s *xandyStorage) ViewShareLink(ctx context.Context, linkID uuid.UUID, now time.Time) (*models.ShareLink, error) {
+	query := `UPDATE share_links l SET views=l.views+1, passphrase_attempts=0, content=CASE WHEN l.views+1>=l.max_views THEN ''::bytea ELSE l.content END
+		FROM (SELECT id, content FROM share_links WHERE id=$1 FOR UPDATE) old
+		WHERE l.id=old.id AND l.views<l.max_views AND l.expires_at>$2
+		RETURNING l.id, l.owner_id, l.data_kind, l.data_id, old.content, l.passphrase_hash, l.max_views, l.views, l.expires_at, l.created_at`
+	shareLink, err := scanShareLink(s.QueryRow(ctx, query, linkID, now))
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, httperror.New(err, "Link not found or expired", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &shareLink, nil
+}
+
+// GetDataShareLinks возвращает действующие ссылки владельца на запись без содержимого
+func (s *xandyStorage) GetDataShareLinks(ctx context.Context, ownerID uuid.UUID, dataID uuid.UUID, now time.Time) ([]models.ShareLink, error) {
+	query := `SELECT id, owner_id, data_kind, data_id, ''::bytea, passphrase_hash, max_views, views, expires_at, created_at FROM share_links
+		WHERE owner_id=$1 AND data_id=$2 AND views<max_views AND expires_at>$3 ORDER BY created_at`
+	rows, err := s.Query(ctx, query, ownerID, dataID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shareLinks []models.ShareLink
+	for rows.Next() {
+		shareLink, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		shareLinks = append(shareLinks, shareLink)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return shareLinks, nil
+}
+
+func (s *xandyStorage) DeleteShareLink(ctx context.Context, linkID uuid.UUID, ownerID uuid.UUID) error {
+	query := `DELETE FROM share_links WHERE id=$1 AND owner_id=$2`
+	tag, err := s.Exec(ctx, query, linkID, ownerID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "Link not found", http.StatusNotFound)
+	}
+	return nil
+}
+
+// DeleteInactiveShareLinks удаляет истёкшие и использованные ссылки
+func (s *xandyStorage) DeleteInactiveShareLinks(ctx context.Context, now time.Time) (int, error) {
+	query := `DELETE FROM share_links WHERE expires_at<=$1 OR views>=max_views`
+	tag, err := s.Exec(ctx, query, now)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
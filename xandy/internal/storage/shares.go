@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+)
+
+const shareColumns = `id, owner_id, owner_email, grantee_id, grantee_email, data_kind, data_id, permission, encrypted_key, created_at, updated_at`
+
+func scanShare(row rowScanner) (models.Share, error) {
+	var share models.Share
+	err := row.Scan(
+		&share.ID,
+		&share.OwnerID,
+		&share.OwnerEmail,
+		&share.GranteeID,
+		&share.GranteeEmail,
+		&share.DataKind,
+		&share.DataID,
+		&share.Permission,
+		&share.EncryptedKey,
+		&share.CreatedAt,
+		&share.UpdatedAt,
+	)
+	return share, err
+}
+
+// UpsertShare выдаёт доступ к записи. Если у получателя уже есть доступ к ней,
+// меняются права и ключ, а share получает идентификатор и время создания существующего доступа.
+func (s *xandyStorage) UpsertShare(ctx context.Context, share *models.Share) error {
+	query := `INSERT INTO shares (` + shareColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (data_id, grantee_id) DO UPDATE SET grantee_email=EXCLUDED.grantee_email, permission=EXCLUDED.permission, encrypted_key=EXCLUDED.encrypted_key, updated_at=EXCLUDED.updated_at
+		RETURNING id, created_at`
+	return s.QueryRow(
+		ctx,
+		query,
+		share.ID,
+		share.OwnerID,
+		share.OwnerEmail,
+		share.GranteeID,
+		share.GranteeEmail,
+		share.DataKind,
+		share.DataID,
+		share.Permission,
+		share.EncryptedKey,
+		share.CreatedAt,
+		share.UpdatedAt,
+	).Scan(&share.ID, &share.CreatedAt)
+}
+
+func (s *xandyStorage) GetShare(ctx context.Context, shareID uuid.UUID) (*models.Share, error) {
+	query := `SELECT ` + shareColumns + ` FROM shares WHERE id=$1`
+	share, err := scanShare(s.QueryRow(ctx, query, shareID))
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, httperror.New(err, "Share not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &share, nil
+}
+
+// GetDataShares возвращает всех, с кем владелец поделился записью
+func (s *xandyStorage) GetDataShares(ctx context.Context, ownerID uuid.UUID, dataID uuid.UUID) ([]models.Share, error) {
+	query := `SELECT ` + shareColumns + ` FROM shares WHERE owner_id=$1 AND data_id=$2 ORDER BY created_at`
+	return s.queryShares(ctx, query, ownerID, dataID)
+}
+
+// GetGranteeShares возвращает записи, которыми поделились с пользователем
+func (s *xandyStorage) GetGranteeShares(ctx context.Context, granteeID uuid.UUID, offset int) ([]models.Share, error) {
+	query := `SELECT ` + shareColumns + ` FROM shares WHERE grantee_id=$1 ORDER BY created_at DESC LIMIT 20 OFFSET $2`
+	return s.queryShares(ctx, query, granteeID, offset)
+}
+
+// DeleteShare удаляет доступ, удалить его может и владелец записи, и получатель
+func (s *xandyStorage) DeleteShare(ctx context.Context, shareID uuid.UUID, userID uuid.UUID) error {
+	query := `DELETE FROM shares WHERE id=$1 AND (owner_id=$2 OR grantee_id=$2)`
+	tag, err := s.Exec(ctx, query, shareID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "Share not found", http.StatusNotFound)
+	}
+	return nil
+}
+
+func (s *xandyStorage) queryShares(ctx context.Context, query string, args ...interface{}) ([]models.Share, error) {
+	rows, err := s.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []models.Share
+	for rows.Next() {
+		share, err := scanShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/google/uuid"
+)
+
+// GetUserUsage считает только личные записи пользователя, записи коллекций принадлежат организации
+func (s *xandyStorage) GetUserUsage(ctx context.Context, userID uuid.UUID) (*models.Usage, error) {
+	query := `SELECT
+		(SELECT COUNT(*) FROM user_auth_info WHERE user_id=$1 AND collection_id IS NULL),
+		(SELECT COUNT(*) FROM user_text_data WHERE user_id=$1 AND collection_id IS NULL),
+		(SELECT COUNT(*) FROM user_bank_card WHERE user_id=$1 AND collection_id IS NULL),
+		(SELECT COUNT(*) FROM user_file_data WHERE user_id=$1 AND collection_id IS NULL),
+		(SELECT COALESCE(SUM(size), 0) FROM user_file_data WHERE user_id=$1 AND collection_id IS NULL),
+		(SELECT COALESCE(SUM(size), 0) FROM file_uploads WHERE user_id=$1)`
+	var authInfo, textData, bankCards, fileData int64
+	usage := models.Usage{}
+	err := s.QueryRow(ctx, query, userID).Scan(&authInfo, &textData, &bankCards, &fileData, &usage.Bytes, &usage.UploadBytes)
+	if err != nil {
+		return nil, err
+	}
+	usage.Records = map[models.DataKind]int64{
+		models.KindAuthInfo: authInfo,
+		models.KindTextData: textData,
+		models.KindBankCard: bankCards,
+		models.KindFileData: fileData,
+	}
+	return &usage, nil
+}
+
+// LockUserUsage блокирует квоты пользователя до конца транзакции, чтобы проверка квоты
+// и создание записи не пересекались с такими же параллельными запросами
+func (s *xandyStorage) LockUserUsage(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('user_usage:' || $1::text, 0))`, userID)
+	return err
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUserUsageSkipsCollectionRecords(t *testing.T) {
+	storage := newTestStorage(t)
+	ctx := context.Background()
+	userID := uuid.New()
+
+	organization, err := models.NewOrganization("team")
+	require.NoError(t, err)
+	owner, err := models.NewOrganizationMember(organization.ID, userID, "owner@example.com", models.OrganizationRoleOwner)
+	require.NoError(t, err)
+	require.NoError(t, storage.InsertOrganization(ctx, &organization, &owner))
+	collection, err := models.NewCollection(organization.ID, "shared notes")
+	require.NoError(t, err)
+	require.NoError(t, storage.InsertCollection(ctx, &collection))
+
+	personal, err := models.NewUserTextData("personal", userID, models.Metadata{}, "mine")
+	require.NoError(t, err)
+	require.NoError(t, storage.InsertUserTextData(ctx, &personal))
+	shared, err := models.NewUserTextData("shared", userID, models.Metadata{}, "team")
+	require.NoError(t, err)
+	shared.CollectionID = &collection.ID
+	require.NoError(t, storage.InsertUserTextData(ctx, &shared))
+
+	// Запись коллекции принадлежит организации и не занимает квоту автора
+	usage, err := storage.GetUserUsage(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), usage.Records[models.KindTextData])
+}
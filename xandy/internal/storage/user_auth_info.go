@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/eac0de/xandy/internal/models"
 	"github.com/eac0de/xandy/shared/pkg/httperror"
@@ -10,7 +11,7 @@ import (
 )
 
 func (s *xandyStorage) InsertUserAuthInfo(ctx context.Context, userAuthInfo *models.UserAuthInfo) error {
-	query := `INSERT INTO user_auth_info (id, user_id, name, created_at, updated_at, login, password, metadata) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	query := `INSERT INTO user_auth_info (id, user_id, name, created_at, updated_at, login, password, metadata, collection_id, expires_at, password_changed_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $5)`
 	_, err := s.Exec(
 		ctx,
 		query,
@@ -22,37 +23,45 @@ func (s *xandyStorage) InsertUserAuthInfo(ctx context.Context, userAuthInfo *mod
 		userAuthInfo.Login,
 		userAuthInfo.Password,
 		userAuthInfo.Metadata,
+		userAuthInfo.CollectionID,
+		userAuthInfo.ExpiresAt,
 	)
 	return err
 }
 
-func (s *xandyStorage) UpdateUserAuthInfo(ctx context.Context, userAuthInfo *models.UserAuthInfo) error {
-	query := `UPDATE user_auth_info SET name=$3, updated_at=$4, login=$5, password=$6, metadata=$7 WHERE id=$1 AND user_id=$2`
-	_, err := s.Exec(
+func (s *xandyStorage) UpdateUserAuthInfo(ctx context.Context, userAuthInfo *models.UserAuthInfo, userID uuid.UUID) error {
+	// Срок смены пароля для напоминаний отсчитывается от последнего изменения пароля, а не записи
+	query := `UPDATE user_auth_info SET name=$3, updated_at=$4, login=$5, password=$6, metadata=$7,
+		password_changed_at=CASE WHEN password IS DISTINCT FROM $6 THEN $4 ELSE password_changed_at END WHERE id=$1 AND ` + writableBy("$2") + ` AND ` + notExpired("$8")
+	tag, err := s.Exec(
 		ctx,
 		query,
 		userAuthInfo.ID,
-		userAuthInfo.UserID,
+		userID,
 		userAuthInfo.Name,
 		userAuthInfo.UpdatedAt,
 		userAuthInfo.Login,
 		userAuthInfo.Password,
 		userAuthInfo.Metadata,
+		time.Now(),
 	)
 	if err != nil {
-		if err.Error() == "no rows in result set" {
-			return httperror.New(err, "UserAuthInfo not found", http.StatusNotFound)
-		}
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "UserAuthInfo not found", http.StatusNotFound)
+	}
 	return nil
 }
 
 func (s *xandyStorage) GetUserAuthInfo(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserAuthInfo, error) {
-	query := `SELECT name, created_at, updated_at, login, password, metadata FROM user_auth_info WHERE id=$1 AND user_id=$2`
-	userAuthInfo := models.UserAuthInfo{BaseUserData: models.BaseUserData{ID: dataID, UserID: userID}}
-	row := s.QueryRow(ctx, query, dataID, userID)
+	query := `SELECT user_id, collection_id, expires_at, name, created_at, updated_at, login, password, metadata FROM user_auth_info WHERE id=$1 AND ` + readableBy("$2") + ` AND ` + notExpired("$3")
+	userAuthInfo := models.UserAuthInfo{BaseUserData: models.BaseUserData{ID: dataID}}
+	row := s.QueryRow(ctx, query, dataID, userID, time.Now())
 	err := row.Scan(
+		&userAuthInfo.UserID,
+		&userAuthInfo.CollectionID,
+		&userAuthInfo.ExpiresAt,
 		&userAuthInfo.Name,
 		&userAuthInfo.CreatedAt,
 		&userAuthInfo.UpdatedAt,
@@ -70,9 +79,9 @@ func (s *xandyStorage) GetUserAuthInfo(ctx context.Context, dataID uuid.UUID, us
 }
 
 func (s *xandyStorage) GetUserAuthInfoList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserAuthInfo, error) {
-	query := `SELECT id, name, created_at, updated_at, login, password, metadata FROM user_auth_info WHERE user_id=$1 ORDER BY created_at DESC LIMIT 20 OFFSET $2`
+	query := `SELECT id, user_id, collection_id, expires_at, name, created_at, updated_at, login, password, metadata FROM user_auth_info WHERE ` + readableBy("$1") + ` AND ` + notExpired("$3") + ` ORDER BY created_at DESC LIMIT 20 OFFSET $2`
 
-	rows, err := s.Query(ctx, query, userID, offset)
+	rows, err := s.Query(ctx, query, userID, offset, time.Now())
 	if err != nil {
 		return nil, err
 	}
@@ -83,6 +92,9 @@ func (s *xandyStorage) GetUserAuthInfoList(ctx context.Context, userID uuid.UUID
 		var userAuthInfo models.UserAuthInfo
 		err := rows.Scan(
 			&userAuthInfo.ID,
+			&userAuthInfo.UserID,
+			&userAuthInfo.CollectionID,
+			&userAuthInfo.ExpiresAt,
 			&userAuthInfo.Name,
 			&userAuthInfo.CreatedAt,
 			&userAuthInfo.UpdatedAt,
@@ -93,7 +105,6 @@ func (s *xandyStorage) GetUserAuthInfoList(ctx context.Context, userID uuid.UUID
 		if err != nil {
 			return nil, err
 		}
-		userAuthInfo.UserID = userID
 		userAuthInfoList = append(userAuthInfoList, userAuthInfo)
 	}
 	if err := rows.Err(); err != nil {
@@ -103,7 +114,7 @@ func (s *xandyStorage) GetUserAuthInfoList(ctx context.Context, userID uuid.UUID
 }
 
 func (s *xandyStorage) DeleteUserAuthInfo(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) error {
-	query := `DELETE FROM user_auth_info WHERE id=$1 AND user_id=$1`
+	query := `DELETE FROM user_auth_info WHERE id=$1 AND ` + writableBy("$2")
 	_, err := s.Exec(ctx, query, dataID, userID)
 	return err
 }
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestStorage подключается к тестовой базе из XANDY_TEST_PSQL_*, без неё тест пропускается
+func newTestStorage(t *testing.T) *xandyStorage {
+	host := os.Getenv("XANDY_TEST_PSQL_HOST")
+	if host == "" {
+		t.Skip("XANDY_TEST_PSQL_HOST is not set")
+	}
+	ctx := context.Background()
+	storage, err := NewxandyStorage(
+		ctx,
+		host,
+		os.Getenv("XANDY_TEST_PSQL_PORT"),
+		os.Getenv("XANDY_TEST_PSQL_USERNAME"),
+		os.Getenv("XANDY_TEST_PSQL_PASSWORD"),
+		os.Getenv("XANDY_TEST_PSQL_DB_NAME"),
+	)
+	require.NoError(t, err)
+	t.Cleanup(storage.Close)
+	require.NoError(t, storage.Migrate(ctx, "../../migrations", false))
+	return storage
+}
+
+func TestDeleteUserAuthInfo(t *testing.T) {
+	storage := newTestStorage(t)
+	ctx := context.Background()
+	ownerID := uuid.New()
+	userAuthInfo, err := models.NewUserAuthInfo("mail", ownerID, models.Metadata{}, "me", "secret")
+	require.NoError(t, err)
+	require.NoError(t, storage.InsertUserAuthInfo(ctx, &userAuthInfo))
+
+	// Запись другого пользователя не удаляется
+	require.NoError(t, storage.DeleteUserAuthInfo(ctx, userAuthInfo.ID, uuid.New()))
+	_, err = storage.GetUserAuthInfo(ctx, userAuthInfo.ID, ownerID)
+	require.NoError(t, err)
+
+	require.NoError(t, storage.DeleteUserAuthInfo(ctx, userAuthInfo.ID, ownerID))
+	_, err = storage.GetUserAuthInfo(ctx, userAuthInfo.ID, ownerID)
+	assert.True(t, httperror.IsNotFound(err))
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/eac0de/xandy/internal/models"
 	"github.com/eac0de/xandy/shared/pkg/httperror"
@@ -10,7 +11,7 @@ import (
 )
 
 func (s *xandyStorage) InsertUserBankCard(ctx context.Context, userBankCardData *models.UserBankCard) error {
-	query := `INSERT INTO user_bank_card (id, user_id, name, created_at, updated_at, number, card_holder, expire_date, csc, metadata) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	query := `INSERT INTO user_bank_card (id, user_id, name, created_at, updated_at, number, card_holder, expire_date, csc, metadata, collection_id, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
 	_, err := s.Exec(ctx, query,
 		userBankCardData.ID,
 		userBankCardData.UserID,
@@ -22,15 +23,17 @@ func (s *xandyStorage) InsertUserBankCard(ctx context.Context, userBankCardData
 		userBankCardData.ExpireDate,
 		userBankCardData.CSC,
 		userBankCardData.Metadata,
+		userBankCardData.CollectionID,
+		userBankCardData.ExpiresAt,
 	)
 	return err
 }
 
-func (s *xandyStorage) UpdateUserBankCard(ctx context.Context, userBankCardData *models.UserBankCard) error {
-	query := `UPDATE user_bank_card SET name=$3, updated_at=$4, number=$5, card_holder=$6, expire_date=$7, csc=$8, metadata=$9 WHERE id=$1 AND user_id=$2`
-	_, err := s.Exec(ctx, query,
+func (s *xandyStorage) UpdateUserBankCard(ctx context.Context, userBankCardData *models.UserBankCard, userID uuid.UUID) error {
+	query := `UPDATE user_bank_card SET name=$3, updated_at=$4, number=$5, card_holder=$6, expire_date=$7, csc=$8, metadata=$9 WHERE id=$1 AND ` + writableBy("$2") + ` AND ` + notExpired("$10")
+	tag, err := s.Exec(ctx, query,
 		userBankCardData.ID,
-		userBankCardData.UserID,
+		userID,
 		userBankCardData.Name,
 		userBankCardData.UpdatedAt,
 		userBankCardData.Number,
@@ -38,27 +41,31 @@ func (s *xandyStorage) UpdateUserBankCard(ctx context.Context, userBankCardData
 		userBankCardData.ExpireDate,
 		userBankCardData.CSC,
 		userBankCardData.Metadata,
+		time.Now(),
 	)
 	if err != nil {
-		if err.Error() == "no rows in result set" {
-			return httperror.New(err, "UserBankCard not found", http.StatusNotFound)
-		}
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "UserBankCard not found", http.StatusNotFound)
+	}
 	return nil
 }
 
 func (s *xandyStorage) DeleteUserBankCard(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) error {
-	query := `DELETE FROM user_bank_card WHERE id=$1 AND user_id=$2`
+	query := `DELETE FROM user_bank_card WHERE id=$1 AND ` + writableBy("$2")
 	_, err := s.Exec(ctx, query, dataID, userID)
 	return err
 }
 
 func (s *xandyStorage) GetUserBankCard(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserBankCard, error) {
-	query := `SELECT name, created_at, updated_at, number, card_holder, expire_date, csc, metadata FROM user_bank_card WHERE id=$1 AND user_id=$2`
-	row := s.QueryRow(ctx, query, dataID, userID)
-	userBankCard := models.UserBankCard{BaseUserData: models.BaseUserData{ID: dataID, UserID: userID}}
+	query := `SELECT user_id, collection_id, expires_at, name, created_at, updated_at, number, card_holder, expire_date, csc, metadata FROM user_bank_card WHERE id=$1 AND ` + readableBy("$2") + ` AND ` + notExpired("$3")
+	row := s.QueryRow(ctx, query, dataID, userID, time.Now())
+	userBankCard := models.UserBankCard{BaseUserData: models.BaseUserData{ID: dataID}}
 	err := row.Scan(
+		&userBankCard.UserID,
+		&userBankCard.CollectionID,
+		&userBankCard.ExpiresAt,
 		&userBankCard.Name,
 		&userBankCard.CreatedAt,
 		&userBankCard.UpdatedAt,
@@ -78,9 +85,9 @@ func (s *xandyStorage) GetUserBankCard(ctx context.Context, dataID uuid.UUID, us
 }
 
 func (s *xandyStorage) GetUserBankCardList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserBankCard, error) {
-	query := `SELECT id, name, created_at, updated_at, number, card_holder, expire_date, csc, metadata FROM user_bank_card WHERE user_id=$1 ORDER BY created_at DESC LIMIT 20 OFFSET $2`
+	query := `SELECT id, user_id, collection_id, expires_at, name, created_at, updated_at, number, card_holder, expire_date, csc, metadata FROM user_bank_card WHERE ` + readableBy("$1") + ` AND ` + notExpired("$3") + ` ORDER BY created_at DESC LIMIT 20 OFFSET $2`
 
-	rows, err := s.Query(ctx, query, userID, offset)
+	rows, err := s.Query(ctx, query, userID, offset, time.Now())
 	if err != nil {
 		return nil, err
 	}
@@ -91,6 +98,9 @@ func (s *xandyStorage) GetUserBankCardList(ctx context.Context, userID uuid.UUID
 		var userBankCard models.UserBankCard
 		err := rows.Scan(
 			&userBankCard.ID,
+			&userBankCard.UserID,
+			&userBankCard.CollectionID,
+			&userBankCard.ExpiresAt,
 			&userBankCard.Name,
 			&userBankCard.CreatedAt,
 			&userBankCard.UpdatedAt,
@@ -103,7 +113,6 @@ func (s *xandyStorage) GetUserBankCardList(ctx context.Context, userID uuid.UUID
 		if err != nil {
 			return nil, err
 		}
-		userBankCard.UserID = userID
 		userBankCardList = append(userBankCardList, userBankCard)
 	}
 	if err := rows.Err(); err != nil {
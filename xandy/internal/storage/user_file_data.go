@@ -2,15 +2,50 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/eac0de/xandy/internal/models"
 	"github.com/eac0de/xandy/shared/pkg/httperror"
 	"github.com/google/uuid"
 )
 
+const userFileDataColumns = `id, user_id, name, created_at, updated_at, blob_key, ext, metadata, sha256, mime_type, size, original_file_name, parent_kind, parent_id, scan_status, scan_result, scanned_at, collection_id, expires_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUserFileData(row rowScanner) (models.UserFileData, error) {
+	var userFileData models.UserFileData
+	err := row.Scan(
+		&userFileData.ID,
+		&userFileData.UserID,
+		&userFileData.Name,
+		&userFileData.CreatedAt,
+		&userFileData.UpdatedAt,
+		&userFileData.BlobKey,
+		&userFileData.Ext,
+		&userFileData.Metadata,
+		&userFileData.SHA256,
+		&userFileData.MimeType,
+		&userFileData.Size,
+		&userFileData.OriginalFileName,
+		&userFileData.ParentKind,
+		&userFileData.ParentID,
+		&userFileData.ScanStatus,
+		&userFileData.ScanResult,
+		&userFileData.ScannedAt,
+		&userFileData.CollectionID,
+		&userFileData.ExpiresAt,
+	)
+	return userFileData, err
+}
+
 func (s *xandyStorage) InsertUserFileData(ctx context.Context, userFileData *models.UserFileData) error {
-	query := `INSERT INTO user_file_data (id, user_id, name, created_at, updated_at, path_to_file, ext, metadata) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	query := `INSERT INTO user_file_data (` + userFileDataColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`
 	_, err := s.Exec(
 		ctx,
 		query,
@@ -19,46 +54,49 @@ func (s *xandyStorage) InsertUserFileData(ctx context.Context, userFileData *mod
 		userFileData.Name,
 		userFileData.CreatedAt,
 		userFileData.UpdatedAt,
-		userFileData.PathToFile,
+		userFileData.BlobKey,
 		userFileData.Ext,
 		userFileData.Metadata,
+		userFileData.SHA256,
+		userFileData.MimeType,
+		userFileData.Size,
+		userFileData.OriginalFileName,
+		userFileData.ParentKind,
+		userFileData.ParentID,
+		userFileData.ScanStatus,
+		userFileData.ScanResult,
+		userFileData.ScannedAt,
+		userFileData.CollectionID,
+		userFileData.ExpiresAt,
 	)
 	return err
 }
 
-func (s *xandyStorage) UpdateUserFileData(ctx context.Context, userFileData *models.UserFileData) error {
-	query := `UPDATE user_file_data SET name=$3, updated_at=$4, path_to_file=$5, ext=$6, metadata=$7 WHERE id=$1 AND user_id=$2`
-	_, err := s.Exec(
+// UpdateUserFileData меняет только описание записи, содержимое меняется через ReplaceUserFileContent
+func (s *xandyStorage) UpdateUserFileData(ctx context.Context, userFileData *models.UserFileData, userID uuid.UUID) error {
+	query := `UPDATE user_file_data SET name=$3, updated_at=$4, ext=$5, metadata=$6 WHERE id=$1 AND ` + writableBy("$2") + ` AND ` + notExpired("$7")
+	tag, err := s.Exec(
 		ctx,
 		query, userFileData.ID,
-		userFileData.UserID,
+		userID,
 		userFileData.Name,
 		userFileData.UpdatedAt,
-		userFileData.PathToFile,
 		userFileData.Ext,
 		userFileData.Metadata,
+		time.Now(),
 	)
 	if err != nil {
-		if err.Error() == "no rows in result set" {
-			return httperror.New(err, "UserFileData not found", http.StatusNotFound)
-		}
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "UserFileData not found", http.StatusNotFound)
+	}
 	return nil
 }
 
 func (s *xandyStorage) GetUserFileData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserFileData, error) {
-	query := `SELECT name, created_at, updated_at, path_to_file, ext, metadata FROM user_file_data WHERE id=$1 AND user_id=$2`
-	row := s.QueryRow(ctx, query, dataID, userID)
-	userFileData := models.UserFileData{BaseUserData: models.BaseUserData{ID: dataID, UserID: userID}}
-	err := row.Scan(
-		&userFileData.Name,
-		&userFileData.CreatedAt,
-		&userFileData.UpdatedAt,
-		&userFileData.PathToFile,
-		&userFileData.Ext,
-		&userFileData.Metadata,
-	)
+	query := `SELECT ` + userFileDataColumns + ` FROM user_file_data WHERE id=$1 AND ` + readableBy("$2") + ` AND ` + notExpired("$3")
+	userFileData, err := scanUserFileData(s.QueryRow(ctx, query, dataID, userID, time.Now()))
 	if err != nil {
 		if err.Error() == "no rows in result set" {
 			return nil, httperror.New(err, "UserFileData not found", http.StatusNotFound)
@@ -68,16 +106,111 @@ func (s *xandyStorage) GetUserFileData(ctx context.Context, dataID uuid.UUID, us
 	return &userFileData, nil
 }
 
+// ReplaceUserFileContent меняет содержимое записи, только если оно всё ещё равно oldBlobKey.
+// Новое содержимое снова ждёт проверки.
+func (s *xandyStorage) ReplaceUserFileContent(ctx context.Context, userFileData *models.UserFileData, oldBlobKey string, userID uuid.UUID) error {
+	query := `UPDATE user_file_data SET updated_at=$3, blob_key=$4, sha256=$5, mime_type=$6, size=$7, scan_status=$9, scan_result=$10, scanned_at=$11 WHERE id=$1 AND blob_key=$8 AND ` + writableBy("$2")
+	tag, err := s.Exec(
+		ctx,
+		query,
+		userFileData.ID,
+		userID,
+		userFileData.UpdatedAt,
+		userFileData.BlobKey,
+		userFileData.SHA256,
+		userFileData.MimeType,
+		userFileData.Size,
+		oldBlobKey,
+		userFileData.ScanStatus,
+		userFileData.ScanResult,
+		userFileData.ScannedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "UserFileData was changed or deleted concurrently", http.StatusConflict)
+	}
+	return nil
+}
+
 func (s *xandyStorage) DeleteUserFileData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) error {
-	query := `DELETE FROM user_file_data WHERE id=$1 AND user_id=$2`
-	_, err := s.Exec(ctx, query, dataID, userID)
+	query := `DELETE FROM user_file_data WHERE id=$1 AND ` + writableBy("$2")
+	tag, err := s.Exec(ctx, query, dataID, userID)
+	if err != nil {
+		return err
+	}
+	// Запись могла удалить параллельная операция, тогда ссылку на содержимое уже вернули
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "UserFileData not found", http.StatusNotFound)
+	}
+	return nil
+}
+
+func (s *xandyStorage) GetUserFileDataList(ctx context.Context, userID uuid.UUID, filter models.FileDataFilter, offset int) ([]models.UserFileData, error) {
+	query := `SELECT ` + userFileDataColumns + ` FROM user_file_data WHERE ` + readableBy("$1") + ` AND ` + notExpired("$2")
+	args := []interface{}{userID, time.Now()}
+	if !filter.WithAttachments {
+		query += " AND parent_id IS NULL"
+	}
+	if filter.MimeType != "" {
+		args = append(args, escapeLike(filter.MimeType)+"%")
+		query += fmt.Sprintf(" AND mime_type LIKE $%d", len(args))
+	}
+	if filter.MinSize != nil {
+		args = append(args, *filter.MinSize)
+		query += fmt.Sprintf(" AND size >= $%d", len(args))
+	}
+	if filter.MaxSize != nil {
+		args = append(args, *filter.MaxSize)
+		query += fmt.Sprintf(" AND size <= $%d", len(args))
+	}
+	if filter.OriginalFileName != "" {
+		args = append(args, "%"+escapeLike(filter.OriginalFileName)+"%")
+		query += fmt.Sprintf(" AND original_file_name ILIKE $%d", len(args))
+	}
+	args = append(args, offset)
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT 20 OFFSET $%d", len(args))
+	return s.queryUserFileData(ctx, query, args...)
+}
+
+// GetUserFileDataAttachments возвращает файлы, прикреплённые к записям parentIDs
+func (s *xandyStorage) GetUserFileDataAttachments(ctx context.Context, userID uuid.UUID, parentIDs []uuid.UUID) ([]models.UserFileData, error) {
+	query := `SELECT ` + userFileDataColumns + ` FROM user_file_data WHERE parent_id = ANY($2) AND ` + readableBy("$1") + ` AND ` + notExpired("$3") + ` ORDER BY created_at`
+	return s.queryUserFileData(ctx, query, userID, parentIDs, time.Now())
+}
+
+// GetAllUserFileData возвращает файлы всех пользователей для проверки содержимого
+func (s *xandyStorage) GetAllUserFileData(ctx context.Context) ([]models.UserFileData, error) {
+	query := `SELECT ` + userFileDataColumns + ` FROM user_file_data ORDER BY blob_key, id`
+	return s.queryUserFileData(ctx, query)
+}
+
+// UpdateUserFileDigest исправляет SHA-256 и размер, если запись всё ещё ссылается на blobKey
+func (s *xandyStorage) UpdateUserFileDigest(ctx context.Context, dataID uuid.UUID, blobKey string, sha256 string, size int64) error {
+	query := `UPDATE user_file_data SET sha256=$3, size=$4 WHERE id=$1 AND blob_key=$2`
+	_, err := s.Exec(ctx, query, dataID, blobKey, sha256, size)
 	return err
 }
 
-func (s *xandyStorage) GetUserFileDataList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserFileData, error) {
-	query := `SELECT id, name, created_at, updated_at, path_to_file, ext, metadata FROM user_file_data WHERE user_id=$1 ORDER BY created_at DESC LIMIT 20 OFFSET $2`
+// GetPendingUserFileData возвращает файлы, которые ждут проверки, начиная с самых старых
+func (s *xandyStorage) GetPendingUserFileData(ctx context.Context, limit int) ([]models.UserFileData, error) {
+	query := `SELECT ` + userFileDataColumns + ` FROM user_file_data WHERE scan_status='pending' ORDER BY updated_at LIMIT $1`
+	return s.queryUserFileData(ctx, query, limit)
+}
 
-	rows, err := s.Query(ctx, query, userID, offset)
+// SetUserFileScanResult сохраняет результат проверки, если содержимое записи не менялось во время проверки
+func (s *xandyStorage) SetUserFileScanResult(ctx context.Context, dataID uuid.UUID, blobKey string, status models.ScanStatus, result string, scannedAt time.Time) (bool, error) {
+	query := `UPDATE user_file_data SET scan_status=$3, scan_result=$4, scanned_at=$5 WHERE id=$1 AND blob_key=$2 AND scan_status='pending'`
+	tag, err := s.Exec(ctx, query, dataID, blobKey, status, result, scannedAt)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *xandyStorage) queryUserFileData(ctx context.Context, query string, args ...interface{}) ([]models.UserFileData, error) {
+	rows, err := s.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -85,20 +218,10 @@ func (s *xandyStorage) GetUserFileDataList(ctx context.Context, userID uuid.UUID
 
 	var userFileDataList []models.UserFileData
 	for rows.Next() {
-		var userFileData models.UserFileData
-		err := rows.Scan(
-			&userFileData.ID,
-			&userFileData.Name,
-			&userFileData.CreatedAt,
-			&userFileData.UpdatedAt,
-			&userFileData.PathToFile,
-			&userFileData.Ext,
-			&userFileData.Metadata,
-		)
+		userFileData, err := scanUserFileData(rows)
 		if err != nil {
 			return nil, err
 		}
-		userFileData.UserID = userID
 		userFileDataList = append(userFileDataList, userFileData)
 	}
 	if err := rows.Err(); err != nil {
@@ -106,3 +229,8 @@ func (s *xandyStorage) GetUserFileDataList(ctx context.Context, userID uuid.UUID
 	}
 	return userFileDataList, nil
 }
+
+// escapeLike экранирует спецсимволы LIKE, чтобы значение фильтра искалось как есть
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
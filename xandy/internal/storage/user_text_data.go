@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/eac0de/xandy/internal/models"
 	"github.com/eac0de/xandy/shared/pkg/httperror"
@@ -10,28 +11,31 @@ import (
 )
 
 func (s *xandyStorage) InsertUserTextData(ctx context.Context, userTextData *models.UserTextData) error {
-	query := `INSERT INTO user_text_data (id, user_id, name, created_at, updated_at, data, metadata) VALUES ($1, $2, $3, $4, $5, $6, $7)`
-	_, err := s.Exec(ctx, query, userTextData.ID, userTextData.UserID, userTextData.Name, userTextData.CreatedAt, userTextData.UpdatedAt, userTextData.Data, userTextData.Metadata)
+	query := `INSERT INTO user_text_data (id, user_id, name, created_at, updated_at, data, metadata, collection_id, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := s.Exec(ctx, query, userTextData.ID, userTextData.UserID, userTextData.Name, userTextData.CreatedAt, userTextData.UpdatedAt, userTextData.Data, userTextData.Metadata, userTextData.CollectionID, userTextData.ExpiresAt)
 	return err
 }
 
-func (s *xandyStorage) UpdateUserTextData(ctx context.Context, userTextData *models.UserTextData) error {
-	query := `UPDATE user_text_data SET name=$3, updated_at=$4, data=$5, metadata=$6 WHERE id=$1 AND user_id=$2`
-	_, err := s.Exec(ctx, query, userTextData.ID, userTextData.UserID, userTextData.Name, userTextData.UpdatedAt, userTextData.Data, userTextData.Metadata)
+func (s *xandyStorage) UpdateUserTextData(ctx context.Context, userTextData *models.UserTextData, userID uuid.UUID) error {
+	query := `UPDATE user_text_data SET name=$3, updated_at=$4, data=$5, metadata=$6 WHERE id=$1 AND ` + writableBy("$2") + ` AND ` + notExpired("$7")
+	tag, err := s.Exec(ctx, query, userTextData.ID, userID, userTextData.Name, userTextData.UpdatedAt, userTextData.Data, userTextData.Metadata, time.Now())
 	if err != nil {
-		if err.Error() == "no rows in result set" {
-			return httperror.New(err, "UserTextData not found", http.StatusNotFound)
-		}
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "UserTextData not found", http.StatusNotFound)
+	}
 	return nil
 }
 
 func (s *xandyStorage) GetUserTextData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) (*models.UserTextData, error) {
-	query := `SELECT name, created_at, updated_at, data, metadata FROM user_text_data WHERE id=$1 AND user_id=$2`
-	row := s.QueryRow(ctx, query, dataID, userID)
-	userTextData := models.UserTextData{BaseUserData: models.BaseUserData{ID: dataID, UserID: userID}}
+	query := `SELECT user_id, collection_id, expires_at, name, created_at, updated_at, data, metadata FROM user_text_data WHERE id=$1 AND ` + readableBy("$2") + ` AND ` + notExpired("$3")
+	row := s.QueryRow(ctx, query, dataID, userID, time.Now())
+	userTextData := models.UserTextData{BaseUserData: models.BaseUserData{ID: dataID}}
 	err := row.Scan(
+		&userTextData.UserID,
+		&userTextData.CollectionID,
+		&userTextData.ExpiresAt,
 		&userTextData.Name,
 		&userTextData.CreatedAt,
 		&userTextData.UpdatedAt,
@@ -48,15 +52,15 @@ func (s *xandyStorage) GetUserTextData(ctx context.Context, dataID uuid.UUID, us
 }
 
 func (s *xandyStorage) DeleteUserTextData(ctx context.Context, dataID uuid.UUID, userID uuid.UUID) error {
-	query := `DELETE FROM user_text_data WHERE id=$1 AND user_id=$2`
+	query := `DELETE FROM user_text_data WHERE id=$1 AND ` + writableBy("$2")
 	_, err := s.Exec(ctx, query, dataID, userID)
 	return err
 }
 
 func (s *xandyStorage) GetUserTextDataList(ctx context.Context, userID uuid.UUID, offset int) ([]models.UserTextData, error) {
-	query := `SELECT id, name, created_at, updated_at, data, metadata FROM user_text_data WHERE user_id=$1 ORDER BY created_at DESC LIMIT 20 OFFSET $2`
+	query := `SELECT id, user_id, collection_id, expires_at, name, created_at, updated_at, data, metadata FROM user_text_data WHERE ` + readableBy("$1") + ` AND ` + notExpired("$3") + ` ORDER BY created_at DESC LIMIT 20 OFFSET $2`
 
-	rows, err := s.Query(ctx, query, userID, offset)
+	rows, err := s.Query(ctx, query, userID, offset, time.Now())
 	if err != nil {
 		return nil, err
 	}
@@ -67,6 +71,9 @@ func (s *xandyStorage) GetUserTextDataList(ctx context.Context, userID uuid.UUID
 		var userTextData models.UserTextData
 		err := rows.Scan(
 			&userTextData.ID,
+			&userTextData.UserID,
+			&userTextData.CollectionID,
+			&userTextData.ExpiresAt,
 			&userTextData.Name,
 			&userTextData.CreatedAt,
 			&userTextData.UpdatedAt,
@@ -76,7 +83,6 @@ func (s *xandyStorage) GetUserTextDataList(ctx context.Context, userID uuid.UUID
 		if err != nil {
 			return nil, err
 		}
-		userTextData.UserID = userID
 		userTextDataList = append(userTextDataList, userTextData)
 	}
 	if err := rows.Err(); err != nil {
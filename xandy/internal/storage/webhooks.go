@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/eac0de/xandy/shared/pkg/httperror"
+	"github.com/google/uuid"
+)
+
+const webhookColumns = `id, user_id, url, events, active, created_at, updated_at`
+
+const webhookDeliveryColumns = `id, webhook_id, event_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error, created_at, updated_at`
+
+func scanWebhook(row rowScanner) (models.Webhook, error) {
+	var webhook models.Webhook
+	var events []string
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.UserID,
+		&webhook.URL,
+		&events,
+		&webhook.Active,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	webhook.Events = make([]models.WebhookEvent, len(events))
+	for i, event := range events {
+		webhook.Events[i] = models.WebhookEvent(event)
+	}
+	return webhook, err
+}
+
+func scanWebhookDelivery(row rowScanner, extra ...interface{}) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	dest := []interface{}{
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.EventID,
+		&delivery.Event,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return delivery, err
+}
+
+func webhookEvents(events []models.WebhookEvent) []string {
+	values := make([]string, len(events))
+	for i, event := range events {
+		values[i] = string(event)
+	}
+	return values
+}
+
+func (s *xandyStorage) InsertWebhook(ctx context.Context, webhook *models.Webhook) error {
+	query := `INSERT INTO webhooks (id, user_id, url, events, secret, active, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := s.Exec(
+		ctx,
+		query,
+		webhook.ID,
+		webhook.UserID,
+		webhook.URL,
+		webhookEvents(webhook.Events),
+		webhook.Secret,
+		webhook.Active,
+		webhook.CreatedAt,
+		webhook.UpdatedAt,
+	)
+	return err
+}
+
+// GetWebhook возвращает вебхук пользователя без ключа подписи
+func (s *xandyStorage) GetWebhook(ctx context.Context, webhookID uuid.UUID, userID uuid.UUID) (*models.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id=$1 AND user_id=$2`
+	webhook, err := scanWebhook(s.QueryRow(ctx, query, webhookID, userID))
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, httperror.New(err, "Webhook not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (s *xandyStorage) GetWebhooks(ctx context.Context, userID uuid.UUID) ([]models.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE user_id=$1 ORDER BY created_at`
+	rows, err := s.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []models.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (s *xandyStorage) UpdateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	query := `UPDATE webhooks SET url=$3, events=$4, active=$5, updated_at=$6 WHERE id=$1 AND user_id=$2`
+	tag, err := s.Exec(ctx, query, webhook.ID, webhook.UserID, webhook.URL, webhookEvents(webhook.Events), webhook.Active, webhook.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "Webhook not found", http.StatusNotFound)
+	}
+	return nil
+}
+
+// DeleteWebhook удаляет вебхук вместе с журналом доставок
+func (s *xandyStorage) DeleteWebhook(ctx context.Context, webhookID uuid.UUID, userID uuid.UUID) error {
+	query := `DELETE FROM webhooks WHERE id=$1 AND user_id=$2`
+	tag, err := s.Exec(ctx, query, webhookID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return httperror.New(nil, "Webhook not found", http.StatusNotFound)
+	}
+	return nil
+}
+
+// GetWebhookDeliveries возвращает журнал доставок вебхука, новые доставки первыми
+func (s *xandyStorage) GetWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, offset int) ([]models.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE webhook_id=$1 ORDER BY created_at DESC LIMIT 20 OFFSET $2`
+	rows, err := s.Query(ctx, query, webhookID, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ReplayWebhookDelivery ставит в очередь новую доставку того же события, прежняя остаётся в журнале
+func (s *xandyStorage) ReplayWebhookDelivery(ctx context.Context, webhookID uuid.UUID, deliveryID uuid.UUID, now time.Time) (*models.WebhookDelivery, error) {
+	query := `INSERT INTO webhook_deliveries (` + webhookDeliveryColumns + `)
+		SELECT $3, webhook_id, event_id, event, payload, $4, 0, $5, 0, '', $5, $5 FROM webhook_deliveries WHERE id=$2 AND webhook_id=$1
+		RETURNING ` + webhookDeliveryColumns
+	delivery, err := scanWebhookDelivery(s.QueryRow(ctx, query, webhookID, deliveryID, uuid.New(), models.WebhookDeliveryPending, now))
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, httperror.New(err, "Webhook delivery not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// DispatchWebhookOutbox разбирает не больше limit событий из outbox: создаёт доставки на активные вебхуки,
+// подписанные на событие и принадлежащие пользователям с доступом к записи, и отмечает события разобранными.
+// Всё делается одним запросом, поэтому событие не потеряется и не разберётся дважды.
+// Возвращает число разобранных событий.
+func (s *xandyStorage) DispatchWebhookOutbox(ctx context.Context, now time.Time, limit int) (int, error) {
+	query := `WITH events AS (
+			SELECT id, event_id, event, data_kind, data_id, name, owner_id, collection_id, occurred_at FROM webhook_outbox
+			WHERE dispatched_at IS NULL ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED
+		), dispatched AS (
+			UPDATE webhook_outbox o SET dispatched_at=$1 FROM events e WHERE o.id = e.id RETURNING o.id
+		), deliveries AS (
+			INSERT INTO webhook_deliveries (` + webhookDeliveryColumns + `)
+			SELECT gen_random_uuid(), w.id, e.event_id, e.event,
+				jsonb_build_object(
+					'id', e.event_id,
+					'event', e.event,
+					'occurred_at', e.occurred_at,
+					'data', jsonb_build_object('kind', e.data_kind, 'id', e.data_id, 'name', e.name, 'owner_id', e.owner_id, 'collection_id', e.collection_id)
+				),
+				$3, 0, $1, 0, '', $1, $1
+			FROM events e JOIN webhooks w ON w.active AND e.event = ANY(w.events)
+				AND (e.collection_id IS NULL AND w.user_id = e.owner_id
+					OR e.collection_id IN (SELECT collection_id FROM collection_access WHERE user_id = w.user_id))
+		)
+		SELECT COUNT(*) FROM dispatched`
+	var dispatched int
+	err := s.QueryRow(ctx, query, now, limit, models.WebhookDeliveryPending).Scan(&dispatched)
+	return dispatched, err
+}
+
+// ClaimWebhookDeliveries берёт в отправку не больше limit доставок, время попытки которых наступило.
+// Следующая попытка откладывается до leaseUntil, чтобы доставку не взял другой экземпляр сервиса,
+// а если отправивший экземпляр упадёт, доставка повторится после leaseUntil.
+func (s *xandyStorage) ClaimWebhookDeliveries(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]models.WebhookDelivery, error) {
+	query := `WITH due AS (
+			SELECT d.id FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id AND w.active
+			WHERE d.status=$3 AND d.next_attempt_at <= $1 ORDER BY d.next_attempt_at LIMIT $4 FOR UPDATE OF d SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d SET next_attempt_at=$2 FROM due, webhooks w WHERE d.id = due.id AND w.id = d.webhook_id
+		RETURNING d.id, d.webhook_id, d.event_id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at, d.last_status_code, d.last_error, d.created_at, d.updated_at, w.url, w.secret`
+	rows, err := s.Query(ctx, query, now, leaseUntil, models.WebhookDeliveryPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var url, secret string
+		delivery, err := scanWebhookDelivery(rows, &url, &secret)
+		if err != nil {
+			return nil, err
+		}
+		delivery.URL = url
+		delivery.Secret = secret
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// CompleteWebhookDelivery сохраняет результат попытки доставки
+func (s *xandyStorage) CompleteWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	query := `UPDATE webhook_deliveries SET status=$2, attempts=$3, next_attempt_at=$4, last_status_code=$5, last_error=$6, updated_at=$7 WHERE id=$1`
+	_, err := s.Exec(
+		ctx,
+		query,
+		delivery.ID,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.LastStatusCode,
+		delivery.LastError,
+		delivery.UpdatedAt,
+	)
+	return err
+}
@@ -0,0 +1,162 @@
+package vaultarchive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/google/uuid"
+)
+
+// Внутри шифрования лежит tar.gz: первым идёт manifest.json, за ним содержимое файлов files/<id>
+const (
+	Version = 1
+
+	manifestName    = "manifest.json"
+	filesDir        = "files/"
+	maxManifestSize = 64 << 20
+)
+
+// Manifest содержит все записи пользователя вместе с идентификаторами и датами
+type Manifest struct {
+	Version    int                   `json:"version"`
+	ExportedAt time.Time             `json:"exported_at"`
+	AuthInfo   []models.UserAuthInfo `json:"auth_info"`
+	TextData   []models.UserTextData `json:"text_data"`
+	BankCards  []models.UserBankCard `json:"bank_cards"`
+	FileData   []models.UserFileData `json:"file_data"`
+	// Файлы, содержимое которых не удалось найти в хранилище при экспорте
+	MissingFiles []uuid.UUID `json:"missing_files,omitempty"`
+	// Файлы, не прошедшие проверку на вредоносное содержимое, выгружаются без содержимого, статус остаётся в scan_status
+	UnscannedFiles []uuid.UUID `json:"unscanned_files,omitempty"`
+}
+
+type Writer struct {
+	encrypt *encryptWriter
+	gzip    *gzip.Writer
+	tar     *tar.Writer
+}
+
+func NewWriter(w io.Writer, passphrase string) (*Writer, error) {
+	encrypt, err := newEncryptWriter(w, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(encrypt)
+	return &Writer{
+		encrypt: encrypt,
+		gzip:    gz,
+		tar:     tar.NewWriter(gz),
+	}, nil
+}
+
+// WriteManifest должен вызываться до записи файлов
+func (aw *Writer) WriteManifest(manifest *Manifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	err = aw.tar.WriteHeader(&tar.Header{
+		Name:     manifestName,
+		Mode:     0600,
+		Size:     int64(len(data)),
+		ModTime:  manifest.ExportedAt,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = aw.tar.Write(data)
+	return err
+}
+
+func (aw *Writer) WriteFile(id uuid.UUID, size int64, content io.Reader) error {
+	err := aw.tar.WriteHeader(&tar.Header{
+		Name:     filesDir + id.String(),
+		Mode:     0600,
+		Size:     size,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(aw.tar, content)
+	return err
+}
+
+func (aw *Writer) Close() error {
+	if err := aw.tar.Close(); err != nil {
+		return err
+	}
+	if err := aw.gzip.Close(); err != nil {
+		return err
+	}
+	return aw.encrypt.Close()
+}
+
+// Read расшифровывает архив и вызывает onFile для содержимого каждого файла.
+// Манифест возвращается только если архив прочитан целиком и все блоки прошли проверку.
+func Read(r io.Reader, passphrase string, onFile func(id uuid.UUID, content io.Reader) error) (*Manifest, error) {
+	decrypt, err := newDecryptReader(r, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(decrypt)
+	if err != nil {
+		return nil, archiveError(err)
+	}
+	defer gz.Close()
+
+	var manifest *Manifest
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, archiveError(err)
+		}
+		switch {
+		case header.Name == manifestName && manifest == nil:
+			manifest = &Manifest{}
+			if err := json.NewDecoder(io.LimitReader(tr, maxManifestSize)).Decode(manifest); err != nil {
+				return nil, archiveError(err)
+			}
+			if manifest.Version != Version {
+				return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidArchive, manifest.Version)
+			}
+		case strings.HasPrefix(header.Name, filesDir) && manifest != nil:
+			id, err := uuid.Parse(strings.TrimPrefix(header.Name, filesDir))
+			if err != nil {
+				return nil, fmt.Errorf("%w: unexpected entry %q", ErrInvalidArchive, header.Name)
+			}
+			if err := onFile(id, tr); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: unexpected entry %q", ErrInvalidArchive, header.Name)
+		}
+	}
+	// Дочитываем поток до конца, чтобы проверить последний блок
+	if _, err := io.Copy(io.Discard, decrypt); err != nil {
+		return nil, archiveError(err)
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("%w: manifest not found", ErrInvalidArchive)
+	}
+	return manifest, nil
+}
+
+func archiveError(err error) error {
+	if errors.Is(err, ErrDecryption) || errors.Is(err, ErrInvalidArchive) {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidArchive, err)
+}
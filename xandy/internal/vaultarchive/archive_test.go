@@ -0,0 +1,84 @@
+package vaultarchive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eac0de/xandy/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeArchive(t *testing.T, passphrase string, manifest *Manifest, files map[uuid.UUID][]byte) []byte {
+	buf := &bytes.Buffer{}
+	writer, err := NewWriter(buf, passphrase)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteManifest(manifest))
+	for id, content := range files {
+		require.NoError(t, writer.WriteFile(id, int64(len(content)), bytes.NewReader(content)))
+	}
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	userID := uuid.New()
+	textData, err := models.NewUserTextData("note", userID, models.Metadata{"tag": "home"}, "secret text")
+	require.NoError(t, err)
+	fileData, err := models.NewUserFileData("scan", userID, models.Metadata{}, ".pdf", "scan.pdf")
+	require.NoError(t, err)
+	manifest := &Manifest{
+		Version:    Version,
+		ExportedAt: time.Now().UTC(),
+		TextData:   []models.UserTextData{textData},
+		FileData:   []models.UserFileData{fileData},
+	}
+	// Содержимое больше одного блока шифрования
+	content := bytes.Repeat([]byte("0123456789"), chunkSize/5)
+	data := writeArchive(t, "correct horse", manifest, map[uuid.UUID][]byte{fileData.ID: content})
+
+	t.Run("Success", func(t *testing.T) {
+		files := map[uuid.UUID][]byte{}
+		got, err := Read(bytes.NewReader(data), "correct horse", func(id uuid.UUID, r io.Reader) error {
+			content, err := io.ReadAll(r)
+			files[id] = content
+			return err
+		})
+		require.NoError(t, err)
+		require.Len(t, got.TextData, 1)
+		assert.Equal(t, textData.ID, got.TextData[0].ID)
+		assert.Equal(t, "secret text", got.TextData[0].Data)
+		assert.True(t, textData.CreatedAt.Equal(got.TextData[0].CreatedAt))
+		assert.Equal(t, content, files[fileData.ID])
+	})
+
+	t.Run("WrongPassphrase", func(t *testing.T) {
+		_, err := Read(bytes.NewReader(data), "wrong horse", func(uuid.UUID, io.Reader) error { return nil })
+		assert.ErrorIs(t, err, ErrDecryption)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		_, err := Read(bytes.NewReader(data[:len(data)-10]), "correct horse", func(id uuid.UUID, r io.Reader) error {
+			_, err := io.Copy(io.Discard, r)
+			return err
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("NotAnArchive", func(t *testing.T) {
+		_, err := Read(strings.NewReader("plain text"), "correct horse", func(uuid.UUID, io.Reader) error { return nil })
+		assert.ErrorIs(t, err, ErrInvalidArchive)
+	})
+
+	t.Run("ExcessiveKDFParams", func(t *testing.T) {
+		tampered := bytes.Clone(data)
+		binary.BigEndian.PutUint32(tampered[12:], 1024*1024)
+		_, err := Read(bytes.NewReader(tampered), "correct horse", func(uuid.UUID, io.Reader) error { return nil })
+		assert.ErrorIs(t, err, ErrInvalidArchive)
+	})
+}
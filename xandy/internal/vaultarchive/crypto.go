@@ -0,0 +1,225 @@
+package vaultarchive
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Формат зашифрованного архива:
+//
+//	magic(8) | argon2 time(4) | argon2 memory KiB(4) | argon2 threads(1) | salt(16) | nonce prefix(7)
+//	затем блоки: length(4) | AES-256-GCM ciphertext
+//
+// Nonce блока - prefix(7) | номер блока(4) | признак последнего блока(1), заголовок передаётся как AAD.
+// Признак последнего блока защищает от обрезки архива.
+const (
+	chunkSize       = 64 * 1024
+	saltSize        = 16
+	noncePrefixSize = 7
+	headerSize      = 8 + 4 + 4 + 1 + saltSize + noncePrefixSize
+
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	keySize       = 32
+
+	// При чтении допускаем не больше двойных параметров экспорта
+	maxArgon2Time    = 2 * argon2Time
+	maxArgon2Memory  = 2 * argon2Memory
+	maxArgon2Threads = 2 * argon2Threads
+)
+
+var magic = []byte("XNDYVLT1")
+
+var (
+	ErrInvalidArchive = errors.New("invalid vault archive")
+	ErrDecryption     = errors.New("wrong passphrase or corrupted vault archive")
+)
+
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	closed  bool
+}
+
+// newEncryptWriter записывает заголовок и возвращает writer, шифрующий данные блоками
+func newEncryptWriter(w io.Writer, passphrase string) (*encryptWriter, error) {
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[8:], argon2Time)
+	binary.BigEndian.PutUint32(header[12:], argon2Memory)
+	header[16] = argon2Threads
+	if _, err := rand.Read(header[17:]); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(passphrase, header[17:17+saltSize], argon2Time, argon2Memory, argon2Threads)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		prefix: header[17+saltSize:],
+		buf:    make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (ew *encryptWriter) Write(p []byte) (int, error) {
+	if ew.closed {
+		return 0, errors.New("write to closed vault archive")
+	}
+	written := 0
+	for len(p) > 0 {
+		n := copy(ew.buf[len(ew.buf):cap(ew.buf)], p)
+		ew.buf = ew.buf[:len(ew.buf)+n]
+		p = p[n:]
+		written += n
+		// Полный блок отправляем только когда точно известно, что он не последний
+		if len(ew.buf) == cap(ew.buf) && len(p) > 0 {
+			if err := ew.flush(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (ew *encryptWriter) Close() error {
+	if ew.closed {
+		return nil
+	}
+	ew.closed = true
+	return ew.flush(true)
+}
+
+func (ew *encryptWriter) flush(final bool) error {
+	sealed := ew.aead.Seal(nil, chunkNonce(ew.prefix, ew.counter, final), ew.buf, ew.header)
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(sealed)))
+	if _, err := ew.w.Write(length); err != nil {
+		return err
+	}
+	if _, err := ew.w.Write(sealed); err != nil {
+		return err
+	}
+	ew.counter++
+	ew.buf = ew.buf[:0]
+	return nil
+}
+
+type decryptReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	counter uint32
+	plain   []byte
+	done    bool
+}
+
+// newDecryptReader читает заголовок и возвращает reader с расшифрованным содержимым
+func newDecryptReader(r io.Reader, passphrase string) (*decryptReader, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrInvalidArchive
+	}
+	if !bytes.Equal(header[:8], magic) {
+		return nil, ErrInvalidArchive
+	}
+	time := binary.BigEndian.Uint32(header[8:])
+	memory := binary.BigEndian.Uint32(header[12:])
+	threads := header[16]
+	// Ограничиваем параметры, чтобы подложенный архив не исчерпал память сервера
+	if time == 0 || time > maxArgon2Time || memory == 0 || memory > maxArgon2Memory || threads == 0 || threads > maxArgon2Threads {
+		return nil, ErrInvalidArchive
+	}
+	aead, err := newAEAD(passphrase, header[17:17+saltSize], time, memory, threads)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		r:      r,
+		aead:   aead,
+		header: header,
+		prefix: header[17+saltSize:],
+	}, nil
+}
+
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	for len(dr.plain) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.plain)
+	dr.plain = dr.plain[n:]
+	return n, nil
+}
+
+func (dr *decryptReader) next() error {
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(dr.r, length); err != nil {
+		// Архив закончился до последнего блока
+		return ErrDecryption
+	}
+	size := binary.BigEndian.Uint32(length)
+	if size > chunkSize+uint32(dr.aead.Overhead()) {
+		return ErrInvalidArchive
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(dr.r, sealed); err != nil {
+		return ErrDecryption
+	}
+	plain, err := dr.aead.Open(nil, chunkNonce(dr.prefix, dr.counter, false), sealed, dr.header)
+	if err != nil {
+		plain, err = dr.aead.Open(nil, chunkNonce(dr.prefix, dr.counter, true), sealed, dr.header)
+		if err != nil {
+			return ErrDecryption
+		}
+		dr.done = true
+	}
+	dr.counter++
+	dr.plain = plain
+	return nil
+}
+
+func newAEAD(passphrase string, salt []byte, time, memory uint32, threads uint8) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase is empty")
+	}
+	key := argon2.IDKey([]byte(passphrase), salt, time, memory, threads, keySize)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, counter uint32, final bool) []byte {
+	nonce := make([]byte, 0, noncePrefixSize+5)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, counter)
+	if final {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE
+    file_uploads (
+        id UUID PRIMARY KEY,
+        user_id UUID NOT NULL,
+        file_name VARCHAR(255) NOT NULL,
+        size BIGINT NOT NULL,
+        upload_offset BIGINT NOT NULL DEFAULT 0,
+        checksum VARCHAR(64) NOT NULL,
+        staging_path VARCHAR(255) NOT NULL,
+        created_at TIMESTAMP NOT NULL,
+        updated_at TIMESTAMP NOT NULL,
+        expires_at TIMESTAMP NOT NULL
+    );
+
+CREATE INDEX file_uploads_expires_at_idx ON file_uploads (expires_at);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE file_uploads;
+
+-- +goose StatementEnd
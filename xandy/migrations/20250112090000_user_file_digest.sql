@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE user_file_data
+    ADD COLUMN sha256 VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN mime_type VARCHAR(255) NOT NULL DEFAULT '';
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE user_file_data
+    DROP COLUMN sha256,
+    DROP COLUMN mime_type;
+
+-- +goose StatementEnd
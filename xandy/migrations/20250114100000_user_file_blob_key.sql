@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE user_file_data RENAME COLUMN path_to_file TO blob_key;
+
+-- Раньше хранился путь на диске, теперь ключ относительно корня BlobStore
+UPDATE user_file_data SET blob_key = regexp_replace(blob_key, '^\.\./user_files/', '');
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+UPDATE user_file_data SET blob_key = '../user_files/' || blob_key;
+
+ALTER TABLE user_file_data RENAME COLUMN blob_key TO path_to_file;
+
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS file_blobs (
+    key TEXT PRIMARY KEY,
+    ref_count INTEGER NOT NULL CHECK (ref_count > 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Уже загруженные файлы остаются под старыми ключами, у каждого одна ссылка
+INSERT INTO file_blobs (key, ref_count)
+SELECT blob_key, COUNT(*) FROM user_file_data GROUP BY blob_key;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS file_blobs;
+
+-- +goose StatementEnd
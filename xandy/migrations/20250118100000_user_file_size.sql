@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE user_file_data ADD COLUMN size BIGINT NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE user_file_data DROP COLUMN size;
+
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE user_file_data ADD COLUMN original_file_name VARCHAR(255) NOT NULL DEFAULT '';
+
+UPDATE user_file_data SET original_file_name = name || ext;
+
+CREATE INDEX IF NOT EXISTS user_file_data_user_id_mime_type_idx ON user_file_data (user_id, mime_type);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS user_file_data_user_id_mime_type_idx;
+
+ALTER TABLE user_file_data DROP COLUMN original_file_name;
+
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE user_file_data
+    ADD COLUMN parent_kind VARCHAR(32) NOT NULL DEFAULT '',
+    ADD COLUMN parent_id UUID;
+
+CREATE INDEX IF NOT EXISTS user_file_data_parent_id_idx ON user_file_data (parent_id) WHERE parent_id IS NOT NULL;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS user_file_data_parent_id_idx;
+
+ALTER TABLE user_file_data
+    DROP COLUMN parent_kind,
+    DROP COLUMN parent_id;
+
+-- +goose StatementEnd
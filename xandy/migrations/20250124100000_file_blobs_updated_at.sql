@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE file_blobs ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+UPDATE file_blobs SET updated_at = created_at;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE file_blobs DROP COLUMN updated_at;
+
+-- +goose StatementEnd
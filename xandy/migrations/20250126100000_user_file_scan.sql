@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE user_file_data ADD COLUMN scan_status VARCHAR(16) NOT NULL DEFAULT 'pending';
+ALTER TABLE user_file_data ADD COLUMN scan_result TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_file_data ADD COLUMN scanned_at TIMESTAMP;
+
+CREATE INDEX user_file_data_scan_pending_idx ON user_file_data (updated_at) WHERE scan_status = 'pending';
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX user_file_data_scan_pending_idx;
+
+ALTER TABLE user_file_data DROP COLUMN scanned_at;
+ALTER TABLE user_file_data DROP COLUMN scan_result;
+ALTER TABLE user_file_data DROP COLUMN scan_status;
+
+-- +goose StatementEnd
@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE
+    shares (
+        id UUID PRIMARY KEY,
+        owner_id UUID NOT NULL,
+        owner_email VARCHAR(255) NOT NULL,
+        grantee_id UUID NOT NULL,
+        grantee_email VARCHAR(255) NOT NULL,
+        data_kind VARCHAR(16) NOT NULL,
+        data_id UUID NOT NULL,
+        permission VARCHAR(16) NOT NULL,
+        encrypted_key TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMP NOT NULL,
+        updated_at TIMESTAMP NOT NULL,
+        UNIQUE (data_id, grantee_id)
+    );
+
+CREATE INDEX shares_grantee_id_idx ON shares (grantee_id, created_at);
+
+-- Записи четырёх видов лежат в разных таблицах, поэтому вместо внешнего ключа
+-- доступ удаляется триггером вместе с записью
+CREATE FUNCTION delete_record_shares() RETURNS TRIGGER AS $$
+BEGIN
+    DELETE FROM shares WHERE data_id = OLD.id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER user_text_data_delete_shares AFTER DELETE ON user_text_data FOR EACH ROW EXECUTE FUNCTION delete_record_shares();
+CREATE TRIGGER user_auth_info_delete_shares AFTER DELETE ON user_auth_info FOR EACH ROW EXECUTE FUNCTION delete_record_shares();
+CREATE TRIGGER user_file_data_delete_shares AFTER DELETE ON user_file_data FOR EACH ROW EXECUTE FUNCTION delete_record_shares();
+CREATE TRIGGER user_bank_card_delete_shares AFTER DELETE ON user_bank_card FOR EACH ROW EXECUTE FUNCTION delete_record_shares();
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER user_bank_card_delete_shares ON user_bank_card;
+DROP TRIGGER user_file_data_delete_shares ON user_file_data;
+DROP TRIGGER user_auth_info_delete_shares ON user_auth_info;
+DROP TRIGGER user_text_data_delete_shares ON user_text_data;
+DROP FUNCTION delete_record_shares();
+
+DROP TABLE shares;
+
+-- +goose StatementEnd
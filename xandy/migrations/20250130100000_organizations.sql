@@ -0,0 +1,102 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE
+    organizations (
+        id UUID PRIMARY KEY,
+        name VARCHAR(255) NOT NULL,
+        created_at TIMESTAMP NOT NULL,
+        updated_at TIMESTAMP NOT NULL
+    );
+
+CREATE TABLE
+    organization_members (
+        organization_id UUID NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+        user_id UUID NOT NULL,
+        email VARCHAR(255) NOT NULL,
+        role VARCHAR(16) NOT NULL,
+        created_at TIMESTAMP NOT NULL,
+        updated_at TIMESTAMP NOT NULL,
+        PRIMARY KEY (organization_id, user_id)
+    );
+
+CREATE INDEX organization_members_user_id_idx ON organization_members (user_id);
+
+CREATE TABLE
+    collections (
+        id UUID PRIMARY KEY,
+        organization_id UUID NOT NULL REFERENCES organizations (id),
+        name VARCHAR(255) NOT NULL,
+        created_at TIMESTAMP NOT NULL,
+        updated_at TIMESTAMP NOT NULL
+    );
+
+CREATE INDEX collections_organization_id_idx ON collections (organization_id);
+
+-- Доступы удаляются вместе с участником, поэтому исключённый участник сразу теряет доступ к коллекциям
+CREATE TABLE
+    collection_grants (
+        collection_id UUID NOT NULL REFERENCES collections (id) ON DELETE CASCADE,
+        organization_id UUID NOT NULL,
+        user_id UUID NOT NULL,
+        permission VARCHAR(16) NOT NULL,
+        created_at TIMESTAMP NOT NULL,
+        updated_at TIMESTAMP NOT NULL,
+        PRIMARY KEY (collection_id, user_id),
+        FOREIGN KEY (organization_id, user_id) REFERENCES organization_members (organization_id, user_id) ON DELETE CASCADE
+    );
+
+-- Запись без коллекции принадлежит пользователю user_id, запись коллекции - организации,
+-- а user_id остаётся автором записи
+ALTER TABLE user_text_data ADD COLUMN collection_id UUID REFERENCES collections (id);
+ALTER TABLE user_auth_info ADD COLUMN collection_id UUID REFERENCES collections (id);
+ALTER TABLE user_file_data ADD COLUMN collection_id UUID REFERENCES collections (id);
+ALTER TABLE user_bank_card ADD COLUMN collection_id UUID REFERENCES collections (id);
+
+CREATE INDEX user_text_data_collection_id_idx ON user_text_data (collection_id) WHERE collection_id IS NOT NULL;
+CREATE INDEX user_auth_info_collection_id_idx ON user_auth_info (collection_id) WHERE collection_id IS NOT NULL;
+CREATE INDEX user_file_data_collection_id_idx ON user_file_data (collection_id) WHERE collection_id IS NOT NULL;
+CREATE INDEX user_bank_card_collection_id_idx ON user_bank_card (collection_id) WHERE collection_id IS NOT NULL;
+
+-- Коллекции, доступные участникам организаций. Владельцы и администраторы работают со всеми
+-- коллекциями организации, остальные участники - только с коллекциями из collection_grants.
+-- Участник только для чтения не может менять записи, даже если ему выдан доступ на запись
+CREATE VIEW
+    collection_access AS
+SELECT
+    c.id AS collection_id,
+    m.user_id,
+    TRUE AS can_write
+FROM
+    collections c
+    JOIN organization_members m ON m.organization_id = c.organization_id
+WHERE
+    m.role IN ('owner', 'admin')
+UNION ALL
+SELECT
+    g.collection_id,
+    g.user_id,
+    g.permission = 'write'
+    AND m.role = 'member' AS can_write
+FROM
+    collection_grants g
+    JOIN organization_members m ON m.organization_id = g.organization_id
+    AND m.user_id = g.user_id
+WHERE
+    m.role IN ('member', 'read_only');
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP VIEW collection_access;
+
+ALTER TABLE user_bank_card DROP COLUMN collection_id;
+ALTER TABLE user_file_data DROP COLUMN collection_id;
+ALTER TABLE user_auth_info DROP COLUMN collection_id;
+ALTER TABLE user_text_data DROP COLUMN collection_id;
+
+DROP TABLE collection_grants;
+DROP TABLE collections;
+DROP TABLE organization_members;
+DROP TABLE organizations;
+
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE
+    share_links (
+        id UUID PRIMARY KEY,
+        owner_id UUID NOT NULL,
+        data_kind VARCHAR(16) NOT NULL,
+        data_id UUID NOT NULL,
+        content BYTEA NOT NULL,
+        passphrase_hash BYTEA NOT NULL DEFAULT '',
+        max_views INTEGER NOT NULL,
+        views INTEGER NOT NULL DEFAULT 0,
+        expires_at TIMESTAMP NOT NULL,
+        created_at TIMESTAMP NOT NULL
+    );
+
+CREATE INDEX share_links_data_id_idx ON share_links (data_id);
+
+CREATE INDEX share_links_expires_at_idx ON share_links (expires_at);
+
+CREATE FUNCTION delete_record_share_links() RETURNS TRIGGER AS $$
+BEGIN
+    DELETE FROM share_links WHERE data_id = OLD.id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER user_text_data_delete_share_links AFTER DELETE ON user_text_data FOR EACH ROW EXECUTE FUNCTION delete_record_share_links();
+CREATE TRIGGER user_auth_info_delete_share_links AFTER DELETE ON user_auth_info FOR EACH ROW EXECUTE FUNCTION delete_record_share_links();
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER user_auth_info_delete_share_links ON user_auth_info;
+DROP TRIGGER user_text_data_delete_share_links ON user_text_data;
+DROP FUNCTION delete_record_share_links();
+
+DROP TABLE share_links;
+
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE
+    emergency_access (
+        id UUID PRIMARY KEY,
+        grantor_id UUID NOT NULL,
+        grantor_email VARCHAR(255) NOT NULL,
+        grantee_id UUID NOT NULL,
+        grantee_email VARCHAR(255) NOT NULL,
+        access_type VARCHAR(16) NOT NULL,
+        wait_days INTEGER NOT NULL,
+        status VARCHAR(16) NOT NULL,
+        requested_at TIMESTAMP,
+        created_at TIMESTAMP NOT NULL,
+        updated_at TIMESTAMP NOT NULL,
+        UNIQUE (grantor_id, grantee_id)
+    );
+
+CREATE INDEX emergency_access_grantee_id_idx ON emergency_access (grantee_id);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE emergency_access;
+
+-- +goose StatementEnd
@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE
+    audit_log (
+        id UUID PRIMARY KEY,
+        occurred_at TIMESTAMP NOT NULL,
+        actor_id UUID,
+        session_id UUID,
+        ip VARCHAR(64) NOT NULL DEFAULT '',
+        user_agent TEXT NOT NULL DEFAULT '',
+        action VARCHAR(32) NOT NULL,
+        owner_id UUID,
+        data_kind VARCHAR(16) NOT NULL DEFAULT '',
+        data_id UUID,
+        collection_id UUID,
+        organization_id UUID,
+        details JSONB NOT NULL DEFAULT '{}'
+    );
+
+CREATE INDEX audit_log_actor_id_idx ON audit_log (actor_id, occurred_at);
+
+CREATE INDEX audit_log_owner_id_idx ON audit_log (owner_id, occurred_at);
+
+CREATE INDEX audit_log_organization_id_idx ON audit_log (organization_id, occurred_at) WHERE organization_id IS NOT NULL;
+
+-- Журнал только пополняется: изменение, удаление и очистка таблицы запрещены
+CREATE FUNCTION audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON audit_log FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER audit_log_no_truncate ON audit_log;
+DROP TRIGGER audit_log_no_update ON audit_log;
+DROP FUNCTION audit_log_append_only();
+
+DROP TABLE audit_log;
+
+-- +goose StatementEnd
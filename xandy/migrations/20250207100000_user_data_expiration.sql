@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE user_auth_info ADD COLUMN expires_at TIMESTAMP;
+ALTER TABLE user_text_data ADD COLUMN expires_at TIMESTAMP;
+ALTER TABLE user_file_data ADD COLUMN expires_at TIMESTAMP;
+ALTER TABLE user_bank_card ADD COLUMN expires_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS user_auth_info_expires_at_idx ON user_auth_info (expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS user_text_data_expires_at_idx ON user_text_data (expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS user_file_data_expires_at_idx ON user_file_data (expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS user_bank_card_expires_at_idx ON user_bank_card (expires_at) WHERE expires_at IS NOT NULL;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS user_bank_card_expires_at_idx;
+DROP INDEX IF EXISTS user_file_data_expires_at_idx;
+DROP INDEX IF EXISTS user_text_data_expires_at_idx;
+DROP INDEX IF EXISTS user_auth_info_expires_at_idx;
+
+ALTER TABLE user_bank_card DROP COLUMN expires_at;
+ALTER TABLE user_file_data DROP COLUMN expires_at;
+ALTER TABLE user_text_data DROP COLUMN expires_at;
+ALTER TABLE user_auth_info DROP COLUMN expires_at;
+
+-- +goose StatementEnd
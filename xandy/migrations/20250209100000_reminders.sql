@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE user_auth_info ADD COLUMN password_changed_at TIMESTAMP;
+UPDATE user_auth_info SET password_changed_at = updated_at;
+ALTER TABLE user_auth_info ALTER COLUMN password_changed_at SET NOT NULL;
+
+CREATE TABLE
+    reminder_preferences (
+        user_id UUID PRIMARY KEY,
+        card_expiry BOOLEAN NOT NULL,
+        credential_rotation BOOLEAN NOT NULL,
+        updated_at TIMESTAMP NOT NULL
+    );
+
+CREATE TABLE
+    reminders_sent (
+        kind VARCHAR(32) NOT NULL,
+        data_id UUID NOT NULL,
+        due_at TIMESTAMP NOT NULL,
+        user_id UUID NOT NULL,
+        sent_at TIMESTAMP NOT NULL,
+        PRIMARY KEY (kind, data_id, due_at)
+    );
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE reminders_sent;
+DROP TABLE reminder_preferences;
+
+ALTER TABLE user_auth_info DROP COLUMN password_changed_at;
+
+-- +goose StatementEnd
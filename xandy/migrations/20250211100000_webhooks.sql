@@ -0,0 +1,110 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE
+    webhooks (
+        id UUID PRIMARY KEY,
+        user_id UUID NOT NULL,
+        url TEXT NOT NULL,
+        events VARCHAR(16)[] NOT NULL,
+        secret VARCHAR(64) NOT NULL,
+        active BOOLEAN NOT NULL,
+        created_at TIMESTAMP NOT NULL,
+        updated_at TIMESTAMP NOT NULL
+    );
+
+CREATE INDEX webhooks_user_id_idx ON webhooks (user_id, created_at);
+
+-- События изменения записей. Пишутся триггерами, поэтому попадают в таблицу
+-- в той же транзакции, что и само изменение, и не теряются при сбое сервиса
+CREATE TABLE
+    webhook_outbox (
+        id BIGSERIAL PRIMARY KEY,
+        event_id UUID NOT NULL,
+        event VARCHAR(16) NOT NULL,
+        data_kind VARCHAR(16) NOT NULL,
+        data_id UUID NOT NULL,
+        name VARCHAR(255) NOT NULL,
+        owner_id UUID NOT NULL,
+        collection_id UUID,
+        occurred_at TIMESTAMP NOT NULL,
+        dispatched_at TIMESTAMP
+    );
+
+CREATE INDEX webhook_outbox_pending_idx ON webhook_outbox (id) WHERE dispatched_at IS NULL;
+
+CREATE TABLE
+    webhook_deliveries (
+        id UUID PRIMARY KEY,
+        webhook_id UUID NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+        event_id UUID NOT NULL,
+        event VARCHAR(16) NOT NULL,
+        payload JSONB NOT NULL,
+        status VARCHAR(16) NOT NULL,
+        attempts INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at TIMESTAMP NOT NULL,
+        last_status_code INTEGER NOT NULL DEFAULT 0,
+        last_error TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMP NOT NULL,
+        updated_at TIMESTAMP NOT NULL
+    );
+
+CREATE INDEX webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, created_at);
+
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+-- В событие попадают только идентификаторы и название записи, секретные поля не копируются
+CREATE FUNCTION webhook_outbox_record() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO webhook_outbox (event_id, event, data_kind, data_id, name, owner_id, collection_id, occurred_at)
+        VALUES (gen_random_uuid(), 'deleted', TG_ARGV[0], OLD.id, OLD.name, OLD.user_id, OLD.collection_id, LOCALTIMESTAMP);
+        RETURN OLD;
+    END IF;
+    INSERT INTO webhook_outbox (event_id, event, data_kind, data_id, name, owner_id, collection_id, occurred_at)
+    VALUES (gen_random_uuid(), CASE TG_OP WHEN 'INSERT' THEN 'created' ELSE 'updated' END, TG_ARGV[0], NEW.id, NEW.name, NEW.user_id, NEW.collection_id, LOCALTIMESTAMP);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION webhook_outbox_share() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO webhook_outbox (event_id, event, data_kind, data_id, name, owner_id, collection_id, occurred_at)
+    SELECT gen_random_uuid(), 'shared', NEW.data_kind, NEW.data_id, record.name, NEW.owner_id, record.collection_id, LOCALTIMESTAMP
+    FROM (
+        SELECT name, collection_id FROM user_auth_info WHERE id = NEW.data_id
+        UNION ALL SELECT name, collection_id FROM user_text_data WHERE id = NEW.data_id
+        UNION ALL SELECT name, collection_id FROM user_file_data WHERE id = NEW.data_id
+        UNION ALL SELECT name, collection_id FROM user_bank_card WHERE id = NEW.data_id
+    ) record;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Служебные изменения (проверка антивирусом, срок жизни, перенос владельца) событий не создают
+CREATE TRIGGER user_auth_info_webhook_outbox AFTER INSERT OR DELETE OR UPDATE OF name, login, password, metadata, collection_id
+    ON user_auth_info FOR EACH ROW EXECUTE FUNCTION webhook_outbox_record('auth_info');
+CREATE TRIGGER user_text_data_webhook_outbox AFTER INSERT OR DELETE OR UPDATE OF name, data, metadata, collection_id
+    ON user_text_data FOR EACH ROW EXECUTE FUNCTION webhook_outbox_record('text_data');
+CREATE TRIGGER user_file_data_webhook_outbox AFTER INSERT OR DELETE OR UPDATE OF name, ext, metadata, blob_key, collection_id
+    ON user_file_data FOR EACH ROW EXECUTE FUNCTION webhook_outbox_record('file_data');
+CREATE TRIGGER user_bank_card_webhook_outbox AFTER INSERT OR DELETE OR UPDATE OF name, number, card_holder, expire_date, csc, metadata, collection_id
+    ON user_bank_card FOR EACH ROW EXECUTE FUNCTION webhook_outbox_record('bank_card');
+CREATE TRIGGER shares_webhook_outbox AFTER INSERT OR UPDATE OF permission
+    ON shares FOR EACH ROW EXECUTE FUNCTION webhook_outbox_share();
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER shares_webhook_outbox ON shares;
+DROP TRIGGER user_bank_card_webhook_outbox ON user_bank_card;
+DROP TRIGGER user_file_data_webhook_outbox ON user_file_data;
+DROP TRIGGER user_text_data_webhook_outbox ON user_text_data;
+DROP TRIGGER user_auth_info_webhook_outbox ON user_auth_info;
+DROP FUNCTION webhook_outbox_share();
+DROP FUNCTION webhook_outbox_record();
+
+DROP TABLE webhook_deliveries;
+DROP TABLE webhook_outbox;
+DROP TABLE webhooks;
+
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE
+    idempotency_keys (
+        user_id UUID NOT NULL,
+        idempotency_key VARCHAR(255) NOT NULL,
+        request_hash VARCHAR(64) NOT NULL,
+        -- 0, пока первый запрос с ключом выполняется
+        status_code INTEGER NOT NULL,
+        content_type VARCHAR(255) NOT NULL,
+        body BYTEA,
+        created_at TIMESTAMP NOT NULL,
+        expires_at TIMESTAMP NOT NULL,
+        PRIMARY KEY (user_id, idempotency_key)
+    );
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE idempotency_keys;
+
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Попытки ввода фразы-пароля с последнего успешного открытия
+ALTER TABLE share_links ADD COLUMN passphrase_attempts INTEGER NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE share_links DROP COLUMN passphrase_attempts;
+
+-- +goose StatementEnd